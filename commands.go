@@ -0,0 +1,237 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/Cealgull/Verify/internal/cert"
+	"github.com/Cealgull/Verify/internal/config"
+	"github.com/Cealgull/Verify/internal/credential"
+	"github.com/Cealgull/Verify/internal/federation"
+	"github.com/Cealgull/Verify/internal/msp"
+	"github.com/Cealgull/Verify/internal/threshold"
+	"github.com/Cealgull/Verify/pkg/frost"
+	"go.uber.org/zap"
+)
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "Usage: %s [command] [flags]\n\n", os.Args[0])
+	fmt.Fprintf(os.Stderr, "Without a command the verification server is started.\n\n")
+	fmt.Fprintf(os.Stderr, "Commands:\n")
+	fmt.Fprintf(os.Stderr, "  ca init            Generate the CA key and self signed certificate.\n")
+	fmt.Fprintf(os.Stderr, "  msp                Export a Hyperledger Fabric MSP directory tree.\n")
+	fmt.Fprintf(os.Stderr, "  threshold split    Split the CA key into threshold signing shares.\n")
+	fmt.Fprintf(os.Stderr, "  federation sign    Sign a trust bundle describing this deployment.\n")
+	fmt.Fprintf(os.Stderr, "  credential keygen  Generate the BBS credential issuer key.\n")
+}
+
+func runCommand(logger *zap.SugaredLogger, vericonf *config.VerifyConfig, cmd string, args []string) {
+
+	switch cmd {
+	case "ca":
+		if len(args) == 0 || args[0] != "init" {
+			usage()
+			os.Exit(2)
+		}
+		runCAInit(logger, vericonf, args[1:])
+	case "msp":
+		runMSP(logger, vericonf, args)
+	case "threshold":
+		if len(args) == 0 || args[0] != "split" {
+			usage()
+			os.Exit(2)
+		}
+		runThresholdSplit(logger, vericonf, args[1:])
+	case "federation":
+		if len(args) == 0 || args[0] != "sign" {
+			usage()
+			os.Exit(2)
+		}
+		runFederationSign(logger, vericonf, args[1:])
+	case "credential":
+		if len(args) == 0 || args[0] != "keygen" {
+			usage()
+			os.Exit(2)
+		}
+		runCredentialKeygen(logger, vericonf, args[1:])
+	default:
+		usage()
+		os.Exit(2)
+	}
+}
+
+func runCAInit(logger *zap.SugaredLogger, vericonf *config.VerifyConfig, args []string) {
+
+	fs := flag.NewFlagSet("ca init", flag.ExitOnError)
+	algorithm := fs.String("algorithm", cert.Ed25519, "key algorithm of the CA, ed25519 or sm2")
+	cn := fs.String("cn", "Cealgull Verify CA", "common name of the CA")
+	org := fs.String("org", "Cealgull", "organization of the CA")
+	days := fs.Int("days", 3650, "validity of the CA certificate in days")
+	keyfile := fs.String("key", vericonf.Cert.Priv, "output file of the CA key")
+	certfile := fs.String("cert", vericonf.Cert.Cert, "output file of the CA certificate")
+	_ = fs.Parse(args)
+
+	for _, file := range []string{*keyfile, *certfile} {
+		if _, err := os.Stat(file); err == nil {
+			logger.Fatalf("Refusing to overwrite %s.", file)
+		}
+	}
+
+	subject := pkix.Name{CommonName: *cn, Organization: []string{*org}}
+
+	ca, err := cert.GenerateAuthority(*keyfile, *certfile, *algorithm, subject, time.Duration(*days)*24*time.Hour)
+
+	if err != nil {
+		logger.Fatal(err.Error())
+	}
+
+	logger.Infof("%s CA %s written to %s and %s.", *algorithm, ca.Subject.String(), *keyfile, *certfile)
+}
+
+func runMSP(logger *zap.SugaredLogger, vericonf *config.VerifyConfig, args []string) {
+
+	fs := flag.NewFlagSet("msp", flag.ExitOnError)
+	out := fs.String("out", "./msp", "output directory of the MSP tree")
+	certfile := fs.String("cert", "", "issued certificate used as signcert, defaults to the CA certificate")
+	admincerts := fs.String("admincerts", "", "PEM bundle of admin certificates, added to those configured")
+	_ = fs.Parse(args)
+
+	cm := newCertManager(logger, vericonf)
+	me := newMSPExporter(logger, vericonf)
+
+	id := msp.NewIdentity(cm.Chain(), cm.Certificate())
+
+	if *certfile != "" {
+
+		b, err := os.ReadFile(*certfile)
+
+		if err != nil {
+			logger.Fatal(err.Error())
+		}
+
+		cert, verr := cm.VerifiedCert(b)
+
+		if verr != nil {
+			logger.Fatal(verr.Error())
+		}
+
+		id.Sign = cert
+	}
+
+	if *admincerts != "" {
+
+		admins, err := msp.LoadCertificates(*admincerts)
+
+		if err != nil {
+			logger.Fatal(err.Error())
+		}
+
+		id.Admins = admins
+	}
+
+	if err := me.WriteDir(*out, id); err != nil {
+		logger.Fatal(err.Error())
+	}
+
+	logger.Infof("MSP directory tree written to %s.", *out)
+}
+
+func runThresholdSplit(logger *zap.SugaredLogger, vericonf *config.VerifyConfig, args []string) {
+
+	fs := flag.NewFlagSet("threshold split", flag.ExitOnError)
+	t := fs.Int("t", 2, "number of shares required to sign")
+	n := fs.Int("n", 3, "number of shares to deal")
+	out := fs.String("out", "./shares", "output directory of the group and share files")
+	_ = fs.Parse(args)
+
+	priv, err := cert.LoadPrivateKey(vericonf.Cert.Priv)
+
+	if _, ok := err.(*cert.AlgorithmError); ok {
+		logger.Fatalf("Threshold shares can only be dealt from an ed25519 CA key. err: %s", err.Error())
+	}
+
+	if err != nil {
+		logger.Fatal(err.Error())
+	}
+
+	group, shares, err := frost.Split(priv, *t, *n, rand.Reader)
+
+	if err != nil {
+		logger.Fatal(err.Error())
+	}
+
+	if err := threshold.WriteShares(*out, group, shares); err != nil {
+		logger.Fatal(err.Error())
+	}
+
+	logger.Infof("Dealt %d-of-%d threshold shares to %s.", *t, *n, *out)
+}
+
+func runFederationSign(logger *zap.SugaredLogger, vericonf *config.VerifyConfig, args []string) {
+
+	fs := flag.NewFlagSet("federation sign", flag.ExitOnError)
+	seq := fs.Uint64("seq", uint64(time.Now().Unix()), "sequence number, must grow with every bundle")
+	ttl := fs.Duration("ttl", 30*24*time.Hour, "validity of the bundle")
+	out := fs.String("out", "./bundle.json", "output file of the signed bundle")
+	_ = fs.Parse(args)
+
+	priv, err := cert.LoadPrivateKey(vericonf.Cert.Priv)
+
+	if _, ok := err.(*cert.AlgorithmError); ok {
+		logger.Fatalf("Federation bundles can only be signed with an ed25519 CA key. err: %s", err.Error())
+	}
+
+	if err != nil {
+		logger.Fatal(err.Error())
+	}
+
+	cm := newCertManager(logger, vericonf)
+
+	org := vericonf.Federation.Organization
+
+	if org == "" {
+		org = cm.Organization()
+	}
+
+	b := federation.NewBundle(org, *seq, *ttl, federation.NewPartner(org, vericonf.Federation.Domain, cm.Chain()...))
+
+	signed, err := federation.Sign(b, priv, cm.Certificate())
+
+	if err != nil {
+		logger.Fatal(err.Error())
+	}
+
+	data, _ := json.MarshalIndent(signed, "", "  ")
+
+	if err := os.WriteFile(*out, data, 0644); err != nil {
+		logger.Fatal(err.Error())
+	}
+
+	logger.Infof("Trust bundle %d of %s written to %s, operator fingerprint %s.", *seq, org, *out, signed.Kid)
+}
+
+func runCredentialKeygen(logger *zap.SugaredLogger, vericonf *config.VerifyConfig, args []string) {
+
+	fs := flag.NewFlagSet("credential keygen", flag.ExitOnError)
+	out := fs.String("out", vericonf.Credential.Key, "output file of the issuer key")
+	_ = fs.Parse(args)
+
+	if *out == "" {
+		logger.Fatal("No output file for the issuer key.")
+	}
+
+	if _, err := os.Stat(*out); err == nil {
+		logger.Fatalf("Refusing to overwrite the issuer key %s.", *out)
+	}
+
+	if _, err := credential.GenerateKey(*out); err != nil {
+		logger.Fatal(err.Error())
+	}
+
+	logger.Infof("Credential issuer key written to %s.", *out)
+}
@@ -0,0 +1,755 @@
+// Package acme implements the subset of RFC 8555 that lets ACME clients
+// obtain Verify certificates. Identifiers are ed25519 public keys and are
+// authorized through a ring signature challenge instead of DNS or HTTP.
+package acme
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/Cealgull/Verify/internal/cache"
+	"github.com/Cealgull/Verify/internal/proto"
+	"go.uber.org/zap"
+)
+
+const (
+	StatusPending    = "pending"
+	StatusReady      = "ready"
+	StatusProcessing = "processing"
+	StatusValid      = "valid"
+	StatusInvalid    = "invalid"
+)
+
+const (
+	// IdentifierPubKey identifies a base64 encoded ed25519 public key.
+	IdentifierPubKey = "pubkey"
+	// ChallengeRingSignature is proven by a ring signature over the key
+	// authorization of the challenge.
+	ChallengeRingSignature = "ring-signature-01"
+)
+
+const (
+	MIMEApplicationJOSE      = "application/jose+json"
+	MIMEApplicationProblem   = "application/problem+json"
+	MIMEApplicationCertChain = "application/pem-certificate-chain"
+)
+
+type Problem struct {
+	Type   string `json:"type"`
+	Detail string `json:"detail"`
+	Status int    `json:"status"`
+}
+
+type Directory struct {
+	NewNonce   string `json:"newNonce"`
+	NewAccount string `json:"newAccount"`
+	NewOrder   string `json:"newOrder"`
+}
+
+type Identifier struct {
+	Type  string `json:"type"`
+	Value string `json:"value"`
+}
+
+type AccountRequest struct {
+	Contact              []string `json:"contact,omitempty"`
+	TermsOfServiceAgreed bool     `json:"termsOfServiceAgreed,omitempty"`
+	OnlyReturnExisting   bool     `json:"onlyReturnExisting,omitempty"`
+}
+
+type OrderRequest struct {
+	Identifiers []Identifier `json:"identifiers"`
+}
+
+type ChallengeRequest struct {
+	Signature string `json:"signature"`
+}
+
+type FinalizeRequest struct {
+	CSR string `json:"csr"`
+}
+
+type Account struct {
+	Status               string   `json:"status"`
+	Contact              []string `json:"contact,omitempty"`
+	TermsOfServiceAgreed bool     `json:"termsOfServiceAgreed,omitempty"`
+	Key                  *JWK     `json:"key"`
+}
+
+type Order struct {
+	ID          string     `json:"id"`
+	Account     string     `json:"account"`
+	Status      string     `json:"status"`
+	Expires     time.Time  `json:"expires"`
+	Identifier  Identifier `json:"identifier"`
+	Authz       string     `json:"authz"`
+	Certificate string     `json:"certificate,omitempty"`
+	Error       *Problem   `json:"error,omitempty"`
+}
+
+type Authorization struct {
+	ID         string     `json:"id"`
+	Account    string     `json:"account"`
+	Order      string     `json:"order"`
+	Status     string     `json:"status"`
+	Expires    time.Time  `json:"expires"`
+	Identifier Identifier `json:"identifier"`
+	Token      string     `json:"token"`
+	Validated  *time.Time `json:"validated,omitempty"`
+	Error      *Problem   `json:"error,omitempty"`
+}
+
+type OrderObject struct {
+	Status         string       `json:"status"`
+	Expires        string       `json:"expires"`
+	Identifiers    []Identifier `json:"identifiers"`
+	Authorizations []string     `json:"authorizations"`
+	Finalize       string       `json:"finalize"`
+	Certificate    string       `json:"certificate,omitempty"`
+	Error          *Problem     `json:"error,omitempty"`
+}
+
+type ChallengeObject struct {
+	Type      string   `json:"type"`
+	URL       string   `json:"url"`
+	Token     string   `json:"token"`
+	Status    string   `json:"status"`
+	Validated string   `json:"validated,omitempty"`
+	Error     *Problem `json:"error,omitempty"`
+}
+
+type AuthorizationObject struct {
+	Identifier Identifier        `json:"identifier"`
+	Status     string            `json:"status"`
+	Expires    string            `json:"expires"`
+	Challenges []ChallengeObject `json:"challenges"`
+}
+
+// issued is a stored certificate with the account that ordered it.
+type issued struct {
+	Account string `json:"account"`
+	Cert    []byte `json:"cert"`
+}
+
+// Request is an authenticated ACME request.
+type Request struct {
+	Header  *Header
+	Payload []byte
+	Account string
+}
+
+func NewProblem(err proto.VerifyError) *Problem {
+
+	p := &Problem{Detail: err.Error(), Status: err.Status()}
+
+	if typed, ok := err.(interface{ Type() string }); ok {
+		p.Type = typed.Type()
+	} else if err.Status() >= 500 {
+		p.Type = ErrorNS + "serverInternal"
+	} else if err.Status() == 401 || err.Status() == 403 {
+		p.Type = ErrorNS + "unauthorized"
+	} else {
+		p.Type = ErrorNS + "malformed"
+	}
+
+	return p
+}
+
+func Link(base string, kind string, id string) string {
+	return base + "/acme/" + kind + "/" + id
+}
+
+func NewDirectory(base string) *Directory {
+	return &Directory{
+		NewNonce:   base + "/acme/new-nonce",
+		NewAccount: base + "/acme/new-account",
+		NewOrder:   base + "/acme/new-order",
+	}
+}
+
+func (o *Order) Object(base string) *OrderObject {
+
+	obj := &OrderObject{
+		Status:         o.Status,
+		Expires:        o.Expires.Format(time.RFC3339),
+		Identifiers:    []Identifier{o.Identifier},
+		Authorizations: []string{Link(base, "authz", o.Authz)},
+		Finalize:       Link(base, "order", o.ID) + "/finalize",
+		Error:          o.Error,
+	}
+
+	if o.Certificate != "" {
+		obj.Certificate = Link(base, "cert", o.Certificate)
+	}
+
+	return obj
+}
+
+func (a *Authorization) Object(base string) *AuthorizationObject {
+
+	challenge := ChallengeObject{
+		Type:   ChallengeRingSignature,
+		URL:    Link(base, "chall", a.ID),
+		Token:  a.Token,
+		Status: a.Status,
+		Error:  a.Error,
+	}
+
+	if a.Validated != nil {
+		challenge.Validated = a.Validated.Format(time.RFC3339)
+	}
+
+	return &AuthorizationObject{
+		Identifier: a.Identifier,
+		Status:     a.Status,
+		Expires:    a.Expires.Format(time.RFC3339),
+		Challenges: []ChallengeObject{challenge},
+	}
+}
+
+func (a *Authorization) Challenge(base string) *ChallengeObject {
+	return &a.Object(base).Challenges[0]
+}
+
+type Manager struct {
+	logger *zap.SugaredLogger
+	cache  cache.Cache
+	ttl    time.Duration
+	nonce  time.Duration
+}
+
+type Option func(m *Manager) error
+
+func WithCache(c cache.Cache) Option {
+	return func(m *Manager) error {
+		m.cache = c
+		return nil
+	}
+}
+
+// WithTTL sets how long orders, authorizations and certificates are kept,
+// in seconds.
+func WithTTL(ttl int64) Option {
+	return func(m *Manager) error {
+		if ttl > 0 {
+			m.ttl = time.Duration(ttl) * time.Second
+		}
+		return nil
+	}
+}
+
+func NewManager(logger *zap.SugaredLogger, options ...Option) (*Manager, error) {
+
+	m := &Manager{
+		logger: logger,
+		ttl:    24 * time.Hour,
+		nonce:  time.Hour,
+	}
+
+	for _, option := range options {
+		if err := option(m); err != nil {
+			return nil, err
+		}
+	}
+
+	return m, nil
+}
+
+func randomID() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func (m *Manager) load(key string, v interface{}) proto.VerifyError {
+
+	data, err := m.cache.Get(key)
+
+	if _, ok := err.(*cache.KeyError); ok {
+		return &ResourceNotFoundError{}
+	}
+
+	if err != nil {
+		m.logger.Errorf("Redis failure happened when loading %s. err: %s.", key, err.Error())
+		return &ACMEInternalError{}
+	}
+
+	if json.Unmarshal([]byte(data), v) != nil {
+		m.logger.Errorf("Corrupted ACME resource stored at %s.", key)
+		return &ACMEInternalError{}
+	}
+
+	return nil
+}
+
+func (m *Manager) store(key string, v interface{}, expiration time.Duration) proto.VerifyError {
+
+	data, _ := json.Marshal(v)
+
+	if err := m.cache.Set(key, string(data), expiration); err != nil {
+		m.logger.Errorf("Redis failure happened when storing %s. err: %s.", key, err.Error())
+		return &ACMEInternalError{}
+	}
+
+	return nil
+}
+
+func (m *Manager) NewNonce() (string, proto.VerifyError) {
+
+	nonce := randomID()
+
+	if err := m.cache.Set("acme:nonce:"+nonce, StatusValid, m.nonce); err != nil {
+		m.logger.Errorf("Redis failure happened when creating nonce. err: %s.", err.Error())
+		return "", &ACMEInternalError{}
+	}
+
+	return nonce, nil
+}
+
+func (m *Manager) useNonce(nonce string) proto.VerifyError {
+
+	if nonce == "" {
+		return &BadNonceError{}
+	}
+
+	value, err := m.cache.GetDel("acme:nonce:" + nonce)
+
+	if _, ok := err.(*cache.KeyError); ok || err == nil && value != StatusValid {
+		return &BadNonceError{}
+	}
+
+	if err != nil {
+		m.logger.Errorf("Redis failure happened when consuming nonce. err: %s.", err.Error())
+		return &ACMEInternalError{}
+	}
+
+	return nil
+}
+
+func (m *Manager) accountKey(kid string) (*JWK, proto.VerifyError) {
+
+	i := strings.LastIndex(kid, "/acme/account/")
+
+	if i < 0 {
+		return nil, &AccountDoesNotExistError{}
+	}
+
+	var acct Account
+
+	if err := m.load("acme:account:"+kid[i+len("/acme/account/"):], &acct); err != nil {
+		if _, ok := err.(*ResourceNotFoundError); ok {
+			return nil, &AccountDoesNotExistError{}
+		}
+		return nil, err
+	}
+
+	return acct.Key, nil
+}
+
+// Verify authenticates an ACME request sent to url and consumes its nonce.
+func (m *Manager) Verify(body []byte, url string) (*Request, proto.VerifyError) {
+
+	header, payload, err := decodeJWS(body, m.accountKey)
+
+	if err != nil {
+		m.logger.Debugf("ACME request to %s rejected. err: %s", url, err.Error())
+		return nil, err
+	}
+
+	if header.URL != url {
+		m.logger.Debugf("ACME request for %s sent to %s.", header.URL, url)
+		return nil, &UnauthorizedError{"JWS URL Mismatch"}
+	}
+
+	if err := m.useNonce(header.Nonce); err != nil {
+		return nil, err
+	}
+
+	req := &Request{Header: header, Payload: payload}
+
+	if header.Kid != "" {
+		req.Account = header.JWK.Thumbprint()
+	}
+
+	return req, nil
+}
+
+func decodePayload(req *Request, v interface{}) proto.VerifyError {
+	if json.Unmarshal(req.Payload, v) != nil {
+		return &MalformedError{"Payload Is Not Valid JSON"}
+	}
+	return nil
+}
+
+// NewAccount registers the key of the request, returning the account id
+// and whether the account was created.
+func (m *Manager) NewAccount(req *Request) (*Account, string, bool, proto.VerifyError) {
+
+	if req.Account != "" {
+		return nil, "", false, &MalformedError{"New Accounts Must Be Signed With A jwk"}
+	}
+
+	var payload AccountRequest
+
+	if err := decodePayload(req, &payload); err != nil {
+		return nil, "", false, err
+	}
+
+	id := req.Header.JWK.Thumbprint()
+
+	var acct Account
+
+	err := m.load("acme:account:"+id, &acct)
+
+	if err == nil {
+		return &acct, id, false, nil
+	}
+
+	if _, ok := err.(*ResourceNotFoundError); !ok {
+		return nil, "", false, err
+	}
+
+	if payload.OnlyReturnExisting {
+		return nil, "", false, &AccountDoesNotExistError{}
+	}
+
+	acct = Account{
+		Status:               StatusValid,
+		Contact:              payload.Contact,
+		TermsOfServiceAgreed: payload.TermsOfServiceAgreed,
+		Key:                  req.Header.JWK,
+	}
+
+	if err := m.store("acme:account:"+id, &acct, 0); err != nil {
+		return nil, "", false, err
+	}
+
+	m.logger.Infof("ACME account %s registered.", id)
+
+	return &acct, id, true, nil
+}
+
+// Account returns the account of the request, updating its contacts when
+// the payload carries them.
+func (m *Manager) Account(req *Request, id string) (*Account, proto.VerifyError) {
+
+	if req.Account != id {
+		return nil, &UnauthorizedError{"Account Does Not Match The Request Key"}
+	}
+
+	var acct Account
+
+	if err := m.load("acme:account:"+id, &acct); err != nil {
+		return nil, err
+	}
+
+	if len(req.Payload) == 0 {
+		return &acct, nil
+	}
+
+	var payload AccountRequest
+
+	if err := decodePayload(req, &payload); err != nil {
+		return nil, err
+	}
+
+	if payload.Contact != nil {
+		acct.Contact = payload.Contact
+		if err := m.store("acme:account:"+id, &acct, 0); err != nil {
+			return nil, err
+		}
+	}
+
+	return &acct, nil
+}
+
+func (m *Manager) NewOrder(req *Request) (*Order, proto.VerifyError) {
+
+	if req.Account == "" {
+		return nil, &MalformedError{"Orders Must Be Signed With A kid"}
+	}
+
+	var payload OrderRequest
+
+	if err := decodePayload(req, &payload); err != nil {
+		return nil, err
+	}
+
+	if len(payload.Identifiers) != 1 || payload.Identifiers[0].Type != IdentifierPubKey {
+		return nil, &RejectedIdentifierError{}
+	}
+
+	ident := payload.Identifiers[0]
+
+	if pub, err := base64.StdEncoding.DecodeString(ident.Value); err != nil || len(pub) != ed25519.PublicKeySize {
+		return nil, &RejectedIdentifierError{}
+	}
+
+	expires := time.Now().Add(m.ttl).UTC().Truncate(time.Second)
+
+	order := &Order{
+		ID:         randomID(),
+		Account:    req.Account,
+		Status:     StatusPending,
+		Expires:    expires,
+		Identifier: ident,
+		Authz:      randomID(),
+	}
+
+	authz := &Authorization{
+		ID:         order.Authz,
+		Account:    req.Account,
+		Order:      order.ID,
+		Status:     StatusPending,
+		Expires:    expires,
+		Identifier: ident,
+		Token:      randomID(),
+	}
+
+	if err := m.store("acme:authz:"+authz.ID, authz, m.ttl); err != nil {
+		return nil, err
+	}
+
+	if err := m.store("acme:order:"+order.ID, order, m.ttl); err != nil {
+		return nil, err
+	}
+
+	m.logger.Infof("ACME order %s created for public key %s.", order.ID, ident.Value)
+
+	return order, nil
+}
+
+func (m *Manager) Order(req *Request, id string) (*Order, proto.VerifyError) {
+
+	var order Order
+
+	if err := m.load("acme:order:"+id, &order); err != nil {
+		return nil, err
+	}
+
+	if time.Now().After(order.Expires) {
+		return nil, &ResourceNotFoundError{}
+	}
+
+	if order.Account != req.Account {
+		return nil, &UnauthorizedError{"Order Belongs To Another Account"}
+	}
+
+	return &order, nil
+}
+
+func (m *Manager) Authorization(req *Request, id string) (*Authorization, proto.VerifyError) {
+
+	var authz Authorization
+
+	if err := m.load("acme:authz:"+id, &authz); err != nil {
+		return nil, err
+	}
+
+	if time.Now().After(authz.Expires) {
+		return nil, &ResourceNotFoundError{}
+	}
+
+	if authz.Account != req.Account {
+		return nil, &UnauthorizedError{"Authorization Belongs To Another Account"}
+	}
+
+	return &authz, nil
+}
+
+// KeyAuthorization returns the message the ring signature of a challenge
+// must cover, as defined in RFC 8555 section 8.1.
+func KeyAuthorization(token string, key *JWK) string {
+	return token + "." + key.Thumbprint()
+}
+
+// Respond validates the ring signature proof of the challenge with verify
+// and moves the authorization and its order to their next state.
+func (m *Manager) Respond(req *Request, id string, verify func(msg string, sigb64 string) (bool, proto.VerifyError)) (*Authorization, proto.VerifyError) {
+
+	authz, err := m.Authorization(req, id)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if authz.Status != StatusPending {
+		return authz, nil
+	}
+
+	var payload ChallengeRequest
+
+	if err := decodePayload(req, &payload); err != nil {
+		return nil, err
+	}
+
+	if payload.Signature == "" {
+		return nil, &MalformedError{"Challenge Response Requires A Ring Signature"}
+	}
+
+	order, err := m.Order(req, authz.Order)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if ok, _ := verify(KeyAuthorization(authz.Token, req.Header.JWK), payload.Signature); !ok {
+		m.logger.Infof("ACME challenge %s failed ring signature verification.", id)
+		authz.Status, order.Status = StatusInvalid, StatusInvalid
+		authz.Error = NewProblem(&UnauthorizedError{"Ring Signature Verification Failed"})
+		order.Error = authz.Error
+	} else {
+		now := time.Now().UTC().Truncate(time.Second)
+		authz.Status, order.Status = StatusValid, StatusReady
+		authz.Validated = &now
+		m.logger.Infof("ACME challenge %s validated.", id)
+	}
+
+	if err := m.store("acme:authz:"+authz.ID, authz, time.Until(authz.Expires)); err != nil {
+		return nil, err
+	}
+
+	if order.Status == StatusReady {
+		err = m.ready(order)
+	} else {
+		err = m.store("acme:order:"+order.ID, order, time.Until(order.Expires))
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return authz, nil
+}
+
+// ready stores the order as ready together with the token a finalization
+// must take before it may issue.
+func (m *Manager) ready(order *Order) proto.VerifyError {
+
+	order.Status = StatusReady
+
+	if err := m.store("acme:order:"+order.ID, order, time.Until(order.Expires)); err != nil {
+		return err
+	}
+
+	if err := m.cache.Set("acme:finalize:"+order.ID, StatusReady, time.Until(order.Expires)); err != nil {
+		m.logger.Errorf("Redis failure happened when storing finalization of %s. err: %s.", order.ID, err.Error())
+		return &ACMEInternalError{}
+	}
+
+	return nil
+}
+
+// process takes the finalization token of a ready order, so only one of
+// concurrent finalizations moves it to processing and issues.
+func (m *Manager) process(order *Order) proto.VerifyError {
+
+	value, err := m.cache.GetDel("acme:finalize:" + order.ID)
+
+	if _, ok := err.(*cache.KeyError); ok || err == nil && value != StatusReady {
+		return &OrderNotReadyError{}
+	}
+
+	if err != nil {
+		m.logger.Errorf("Redis failure happened when finalizing %s. err: %s.", order.ID, err.Error())
+		return &ACMEInternalError{}
+	}
+
+	order.Status = StatusProcessing
+
+	return m.store("acme:order:"+order.ID, order, time.Until(order.Expires))
+}
+
+// Finalize checks the certificate request of a ready order against its
+// identifier and stores the certificate returned by issue. The order is
+// processing while issue runs and ready again when it fails.
+func (m *Manager) Finalize(req *Request, id string, issue func(pubb64 string) ([]byte, proto.VerifyError)) (*Order, proto.VerifyError) {
+
+	order, err := m.Order(req, id)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if order.Status != StatusReady {
+		return nil, &OrderNotReadyError{}
+	}
+
+	var payload FinalizeRequest
+
+	if err := decodePayload(req, &payload); err != nil {
+		return nil, err
+	}
+
+	der, derr := base64.RawURLEncoding.DecodeString(payload.CSR)
+
+	if derr != nil {
+		return nil, &BadCSRError{"CSR Decode Error"}
+	}
+
+	csr, derr := x509.ParseCertificateRequest(der)
+
+	if derr != nil || csr.CheckSignature() != nil {
+		return nil, &BadCSRError{"CSR Signature Invalid"}
+	}
+
+	pub, ok := csr.PublicKey.(ed25519.PublicKey)
+
+	if !ok || base64.StdEncoding.EncodeToString(pub) != order.Identifier.Value {
+		return nil, &BadCSRError{"CSR Key Does Not Match The Order Identifier"}
+	}
+
+	if err := m.process(order); err != nil {
+		return nil, err
+	}
+
+	cert, err := issue(order.Identifier.Value)
+
+	if err != nil {
+		if rerr := m.ready(order); rerr != nil {
+			return nil, rerr
+		}
+		return nil, err
+	}
+
+	order.Status = StatusValid
+	order.Certificate = randomID()
+
+	if err := m.store("acme:cert:"+order.Certificate, &issued{order.Account, cert}, m.ttl); err != nil {
+		return nil, err
+	}
+
+	if err := m.store("acme:order:"+order.ID, order, time.Until(order.Expires)); err != nil {
+		return nil, err
+	}
+
+	m.logger.Infof("ACME order %s finalized.", order.ID)
+
+	return order, nil
+}
+
+// Certificate returns the PEM certificate issued for an order of the
+// account.
+func (m *Manager) Certificate(req *Request, id string) ([]byte, proto.VerifyError) {
+
+	if req.Account == "" {
+		return nil, &MalformedError{"Certificates Must Be Fetched With A kid"}
+	}
+
+	var cert issued
+
+	if err := m.load("acme:cert:"+id, &cert); err != nil {
+		return nil, err
+	}
+
+	if cert.Account != req.Account {
+		return nil, &UnauthorizedError{"Certificate Belongs To Another Account"}
+	}
+
+	return cert.Cert, nil
+}
@@ -0,0 +1,480 @@
+package acme
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/Cealgull/Verify/internal/cache"
+	"github.com/Cealgull/Verify/internal/cache/mock"
+	"github.com/Cealgull/Verify/internal/proto"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+const base = "https://ca.example"
+
+type client struct {
+	alg string
+	key crypto.Signer
+	jwk *JWK
+	kid string
+}
+
+func newEdClient() *client {
+	pub, priv, _ := ed25519.GenerateKey(nil)
+	return &client{alg: "EdDSA", key: priv, jwk: &JWK{Kty: "OKP", Crv: "Ed25519", X: base64.RawURLEncoding.EncodeToString(pub)}}
+}
+
+func newECClient() *client {
+	priv, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	return &client{alg: "ES256", key: priv, jwk: &JWK{
+		Kty: "EC", Crv: "P-256",
+		X: base64.RawURLEncoding.EncodeToString(priv.X.FillBytes(make([]byte, 32))),
+		Y: base64.RawURLEncoding.EncodeToString(priv.Y.FillBytes(make([]byte, 32))),
+	}}
+}
+
+func newRSAClient() *client {
+	priv, _ := rsa.GenerateKey(rand.Reader, 2048)
+	return &client{alg: "RS256", key: priv, jwk: &JWK{
+		Kty: "RSA",
+		N:   base64.RawURLEncoding.EncodeToString(priv.N.Bytes()),
+		E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(priv.E)).Bytes()),
+	}}
+}
+
+func (cl *client) sign(url string, nonce string, payload interface{}) []byte {
+
+	header := Header{Alg: cl.alg, Nonce: nonce, URL: url}
+
+	if cl.kid == "" {
+		header.JWK = cl.jwk
+	} else {
+		header.Kid = cl.kid
+	}
+
+	protected, _ := json.Marshal(&header)
+
+	var body []byte
+
+	if payload != nil {
+		body, _ = json.Marshal(payload)
+	}
+
+	jws := JWS{
+		Protected: base64.RawURLEncoding.EncodeToString(protected),
+		Payload:   base64.RawURLEncoding.EncodeToString(body),
+	}
+
+	input := []byte(jws.Protected + "." + jws.Payload)
+	digest := sha256.Sum256(input)
+
+	var sig []byte
+
+	switch key := cl.key.(type) {
+	case ed25519.PrivateKey:
+		sig = ed25519.Sign(key, input)
+	case *ecdsa.PrivateKey:
+		r, s, _ := ecdsa.Sign(rand.Reader, key, digest[:])
+		sig = append(r.FillBytes(make([]byte, 32)), s.FillBytes(make([]byte, 32))...)
+	case *rsa.PrivateKey:
+		sig, _ = rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+	}
+
+	jws.Signature = base64.RawURLEncoding.EncodeToString(sig)
+
+	data, _ := json.Marshal(&jws)
+	return data
+}
+
+func (cl *client) request(t *testing.T, m *Manager, url string, payload interface{}) (*Request, proto.VerifyError) {
+	nonce, err := m.NewNonce()
+	assert.Nil(t, err)
+	return m.Verify(cl.sign(url, nonce, payload), url)
+}
+
+func newManager(t *testing.T) (*Manager, *mock.MockCache) {
+	l, _ := zap.NewProduction()
+	c := mock.NewMockCache()
+	m, err := NewManager(l.Sugar(), WithCache(c), WithTTL(60))
+	assert.NoError(t, err)
+	return m, c
+}
+
+func TestThumbprint(t *testing.T) {
+
+	// RFC 7638 section 3.1
+	jwk := &JWK{
+		Kty: "RSA",
+		N:   "0vx7agoebGcQSuuPiLJXZptN9nndrQmbXEps2aiAFbWhM78LhWx4cbbfAAtVT86zwu1RK7aPFFxuhDR1L6tSoc_BJECPebWKRXjBZCiFV4n3oknjhMstn64tZ_2W-5JsGY4Hc5n9yBXArwl93lqt7_RN5w6Cf0h4QyQ5v-65YGjQR0_FDW2QvzqY368QQMicAtaSqzs8KJZgnYb9c7d0zgdAZHzu6qMQvRL5hajrn1n91CbOpbISD08qNLyrdkt-bFTWhAI4vMQFh6WeZu0fM4lFd2NcRwr3XPksINHaQ-G_xBniIqbw0Ls1jF44-csFCur-kEgU8awapJzKnqDKgw",
+		E:   "AQAB",
+	}
+	assert.Equal(t, "NzbLsXh8uDCcd-6MNwXF4W_7noWXFZAfHkxZsRGC9Xs", jwk.Thumbprint())
+
+	_, err := jwk.PublicKey()
+	assert.Nil(t, err)
+
+	invalid := []*JWK{
+		{Kty: "OKP", Crv: "Ed25519", X: "AAAA"},
+		{Kty: "EC", Crv: "P-256", X: "AAAA", Y: "AAAA"},
+		{Kty: "EC", Crv: "P-256", X: "!", Y: "AAAA"},
+		{Kty: "RSA", N: "AAAA", E: "AQAB"},
+		{Kty: "oct"},
+	}
+
+	for _, k := range invalid {
+		_, err := k.PublicKey()
+		assert.NotNil(t, err)
+	}
+}
+
+func TestVerify(t *testing.T) {
+
+	m, c := newManager(t)
+	url := base + "/acme/new-account"
+
+	for _, cl := range []*client{newEdClient(), newECClient(), newRSAClient()} {
+		req, err := cl.request(t, m, url, &AccountRequest{})
+		assert.Nil(t, err)
+		assert.Equal(t, cl.jwk.Thumbprint(), req.Header.JWK.Thumbprint())
+		assert.Empty(t, req.Account)
+	}
+
+	cl := newEdClient()
+
+	// nonces are single use
+	nonce, _ := m.NewNonce()
+	_, err := m.Verify(cl.sign(url, nonce, nil), url)
+	assert.Nil(t, err)
+	_, err = m.Verify(cl.sign(url, nonce, nil), url)
+	assert.IsType(t, &BadNonceError{}, err)
+	_, err = m.Verify(cl.sign(url, "", nil), url)
+	assert.IsType(t, &BadNonceError{}, err)
+
+	_, err = cl.request(t, m, base+"/acme/new-order", nil)
+	assert.Nil(t, err)
+	nonce, _ = m.NewNonce()
+	_, err = m.Verify(cl.sign(base+"/acme/new-order", nonce, nil), url)
+	assert.IsType(t, &UnauthorizedError{}, err)
+
+	// the algorithm must match the key type
+	cl.alg = "ES256"
+	_, err = cl.request(t, m, url, nil)
+	assert.IsType(t, &BadSignatureAlgorithmError{}, err)
+	cl.alg = "EdDSA"
+
+	other := newEdClient()
+	other.jwk = cl.jwk
+	_, err = other.request(t, m, url, nil)
+	assert.IsType(t, &UnauthorizedError{}, err)
+
+	cl.kid = base + "/acme/account/unknown"
+	_, err = cl.request(t, m, url, nil)
+	assert.IsType(t, &AccountDoesNotExistError{}, err)
+	cl.kid = "unknown"
+	_, err = cl.request(t, m, url, nil)
+	assert.IsType(t, &AccountDoesNotExistError{}, err)
+
+	for _, body := range []string{
+		`not json`,
+		`{"protected":"!","payload":"","signature":""}`,
+		`{"protected":"bm90IGpzb24","payload":"","signature":""}`,
+		`{"protected":"e30","payload":"","signature":""}`,
+		`{"protected":"eyJraWQiOiJ4In0","payload":"!","signature":""}`,
+		`{"protected":"eyJraWQiOiJ4In0","payload":"","signature":"!"}`,
+	} {
+		_, err := m.Verify([]byte(body), url)
+		assert.IsType(t, &MalformedError{}, err, body)
+	}
+
+	c.AddSetErr("acme:account:broken", &cache.InternalError{})
+	c.AddGetErr("acme:account:broken", &cache.InternalError{})
+	cl.kid = base + "/acme/account/broken"
+	_, err = cl.request(t, m, url, nil)
+	assert.IsType(t, &ACMEInternalError{}, err)
+}
+
+func TestIssuance(t *testing.T) {
+
+	m, _ := newManager(t)
+	cl := newECClient()
+
+	req, err := cl.request(t, m, base+"/acme/new-account", &AccountRequest{OnlyReturnExisting: true})
+	assert.Nil(t, err)
+	_, _, _, err = m.NewAccount(req)
+	assert.IsType(t, &AccountDoesNotExistError{}, err)
+
+	req, _ = cl.request(t, m, base+"/acme/new-account", &AccountRequest{Contact: []string{"mailto:a@b.org"}, TermsOfServiceAgreed: true})
+	acct, id, created, err := m.NewAccount(req)
+	assert.Nil(t, err)
+	assert.True(t, created)
+	assert.Equal(t, StatusValid, acct.Status)
+
+	req, _ = cl.request(t, m, base+"/acme/new-account", &AccountRequest{})
+	_, again, created, err := m.NewAccount(req)
+	assert.Nil(t, err)
+	assert.False(t, created)
+	assert.Equal(t, id, again)
+
+	cl.kid = Link(base, "account", id)
+
+	req, _ = cl.request(t, m, base+"/acme/new-account", &AccountRequest{})
+	_, _, _, err = m.NewAccount(req)
+	assert.IsType(t, &MalformedError{}, err)
+
+	req, _ = cl.request(t, m, cl.kid, &AccountRequest{Contact: []string{"mailto:c@d.org"}})
+	acct, err = m.Account(req, id)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"mailto:c@d.org"}, acct.Contact)
+
+	req, _ = cl.request(t, m, cl.kid, nil)
+	acct, err = m.Account(req, id)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"mailto:c@d.org"}, acct.Contact)
+
+	_, err = m.Account(req, "other")
+	assert.IsType(t, &UnauthorizedError{}, err)
+
+	// orders take exactly one ed25519 public key
+	pub, priv, _ := ed25519.GenerateKey(nil)
+	pubb64 := base64.StdEncoding.EncodeToString(pub)
+
+	for _, idents := range [][]Identifier{
+		nil,
+		{{Type: "dns", Value: "example.org"}},
+		{{Type: IdentifierPubKey, Value: "AAAA"}},
+		{{Type: IdentifierPubKey, Value: pubb64}, {Type: IdentifierPubKey, Value: pubb64}},
+	} {
+		req, _ = cl.request(t, m, base+"/acme/new-order", &OrderRequest{idents})
+		_, err = m.NewOrder(req)
+		assert.IsType(t, &RejectedIdentifierError{}, err)
+	}
+
+	req, _ = cl.request(t, m, base+"/acme/new-order", &OrderRequest{[]Identifier{{IdentifierPubKey, pubb64}}})
+	order, err := m.NewOrder(req)
+	assert.Nil(t, err)
+	assert.Equal(t, StatusPending, order.Status)
+
+	obj := order.Object(base)
+	assert.Equal(t, []string{Link(base, "authz", order.Authz)}, obj.Authorizations)
+	assert.Equal(t, Link(base, "order", order.ID)+"/finalize", obj.Finalize)
+
+	issue := func(s string) ([]byte, proto.VerifyError) {
+		return []byte("certificate for " + s), nil
+	}
+
+	csr, _ := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{}, priv)
+	finalize := &FinalizeRequest{base64.RawURLEncoding.EncodeToString(csr)}
+
+	req, _ = cl.request(t, m, obj.Finalize, finalize)
+	_, err = m.Finalize(req, order.ID, issue)
+	assert.IsType(t, &OrderNotReadyError{}, err)
+
+	// another account sees neither the order nor the authorization
+	stranger := newEdClient()
+	req, _ = stranger.request(t, m, base+"/acme/new-account", &AccountRequest{})
+	_, sid, _, _ := m.NewAccount(req)
+	stranger.kid = Link(base, "account", sid)
+	req, _ = stranger.request(t, m, obj.Authorizations[0], nil)
+	_, err = m.Authorization(req, order.Authz)
+	assert.IsType(t, &UnauthorizedError{}, err)
+	_, err = m.Order(req, order.ID)
+	assert.IsType(t, &UnauthorizedError{}, err)
+	_, err = m.Order(req, "missing")
+	assert.IsType(t, &ResourceNotFoundError{}, err)
+
+	req, _ = cl.request(t, m, obj.Authorizations[0], nil)
+	authz, err := m.Authorization(req, order.Authz)
+	assert.Nil(t, err)
+	challenge := authz.Challenge(base)
+	assert.Equal(t, ChallengeRingSignature, challenge.Type)
+	assert.Equal(t, Link(base, "chall", authz.ID), challenge.URL)
+
+	var signed string
+	verify := func(msg string, sig string) (bool, proto.VerifyError) {
+		signed = msg
+		return sig == "ring", nil
+	}
+
+	req, _ = cl.request(t, m, challenge.URL, &ChallengeRequest{})
+	_, err = m.Respond(req, authz.ID, verify)
+	assert.IsType(t, &MalformedError{}, err)
+
+	req, _ = cl.request(t, m, challenge.URL, &ChallengeRequest{"ring"})
+	authz, err = m.Respond(req, authz.ID, verify)
+	assert.Nil(t, err)
+	assert.Equal(t, StatusValid, authz.Status)
+	assert.NotEmpty(t, authz.Challenge(base).Validated)
+	assert.Equal(t, authz.Token+"."+cl.jwk.Thumbprint(), signed)
+
+	// responding again leaves the authorization untouched
+	req, _ = cl.request(t, m, challenge.URL, &ChallengeRequest{"other"})
+	authz, err = m.Respond(req, authz.ID, verify)
+	assert.Nil(t, err)
+	assert.Equal(t, StatusValid, authz.Status)
+
+	req, _ = cl.request(t, m, Link(base, "order", order.ID), nil)
+	order, err = m.Order(req, order.ID)
+	assert.Nil(t, err)
+	assert.Equal(t, StatusReady, order.Status)
+
+	_, otherpriv, _ := ed25519.GenerateKey(nil)
+	wrong, _ := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{}, otherpriv)
+	ecpriv, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	eccsr, _ := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{}, ecpriv)
+
+	for _, bad := range []string{
+		"!",
+		base64.RawURLEncoding.EncodeToString([]byte("garbage")),
+		base64.RawURLEncoding.EncodeToString(wrong),
+		base64.RawURLEncoding.EncodeToString(eccsr),
+	} {
+		req, _ = cl.request(t, m, obj.Finalize, &FinalizeRequest{bad})
+		_, err = m.Finalize(req, order.ID, issue)
+		assert.IsType(t, &BadCSRError{}, err)
+	}
+
+	req, _ = cl.request(t, m, obj.Finalize, finalize)
+	_, err = m.Finalize(req, order.ID, func(string) ([]byte, proto.VerifyError) {
+		return nil, &ACMEInternalError{}
+	})
+	assert.IsType(t, &ACMEInternalError{}, err)
+
+	// a finalization racing an issuance in progress does not issue again
+	issued := 0
+	req, _ = cl.request(t, m, obj.Finalize, finalize)
+	order, err = m.Finalize(req, order.ID, func(pubb64 string) ([]byte, proto.VerifyError) {
+		issued++
+		req, _ := cl.request(t, m, obj.Finalize, finalize)
+		_, err := m.Finalize(req, order.ID, issue)
+		assert.IsType(t, &OrderNotReadyError{}, err)
+		req, _ = cl.request(t, m, Link(base, "order", order.ID), nil)
+		processing, _ := m.Order(req, order.ID)
+		assert.Equal(t, StatusProcessing, processing.Status)
+		return issue(pubb64)
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, 1, issued)
+	assert.Equal(t, StatusValid, order.Status)
+	assert.Equal(t, Link(base, "cert", order.Certificate), order.Object(base).Certificate)
+
+	req, _ = cl.request(t, m, obj.Finalize, finalize)
+	_, err = m.Finalize(req, order.ID, issue)
+	assert.IsType(t, &OrderNotReadyError{}, err)
+
+	req, _ = cl.request(t, m, Link(base, "cert", order.Certificate), nil)
+	cert, err := m.Certificate(req, order.Certificate)
+	assert.Nil(t, err)
+	assert.Equal(t, "certificate for "+pubb64, string(cert))
+
+	req, _ = stranger.request(t, m, Link(base, "cert", order.Certificate), nil)
+	_, err = m.Certificate(req, order.Certificate)
+	assert.IsType(t, &UnauthorizedError{}, err)
+
+	_, err = m.Certificate(req, "missing")
+	assert.IsType(t, &ResourceNotFoundError{}, err)
+
+	cl.kid = ""
+	req, _ = cl.request(t, m, Link(base, "cert", order.Certificate), nil)
+	_, err = m.Certificate(req, order.Certificate)
+	assert.IsType(t, &MalformedError{}, err)
+	_, err = m.NewOrder(req)
+	assert.IsType(t, &MalformedError{}, err)
+}
+
+func TestFailedChallenge(t *testing.T) {
+
+	m, c := newManager(t)
+	cl := newEdClient()
+
+	req, _ := cl.request(t, m, base+"/acme/new-account", &AccountRequest{})
+	_, id, _, _ := m.NewAccount(req)
+	cl.kid = Link(base, "account", id)
+
+	pub, _, _ := ed25519.GenerateKey(nil)
+	req, _ = cl.request(t, m, base+"/acme/new-order", &OrderRequest{[]Identifier{{IdentifierPubKey, base64.StdEncoding.EncodeToString(pub)}}})
+	order, err := m.NewOrder(req)
+	assert.Nil(t, err)
+
+	req, _ = cl.request(t, m, Link(base, "chall", order.Authz), &ChallengeRequest{"forged"})
+	authz, err := m.Respond(req, order.Authz, func(string, string) (bool, proto.VerifyError) {
+		return false, &UnauthorizedError{"Forged"}
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, StatusInvalid, authz.Status)
+	assert.Equal(t, ErrorNS+"unauthorized", authz.Challenge(base).Error.Type)
+
+	req, _ = cl.request(t, m, Link(base, "order", order.ID), nil)
+	order, err = m.Order(req, order.ID)
+	assert.Nil(t, err)
+	assert.Equal(t, StatusInvalid, order.Status)
+	assert.NotNil(t, order.Object(base).Error)
+
+	// expired resources are gone even before the cache drops them
+	order.Expires = time.Now().Add(-time.Second)
+	assert.Nil(t, m.store("acme:order:"+order.ID, order, time.Minute))
+	_, err = m.Order(req, order.ID)
+	assert.IsType(t, &ResourceNotFoundError{}, err)
+
+	authz.Expires = order.Expires
+	assert.Nil(t, m.store("acme:authz:"+authz.ID, authz, time.Minute))
+	_, err = m.Authorization(req, authz.ID)
+	assert.IsType(t, &ResourceNotFoundError{}, err)
+
+	c.AddSetErr("acme:order:broken", &cache.InternalError{})
+	assert.IsType(t, &ACMEInternalError{}, m.store("acme:order:broken", order, time.Minute))
+	assert.Nil(t, c.Set("acme:order:corrupt", "{", 0))
+	_, err = m.Order(req, "corrupt")
+	assert.IsType(t, &ACMEInternalError{}, err)
+}
+
+func TestProblem(t *testing.T) {
+
+	errs := []proto.VerifyError{
+		&BadNonceError{}, &MalformedError{}, &BadSignatureAlgorithmError{},
+		&UnauthorizedError{}, &AccountDoesNotExistError{}, &ResourceNotFoundError{},
+		&OrderNotReadyError{}, &BadCSRError{}, &RejectedIdentifierError{}, &ACMEInternalError{},
+	}
+
+	codes := make(map[string]bool)
+
+	for _, err := range errs {
+		p := NewProblem(err)
+		assert.Equal(t, err.Status(), p.Status)
+		assert.Contains(t, p.Type, ErrorNS)
+		codes[err.Message().Code] = true
+	}
+
+	assert.Len(t, codes, len(errs))
+
+	assert.Equal(t, ErrorNS+"serverInternal", NewProblem(&statusError{500}).Type)
+	assert.Equal(t, ErrorNS+"unauthorized", NewProblem(&statusError{401}).Type)
+	assert.Equal(t, ErrorNS+"malformed", NewProblem(&statusError{400}).Type)
+}
+
+type statusError struct {
+	status int
+}
+
+func (e *statusError) Error() string {
+	return "status error"
+}
+
+func (e *statusError) Status() int {
+	return e.status
+}
+
+func (e *statusError) Message() *proto.ResponseMessage {
+	return &proto.ResponseMessage{Code: "X0000", Message: e.Error()}
+}
@@ -0,0 +1,218 @@
+package acme
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/Cealgull/Verify/internal/proto"
+)
+
+// ErrorNS prefixes the problem types defined by RFC 8555.
+const ErrorNS = "urn:ietf:params:acme:error:"
+
+type BadNonceError struct{}
+type MalformedError struct {
+	Detail string
+}
+type BadSignatureAlgorithmError struct{}
+type UnauthorizedError struct {
+	Detail string
+}
+type AccountDoesNotExistError struct{}
+type ResourceNotFoundError struct{}
+type OrderNotReadyError struct{}
+type BadCSRError struct {
+	Detail string
+}
+type RejectedIdentifierError struct{}
+type ACMEInternalError struct{}
+
+func (e *BadNonceError) Error() string {
+	return "ACME: Replay Nonce Invalid Or Used."
+}
+
+func (e *BadNonceError) Status() int {
+	return http.StatusBadRequest
+}
+
+func (e *BadNonceError) Message() *proto.ResponseMessage {
+	return &proto.ResponseMessage{
+		Code:    "Q1001",
+		Message: e.Error(),
+	}
+}
+
+func (e *BadNonceError) Type() string {
+	return ErrorNS + "badNonce"
+}
+
+func (e *MalformedError) Error() string {
+	return fmt.Sprintf("ACME: Malformed Request. %s.", e.Detail)
+}
+
+func (e *MalformedError) Status() int {
+	return http.StatusBadRequest
+}
+
+func (e *MalformedError) Message() *proto.ResponseMessage {
+	return &proto.ResponseMessage{
+		Code:    "Q1002",
+		Message: e.Error(),
+	}
+}
+
+func (e *MalformedError) Type() string {
+	return ErrorNS + "malformed"
+}
+
+func (e *BadSignatureAlgorithmError) Error() string {
+	return "ACME: JWS Algorithm Not Supported. Use EdDSA, ES256 or RS256."
+}
+
+func (e *BadSignatureAlgorithmError) Status() int {
+	return http.StatusBadRequest
+}
+
+func (e *BadSignatureAlgorithmError) Message() *proto.ResponseMessage {
+	return &proto.ResponseMessage{
+		Code:    "Q1003",
+		Message: e.Error(),
+	}
+}
+
+func (e *BadSignatureAlgorithmError) Type() string {
+	return ErrorNS + "badSignatureAlgorithm"
+}
+
+func (e *UnauthorizedError) Error() string {
+	return fmt.Sprintf("ACME: Unauthorized. %s.", e.Detail)
+}
+
+func (e *UnauthorizedError) Status() int {
+	return http.StatusForbidden
+}
+
+func (e *UnauthorizedError) Message() *proto.ResponseMessage {
+	return &proto.ResponseMessage{
+		Code:    "Q1004",
+		Message: e.Error(),
+	}
+}
+
+func (e *UnauthorizedError) Type() string {
+	return ErrorNS + "unauthorized"
+}
+
+func (e *AccountDoesNotExistError) Error() string {
+	return "ACME: Account Does Not Exist."
+}
+
+func (e *AccountDoesNotExistError) Status() int {
+	return http.StatusBadRequest
+}
+
+func (e *AccountDoesNotExistError) Message() *proto.ResponseMessage {
+	return &proto.ResponseMessage{
+		Code:    "Q1005",
+		Message: e.Error(),
+	}
+}
+
+func (e *AccountDoesNotExistError) Type() string {
+	return ErrorNS + "accountDoesNotExist"
+}
+
+func (e *ResourceNotFoundError) Error() string {
+	return "ACME: Resource Not Found."
+}
+
+func (e *ResourceNotFoundError) Status() int {
+	return http.StatusNotFound
+}
+
+func (e *ResourceNotFoundError) Message() *proto.ResponseMessage {
+	return &proto.ResponseMessage{
+		Code:    "Q1006",
+		Message: e.Error(),
+	}
+}
+
+func (e *ResourceNotFoundError) Type() string {
+	return ErrorNS + "malformed"
+}
+
+func (e *OrderNotReadyError) Error() string {
+	return "ACME: Order Is Not Ready For Finalization."
+}
+
+func (e *OrderNotReadyError) Status() int {
+	return http.StatusForbidden
+}
+
+func (e *OrderNotReadyError) Message() *proto.ResponseMessage {
+	return &proto.ResponseMessage{
+		Code:    "Q1007",
+		Message: e.Error(),
+	}
+}
+
+func (e *OrderNotReadyError) Type() string {
+	return ErrorNS + "orderNotReady"
+}
+
+func (e *BadCSRError) Error() string {
+	return fmt.Sprintf("ACME: Bad Certificate Request. %s.", e.Detail)
+}
+
+func (e *BadCSRError) Status() int {
+	return http.StatusBadRequest
+}
+
+func (e *BadCSRError) Message() *proto.ResponseMessage {
+	return &proto.ResponseMessage{
+		Code:    "Q1008",
+		Message: e.Error(),
+	}
+}
+
+func (e *BadCSRError) Type() string {
+	return ErrorNS + "badCSR"
+}
+
+func (e *RejectedIdentifierError) Error() string {
+	return "ACME: Orders Take A Single pubkey Identifier With A Base64 Ed25519 Key."
+}
+
+func (e *RejectedIdentifierError) Status() int {
+	return http.StatusBadRequest
+}
+
+func (e *RejectedIdentifierError) Message() *proto.ResponseMessage {
+	return &proto.ResponseMessage{
+		Code:    "Q1009",
+		Message: e.Error(),
+	}
+}
+
+func (e *RejectedIdentifierError) Type() string {
+	return ErrorNS + "rejectedIdentifier"
+}
+
+func (e *ACMEInternalError) Error() string {
+	return "ACME: Internal Server Error."
+}
+
+func (e *ACMEInternalError) Status() int {
+	return http.StatusInternalServerError
+}
+
+func (e *ACMEInternalError) Message() *proto.ResponseMessage {
+	return &proto.ResponseMessage{
+		Code:    "Q1010",
+		Message: e.Error(),
+	}
+}
+
+func (e *ACMEInternalError) Type() string {
+	return ErrorNS + "serverInternal"
+}
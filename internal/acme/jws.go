@@ -0,0 +1,208 @@
+package acme
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+
+	"github.com/Cealgull/Verify/internal/proto"
+)
+
+// JWS is a request body in the flattened JSON serialization RFC 8555 uses.
+type JWS struct {
+	Protected string `json:"protected"`
+	Payload   string `json:"payload"`
+	Signature string `json:"signature"`
+}
+
+type Header struct {
+	Alg   string `json:"alg"`
+	Nonce string `json:"nonce"`
+	URL   string `json:"url"`
+	JWK   *JWK   `json:"jwk,omitempty"`
+	Kid   string `json:"kid,omitempty"`
+}
+
+// JWK is the public account key of an ACME client.
+type JWK struct {
+	Kty string `json:"kty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+	Y   string `json:"y,omitempty"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+}
+
+func decodeInt(s string) (*big.Int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil || len(b) == 0 {
+		return nil, &MalformedError{"Invalid JWK Integer"}
+	}
+	return new(big.Int).SetBytes(b), nil
+}
+
+func (k *JWK) PublicKey() (crypto.PublicKey, proto.VerifyError) {
+
+	switch {
+	case k.Kty == "OKP" && k.Crv == "Ed25519":
+
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+
+		if err != nil || len(x) != ed25519.PublicKeySize {
+			return nil, &MalformedError{"Invalid Ed25519 JWK"}
+		}
+
+		return ed25519.PublicKey(x), nil
+
+	case k.Kty == "EC" && k.Crv == "P-256":
+
+		x, xerr := decodeInt(k.X)
+		y, yerr := decodeInt(k.Y)
+
+		if xerr != nil || yerr != nil || !elliptic.P256().IsOnCurve(x, y) {
+			return nil, &MalformedError{"Invalid P-256 JWK"}
+		}
+
+		return &ecdsa.PublicKey{Curve: elliptic.P256(), X: x, Y: y}, nil
+
+	case k.Kty == "RSA":
+
+		n, nerr := decodeInt(k.N)
+		e, eerr := decodeInt(k.E)
+
+		if nerr != nil || eerr != nil || !e.IsInt64() || n.BitLen() < 2048 {
+			return nil, &MalformedError{"Invalid RSA JWK"}
+		}
+
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	}
+
+	return nil, &BadSignatureAlgorithmError{}
+}
+
+// Thumbprint computes the RFC 7638 thumbprint over the required members.
+func (k *JWK) Thumbprint() string {
+
+	var canonical string
+
+	switch k.Kty {
+	case "OKP":
+		canonical = fmt.Sprintf(`{"crv":"%s","kty":"%s","x":"%s"}`, k.Crv, k.Kty, k.X)
+	case "EC":
+		canonical = fmt.Sprintf(`{"crv":"%s","kty":"%s","x":"%s","y":"%s"}`, k.Crv, k.Kty, k.X, k.Y)
+	case "RSA":
+		canonical = fmt.Sprintf(`{"e":"%s","kty":"%s","n":"%s"}`, k.E, k.Kty, k.N)
+	}
+
+	sum := sha256.Sum256([]byte(canonical))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+func verifySignature(alg string, pub crypto.PublicKey, input []byte, sig []byte) proto.VerifyError {
+
+	digest := sha256.Sum256(input)
+
+	switch key := pub.(type) {
+	case ed25519.PublicKey:
+		if alg != "EdDSA" {
+			return &BadSignatureAlgorithmError{}
+		}
+		if !ed25519.Verify(key, input, sig) {
+			return &UnauthorizedError{"JWS Signature Invalid"}
+		}
+	case *ecdsa.PublicKey:
+		if alg != "ES256" {
+			return &BadSignatureAlgorithmError{}
+		}
+		if len(sig) != 64 {
+			return &UnauthorizedError{"JWS Signature Invalid"}
+		}
+		r := new(big.Int).SetBytes(sig[:32])
+		s := new(big.Int).SetBytes(sig[32:])
+		if !ecdsa.Verify(key, digest[:], r, s) {
+			return &UnauthorizedError{"JWS Signature Invalid"}
+		}
+	case *rsa.PublicKey:
+		if alg != "RS256" {
+			return &BadSignatureAlgorithmError{}
+		}
+		if rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], sig) != nil {
+			return &UnauthorizedError{"JWS Signature Invalid"}
+		}
+	default:
+		return &BadSignatureAlgorithmError{}
+	}
+
+	return nil
+}
+
+// decodeJWS parses the flattened JWS and checks its signature against the
+// key in the header, or against the account key when it carries a kid.
+func decodeJWS(body []byte, lookup func(kid string) (*JWK, proto.VerifyError)) (*Header, []byte, proto.VerifyError) {
+
+	var jws JWS
+
+	if err := json.Unmarshal(body, &jws); err != nil {
+		return nil, nil, &MalformedError{"Request Is Not A Flattened JWS"}
+	}
+
+	protected, err := base64.RawURLEncoding.DecodeString(jws.Protected)
+
+	if err != nil {
+		return nil, nil, &MalformedError{"Protected Header Decode Error"}
+	}
+
+	var header Header
+
+	if err := json.Unmarshal(protected, &header); err != nil {
+		return nil, nil, &MalformedError{"Protected Header Decode Error"}
+	}
+
+	if (header.JWK == nil) == (header.Kid == "") {
+		return nil, nil, &MalformedError{"Exactly One Of jwk And kid Required"}
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(jws.Payload)
+
+	if err != nil {
+		return nil, nil, &MalformedError{"Payload Decode Error"}
+	}
+
+	sig, err := base64.RawURLEncoding.DecodeString(jws.Signature)
+
+	if err != nil {
+		return nil, nil, &MalformedError{"Signature Decode Error"}
+	}
+
+	jwk := header.JWK
+
+	if jwk == nil {
+
+		var verr proto.VerifyError
+
+		if jwk, verr = lookup(header.Kid); verr != nil {
+			return nil, nil, verr
+		}
+	}
+
+	pub, verr := jwk.PublicKey()
+
+	if verr != nil {
+		return nil, nil, verr
+	}
+
+	if verr := verifySignature(header.Alg, pub, []byte(jws.Protected+"."+jws.Payload), sig); verr != nil {
+		return nil, nil, verr
+	}
+
+	header.JWK = jwk
+
+	return &header, payload, nil
+}
@@ -8,6 +8,14 @@ type Cache interface {
 	Del(key string) error
 	Set(key string, value string, expiration time.Duration) error
 	GetDel(key string) (string, error)
-	SAdd(set string, elem string) error
+	CompareAndDel(key string, value string) (bool, error)
+	TTL(key string) (time.Duration, error)
+	SAdd(set string, elems ...string) error
 	SIsmember(set string, elem string) (bool, error)
+	Incr(key string, expiration time.Duration) (int64, error)
+	Decr(key string) (int64, error)
+	ZAdd(set string, score float64, member string) error
+	ZRangeByScore(set string, max float64, count int64) ([]string, error)
+	ZRem(set string, member string) (bool, error)
+	ZMove(src string, dst string, score float64, member string) (bool, error)
 }
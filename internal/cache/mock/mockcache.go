@@ -1,13 +1,19 @@
 package mock
 
 import (
+	"sort"
+	"strconv"
+	"sync"
 	"time"
 
 	"github.com/Cealgull/Verify/internal/cache"
 )
 
 type MockCache struct {
+	mu      sync.Mutex
 	m       map[string]string
+	exp     map[string]time.Time
+	zsets   map[string]map[string]float64
 	sets    map[string]map[string]bool
 	geterr  map[string]error
 	seterr  map[string]error
@@ -18,7 +24,9 @@ type MockCache struct {
 func NewMockCache() *MockCache {
 	return &MockCache{
 		m:       make(map[string]string),
+		exp:     make(map[string]time.Time),
 		sets:    make(map[string]map[string]bool),
+		zsets:   make(map[string]map[string]float64),
 		geterr:  make(map[string]error),
 		seterr:  make(map[string]error),
 		setserr: make(map[string]error),
@@ -26,26 +34,44 @@ func NewMockCache() *MockCache {
 }
 
 func (r *MockCache) AddGetErr(key string, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
 	r.geterr[key] = err
 }
 
+func (r *MockCache) DelGetErr(key string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.geterr, key)
+}
+
 func (r *MockCache) AddSetErr(key string, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
 	r.seterr[key] = err
 }
 
 func (r *MockCache) AddDelErr(key string, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
 	r.delerr[key] = err
 }
 
 func (r *MockCache) AddSetsErr(key string, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
 	r.setserr[key] = err
 }
 
 func (r *MockCache) DelSetsErr(key string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
 	delete(r.setserr, key)
 }
 
 func (r *MockCache) Get(key string) (string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
 	if err, f := r.geterr[key]; f {
 		return "", err
 	}
@@ -56,14 +82,48 @@ func (r *MockCache) Get(key string) (string, error) {
 }
 
 func (r *MockCache) Set(key string, value string, expiration time.Duration) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
 	if err, f := r.seterr[key]; f {
 		return err
 	}
 	r.m[key] = value
+	r.expire(key, expiration)
 	return nil
 }
 
+// expire records when key expires. Keys are never evicted, the deadline
+// only answers TTL.
+func (r *MockCache) expire(key string, expiration time.Duration) {
+	if expiration > 0 {
+		r.exp[key] = time.Now().Add(expiration)
+	} else {
+		delete(r.exp, key)
+	}
+}
+
+func (r *MockCache) TTL(key string) (time.Duration, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err, f := r.geterr[key]; f {
+		return -1, err
+	}
+	if _, f := r.m[key]; !f {
+		return -1, &cache.KeyError{}
+	}
+	deadline, f := r.exp[key]
+	if !f {
+		return 0, nil
+	}
+	if left := time.Until(deadline); left > 0 {
+		return left, nil
+	}
+	return -1, &cache.KeyError{}
+}
+
 func (r *MockCache) Exists(ks ...string) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
 	cnt := 0
 	for _, k := range ks {
 		if err, f := r.geterr[k]; f {
@@ -77,15 +137,34 @@ func (r *MockCache) Exists(ks ...string) (int, error) {
 }
 
 func (r *MockCache) GetDel(key string) (string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
 	if err, f := r.geterr[key]; f {
 		return "", err
 	}
 	res := r.m[key]
 	delete(r.m, key)
+	delete(r.exp, key)
 	return res, nil
 }
 
+func (r *MockCache) CompareAndDel(key string, value string) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err, f := r.geterr[key]; f {
+		return false, err
+	}
+	if v, f := r.m[key]; !f || v != value {
+		return false, nil
+	}
+	delete(r.m, key)
+	delete(r.exp, key)
+	return true, nil
+}
+
 func (r *MockCache) Del(key string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
 	if err, f := r.delerr[key]; f {
 		return err
 	}
@@ -93,24 +172,30 @@ func (r *MockCache) Del(key string) error {
 		return &cache.KeyError{}
 	}
 	delete(r.m, key)
+	delete(r.exp, key)
 	return nil
 }
 
-func (r *MockCache) SAdd(set string, key string) error {
+func (r *MockCache) SAdd(set string, keys ...string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
 	if err, f := r.setserr[set]; f {
 		return err
 	}
-	if s, f := r.sets[set]; f {
-		s[key] = true
-	} else {
+	s, f := r.sets[set]
+	if !f {
 		s = make(map[string]bool)
-		s[key] = true
 		r.sets[set] = s
 	}
+	for _, key := range keys {
+		s[key] = true
+	}
 	return nil
 }
 
 func (r *MockCache) SIsmember(set string, key string) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
 	if err, f := r.setserr[set]; f {
 		return false, err
 	}
@@ -123,3 +208,105 @@ func (r *MockCache) SIsmember(set string, key string) (bool, error) {
 
 	return f, nil
 }
+
+func (r *MockCache) Incr(key string, expiration time.Duration) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err, f := r.seterr[key]; f {
+		return -1, err
+	}
+	n, _ := strconv.ParseInt(r.m[key], 10, 64)
+	n += 1
+	r.m[key] = strconv.FormatInt(n, 10)
+	if n == 1 {
+		r.expire(key, expiration)
+	}
+	return n, nil
+}
+
+func (r *MockCache) Decr(key string) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err, f := r.seterr[key]; f {
+		return -1, err
+	}
+	n, _ := strconv.ParseInt(r.m[key], 10, 64)
+	n -= 1
+	r.m[key] = strconv.FormatInt(n, 10)
+	return n, nil
+}
+
+func (r *MockCache) ZAdd(set string, score float64, member string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err, f := r.setserr[set]; f {
+		return err
+	}
+	z, f := r.zsets[set]
+	if !f {
+		z = make(map[string]float64)
+		r.zsets[set] = z
+	}
+	z[member] = score
+	return nil
+}
+
+func (r *MockCache) ZRangeByScore(set string, max float64, count int64) ([]string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err, f := r.setserr[set]; f {
+		return nil, err
+	}
+	z := r.zsets[set]
+	res := []string{}
+	for member, score := range z {
+		if score <= max {
+			res = append(res, member)
+		}
+	}
+	sort.Slice(res, func(i, j int) bool {
+		if z[res[i]] != z[res[j]] {
+			return z[res[i]] < z[res[j]]
+		}
+		return res[i] < res[j]
+	})
+	if count > 0 && int64(len(res)) > count {
+		res = res[:count]
+	}
+	return res, nil
+}
+
+func (r *MockCache) ZRem(set string, member string) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err, f := r.delerr[set]; f {
+		return false, err
+	}
+	if _, f := r.zsets[set][member]; !f {
+		return false, nil
+	}
+	delete(r.zsets[set], member)
+	return true, nil
+}
+
+func (r *MockCache) ZMove(src string, dst string, score float64, member string) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err, f := r.setserr[dst]; f {
+		return false, err
+	}
+	if err, f := r.delerr[src]; f {
+		return false, err
+	}
+	if _, f := r.zsets[src][member]; !f {
+		return false, nil
+	}
+	delete(r.zsets[src], member)
+	z, f := r.zsets[dst]
+	if !f {
+		z = make(map[string]float64)
+		r.zsets[dst] = z
+	}
+	z[member] = score
+	return true, nil
+}
@@ -49,15 +49,36 @@ func TestMockSimpleKV(t *testing.T) {
 
 }
 
+func TestMockCompareAndDel(t *testing.T) {
+	assert.Nil(t, c.Set("cad", "v1", time.Hour))
+	ok, err := c.CompareAndDel("cad", "v2")
+	assert.Nil(t, err)
+	assert.False(t, ok)
+	ok, _ = c.CompareAndDel("cad", "v1")
+	assert.True(t, ok)
+	ok, _ = c.CompareAndDel("cad", "v1")
+	assert.False(t, ok)
+	c.AddGetErr("cad", &cache.InternalError{})
+	_, err = c.CompareAndDel("cad", "v1")
+	assert.NotNil(t, err)
+	c.DelGetErr("cad")
+	_, err = c.CompareAndDel("cad", "v1")
+	assert.Nil(t, err)
+}
+
 func TestMockSet(t *testing.T) {
 	err := c.SAdd("s1", "k1")
 	assert.Nil(t, err)
-	err = c.SAdd("s1", "k2")
+	err = c.SAdd("s1", "k2", "k5")
 	assert.Nil(t, err)
 	valid, err := c.SIsmember("s1", "k1")
 	assert.True(t, valid)
 	assert.Nil(t, err)
 
+	valid, err = c.SIsmember("s1", "k5")
+	assert.True(t, valid)
+	assert.Nil(t, err)
+
 	valid, err = c.SIsmember("s2", "k4")
 	assert.False(t, valid)
 	assert.NotNil(t, err)
@@ -76,3 +97,92 @@ func TestMockSet(t *testing.T) {
 	err = c.SAdd("s1", "k3")
 	assert.Nil(t, err)
 }
+
+func TestMockIncr(t *testing.T) {
+	n, err := c.Incr("counter", time.Hour)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), n)
+	n, err = c.Incr("counter", time.Hour)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(2), n)
+	n, err = c.Decr("counter")
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), n)
+
+	c.AddSetErr("counter", &cache.InternalError{})
+	_, err = c.Incr("counter", time.Hour)
+	assert.NotNil(t, err)
+	_, err = c.Decr("counter")
+	assert.NotNil(t, err)
+}
+
+func TestMockSortedSet(t *testing.T) {
+	assert.Nil(t, c.ZAdd("z1", 3, "c"))
+	assert.Nil(t, c.ZAdd("z1", 1, "a"))
+	assert.Nil(t, c.ZAdd("z1", 2, "b"))
+
+	res, err := c.ZRangeByScore("z1", 2, 0)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"a", "b"}, res)
+
+	res, _ = c.ZRangeByScore("z1", 3, 1)
+	assert.Equal(t, []string{"a"}, res)
+
+	ok, err := c.ZRem("z1", "a")
+	assert.True(t, ok)
+	assert.Nil(t, err)
+	ok, _ = c.ZRem("z1", "a")
+	assert.False(t, ok)
+
+	ok, err = c.ZMove("z1", "z3", 5, "b")
+	assert.True(t, ok)
+	assert.Nil(t, err)
+	ok, _ = c.ZMove("z1", "z3", 5, "b")
+	assert.False(t, ok)
+	res, _ = c.ZRangeByScore("z3", 5, 0)
+	assert.Equal(t, []string{"b"}, res)
+	res, _ = c.ZRangeByScore("z1", 5, 0)
+	assert.Equal(t, []string{"c"}, res)
+
+	c.AddSetsErr("z2", &cache.InternalError{})
+	assert.NotNil(t, c.ZAdd("z2", 1, "a"))
+	_, err = c.ZMove("z1", "z2", 1, "c")
+	assert.NotNil(t, err)
+	_, err = c.ZRangeByScore("z2", 1, 0)
+	assert.NotNil(t, err)
+	c.AddDelErr("z2", &cache.InternalError{})
+	_, err = c.ZRem("z2", "a")
+	assert.NotNil(t, err)
+}
+
+func TestMockTTL(t *testing.T) {
+	assert.Nil(t, c.Set("t1", "v1", time.Hour))
+	ttl, err := c.TTL("t1")
+	assert.Nil(t, err)
+	assert.InDelta(t, float64(time.Hour), float64(ttl), float64(time.Second))
+
+	assert.Nil(t, c.Set("t1", "v1", 0))
+	ttl, err = c.TTL("t1")
+	assert.Nil(t, err)
+	assert.Zero(t, ttl)
+
+	assert.Nil(t, c.Set("t1", "v1", time.Nanosecond))
+	time.Sleep(time.Millisecond)
+	_, err = c.TTL("t1")
+	assert.IsType(t, &cache.KeyError{}, err)
+
+	_, err = c.Incr("t2", time.Minute)
+	assert.Nil(t, err)
+	_, err = c.Incr("t2", time.Hour)
+	assert.Nil(t, err)
+	ttl, _ = c.TTL("t2")
+	assert.LessOrEqual(t, ttl, time.Minute)
+
+	assert.Nil(t, c.Del("t2"))
+	_, err = c.TTL("t2")
+	assert.IsType(t, &cache.KeyError{}, err)
+
+	c.AddGetErr("t3", &cache.InternalError{})
+	_, err = c.TTL("t3")
+	assert.IsType(t, &cache.InternalError{}, err)
+}
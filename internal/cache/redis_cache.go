@@ -3,6 +3,7 @@ package cache
 import (
 	"context"
 	"fmt"
+	"strconv"
 	"time"
 
 	"github.com/redis/go-redis/v9"
@@ -75,6 +76,39 @@ func (r *RedisCache) GetDel(key string) (string, error) {
 	return res, nil
 }
 
+// compareAndDelScript deletes the key only while it holds the value, so a
+// value replaced meanwhile is kept.
+const compareAndDelScript = `if redis.call('GET', KEYS[1]) ~= ARGV[1] then return 0 end
+return redis.call('DEL', KEYS[1])`
+
+// CompareAndDel reports whether key held value and was deleted by this
+// call.
+func (r *RedisCache) CompareAndDel(key string, value string) (bool, error) {
+	res, err := r.client.Eval(context.Background(), compareAndDelScript, []string{key}, value).Int64()
+	if err != nil {
+		return false, &InternalError{}
+	}
+	return res == 1, nil
+}
+
+// TTL returns the time left before key expires, zero when it never does.
+func (r *RedisCache) TTL(key string) (time.Duration, error) {
+	res, err := r.client.TTL(context.Background(), key).Result()
+
+	if err != nil {
+		return -1, &InternalError{}
+	}
+
+	switch res {
+	case -2:
+		return -1, &KeyError{}
+	case -1:
+		return 0, nil
+	}
+
+	return res, nil
+}
+
 func (r *RedisCache) Del(key string) error {
 	cmd := r.client.Del(context.Background(), key)
 	res, err := cmd.Result()
@@ -90,8 +124,12 @@ func (r *RedisCache) Del(key string) error {
 	return nil
 }
 
-func (r *RedisCache) SAdd(set string, elem string) error {
-	_, err := r.client.SAdd(context.Background(), set, elem).Result()
+func (r *RedisCache) SAdd(set string, elems ...string) error {
+	members := make([]interface{}, len(elems))
+	for i, elem := range elems {
+		members[i] = elem
+	}
+	_, err := r.client.SAdd(context.Background(), set, members...).Result()
 	if err != nil {
 		return &InternalError{}
 	}
@@ -105,3 +143,75 @@ func (r *RedisCache) SIsmember(set string, elem string) (bool, error) {
 	}
 	return res, nil
 }
+
+// incrScript increments the counter and starts its expiration in one step,
+// so a counter is never left behind without one.
+const incrScript = `local n = redis.call('INCR', KEYS[1])
+if n == 1 then redis.call('PEXPIRE', KEYS[1], ARGV[1]) end
+return n`
+
+// Incr increments the counter at key and starts its expiration when the
+// counter is created.
+func (r *RedisCache) Incr(key string, expiration time.Duration) (int64, error) {
+	res, err := r.client.Eval(context.Background(), incrScript, []string{key}, expiration.Milliseconds()).Int64()
+	if err != nil {
+		return -1, &InternalError{}
+	}
+	return res, nil
+}
+
+// Decr gives back one count of the counter at key.
+func (r *RedisCache) Decr(key string) (int64, error) {
+	res, err := r.client.Decr(context.Background(), key).Result()
+	if err != nil {
+		return -1, &InternalError{}
+	}
+	return res, nil
+}
+
+func (r *RedisCache) ZAdd(set string, score float64, member string) error {
+	err := r.client.ZAdd(context.Background(), set, redis.Z{Score: score, Member: member}).Err()
+	if err != nil {
+		return &InternalError{}
+	}
+	return nil
+}
+
+// ZRangeByScore lists at most count members of set scoring up to max, lowest
+// first.
+func (r *RedisCache) ZRangeByScore(set string, max float64, count int64) ([]string, error) {
+	res, err := r.client.ZRangeByScore(context.Background(), set, &redis.ZRangeBy{
+		Min:   "-inf",
+		Max:   strconv.FormatFloat(max, 'f', -1, 64),
+		Count: count,
+	}).Result()
+	if err != nil {
+		return nil, &InternalError{}
+	}
+	return res, nil
+}
+
+// ZRem reports whether member was removed from set by this call.
+func (r *RedisCache) ZRem(set string, member string) (bool, error) {
+	res, err := r.client.ZRem(context.Background(), set, member).Result()
+	if err != nil {
+		return false, &InternalError{}
+	}
+	return res == 1, nil
+}
+
+// zmoveScript moves a member between sorted sets in one step, so a member
+// is claimed by one caller only and never lost in between.
+const zmoveScript = `if redis.call('ZREM', KEYS[1], ARGV[2]) == 0 then return 0 end
+redis.call('ZADD', KEYS[2], ARGV[1], ARGV[2])
+return 1`
+
+// ZMove reports whether member was moved from src to dst, scored by score,
+// by this call.
+func (r *RedisCache) ZMove(src string, dst string, score float64, member string) (bool, error) {
+	res, err := r.client.Eval(context.Background(), zmoveScript, []string{src, dst}, score, member).Int64()
+	if err != nil {
+		return false, &InternalError{}
+	}
+	return res == 1, nil
+}
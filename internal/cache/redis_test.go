@@ -56,6 +56,18 @@ func TestGet(t *testing.T) {
 	_, err = incorrectCache.GetDel("user1")
 	assert.IsType(t, &InternalError{}, err)
 
+	mock.ExpectEval(compareAndDelScript, []string{"user1"}, "code1").SetVal(int64(1))
+	ok, err := normalCache.CompareAndDel("user1", "code1")
+	assert.Nil(t, err)
+	assert.True(t, ok)
+
+	mock.ExpectEval(compareAndDelScript, []string{"user1"}, "code1").SetVal(int64(0))
+	ok, _ = normalCache.CompareAndDel("user1", "code1")
+	assert.False(t, ok)
+
+	_, err = incorrectCache.CompareAndDel("user1", "code1")
+	assert.IsType(t, &InternalError{}, err)
+
 }
 
 func TestExists(t *testing.T) {
@@ -87,6 +99,10 @@ func TestSAdd(t *testing.T) {
 	err := normalCache.SAdd("pub", "123")
 	assert.Nil(t, err)
 
+	mock.ExpectSAdd("pub", "234", "345").SetVal(2)
+	err = normalCache.SAdd("pub", "234", "345")
+	assert.Nil(t, err)
+
 	err = incorrectCache.SAdd("pub", "123")
 	assert.NotNil(t, err)
 }
@@ -101,3 +117,86 @@ func TestSIsmember(t *testing.T) {
 	assert.False(t, valid)
 	assert.NotNil(t, err)
 }
+
+func TestIncr(t *testing.T) {
+	mock.ExpectEval(incrScript, []string{"counter"}, time.Hour.Milliseconds()).SetVal(int64(1))
+	n, err := normalCache.Incr("counter", time.Hour)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), n)
+
+	mock.ExpectEval(incrScript, []string{"counter"}, time.Hour.Milliseconds()).SetVal(int64(2))
+	n, err = normalCache.Incr("counter", time.Hour)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(2), n)
+
+	mock.ExpectEval(incrScript, []string{"fresh"}, time.Hour.Milliseconds()).SetErr(&InternalError{})
+	_, err = normalCache.Incr("fresh", time.Hour)
+	assert.NotNil(t, err)
+
+	_, err = incorrectCache.Incr("counter", time.Hour)
+	assert.NotNil(t, err)
+
+	mock.ExpectDecr("counter").SetVal(1)
+	n, err = normalCache.Decr("counter")
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), n)
+
+	_, err = incorrectCache.Decr("counter")
+	assert.NotNil(t, err)
+}
+
+func TestSortedSet(t *testing.T) {
+	mock.ExpectZAdd("queue", redis.Z{Score: 1000, Member: "job"}).SetVal(1)
+	assert.Nil(t, normalCache.ZAdd("queue", 1000, "job"))
+
+	mock.ExpectZRangeByScore("queue", &redis.ZRangeBy{Min: "-inf", Max: "2000", Count: 4}).SetVal([]string{"job"})
+	res, err := normalCache.ZRangeByScore("queue", 2000, 4)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"job"}, res)
+
+	mock.ExpectZRem("queue", "job").SetVal(1)
+	ok, err := normalCache.ZRem("queue", "job")
+	assert.Nil(t, err)
+	assert.True(t, ok)
+
+	mock.ExpectZRem("queue", "job").SetVal(0)
+	ok, _ = normalCache.ZRem("queue", "job")
+	assert.False(t, ok)
+
+	assert.NotNil(t, incorrectCache.ZAdd("queue", 1000, "job"))
+	_, err = incorrectCache.ZRangeByScore("queue", 2000, 4)
+	assert.NotNil(t, err)
+	_, err = incorrectCache.ZRem("queue", "job")
+	assert.NotNil(t, err)
+
+	mock.ExpectEval(zmoveScript, []string{"queue", "flight"}, float64(3000), "job").SetVal(int64(1))
+	ok, err = normalCache.ZMove("queue", "flight", 3000, "job")
+	assert.Nil(t, err)
+	assert.True(t, ok)
+
+	mock.ExpectEval(zmoveScript, []string{"queue", "flight"}, float64(3000), "job").SetVal(int64(0))
+	ok, _ = normalCache.ZMove("queue", "flight", 3000, "job")
+	assert.False(t, ok)
+
+	_, err = incorrectCache.ZMove("queue", "flight", 3000, "job")
+	assert.NotNil(t, err)
+}
+
+func TestTTL(t *testing.T) {
+	mock.ExpectTTL("user1").SetVal(time.Minute)
+	ttl, err := normalCache.TTL("user1")
+	assert.Nil(t, err)
+	assert.Equal(t, time.Minute, ttl)
+
+	mock.ExpectTTL("user2").SetVal(-1)
+	ttl, err = normalCache.TTL("user2")
+	assert.Nil(t, err)
+	assert.Zero(t, ttl)
+
+	mock.ExpectTTL("user3").SetVal(-2)
+	_, err = normalCache.TTL("user3")
+	assert.IsType(t, &KeyError{}, err)
+
+	_, err = incorrectCache.TTL("user1")
+	assert.IsType(t, &InternalError{}, err)
+}
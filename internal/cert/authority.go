@@ -0,0 +1,83 @@
+package cert
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"os"
+	"time"
+
+	"github.com/Cealgull/Verify/pkg/sm2"
+)
+
+// CA key algorithms, SM2 signing with SM3 for deployments bound to the
+// national cryptography standards.
+const (
+	Ed25519 = "ed25519"
+	SM2     = "sm2"
+)
+
+// GenerateAuthority creates a CA key of the given algorithm with a self
+// signed certificate and writes both to the given files.
+func GenerateAuthority(keyfile string, certfile string, algorithm string, subject pkix.Name, validity time.Duration) (*x509.Certificate, error) {
+
+	var signer crypto.Signer
+	var key []byte
+	var err error
+
+	switch algorithm {
+	case Ed25519:
+		_, priv, _ := ed25519.GenerateKey(rand.Reader)
+		signer = priv
+		key, err = x509.MarshalPKCS8PrivateKey(priv)
+	case SM2:
+		var priv *sm2.PrivateKey
+		if priv, err = sm2.GenerateKey(); err == nil {
+			signer, key = priv, sm2.MarshalPKCS8PrivateKey(priv)
+		}
+	default:
+		return nil, &AlgorithmError{Algorithm: algorithm}
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	sn, _ := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	now := time.Now()
+
+	template := &x509.Certificate{
+		SerialNumber:          sn,
+		Subject:               subject,
+		NotBefore:             now,
+		NotAfter:              now.Add(validity),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign | x509.KeyUsageDigitalSignature,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+
+	var der []byte
+
+	if priv, ok := signer.(*sm2.PrivateKey); ok {
+		der, err = sm2.CreateCertificate(rand.Reader, template, template, priv.Public(), priv)
+	} else {
+		der, err = x509.CreateCertificate(rand.Reader, template, template, signer.Public(), signer)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	if err := os.WriteFile(keyfile, generatePem(PRIVATE, key), 0600); err != nil {
+		return nil, err
+	}
+
+	if err := os.WriteFile(certfile, generatePem(CERT, der), 0644); err != nil {
+		return nil, err
+	}
+
+	return sm2.ParseCertificate(der)
+}
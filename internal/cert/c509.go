@@ -0,0 +1,80 @@
+package cert
+
+import (
+	"crypto/x509"
+
+	"github.com/Cealgull/Verify/internal/proto"
+	"github.com/Cealgull/Verify/pkg/c509"
+)
+
+// isC509 reports whether data starts like the 11 item array of a C509
+// certificate, which no DER, PEM or base64 input does.
+func isC509(data []byte) bool {
+	return len(data) > 0 && data[0] == 0x8b
+}
+
+func decodeC509(data []byte) ([]*x509.Certificate, proto.VerifyError) {
+
+	cert, err := c509.Parse(data)
+
+	if err != nil {
+		return nil, &CertFormatError{}
+	}
+
+	return []*x509.Certificate{cert}, nil
+}
+
+// CheckC509 fails when the certificates the authority issues cannot be
+// encoded as C509, so callers can refuse before anything is signed.
+func (m *CertManager) CheckC509() proto.VerifyError {
+
+	if !c509.Issuable(m.Certificate()) {
+		return &C509ProfileError{}
+	}
+
+	return nil
+}
+
+// EncodeC509 re-encodes the leaf of a certificate bundle as C509. The
+// bundle is not verified.
+func EncodeC509(data []byte) ([]byte, proto.VerifyError) {
+
+	certs, verr := decodeBundle(data)
+
+	if verr != nil {
+		return nil, verr
+	}
+
+	out, err := c509.FromX509(certs[0])
+
+	if err != nil {
+		return nil, &C509ProfileError{}
+	}
+
+	return out, nil
+}
+
+// EncodeX509 returns the DER encoding of the leaf of a certificate bundle,
+// rebuilding it when the bundle is a C509 certificate.
+func EncodeX509(data []byte) ([]byte, proto.VerifyError) {
+
+	certs, verr := decodeBundle(data)
+
+	if verr != nil {
+		return nil, verr
+	}
+
+	return certs[0].Raw, nil
+}
+
+// EncodePEM is EncodeX509 with the PEM armor issued certificates use.
+func EncodePEM(data []byte) ([]byte, proto.VerifyError) {
+
+	der, verr := EncodeX509(data)
+
+	if verr != nil {
+		return nil, verr
+	}
+
+	return generatePem(CERT, der), nil
+}
@@ -1,6 +1,7 @@
 package cert
 
 import (
+	"fmt"
 	"net/http"
 
 	"github.com/Cealgull/Verify/internal/proto"
@@ -9,6 +10,11 @@ import (
 type CertDecodeError struct{}
 type CertFormatError struct{}
 type CertUnauthorizedError struct{}
+type CertRevokedError struct{}
+type BatchSizeError struct {
+	Limit int
+}
+type BatchDuplicateError struct{}
 type CertInternalError struct{}
 type PubDecodeError struct{}
 type PubFormatError struct{}
@@ -17,6 +23,16 @@ type BadRequestError struct{}
 type FileInternalError struct{}
 type FileFormatError struct{}
 type FileDecodeError struct{}
+type KeyMismatchError struct{}
+type SignerMissingError struct{}
+type AlgorithmError struct {
+	Algorithm string
+}
+type PairwiseDisabledError struct{}
+type AudienceFormatError struct{}
+type ProofInvalidError struct{}
+type PairwiseKeyError struct{}
+type C509ProfileError struct{}
 
 func (e *PubFormatError) Error() string {
 	return "PK: Public Key Decode Error."
@@ -123,6 +139,126 @@ func (e *CertUnauthorizedError) Message() *proto.ResponseMessage {
 	}
 }
 
+func (e *CertRevokedError) Error() string {
+	return "Cert: Certificate Has Been Revoked."
+}
+
+func (e *CertRevokedError) Status() int {
+	return http.StatusUnauthorized
+}
+
+func (e *CertRevokedError) Message() *proto.ResponseMessage {
+	return &proto.ResponseMessage{
+		Code:    "A0241",
+		Message: e.Error(),
+	}
+}
+
+func (e *BatchSizeError) Error() string {
+	return fmt.Sprintf("Cert: Batch Must Contain Between 1 and %d Public Keys.", e.Limit)
+}
+
+func (e *BatchSizeError) Status() int {
+	return http.StatusBadRequest
+}
+
+func (e *BatchSizeError) Message() *proto.ResponseMessage {
+	return &proto.ResponseMessage{
+		Code:    "C1004",
+		Message: e.Error(),
+	}
+}
+
+func (e *BatchDuplicateError) Error() string {
+	return "Cert: Batch Contains Duplicated Public Keys."
+}
+
+func (e *BatchDuplicateError) Status() int {
+	return http.StatusBadRequest
+}
+
+func (e *BatchDuplicateError) Message() *proto.ResponseMessage {
+	return &proto.ResponseMessage{
+		Code:    "C1005",
+		Message: e.Error(),
+	}
+}
+
+func (e *PairwiseDisabledError) Error() string {
+	return "Cert: Pairwise Certificates Are Not Enabled."
+}
+
+func (e *PairwiseDisabledError) Status() int {
+	return http.StatusNotImplemented
+}
+
+func (e *PairwiseDisabledError) Message() *proto.ResponseMessage {
+	return &proto.ResponseMessage{
+		Code:    "C1006",
+		Message: e.Error(),
+	}
+}
+
+func (e *AudienceFormatError) Error() string {
+	return "Cert: Audience Must Be An Origin Like https://forum.example.org."
+}
+
+func (e *AudienceFormatError) Status() int {
+	return http.StatusBadRequest
+}
+
+func (e *AudienceFormatError) Message() *proto.ResponseMessage {
+	return &proto.ResponseMessage{
+		Code:    "C1007",
+		Message: e.Error(),
+	}
+}
+
+func (e *ProofInvalidError) Error() string {
+	return "Cert: Issuance Proof Not Signed By The Master Key."
+}
+
+func (e *ProofInvalidError) Status() int {
+	return http.StatusUnauthorized
+}
+
+func (e *ProofInvalidError) Message() *proto.ResponseMessage {
+	return &proto.ResponseMessage{
+		Code:    "C1008",
+		Message: e.Error(),
+	}
+}
+
+func (e *PairwiseKeyError) Error() string {
+	return "Cert: Pairwise Key Must Not Be A Registered Master Key."
+}
+
+func (e *PairwiseKeyError) Status() int {
+	return http.StatusBadRequest
+}
+
+func (e *PairwiseKeyError) Message() *proto.ResponseMessage {
+	return &proto.ResponseMessage{
+		Code:    "C1009",
+		Message: e.Error(),
+	}
+}
+
+func (e *C509ProfileError) Error() string {
+	return "Cert: Certificate Not Representable As C509."
+}
+
+func (e *C509ProfileError) Status() int {
+	return http.StatusNotAcceptable
+}
+
+func (e *C509ProfileError) Message() *proto.ResponseMessage {
+	return &proto.ResponseMessage{
+		Code:    "C1010",
+		Message: e.Error(),
+	}
+}
+
 func (e *FileInternalError) Error() string {
 	return "Filesystem: Internal Server Error."
 }
@@ -134,3 +270,15 @@ func (e *FileDecodeError) Error() string {
 func (e *FileFormatError) Error() string {
 	return "Filesystem: Pem Type Decode Error."
 }
+
+func (e *KeyMismatchError) Error() string {
+	return "Filesystem: Private Key Not Matched With Certificate."
+}
+
+func (e *SignerMissingError) Error() string {
+	return "Filesystem: Private Key Or Signer Missing."
+}
+
+func (e *AlgorithmError) Error() string {
+	return fmt.Sprintf("Filesystem: Unsupported Key Algorithm %s.", e.Algorithm)
+}
@@ -0,0 +1,89 @@
+package cert
+
+import (
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+
+	"github.com/Cealgull/Verify/internal/proto"
+	"github.com/Cealgull/Verify/pkg/sm2"
+)
+
+type JWK struct {
+	Kty     string   `json:"kty"`
+	Crv     string   `json:"crv"`
+	X       string   `json:"x"`
+	Y       string   `json:"y,omitempty"`
+	Kid     string   `json:"kid,omitempty"`
+	Use     string   `json:"use,omitempty"`
+	Alg     string   `json:"alg,omitempty"`
+	X5c     []string `json:"x5c,omitempty"`
+	X5tS256 string   `json:"x5t#S256,omitempty"`
+}
+
+type JWKSet struct {
+	Keys []JWK `json:"keys"`
+}
+
+func NewJWK(pub ed25519.PublicKey) *JWK {
+	return &JWK{
+		Kty: "OKP",
+		Crv: "Ed25519",
+		X:   base64.RawURLEncoding.EncodeToString(pub),
+	}
+}
+
+// NewSM2JWK describes an SM2 key as an elliptic curve key on the SM2
+// curve. JOSE registers neither the curve nor an algorithm for it.
+func NewSM2JWK(pub *sm2.PublicKey) *JWK {
+	x, y := pub.Point()
+	return &JWK{
+		Kty: "EC",
+		Crv: "SM2",
+		X:   base64.RawURLEncoding.EncodeToString(x),
+		Y:   base64.RawURLEncoding.EncodeToString(y),
+	}
+}
+
+// Thumbprint computes the RFC 7638 thumbprint over the required members.
+func (k *JWK) Thumbprint() string {
+	canonical := fmt.Sprintf(`{"crv":"%s","kty":"%s","x":"%s"}`, k.Crv, k.Kty, k.X)
+	if k.Kty == "EC" {
+		canonical = fmt.Sprintf(`{"crv":"%s","kty":"%s","x":"%s","y":"%s"}`, k.Crv, k.Kty, k.X, k.Y)
+	}
+	sum := sha256.Sum256([]byte(canonical))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+func (m *CertManager) JWKS() (*JWKSet, proto.VerifyError) {
+
+	m.mtx.RLock()
+	cert, chain := m.cert, m.chain
+	m.mtx.RUnlock()
+
+	var jwk *JWK
+
+	switch pub := cert.PublicKey.(type) {
+	case *sm2.PublicKey:
+		jwk = NewSM2JWK(pub)
+	case ed25519.PublicKey:
+		jwk = NewJWK(pub)
+		jwk.Alg = "EdDSA"
+	default:
+		m.logger.Errorf("No JWK form of the CA public key %T.", pub)
+		return nil, &CertInternalError{}
+	}
+
+	jwk.Kid = jwk.Thumbprint()
+	jwk.Use = "sig"
+
+	for _, c := range chain {
+		jwk.X5c = append(jwk.X5c, base64.StdEncoding.EncodeToString(c.Raw))
+	}
+
+	sum := sha256.Sum256(cert.Raw)
+	jwk.X5tS256 = base64.RawURLEncoding.EncodeToString(sum[:])
+
+	return &JWKSet{Keys: []JWK{*jwk}}, nil
+}
@@ -1,30 +1,64 @@
 package cert
 
 import (
+	"bytes"
+	"crypto"
 	"crypto/ed25519"
 	"crypto/rand"
 	"crypto/sha256"
 	"crypto/x509"
 	"crypto/x509/pkix"
 	"encoding/base64"
+	"encoding/hex"
 	"encoding/pem"
+	"fmt"
 	"io"
 	"math/big"
 	"os"
+	"sort"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/Cealgull/Verify/internal/cache"
+	"github.com/Cealgull/Verify/internal/federation"
+	"github.com/Cealgull/Verify/internal/policy"
 	"github.com/Cealgull/Verify/internal/proto"
+	"github.com/Cealgull/Verify/pkg/sm2"
 	"go.uber.org/zap"
 )
 
+// Subject organization and units of the certificates the CA issues.
+const (
+	SubjectOrganization = "Cealgull"
+	UnitProject         = "Cealgull Project"
+	UnitPairwise        = "Cealgull Pairwise"
+)
+
 type CertManager struct {
 	logger     *zap.SugaredLogger
-	priv       ed25519.PrivateKey
+	mtx        sync.RWMutex
+	priv       crypto.Signer
+	signer     crypto.Signer
+	external   bool
 	cert       *x509.Certificate
+	chain      []*x509.Certificate
+	anchors    []*x509.Certificate
+	privfile   string
+	certfile   string
 	cache      cache.Cache
 	version    byte
 	expiration time.Duration
+	batch      int
+	policy     *policy.Policy
+	federation *federation.Registry
+	pairwise   []byte
+}
+
+type BatchCert struct {
+	Pub  string
+	Cert []byte
+	Err  proto.VerifyError
 }
 
 const (
@@ -50,6 +84,32 @@ func loadPem(data []byte, ftype string) ([]byte, error) {
 	return p.Bytes, nil
 }
 
+func loadPemChain(data []byte, ftype string) ([][]byte, error) {
+
+	var blocks [][]byte
+
+	for {
+		p, rest := pem.Decode(data)
+
+		if p == nil {
+			break
+		}
+
+		if p.Type != ftype {
+			return nil, &FileFormatError{}
+		}
+
+		blocks = append(blocks, p.Bytes)
+		data = rest
+	}
+
+	if len(blocks) == 0 {
+		return nil, &FileDecodeError{}
+	}
+
+	return blocks, nil
+}
+
 func loadPemFromDisk(file string, ftype string) ([]byte, error) {
 
 	f, err := os.Open(file)
@@ -71,21 +131,100 @@ func generatePem(ftype string, data []byte) []byte {
 	return pem.EncodeToMemory(p)
 }
 
-func WithPrivateKey(file string) Option {
-	return func(mgr *CertManager) error {
-		b, err := loadPemFromDisk(file, PRIVATE)
+// LoadPrivateKey loads an ed25519 private key. Keys of other algorithms,
+// SM2 included, fail with an AlgorithmError.
+func LoadPrivateKey(file string) (ed25519.PrivateKey, error) {
+
+	b, err := loadPemFromDisk(file, PRIVATE)
+
+	if err != nil {
+		return nil, err
+	}
+
+	priv, err := x509.ParsePKCS8PrivateKey(b)
+
+	if err != nil {
+		if _, serr := sm2.ParsePKCS8PrivateKey(b); serr == nil {
+			return nil, &AlgorithmError{Algorithm: SM2}
+		}
+		return nil, err
+	}
+
+	key, ok := priv.(ed25519.PrivateKey)
+
+	if !ok {
+		return nil, &AlgorithmError{Algorithm: fmt.Sprintf("%T", priv)}
+	}
+
+	return key, nil
+}
+
+// LoadSigner loads a CA private key, either ed25519 or SM2.
+func LoadSigner(file string) (crypto.Signer, error) {
+
+	b, err := loadPemFromDisk(file, PRIVATE)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if priv, err := x509.ParsePKCS8PrivateKey(b); err == nil {
+		if priv, ok := priv.(ed25519.PrivateKey); ok {
+			return priv, nil
+		}
+		return nil, &FileFormatError{}
+	}
+
+	priv, err := sm2.ParsePKCS8PrivateKey(b)
+
+	if err != nil {
+		return nil, &FileFormatError{}
+	}
+
+	return priv, nil
+}
+
+func LoadCertificateChain(file string) ([]*x509.Certificate, error) {
+
+	b, err := os.ReadFile(file)
+
+	if err != nil {
+		return nil, &FileInternalError{}
+	}
+
+	blocks, err := loadPemChain(b, CERT)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var chain []*x509.Certificate
+
+	for _, block := range blocks {
+
+		cert, err := sm2.ParseCertificate(block)
 
 		if err != nil {
-			return err
+			return nil, err
 		}
 
-		priv, err := x509.ParsePKCS8PrivateKey(b)
+		chain = append(chain, cert)
+	}
+
+	return chain, nil
+}
+
+func WithPrivateKey(file string) Option {
+	return func(mgr *CertManager) error {
+
+		priv, err := LoadSigner(file)
 
 		if err != nil {
 			return err
 		}
 
-		mgr.priv = priv.(ed25519.PrivateKey)
+		mgr.priv = priv
+		mgr.privfile = file
 		return nil
 
 	}
@@ -93,23 +232,46 @@ func WithPrivateKey(file string) Option {
 
 func WithCertificate(file string) Option {
 	return func(mgr *CertManager) error {
-		b, err := loadPemFromDisk(file, CERT)
+
+		chain, err := LoadCertificateChain(file)
+
 		if err != nil {
 			return err
 		}
 
-		cert, err := x509.ParseCertificate(b)
+		mgr.cert = chain[0]
+		mgr.chain = chain
+		mgr.certfile = file
+
+		return nil
+	}
+}
+
+// WithTrustAnchors adds the certificates in file as roots that presented
+// chains may terminate at, besides the certificate of the manager itself.
+func WithTrustAnchors(file string) Option {
+	return func(mgr *CertManager) error {
+
+		anchors, err := LoadCertificateChain(file)
 
 		if err != nil {
 			return err
 		}
 
-		mgr.cert = cert
+		mgr.anchors = append(mgr.anchors, anchors...)
 
 		return nil
 	}
 }
 
+func WithSigner(signer crypto.Signer) Option {
+	return func(mgr *CertManager) error {
+		mgr.signer = signer
+		mgr.external = true
+		return nil
+	}
+}
+
 func WithVersion(ver byte) Option {
 	return func(mgr *CertManager) error {
 		mgr.version = ver
@@ -124,6 +286,33 @@ func WithExpiration(t int64) Option {
 	}
 }
 
+func WithBatchLimit(n int) Option {
+	return func(mgr *CertManager) error {
+		if n > 0 {
+			mgr.batch = n
+		}
+		return nil
+	}
+}
+
+// WithPolicy evaluates the issuance rules of p before every certificate
+// is signed.
+func WithPolicy(p *policy.Policy) Option {
+	return func(mgr *CertManager) error {
+		mgr.policy = p
+		return nil
+	}
+}
+
+// WithFederation also accepts certificates issued by the partner
+// authorities of the trust bundles held in r.
+func WithFederation(r *federation.Registry) Option {
+	return func(mgr *CertManager) error {
+		mgr.federation = r
+		return nil
+	}
+}
+
 func WithCache(c cache.Cache) Option {
 	return func(mgr *CertManager) error {
 		mgr.cache = c
@@ -137,6 +326,7 @@ func NewCertManager(logger *zap.SugaredLogger, options ...Option) (*CertManager,
 		logger:     logger,
 		expiration: time.Duration(10),
 		version:    0x01,
+		batch:      16,
 	}
 
 	for _, option := range options {
@@ -146,6 +336,14 @@ func NewCertManager(logger *zap.SugaredLogger, options ...Option) (*CertManager,
 		}
 	}
 
+	if !mgr.external && mgr.priv != nil {
+		mgr.signer = mgr.priv
+	}
+
+	if mgr.signer == nil {
+		return nil, &SignerMissingError{}
+	}
+
 	return mgr, nil
 }
 
@@ -179,9 +377,11 @@ func (m *CertManager) pubToAddress(pub []byte) string {
 
 }
 
-func (m *CertManager) createCertificate(s string) ([]byte, proto.VerifyError) {
+func (m *CertManager) Address(pub []byte) string {
+	return "0x" + m.pubToAddress(pub)
+}
 
-	var pub ed25519.PublicKey
+func (m *CertManager) decodePub(s string) (ed25519.PublicKey, proto.VerifyError) {
 
 	pub, err := base64.StdEncoding.DecodeString(s)
 
@@ -190,60 +390,189 @@ func (m *CertManager) createCertificate(s string) ([]byte, proto.VerifyError) {
 		return nil, &PubDecodeError{}
 	}
 
-	if len(pub) != 32 {
+	if len(pub) != ed25519.PublicKeySize {
 		m.logger.Debugf("Invalid ed25519 public key size: %s.", s)
 		return nil, &PubFormatError{}
 	}
 
-	sn := new(big.Int)
-	sn = sn.Lsh(big.NewInt(1), 512)
-	sn, _ = rand.Int(rand.Reader, sn)
+	return pub, nil
+}
+
+func (m *CertManager) createCertificate(s string, resign bool, exts ...pkix.Extension) ([]byte, *policy.Request, proto.VerifyError) {
+
+	pub, verr := m.decodePub(s)
+
+	if verr != nil {
+		return nil, nil, verr
+	}
 
 	address := m.pubToAddress(pub)
 	m.logger.Infof("Signing certificate for public andress: 0x%s.", address)
 
 	template := &x509.Certificate{
-		SerialNumber: sn,
 		Subject: pkix.Name{
 			CommonName:         "0x" + address,
-			Organization:       []string{"Cealgull"},
-			OrganizationalUnit: []string{"Cealgull Project"},
+			Organization:       []string{SubjectOrganization},
+			OrganizationalUnit: []string{UnitProject},
 		},
-		Issuer:    m.cert.Subject,
-		NotBefore: time.Now(),
+		ExtraExtensions: exts,
 	}
 
-	cert, err := x509.CreateCertificate(rand.Reader, template, m.cert, pub, m.priv)
+	cert, req, verr := m.issue(pub, template, resign)
+
+	if verr != nil {
+		return nil, nil, verr
+	}
+
+	m.logger.Infof("Signing Completed for address: 0x%s.", address)
+
+	return cert, req, nil
+}
+
+// algorithm names the algorithm of a key for the issuance policy.
+func algorithm(key crypto.PublicKey) string {
+	switch key.(type) {
+	case ed25519.PublicKey:
+		return policy.Ed25519
+	case *sm2.PublicKey:
+		return policy.SM2
+	}
+	return ""
+}
+
+// issue completes the template with a random serial and the issuer and
+// signs it for pub once the issuance policy allows it. The quota counted
+// by the policy is given back when signing fails, otherwise the evaluated
+// request is returned for callers failing afterwards, nil without a
+// policy.
+func (m *CertManager) issue(pub ed25519.PublicKey, template *x509.Certificate, resign bool) ([]byte, *policy.Request, proto.VerifyError) {
+
+	m.mtx.RLock()
+	issuer, signer := m.cert, m.signer
+	m.mtx.RUnlock()
+
+	var req *policy.Request
+
+	if m.policy != nil {
+		req = &policy.Request{Pub: pub, Algorithm: algorithm(pub), Signature: algorithm(signer.Public()), Resign: resign}
+		if err := m.policy.Evaluate(req); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	sn := new(big.Int)
+	sn = sn.Lsh(big.NewInt(1), 512)
+	sn, _ = rand.Int(rand.Reader, sn)
+
+	template.SerialNumber = sn
+	template.Issuer = issuer.Subject
+	template.NotBefore = time.Now()
+
+	var cert []byte
+	var err error
+
+	if key, ok := signer.(*sm2.PrivateKey); ok {
+		cert, err = sm2.CreateCertificate(rand.Reader, template, issuer, pub, key)
+	} else {
+		cert, err = x509.CreateCertificate(rand.Reader, template, issuer, pub, signer)
+	}
 
 	if err != nil {
 		m.logger.Debugf("Error when creating certificates. err: %s", err.Error())
-		return nil, &CertInternalError{}
+		m.release(req)
+		return nil, nil, &CertInternalError{}
 	}
 
-	m.logger.Infof("Signing Completed for address: 0x%s.", address)
+	return generatePem(CERT, cert), req, nil
+}
 
-	return generatePem(CERT, cert), nil
+// release gives back the quota of issued requests whose certificates are
+// not handed out.
+func (m *CertManager) release(reqs ...*policy.Request) {
+	for _, req := range reqs {
+		if req != nil {
+			m.policy.Release(req)
+		}
+	}
 }
 
-func (m *CertManager) SignCSR(s string) ([]byte, proto.VerifyError) {
+func (m *CertManager) SignCSR(s string, exts ...pkix.Extension) ([]byte, proto.VerifyError) {
 
 	m.logger.Infof("Signing Certificate for public key: %s.", s)
 
-	cert, err := m.createCertificate(s)
+	cert, req, err := m.createCertificate(s, false, exts...)
 
 	if err != nil {
 		return nil, err
 	}
 
 	if err := m.cache.SAdd("pub", s); err != nil {
-		m.logger.Errorf("Redis failure happened when signing %s. err: %s.", err.Error())
+		m.logger.Errorf("Redis failure happened when signing %s. err: %s.", s, err.Error())
+		m.release(req)
 		return nil, &CertInternalError{}
 	}
 
 	return cert, nil
 }
 
-func (m *CertManager) ResignCSR(s string) ([]byte, proto.VerifyError) {
+// CanonicalBatch returns the message a ring signature over a batch of public
+// keys must cover: the keys sorted and joined by newlines.
+func (m *CertManager) CanonicalBatch(pubs []string) (string, proto.VerifyError) {
+
+	if len(pubs) == 0 || len(pubs) > m.batch {
+		m.logger.Debugf("Batch size %d out of the limit %d.", len(pubs), m.batch)
+		return "", &BatchSizeError{m.batch}
+	}
+
+	sorted := make([]string, len(pubs))
+	copy(sorted, pubs)
+	sort.Strings(sorted)
+
+	for i := 1; i < len(sorted); i++ {
+		if sorted[i] == sorted[i-1] {
+			m.logger.Debugf("Duplicated public key in batch: %s.", sorted[i])
+			return "", &BatchDuplicateError{}
+		}
+	}
+
+	return strings.Join(sorted, "\n"), nil
+}
+
+func (m *CertManager) SignCSRBatch(pubs []string) ([]*BatchCert, proto.VerifyError) {
+
+	if _, err := m.CanonicalBatch(pubs); err != nil {
+		return nil, err
+	}
+
+	m.logger.Infof("Signing certificate batch of %d public keys.", len(pubs))
+
+	certs := make([]*BatchCert, len(pubs))
+	var signed []string
+	var reqs []*policy.Request
+
+	for i, s := range pubs {
+		cert, req, err := m.createCertificate(s, false)
+		certs[i] = &BatchCert{Pub: s, Cert: cert, Err: err}
+		if err == nil {
+			signed = append(signed, s)
+			reqs = append(reqs, req)
+		}
+	}
+
+	if len(signed) == 0 {
+		return certs, nil
+	}
+
+	if err := m.cache.SAdd("pub", signed...); err != nil {
+		m.logger.Errorf("Redis failure happened when signing batch. err: %s.", err.Error())
+		m.release(reqs...)
+		return nil, &CertInternalError{}
+	}
+
+	return certs, nil
+}
+
+func (m *CertManager) ResignCSR(s string, exts ...pkix.Extension) ([]byte, proto.VerifyError) {
 
 	valid, err := m.cache.SIsmember("pub", s)
 
@@ -259,38 +588,278 @@ func (m *CertManager) ResignCSR(s string) ([]byte, proto.VerifyError) {
 
 	m.logger.Infof("Resigning Certificate for public key: %s.", s)
 
-	return m.createCertificate(s)
+	cert, _, verr := m.createCertificate(s, true, exts...)
+
+	return cert, verr
 
 }
 
-func (m *CertManager) VerifyCert(data []byte) (bool, proto.VerifyError) {
+func (m *CertManager) Revoke(cert *x509.Certificate) proto.VerifyError {
 
-	b, err := loadPem(data, CERT)
+	serial := cert.SerialNumber.Text(16)
 
-	m.logger.Info("Responding to new certificate verification request.")
+	m.logger.Infof("Revoking certificate with serial: %s.", serial)
 
-	if _, ok := err.(*FileFormatError); ok {
-		m.logger.Debug("Wrong certficate pem format when verifying.")
-		return false, &CertFormatError{}
-	} else if _, ok := err.(*FileDecodeError); ok {
-		m.logger.Debug("Error when decoding certificate pem body.")
-		return false, &CertDecodeError{}
+	if err := m.cache.SAdd("revoked", serial); err != nil {
+		m.logger.Errorf("Redis failure happened when revoking %s. err: %s.", serial, err.Error())
+		return &CertInternalError{}
 	}
 
-	cert, err := x509.ParseCertificate(b)
+	return nil
+}
+
+func (m *CertManager) isRevoked(cert *x509.Certificate) (bool, proto.VerifyError) {
+
+	revoked, err := m.cache.SIsmember("revoked", cert.SerialNumber.Text(16))
+
+	if _, ok := err.(*cache.KeyError); ok {
+		return false, nil
+	}
 
 	if err != nil {
-		m.logger.Debug("Error when loading certificate.")
-		return false, &CertFormatError{}
+		m.logger.Errorf("Redis failure happened when checking revocation. err: %s.", err.Error())
+		return false, &CertInternalError{}
 	}
 
-	if err := cert.CheckSignatureFrom(m.cert); err != nil {
-		m.logger.Debug("Certificate is not signed by the current host.")
-		return false, &CertUnauthorizedError{}
+	return revoked, nil
+}
+
+func (m *CertManager) Certificate() *x509.Certificate {
+	m.mtx.RLock()
+	defer m.mtx.RUnlock()
+	return m.cert
+}
+
+func (m *CertManager) Chain() []*x509.Certificate {
+	m.mtx.RLock()
+	defer m.mtx.RUnlock()
+	return m.chain
+}
+
+func (m *CertManager) Fingerprint() string {
+	sum := sha256.Sum256(m.Certificate().Raw)
+	return hex.EncodeToString(sum[:])
+}
+
+func decodePemBundle(data []byte) ([]*x509.Certificate, proto.VerifyError) {
+
+	blocks, err := loadPemChain(data, CERT)
+
+	if _, ok := err.(*FileFormatError); ok {
+		return nil, &CertFormatError{}
+	} else if err != nil {
+		return nil, &CertDecodeError{}
+	}
+
+	var certs []*x509.Certificate
+
+	for _, block := range blocks {
+
+		cert, err := sm2.ParseCertificate(block)
+
+		if err != nil {
+			return nil, &CertFormatError{}
+		}
+
+		certs = append(certs, cert)
+	}
+
+	return certs, nil
+}
+
+// decodeBundle detects whether data is a PEM bundle, raw DER, base64
+// encoded DER or a C509 certificate and returns the certificates in it,
+// leaf first.
+func decodeBundle(data []byte) ([]*x509.Certificate, proto.VerifyError) {
+
+	der := data
+
+	if isC509(data) {
+		return decodeC509(data)
+	}
+
+	// DER always starts with the SEQUENCE tag, which is not a PEM or base64
+	// character, so it is parsed as is before any whitespace is trimmed.
+	if len(der) == 0 || der[0] != 0x30 {
+
+		trimmed := bytes.TrimSpace(data)
+
+		if bytes.HasPrefix(trimmed, []byte("-----BEGIN")) {
+			return decodePemBundle(trimmed)
+		}
+
+		var err error
+
+		der, err = base64.StdEncoding.DecodeString(strings.Join(strings.Fields(string(trimmed)), ""))
+
+		if err != nil || len(der) == 0 {
+			return nil, &CertDecodeError{}
+		}
+	}
+
+	certs, err := sm2.ParseCertificates(der)
+
+	if err != nil || len(certs) == 0 {
+		return nil, &CertFormatError{}
+	}
+
+	return certs, nil
+}
+
+// verifyPath walks from the leaf through the presented intermediates until
+// one of the anchors signs the current certificate and returns its index.
+// The walk is done by hand because issued leaves carry no expiry, which
+// x509.Verify rejects.
+func verifyPath(leaf *x509.Certificate, intermediates []*x509.Certificate, anchors []*x509.Certificate) int {
+
+	now := time.Now()
+	used := make([]bool, len(intermediates))
+	current := leaf
+
+	for depth := 0; depth <= len(intermediates); depth++ {
+
+		for i, anchor := range anchors {
+			if sm2.CheckSignatureFrom(current, anchor) == nil {
+				return i
+			}
+		}
+
+		next := -1
+
+		for i, c := range intermediates {
+
+			if used[i] || now.Before(c.NotBefore) || now.After(c.NotAfter) {
+				continue
+			}
+
+			if bytes.Equal(c.RawSubject, current.RawIssuer) && sm2.CheckSignatureFrom(current, c) == nil {
+				next = i
+				break
+			}
+		}
+
+		if next < 0 {
+			return -1
+		}
+
+		used[next] = true
+		current = intermediates[next]
+	}
+
+	return -1
+}
+
+// Organization names the owner of the certificate authority, falling back
+// to its common name.
+func (m *CertManager) Organization() string {
+	return organization(m.Certificate())
+}
+
+func organization(c *x509.Certificate) string {
+	if len(c.Subject.Organization) > 0 {
+		return c.Subject.Organization[0]
+	}
+	return c.Subject.CommonName
+}
+
+// verifyIssuer verifies the leaf of a bundle against the local trust anchors
+// and, when federated is set, the partner authorities, returning the
+// organization which issued it.
+func (m *CertManager) verifyIssuer(data []byte, federated bool) (*x509.Certificate, string, proto.VerifyError) {
+
+	m.logger.Info("Responding to new certificate verification request.")
+
+	certs, verr := decodeBundle(data)
+
+	if verr != nil {
+		m.logger.Debugf("Error when decoding certificate bundle. err: %s", verr.Error())
+		return nil, "", verr
+	}
+
+	cert := certs[0]
+
+	anchors := append([]*x509.Certificate{m.Certificate()}, m.anchors...)
+
+	if verifyPath(cert, certs[1:], anchors) < 0 {
+
+		if federated {
+			return m.verifyFederated(cert, certs[1:])
+		}
+
+		m.logger.Debug("Certificate does not chain to a trust anchor.")
+		return nil, "", &CertUnauthorizedError{}
+	}
+
+	revoked, verr := m.isRevoked(cert)
+
+	if verr != nil {
+		return nil, "", verr
+	}
+
+	if revoked {
+		m.logger.Debugf("Certificate with serial %s has been revoked.", cert.SerialNumber.Text(16))
+		return nil, "", &CertRevokedError{}
 	}
 
 	m.logger.Info("Certificate verification success.")
 
-	return true, nil
+	return cert, m.Organization(), nil
+}
+
+// verifyFederated checks certificates from partner deployments. Their serials
+// are not tracked by the local revocation list but by the partner bundle.
+func (m *CertManager) verifyFederated(cert *x509.Certificate, intermediates []*x509.Certificate) (*x509.Certificate, string, proto.VerifyError) {
+
+	if m.federation == nil {
+		m.logger.Debug("Certificate does not chain to a trust anchor.")
+		return nil, "", &CertUnauthorizedError{}
+	}
+
+	federated := m.federation.Anchors()
+	anchors := make([]*x509.Certificate, len(federated))
+
+	for i, a := range federated {
+		anchors[i] = a.Certificate
+	}
+
+	i := verifyPath(cert, intermediates, anchors)
+
+	if i < 0 {
+		m.logger.Debug("Certificate does not chain to a trust anchor or federated partner.")
+		return nil, "", &CertUnauthorizedError{}
+	}
+
+	if federated[i].Revoked(cert) {
+		m.logger.Debugf("Federated certificate with serial %s has been revoked.", cert.SerialNumber.Text(16))
+		return nil, "", &CertRevokedError{}
+	}
+
+	m.logger.Infof("Certificate verification success for federated partner %s.", federated[i].Organization)
+
+	return cert, federated[i].Organization, nil
+}
+
+// VerifiedCert accepts a single certificate or a bundle in PEM, DER or
+// base64 DER form and verifies its leaf, the first certificate, against the
+// local trust anchors using the other certificates as intermediates.
+// Certificates of federated partners are not accepted here, as the callers
+// grant local identities based on the result.
+func (m *CertManager) VerifiedCert(data []byte) (*x509.Certificate, proto.VerifyError) {
+	cert, _, err := m.verifyIssuer(data, false)
+	return cert, err
+}
+
+// VerifyCert verifies the certificate like VerifiedCert, additionally
+// trusting federated partners, and returns the organization of the
+// authority that issued it.
+func (m *CertManager) VerifyCert(data []byte) (string, proto.VerifyError) {
+
+	_, org, err := m.verifyIssuer(data, true)
+
+	if err != nil {
+		return "", err
+	}
+
+	return org, nil
 
 }
@@ -0,0 +1,138 @@
+package cert
+
+import (
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"net/url"
+	"strings"
+
+	"github.com/Cealgull/Verify/internal/proto"
+)
+
+// WithPairwiseSecret enables pairwise certificates. The secret keys the
+// derivation of pseudonymous addresses, so relying parties holding the
+// master certificate cannot compute them, and must stay fixed to keep
+// the pseudonyms stable.
+func WithPairwiseSecret(secret string) Option {
+	return func(mgr *CertManager) error {
+		if secret != "" {
+			mgr.pairwise = []byte(secret)
+		}
+		return nil
+	}
+}
+
+// Audience normalizes a relying party identifier to its origin.
+func Audience(s string) (string, proto.VerifyError) {
+
+	u, err := url.Parse(s)
+
+	if err != nil || u.Scheme == "" || u.Host == "" || u.User != nil ||
+		(u.Path != "" && u.Path != "/") || u.RawQuery != "" || u.Fragment != "" {
+		return "", &AudienceFormatError{}
+	}
+
+	return strings.ToLower(u.Scheme) + "://" + strings.ToLower(u.Host), nil
+}
+
+// PairwiseMessage is what the master key signs to request a certificate
+// for key scoped to audience.
+func PairwiseMessage(audience string, key string) string {
+	return "cealgull-pairwise\n" + audience + "\n" + key
+}
+
+// PairwiseAddress derives the pseudonymous address of a master public key
+// for an audience.
+func (m *CertManager) PairwiseAddress(master []byte, audience string) string {
+	mac := hmac.New(sha256.New, m.pairwise)
+	mac.Write(master)
+	mac.Write([]byte{0})
+	mac.Write([]byte(audience))
+	return m.Address(mac.Sum(nil))
+}
+
+// SignPairwise issues a certificate for key under the pseudonym of master
+// towards audience. The registered master key must sign PairwiseMessage.
+func (m *CertManager) SignPairwise(master string, audience string, key string, sigb64 string) ([]byte, proto.VerifyError) {
+
+	if m.pairwise == nil {
+		return nil, &PairwiseDisabledError{}
+	}
+
+	aud, verr := Audience(audience)
+
+	if verr != nil {
+		m.logger.Debugf("Invalid pairwise audience: %s.", audience)
+		return nil, verr
+	}
+
+	mpub, verr := m.decodePub(master)
+
+	if verr != nil {
+		return nil, verr
+	}
+
+	pub, verr := m.decodePub(key)
+
+	if verr != nil {
+		return nil, verr
+	}
+
+	sig, err := base64.StdEncoding.DecodeString(sigb64)
+
+	if err != nil || !ed25519.Verify(mpub, []byte(PairwiseMessage(audience, key)), sig) {
+		m.logger.Debugf("Invalid pairwise issuance proof for public key: %s.", master)
+		return nil, &ProofInvalidError{}
+	}
+
+	registered, err := m.cache.SIsmember("pub", master)
+
+	if err != nil {
+		m.logger.Errorf("Redis failure happened when checking existence. err: %s.", err.Error())
+		return nil, &CertInternalError{}
+	}
+
+	if !registered {
+		m.logger.Debugf("Public Key: %s missing when signing pairwise certificate.", master)
+		return nil, &PubNotFoundError{}
+	}
+
+	// a pairwise key that is also a registered master key would link the
+	// pseudonym to that identity
+	if key == master {
+		return nil, &PairwiseKeyError{}
+	}
+
+	linked, err := m.cache.SIsmember("pub", key)
+
+	if err != nil {
+		m.logger.Errorf("Redis failure happened when checking existence. err: %s.", err.Error())
+		return nil, &CertInternalError{}
+	}
+
+	if linked {
+		return nil, &PairwiseKeyError{}
+	}
+
+	address := m.PairwiseAddress(mpub, aud)
+	target, _ := url.Parse(aud)
+
+	m.logger.Infof("Signing pairwise certificate for address %s towards %s.", address, aud)
+
+	template := &x509.Certificate{
+		Subject: pkix.Name{
+			CommonName:         address,
+			Organization:       []string{SubjectOrganization},
+			OrganizationalUnit: []string{UnitPairwise},
+		},
+		URIs: []*url.URL{target},
+	}
+
+	cert, _, verr := m.issue(pub, template, false)
+
+	return cert, verr
+}
@@ -0,0 +1,125 @@
+package cert
+
+import (
+	"crypto"
+	"path/filepath"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// Reload reads the key and certificate files again and swaps them in only
+// when the key matches the certificate. On failure the manager keeps
+// serving with the material it already holds.
+func (m *CertManager) Reload() error {
+
+	if m.certfile == "" {
+		return &FileInternalError{}
+	}
+
+	m.logger.Info("Reloading the certificate authority material.")
+
+	chain, err := LoadCertificateChain(m.certfile)
+
+	if err != nil {
+		m.logger.Errorf("Failed loading certificate from %s. err: %s", m.certfile, err.Error())
+		return err
+	}
+
+	m.mtx.RLock()
+	priv, signer := m.priv, m.signer
+	m.mtx.RUnlock()
+
+	if m.privfile != "" {
+
+		if priv, err = LoadSigner(m.privfile); err != nil {
+			m.logger.Errorf("Failed loading private key from %s. err: %s", m.privfile, err.Error())
+			return err
+		}
+
+		if !m.external {
+			signer = priv
+		}
+	}
+
+	if signer == nil || !keyMatches(signer.Public(), chain[0].PublicKey) {
+		m.logger.Error("Private key does not match the certificate, keeping the current material.")
+		return &KeyMismatchError{}
+	}
+
+	m.mtx.Lock()
+	m.priv, m.signer = priv, signer
+	m.cert, m.chain = chain[0], chain
+	m.mtx.Unlock()
+
+	m.logger.Infof("Certificate authority reloaded. fingerprint: %s", m.Fingerprint())
+
+	return nil
+}
+
+func keyMatches(pub crypto.PublicKey, certpub crypto.PublicKey) bool {
+	k, ok := pub.(interface{ Equal(crypto.PublicKey) bool })
+	return ok && k.Equal(certpub)
+}
+
+// Watch reloads the material whenever the directories holding the key or
+// the certificate change. Events are coalesced over the given delay so that
+// replacing both files triggers a single reload. Watching stops once stop
+// is closed.
+func (m *CertManager) Watch(delay time.Duration, stop <-chan struct{}) error {
+
+	watcher, err := fsnotify.NewWatcher()
+
+	if err != nil {
+		return err
+	}
+
+	dirs := make(map[string]bool)
+
+	for _, file := range []string{m.privfile, m.certfile} {
+		if file != "" {
+			dirs[filepath.Dir(file)] = true
+		}
+	}
+
+	for dir := range dirs {
+		if err := watcher.Add(dir); err != nil {
+			watcher.Close()
+			return err
+		}
+	}
+
+	go func() {
+
+		defer watcher.Close()
+
+		var timer *time.Timer
+
+		for {
+			select {
+			case <-stop:
+				if timer != nil {
+					timer.Stop()
+				}
+				return
+			case ev, ok := <-watcher.Events:
+				if !ok {
+					return
+				}
+				m.logger.Debugf("Certificate authority file event: %s.", ev.String())
+				if timer == nil {
+					timer = time.AfterFunc(delay, func() { _ = m.Reload() })
+				} else {
+					timer.Reset(delay)
+				}
+			case err, ok := <-watcher.Errors:
+				if !ok {
+					return
+				}
+				m.logger.Warnf("Certificate authority watcher error. err: %s", err.Error())
+			}
+		}
+	}()
+
+	return nil
+}
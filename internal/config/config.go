@@ -1,39 +1,140 @@
 package config
 
+// Dialer selects the mail backend, smtp unless set otherwise.
+type Dialer struct {
+	Backend    string `yaml:"backend"`
+	Host       string `yaml:"host"`
+	Port       int    `yaml:"port"`
+	From       string `yaml:"from"`
+	Todom      string `yaml:"todom"`
+	Secret     string `yaml:"secret"`
+	Subject    string `yaml:"subject"`
+	Sendmail   string `yaml:"sendmail"`
+	Maildir    string `yaml:"maildir"`
+	Endpoint   string `yaml:"endpoint"`
+	Token      string `yaml:"token"`
+	Encryption string `yaml:"encryption"`
+	Auth       string `yaml:"auth"`
+	Connect    int    `yaml:"connect"`
+	Send       int    `yaml:"send"`
+	Ca         string `yaml:"ca"`
+	Cert       string `yaml:"cert"`
+	Key        string `yaml:"key"`
+	Insecure   bool   `yaml:"insecure"`
+	Helo       string `yaml:"helo"`
+	Pool       int    `yaml:"pool"`
+	Idle       int    `yaml:"idle"`
+	Check      int    `yaml:"check"`
+	Dkim       struct {
+		Domain   string   `yaml:"domain"`
+		Selector string   `yaml:"selector"`
+		Key      string   `yaml:"key"`
+		Headers  []string `yaml:"headers"`
+	} `yaml:"dkim"`
+}
+
 type VerifyConfig struct {
 	Email struct {
-		Dialer struct {
-			Host    string `yaml:"host"`
-			Port    int    `yaml:"port"`
-			From    string `yaml:"from"`
-			Todom   string `yaml:"todom"`
-			Secret  string `yaml:"secret"`
-			Subject string `yaml:"subject"`
-		} `yaml:"dialer"`
-		Redis struct {
+		Dialer Dialer `yaml:"dialer"`
+		Redis  struct {
 			Host   string `yaml:"host"`
 			Port   int    `yaml:"port"`
 			User   string `yaml:"user"`
 			Secret string `yaml:"string"`
 			DB     int    `yaml:"db"`
 		} `yaml:"redis"`
-		Template string `yaml:"template"`
+		Template  string `yaml:"template"`
+		Templates struct {
+			Dir      string `yaml:"dir"`
+			Fallback string `yaml:"fallback"`
+		} `yaml:"templates"`
+		Link     string `yaml:"link"`
+		Mode     string `yaml:"mode"`
+		Secret   string `yaml:"secret"`
 		Accrule  string `yaml:"accrule"`
 		Coderule string `yaml:"coderule"`
+		Ttl      int    `yaml:"ttl"`
+		Cooldown int    `yaml:"cooldown"`
+		Lockout  struct {
+			Attempts int `yaml:"attempts"`
+			Base     int `yaml:"base"`
+			Ceiling  int `yaml:"ceiling"`
+		} `yaml:"lockout"`
+		Queue struct {
+			Workers int `yaml:"workers"`
+			Retries int `yaml:"retries"`
+			Backoff int `yaml:"backoff"`
+			Ceiling int `yaml:"ceiling"`
+		} `yaml:"queue"`
+		Domains []struct {
+			Name      string `yaml:"name"`
+			Accrule   string `yaml:"accrule"`
+			Subject   string `yaml:"subject"`
+			Template  string `yaml:"template"`
+			Templates string `yaml:"templates"`
+			Dialer    Dialer `yaml:"dialer"`
+		} `yaml:"domains"`
 	} `yaml:"email"`
 	Cert struct {
-		Priv string `yaml:"priv"`
-		Cert string `yaml:"cert"`
+		Priv     string `yaml:"priv"`
+		Cert     string `yaml:"cert"`
+		Anchors  string `yaml:"anchors"`
+		Maxage   int    `yaml:"maxage"`
+		Batch    int    `yaml:"batch"`
+		Pairwise string `yaml:"pairwise"`
 	} `yaml:"cert"`
+	Policy struct {
+		Resigns    int      `yaml:"resigns"`
+		Algorithms []string `yaml:"algorithms"`
+		Forbidden  []string `yaml:"forbidden"`
+		Windows    []string `yaml:"windows"`
+		Timezone   string   `yaml:"timezone"`
+		Epoch      int64    `yaml:"epoch"`
+		Cap        int      `yaml:"cap"`
+	} `yaml:"policy"`
+	Threshold struct {
+		Share   string   `yaml:"share"`
+		Group   string   `yaml:"group"`
+		Token   string   `yaml:"token"`
+		Signers []string `yaml:"signers"`
+	} `yaml:"threshold"`
 	Keyset struct {
 		NR_mem int `yaml:"nr_mem"`
 		Cap    int `yaml:"cap"`
 	} `yaml:"keyset"`
+	Acme struct {
+		Base string `yaml:"base"`
+		Ttl  int64  `yaml:"ttl"`
+	} `yaml:"acme"`
+	Federation struct {
+		Operators    []string `yaml:"operators"`
+		Dir          string   `yaml:"dir"`
+		Organization string   `yaml:"organization"`
+		Domain       string   `yaml:"domain"`
+	} `yaml:"federation"`
+	Credential struct {
+		Key    string `yaml:"key"`
+		Issuer string `yaml:"issuer"`
+		Group  string `yaml:"group"`
+		Epoch  int64  `yaml:"epoch"`
+	} `yaml:"credential"`
+	Fabric struct {
+		Caname string `yaml:"caname"`
+	} `yaml:"fabric"`
 	Turnstile struct {
 		Secret string `yaml:"secret"`
 	} `yaml:"turnstile"`
+	MSP struct {
+		Client  string `yaml:"client"`
+		Peer    string `yaml:"peer"`
+		Admin   string `yaml:"admin"`
+		Orderer string `yaml:"orderer"`
+		// Admincerts is a PEM bundle exported under admincerts
+		Admincerts string `yaml:"admincerts"`
+	} `yaml:"msp"`
 	Verify struct {
-		Host string `yaml:"host"`
-		Port int    `yaml:"port"`
+		Host  string `yaml:"host"`
+		Port  int    `yaml:"port"`
+		Admin string `yaml:"admin"`
 	} `yaml:"verify"`
 }
@@ -0,0 +1,124 @@
+package credential
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/Cealgull/Verify/internal/proto"
+)
+
+type SecretFormatError struct{}
+type PresentationFormatError struct{}
+type AttributeUnknownError struct {
+	Name string
+}
+type PresentationInvalidError struct{}
+type CredentialInternalError struct{}
+type NonceInvalidError struct{}
+type KeyMissingError struct{}
+type CacheMissingError struct{}
+type KeyFormatError struct {
+	File string
+}
+
+func (e *SecretFormatError) Error() string {
+	return "Credential: Holder Secret Must Be 32 Base64 Encoded Bytes."
+}
+
+func (e *SecretFormatError) Status() int {
+	return http.StatusBadRequest
+}
+
+func (e *SecretFormatError) Message() *proto.ResponseMessage {
+	return &proto.ResponseMessage{
+		Code:    "K1001",
+		Message: e.Error(),
+	}
+}
+
+func (e *PresentationFormatError) Error() string {
+	return "Credential: Presentation Malformed."
+}
+
+func (e *PresentationFormatError) Status() int {
+	return http.StatusBadRequest
+}
+
+func (e *PresentationFormatError) Message() *proto.ResponseMessage {
+	return &proto.ResponseMessage{
+		Code:    "K1002",
+		Message: e.Error(),
+	}
+}
+
+func (e *AttributeUnknownError) Error() string {
+	return fmt.Sprintf("Credential: Attribute %s Cannot Be Disclosed.", e.Name)
+}
+
+func (e *AttributeUnknownError) Status() int {
+	return http.StatusBadRequest
+}
+
+func (e *AttributeUnknownError) Message() *proto.ResponseMessage {
+	return &proto.ResponseMessage{
+		Code:    "K1003",
+		Message: e.Error(),
+	}
+}
+
+func (e *PresentationInvalidError) Error() string {
+	return "Credential: Presentation Verification Failure."
+}
+
+func (e *PresentationInvalidError) Status() int {
+	return http.StatusUnauthorized
+}
+
+func (e *PresentationInvalidError) Message() *proto.ResponseMessage {
+	return &proto.ResponseMessage{
+		Code:    "K1004",
+		Message: e.Error(),
+	}
+}
+
+func (e *CredentialInternalError) Error() string {
+	return "Credential: Internal Server Error."
+}
+
+func (e *CredentialInternalError) Status() int {
+	return http.StatusInternalServerError
+}
+
+func (e *CredentialInternalError) Message() *proto.ResponseMessage {
+	return &proto.ResponseMessage{
+		Code:    "K1005",
+		Message: e.Error(),
+	}
+}
+
+func (e *NonceInvalidError) Error() string {
+	return "Credential: Presentation Nonce Unknown Or Used."
+}
+
+func (e *NonceInvalidError) Status() int {
+	return http.StatusUnauthorized
+}
+
+func (e *NonceInvalidError) Message() *proto.ResponseMessage {
+	return &proto.ResponseMessage{
+		Code:    "K1006",
+		Message: e.Error(),
+	}
+}
+
+func (e *KeyMissingError) Error() string {
+	return "Credential: Issuer Key Missing."
+}
+
+func (e *KeyFormatError) Error() string {
+	return fmt.Sprintf("Credential: Issuer Key %s Malformed.", e.File)
+}
+
+func (e *CacheMissingError) Error() string {
+	return "Credential: Nonces Require A Cache."
+}
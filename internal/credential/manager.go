@@ -0,0 +1,382 @@
+package credential
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/pem"
+	"io"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/Cealgull/Verify/internal/cache"
+	"github.com/Cealgull/Verify/internal/proto"
+	"github.com/Cealgull/Verify/pkg/bbs"
+	"go.uber.org/zap"
+)
+
+const (
+	AttrSecret = "secret"
+	AttrIssuer = "issuer"
+	AttrGroup  = "group"
+	AttrEpoch  = "epoch"
+)
+
+const PRIVATE = "BBS PRIVATE KEY"
+
+// NonceTTL bounds how long a verifier nonce may wait for its presentation.
+const NonceTTL = 5 * time.Minute
+
+// Header is bound to every credential and names the attribute schema.
+var Header = []byte("cealgull-credential-v1")
+
+// Attributes lists the signed attributes in message order. The holder
+// secret is chosen by the holder and never disclosed, so a presentation
+// also proves the holder knows it.
+var Attributes = []string{AttrSecret, AttrIssuer, AttrGroup, AttrEpoch}
+
+type Credential struct {
+	Signature  string            `json:"signature"`
+	Attributes map[string]string `json:"attributes"`
+}
+
+type Presentation struct {
+	Proof     string            `json:"proof"`
+	Nonce     string            `json:"nonce"`
+	Disclosed map[string]string `json:"disclosed"`
+}
+
+type IssuerKey struct {
+	Key        string   `json:"key"`
+	Header     string   `json:"header"`
+	Attributes []string `json:"attributes"`
+}
+
+type Manager struct {
+	logger *zap.SugaredLogger
+	sk     *bbs.SecretKey
+	pk     *bbs.PublicKey
+	issuer string
+	group  string
+	epoch  int64
+	cache  cache.Cache
+	now    func() time.Time
+}
+
+type Option func(m *Manager) error
+
+func LoadKey(file string) (*bbs.SecretKey, error) {
+
+	data, err := os.ReadFile(file)
+
+	if err != nil {
+		return nil, err
+	}
+
+	block, _ := pem.Decode(data)
+
+	if block == nil || block.Type != PRIVATE {
+		return nil, &KeyFormatError{File: file}
+	}
+
+	var sk bbs.SecretKey
+
+	if err := sk.SetBytes(block.Bytes); err != nil {
+		return nil, &KeyFormatError{File: file}
+	}
+
+	return &sk, nil
+}
+
+// GenerateKey writes a fresh issuer key to file.
+func GenerateKey(file string) (*bbs.SecretKey, error) {
+
+	material := make([]byte, 32)
+
+	if _, err := io.ReadFull(rand.Reader, material); err != nil {
+		return nil, err
+	}
+
+	sk, err := bbs.KeyGen(material, Header)
+
+	if err != nil {
+		return nil, err
+	}
+
+	data := pem.EncodeToMemory(&pem.Block{Type: PRIVATE, Bytes: sk.Bytes()})
+
+	return sk, os.WriteFile(file, data, 0600)
+}
+
+func WithKey(file string) Option {
+	return func(m *Manager) error {
+		sk, err := LoadKey(file)
+		if err != nil {
+			return err
+		}
+		m.sk = sk
+		return nil
+	}
+}
+
+func WithSecretKey(sk *bbs.SecretKey) Option {
+	return func(m *Manager) error {
+		m.sk = sk
+		return nil
+	}
+}
+
+func WithIssuer(issuer string) Option {
+	return func(m *Manager) error {
+		m.issuer = issuer
+		return nil
+	}
+}
+
+func WithGroup(group string) Option {
+	return func(m *Manager) error {
+		m.group = group
+		return nil
+	}
+}
+
+// WithEpoch sets the length in seconds of an enrollment epoch.
+func WithEpoch(seconds int64) Option {
+	return func(m *Manager) error {
+		if seconds > 0 {
+			m.epoch = seconds
+		}
+		return nil
+	}
+}
+
+// WithCache stores the nonces handed out to verifiers in c.
+func WithCache(c cache.Cache) Option {
+	return func(m *Manager) error {
+		m.cache = c
+		return nil
+	}
+}
+
+func NewManager(logger *zap.SugaredLogger, options ...Option) (*Manager, error) {
+
+	m := &Manager{
+		logger: logger,
+		issuer: "Cealgull",
+		group:  "Cealgull Project",
+		epoch:  180 * 24 * 3600,
+		now:    time.Now,
+	}
+
+	for _, option := range options {
+		if err := option(m); err != nil {
+			return nil, err
+		}
+	}
+
+	if m.sk == nil {
+		return nil, &KeyMissingError{}
+	}
+
+	if m.cache == nil {
+		return nil, &CacheMissingError{}
+	}
+
+	m.pk = m.sk.PublicKey()
+
+	return m, nil
+}
+
+func (m *Manager) Key() *IssuerKey {
+	return &IssuerKey{
+		Key:        base64.StdEncoding.EncodeToString(m.pk.Bytes()),
+		Header:     string(Header),
+		Attributes: Attributes,
+	}
+}
+
+func messages(attrs map[string]string) [][]byte {
+	msgs := make([][]byte, len(Attributes))
+	for i, name := range Attributes {
+		msgs[i] = []byte(attrs[name])
+	}
+	return msgs
+}
+
+// Issue signs a credential over the holder secret and the attributes of
+// the current enrollment epoch.
+func (m *Manager) Issue(secret string) (*Credential, proto.VerifyError) {
+
+	raw, err := base64.StdEncoding.DecodeString(secret)
+
+	if err != nil || len(raw) != 32 {
+		m.logger.Debugf("Invalid credential holder secret.")
+		return nil, &SecretFormatError{}
+	}
+
+	attrs := map[string]string{
+		AttrSecret: secret,
+		AttrIssuer: m.issuer,
+		AttrGroup:  m.group,
+		AttrEpoch:  strconv.FormatInt(m.now().Unix()/m.epoch, 10),
+	}
+
+	sig, err := bbs.Sign(m.sk, m.pk, Header, messages(attrs))
+
+	if err != nil {
+		m.logger.Errorf("Failed signing credential. err: %s", err.Error())
+		return nil, &CredentialInternalError{}
+	}
+
+	m.logger.Infof("Issued credential for epoch %s.", attrs[AttrEpoch])
+
+	return &Credential{
+		Signature:  base64.StdEncoding.EncodeToString(sig.Bytes()),
+		Attributes: attrs,
+	}, nil
+}
+
+// disclosure maps attribute names to their message indexes in ascending
+// order. The holder secret can never be disclosed.
+func disclosure(names map[string]string) ([]int, proto.VerifyError) {
+
+	var indexes []int
+
+	for i, name := range Attributes {
+		if _, ok := names[name]; ok && name != AttrSecret {
+			indexes = append(indexes, i)
+		}
+	}
+
+	if len(indexes) != len(names) {
+		for name := range names {
+			return nil, &AttributeUnknownError{Name: name}
+		}
+	}
+
+	return indexes, nil
+}
+
+// Present derives a presentation of cred disclosing only the named
+// attributes, bound to the nonce of the verifier.
+func Present(key *IssuerKey, cred *Credential, nonce string, disclose ...string) (*Presentation, error) {
+
+	var pk bbs.PublicKey
+	var sig bbs.Signature
+
+	raw, err := base64.StdEncoding.DecodeString(key.Key)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if err := pk.SetBytes(raw); err != nil {
+		return nil, err
+	}
+
+	raw, err = base64.StdEncoding.DecodeString(cred.Signature)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if err := sig.SetBytes(raw); err != nil {
+		return nil, err
+	}
+
+	disclosed := make(map[string]string, len(disclose))
+
+	for _, name := range disclose {
+		disclosed[name] = cred.Attributes[name]
+	}
+
+	indexes, verr := disclosure(disclosed)
+
+	if verr != nil {
+		return nil, verr
+	}
+
+	proof, err := bbs.ProofGen(&pk, &sig, Header, []byte(nonce), messages(cred.Attributes), indexes, rand.Reader)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &Presentation{
+		Proof:     base64.StdEncoding.EncodeToString(proof),
+		Nonce:     nonce,
+		Disclosed: disclosed,
+	}, nil
+}
+
+// Nonce hands out a single use nonce a presentation must be bound to.
+func (m *Manager) Nonce() (string, proto.VerifyError) {
+
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	nonce := base64.RawURLEncoding.EncodeToString(b)
+
+	if err := m.cache.Set("credential:nonce:"+nonce, "1", NonceTTL); err != nil {
+		m.logger.Errorf("Redis failure happened when creating nonce. err: %s.", err.Error())
+		return "", &CredentialInternalError{}
+	}
+
+	return nonce, nil
+}
+
+func (m *Manager) useNonce(nonce string) proto.VerifyError {
+
+	if nonce == "" {
+		return &NonceInvalidError{}
+	}
+
+	value, err := m.cache.GetDel("credential:nonce:" + nonce)
+
+	if _, ok := err.(*cache.KeyError); ok || err == nil && value == "" {
+		return &NonceInvalidError{}
+	}
+
+	if err != nil {
+		m.logger.Errorf("Redis failure happened when consuming nonce. err: %s.", err.Error())
+		return &CredentialInternalError{}
+	}
+
+	return nil
+}
+
+// Verify checks a presentation bound to a nonce from Nonce, which it uses
+// up, and returns the disclosed attributes.
+func (m *Manager) Verify(p *Presentation) (map[string]string, proto.VerifyError) {
+
+	proof, err := base64.StdEncoding.DecodeString(p.Proof)
+
+	if err != nil {
+		return nil, &PresentationFormatError{}
+	}
+
+	indexes, verr := disclosure(p.Disclosed)
+
+	if verr != nil {
+		return nil, verr
+	}
+
+	if err := m.useNonce(p.Nonce); err != nil {
+		m.logger.Debugf("Credential presentation with unknown nonce %s.", p.Nonce)
+		return nil, err
+	}
+
+	msgs := make([][]byte, len(indexes))
+
+	for k, i := range indexes {
+		msgs[k] = []byte(p.Disclosed[Attributes[i]])
+	}
+
+	if err := bbs.ProofVerify(m.pk, proof, Header, []byte(p.Nonce), msgs, indexes); err != nil {
+		m.logger.Debugf("Credential presentation rejected. err: %s", err.Error())
+		return nil, &PresentationInvalidError{}
+	}
+
+	m.logger.Info("Credential presentation verification success.")
+
+	return p.Disclosed, nil
+}
@@ -0,0 +1,161 @@
+package credential
+
+import (
+	"bytes"
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Cealgull/Verify/internal/cache"
+	"github.com/Cealgull/Verify/internal/cache/mock"
+	"github.com/Cealgull/Verify/pkg/bbs"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+var logger *zap.SugaredLogger
+
+func init() {
+	l, _ := zap.NewDevelopment()
+	logger = l.Sugar()
+}
+
+func TestKeyFile(t *testing.T) {
+
+	file := filepath.Join(t.TempDir(), "bbs.pem")
+
+	sk, err := GenerateKey(file)
+	assert.NoError(t, err)
+
+	loaded, err := LoadKey(file)
+	assert.NoError(t, err)
+	assert.Equal(t, sk.Bytes(), loaded.Bytes())
+
+	_, err = LoadKey("./notexists")
+	assert.Error(t, err)
+
+	assert.NoError(t, os.WriteFile(file, []byte("garbage"), 0600))
+	_, err = LoadKey(file)
+	assert.IsType(t, &KeyFormatError{}, err)
+	assert.NotEmpty(t, err.Error())
+
+	_, err = NewManager(logger, WithKey(file))
+	assert.Error(t, err)
+
+	_, err = NewManager(logger)
+	assert.IsType(t, &KeyMissingError{}, err)
+	assert.NotEmpty(t, err.Error())
+
+	_, err = NewManager(logger, WithSecretKey(sk))
+	assert.IsType(t, &CacheMissingError{}, err)
+	assert.NotEmpty(t, err.Error())
+
+	_, err = GenerateKey(filepath.Join(file, "bbs.pem"))
+	assert.Error(t, err)
+}
+
+func TestIssueAndPresent(t *testing.T) {
+
+	sk, err := bbs.KeyGen(bytes.Repeat([]byte{1}, 32), Header)
+	assert.NoError(t, err)
+
+	c := mock.NewMockCache()
+	m, err := NewManager(logger,
+		WithSecretKey(sk),
+		WithCache(c),
+		WithIssuer("Campus A"),
+		WithGroup("students"),
+		WithEpoch(3600),
+	)
+	assert.NoError(t, err)
+	m.now = func() time.Time { return time.Unix(7200, 0) }
+
+	_, verr := m.Issue("!!")
+	assert.IsType(t, &SecretFormatError{}, verr)
+	_, verr = m.Issue(base64.StdEncoding.EncodeToString([]byte("short")))
+	assert.IsType(t, &SecretFormatError{}, verr)
+
+	secret := base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{7}, 32))
+	cred, verr := m.Issue(secret)
+	assert.Nil(t, verr)
+	assert.Equal(t, "2", cred.Attributes[AttrEpoch])
+	assert.Equal(t, "students", cred.Attributes[AttrGroup])
+
+	key := m.Key()
+	assert.Equal(t, Attributes, key.Attributes)
+
+	nonce := func() string {
+		n, verr := m.Nonce()
+		assert.Nil(t, verr)
+		return n
+	}
+
+	p, err := Present(key, cred, nonce(), AttrGroup, AttrEpoch)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{AttrGroup: "students", AttrEpoch: "2"}, p.Disclosed)
+
+	disclosed, verr := m.Verify(p)
+	assert.Nil(t, verr)
+	assert.Equal(t, p.Disclosed, disclosed)
+
+	// a nonce serves a single presentation and must come from the verifier
+	_, verr = m.Verify(p)
+	assert.IsType(t, &NonceInvalidError{}, verr)
+
+	chosen, err := Present(key, cred, "nonce", AttrGroup)
+	assert.NoError(t, err)
+	_, verr = m.Verify(chosen)
+	assert.IsType(t, &NonceInvalidError{}, verr)
+	_, verr = m.Verify(&Presentation{Proof: chosen.Proof, Disclosed: chosen.Disclosed})
+	assert.IsType(t, &NonceInvalidError{}, verr)
+
+	// two presentations of the same credential do not share the proof
+	q, err := Present(key, cred, "nonce", AttrGroup, AttrEpoch)
+	assert.NoError(t, err)
+	assert.NotEqual(t, p.Proof, q.Proof)
+
+	hidden, err := Present(key, cred, nonce())
+	assert.NoError(t, err)
+	_, verr = m.Verify(hidden)
+	assert.Nil(t, verr)
+
+	_, err = Present(key, cred, "nonce", AttrSecret)
+	assert.IsType(t, &AttributeUnknownError{}, err)
+
+	_, verr = m.Verify(&Presentation{Proof: p.Proof, Nonce: nonce(), Disclosed: p.Disclosed})
+	assert.IsType(t, &PresentationInvalidError{}, verr)
+
+	p, err = Present(key, cred, nonce(), AttrGroup, AttrEpoch)
+	assert.NoError(t, err)
+	_, verr = m.Verify(&Presentation{Proof: p.Proof, Nonce: p.Nonce, Disclosed: map[string]string{AttrGroup: "teachers", AttrEpoch: "2"}})
+	assert.IsType(t, &PresentationInvalidError{}, verr)
+
+	c.AddGetErr("credential:nonce:broken", &cache.InternalError{})
+	_, verr = m.Verify(&Presentation{Proof: p.Proof, Nonce: "broken", Disclosed: p.Disclosed})
+	assert.IsType(t, &CredentialInternalError{}, verr)
+
+	_, verr = m.Verify(&Presentation{Proof: p.Proof, Nonce: p.Nonce, Disclosed: map[string]string{"name": "alice"}})
+	assert.IsType(t, &AttributeUnknownError{}, verr)
+
+	_, verr = m.Verify(&Presentation{Proof: "!!"})
+	assert.IsType(t, &PresentationFormatError{}, verr)
+
+	_, err = Present(&IssuerKey{Key: "!!"}, cred, "nonce")
+	assert.Error(t, err)
+	_, err = Present(&IssuerKey{Key: "AAAA"}, cred, "nonce")
+	assert.Error(t, err)
+	_, err = Present(key, &Credential{Signature: "!!"}, "nonce")
+	assert.Error(t, err)
+	_, err = Present(key, &Credential{Signature: "AAAA"}, "nonce")
+	assert.Error(t, err)
+
+	for _, err := range []interface {
+		Status() int
+		Error() string
+	}{&SecretFormatError{}, &PresentationFormatError{}, &AttributeUnknownError{}, &PresentationInvalidError{}, &CredentialInternalError{}, &NonceInvalidError{}} {
+		assert.NotEmpty(t, err.Error())
+		assert.NotZero(t, err.Status())
+	}
+}
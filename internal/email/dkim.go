@@ -0,0 +1,87 @@
+package email
+
+import (
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"strings"
+
+	"github.com/toorop/go-dkim"
+)
+
+// DefaultDKIMHeaders are signed when no header set is configured.
+var DefaultDKIMHeaders = []string{"from", "to", "subject", "date", "mime-version", "content-type"}
+
+const minDKIMBits = 1024
+
+// DKIM signs outgoing mail as domain with the key published under selector.
+type DKIM struct {
+	options dkim.SigOptions
+}
+
+// LoadDKIM reads the RSA signing key from keyfile and checks it by signing
+// a sample message. The From header is always signed.
+func LoadDKIM(domain string, selector string, keyfile string, headers []string) (*DKIM, error) {
+
+	if domain == "" || selector == "" {
+		return nil, &DKIMError{File: keyfile, Reason: "domain and selector are required"}
+	}
+
+	data, err := os.ReadFile(keyfile)
+
+	if err != nil {
+		return nil, err
+	}
+
+	block, _ := pem.Decode(data)
+
+	if block == nil {
+		return nil, &DKIMError{File: keyfile, Reason: "no PEM block"}
+	}
+
+	var key any
+
+	if key, err = x509.ParsePKCS1PrivateKey(block.Bytes); err != nil {
+		key, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	}
+
+	rsakey, ok := key.(*rsa.PrivateKey)
+
+	if err != nil || !ok {
+		return nil, &DKIMError{File: keyfile, Reason: "not an RSA private key"}
+	}
+
+	if rsakey.N.BitLen() < minDKIMBits {
+		return nil, &DKIMError{File: keyfile, Reason: "RSA key shorter than 1024 bits"}
+	}
+
+	if len(headers) == 0 {
+		headers = DefaultDKIMHeaders
+	}
+
+	signed := []string{"from"}
+
+	for _, h := range headers {
+		if h = strings.ToLower(strings.TrimSpace(h)); h != "" && h != "from" {
+			signed = append(signed, h)
+		}
+	}
+
+	options := dkim.NewSigOptions()
+	options.PrivateKey = data
+	options.Domain = domain
+	options.Selector = selector
+	options.Canonicalization = "relaxed/relaxed"
+	options.Headers = signed
+
+	d := DKIM{options: options}
+
+	msg, err := compose("postmaster@"+domain, "postmaster@"+domain, &Message{Subject: "DKIM", Text: "DKIM", dkim: &d})
+
+	if err != nil || msg.DkimMsg == "" {
+		return nil, &DKIMError{File: keyfile, Reason: "signing failed"}
+	}
+
+	return &d, nil
+}
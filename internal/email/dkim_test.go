@@ -0,0 +1,108 @@
+package email
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/toorop/go-dkim"
+	"go.uber.org/zap"
+)
+
+func TestDKIM(t *testing.T) {
+
+	dir := t.TempDir()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NoError(t, err)
+
+	pkcs1 := filepath.Join(dir, "pkcs1.pem")
+	assert.NoError(t, os.WriteFile(pkcs1, pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)}), 0600))
+
+	der, _ := x509.MarshalPKCS8PrivateKey(key)
+	pkcs8 := filepath.Join(dir, "pkcs8.pem")
+	assert.NoError(t, os.WriteFile(pkcs8, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0600))
+
+	eckey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	der, _ = x509.MarshalPKCS8PrivateKey(eckey)
+	ec := filepath.Join(dir, "ec.pem")
+	assert.NoError(t, os.WriteFile(ec, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0600))
+
+	garbage := filepath.Join(dir, "garbage.pem")
+	assert.NoError(t, os.WriteFile(garbage, []byte("garbage"), 0600))
+
+	_, err = LoadDKIM("example2.org", "mail", filepath.Join(dir, "missing.pem"), nil)
+	assert.Error(t, err)
+
+	for _, file := range []string{ec, garbage} {
+		_, err = LoadDKIM("example2.org", "mail", file, nil)
+		assert.IsType(t, &DKIMError{}, err)
+		var _ = err.Error()
+	}
+
+	_, err = LoadDKIM("", "mail", pkcs1, nil)
+	assert.IsType(t, &DKIMError{}, err)
+
+	d, err := LoadDKIM("example2.org", "mail", pkcs8, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, DefaultDKIMHeaders, d.options.Headers)
+
+	d, err = LoadDKIM("example2.org", "mail", pkcs1, []string{"Subject", " To ", "From"})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"from", "subject", "to"}, d.options.Headers)
+
+	server := startMockSMTP(t, 2339)
+
+	mailer, err := NewSMTPMailer("localhost", 2339, "admin@example2.org", "secret", nil)
+	assert.NoError(t, err)
+
+	l, _ := zap.NewProduction()
+	dialer, err := NewEmailDialer(l.Sugar(), WithMailer(mailer, "admin@example2.org"), WithDKIM(d))
+	assert.NoError(t, err)
+
+	assert.NoError(t, dialer.send("user@example2.org", testMessage))
+
+	msgs := server.Messages()
+	assert.Len(t, msgs, 1)
+
+	captured := []byte(msgs[0].MsgRequest())
+	assert.Contains(t, string(captured), "DKIM-Signature:")
+
+	spki, _ := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	record := "v=DKIM1; k=rsa; p=" + base64.StdEncoding.EncodeToString(spki)
+
+	lookup := dkim.DNSOptLookupTXT(func(name string) ([]string, error) {
+		assert.Equal(t, "mail._domainkey.example2.org", name)
+		return []string{record}, nil
+	})
+
+	status, err := dkim.Verify(&captured, lookup)
+	assert.NoError(t, err)
+	assert.Equal(t, dkim.SUCCESS, status)
+
+	tampered := []byte(strings.Replace(string(captured), "012345", "543210", 1))
+	status, _ = dkim.Verify(&tampered, lookup)
+	assert.NotEqual(t, dkim.SUCCESS, status)
+
+	// the outbox keeps the signature too
+	outbox, _ := NewMaildirMailer(filepath.Join(dir, "outbox"))
+	dialer, _ = NewEmailDialer(l.Sugar(), WithMailer(outbox, "admin@example2.org"), WithDKIM(d))
+	assert.NoError(t, dialer.send("user@example2.org", testMessage))
+
+	entries, _ := os.ReadDir(filepath.Join(dir, "outbox", "new"))
+	assert.Len(t, entries, 1)
+
+	stored, _ := os.ReadFile(filepath.Join(dir, "outbox", "new", entries[0].Name()))
+	status, err = dkim.Verify(&stored, lookup)
+	assert.NoError(t, err)
+	assert.Equal(t, dkim.SUCCESS, status)
+}
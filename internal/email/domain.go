@@ -0,0 +1,127 @@
+package email
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/Cealgull/Verify/internal/proto"
+)
+
+// Domain is a recipient domain allowed to enroll. Unset rules fall back to
+// the ones of the EmailManager.
+type Domain struct {
+	name      string
+	accexp    *regexp.Regexp
+	subject   string
+	template  string
+	templates *Templates
+	dialer    *EmailDialer
+}
+
+type DomainOption func(d *Domain) error
+
+func WithDomainAccExp(rule string) DomainOption {
+	return func(d *Domain) error {
+		var err error
+		d.accexp, err = regexp.Compile(rule)
+		return err
+	}
+}
+
+func WithDomainSubject(subject string) DomainOption {
+	return func(d *Domain) error {
+		d.subject = subject
+		return nil
+	}
+}
+
+func WithDomainTemplate(template string) DomainOption {
+	return func(d *Domain) error {
+		d.template = template
+		return nil
+	}
+}
+
+func WithDomainTemplates(t *Templates) DomainOption {
+	return func(d *Domain) error {
+		d.templates = t
+		return nil
+	}
+}
+
+// WithDomainDialer routes the mails of the domain through its own SMTP
+// server.
+func WithDomainDialer(dialer *EmailDialer) DomainOption {
+	return func(d *Domain) error {
+		d.dialer = dialer
+		return nil
+	}
+}
+
+func NewDomain(name string, options ...DomainOption) (*Domain, error) {
+
+	d := Domain{name: strings.ToLower(name)}
+
+	for _, option := range options {
+		if err := option(&d); err != nil {
+			return nil, err
+		}
+	}
+
+	return &d, nil
+}
+
+func (d *Domain) Name() string {
+	return d.name
+}
+
+// WithDomains sets the allowlist of recipient domains. Accounts given
+// without a domain belong to the first one.
+func WithDomains(domains ...*Domain) ManagerOption {
+	return func(mgr *EmailManager) error {
+		for _, d := range domains {
+			if _, ok := mgr.domains[d.name]; ok {
+				continue
+			}
+			mgr.domains[d.name] = d
+			mgr.order = append(mgr.order, d.name)
+		}
+		return nil
+	}
+}
+
+// resolve splits address into its account and allowed domain.
+func (m *EmailManager) resolve(address string) (string, *Domain, proto.VerifyError) {
+
+	account, name := address, ""
+
+	if i := strings.LastIndexByte(address, '@'); i >= 0 {
+		account, name = address[:i], address[i+1:]
+		if account == "" || name == "" {
+			m.logger.Debugf("Format checking failure for account: %s", address)
+			return "", nil, &AccountFormatError{}
+		}
+	} else if len(m.order) != 0 {
+		name = m.order[0]
+	}
+
+	d, ok := m.domains[strings.ToLower(name)]
+
+	if !ok {
+		m.logger.Debugf("Domain not allowed for address: %s.", address)
+		return "", nil, &DomainNotAllowedError{}
+	}
+
+	accexp := d.accexp
+
+	if accexp == nil {
+		accexp = m.accexp
+	}
+
+	if accexp == nil || !accexp.MatchString(account) {
+		m.logger.Debugf("Format checking failure for account: %s", address)
+		return "", nil, &AccountFormatError{}
+	}
+
+	return account, d, nil
+}
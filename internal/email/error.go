@@ -1,21 +1,60 @@
 package email
 
 import (
+	"fmt"
 	"net/http"
+	"time"
 
 	"github.com/Cealgull/Verify/internal/proto"
 )
 
-type DuplicateEmailError struct{}
+type DuplicateEmailError struct {
+	Timing
+}
 type AccountFormatError struct{}
 type CodeFormatError struct{}
-type CodeIncorrectError struct{}
+type CodeIncorrectError struct {
+	Remaining int
+}
 type EmailInternalError struct{}
 type AccountNotFoundError struct{}
 type EmailDialingError struct{}
+type DomainNotAllowedError struct{}
+type LinkInvalidError struct{}
+type LinkExpiredError struct{}
+type AttemptsExceededError struct {
+	Lockout time.Duration
+}
+type AccountLockedError struct {
+	Retry time.Duration
+}
+type ResendCooldownError struct {
+	Timing
+}
+type TemplateError struct {
+	File string
+}
+type DeliveryError struct {
+	Backend string
+	Reason  string
+}
+type BackendError struct {
+	Backend string
+}
+type TransportError struct {
+	Reason string
+}
+type ModeError struct {
+	Mode   string
+	Reason string
+}
+type DKIMError struct {
+	File   string
+	Reason string
+}
 
 func (e *DuplicateEmailError) Error() string {
-	return "Email: Email Duplicated, Please verify or wait for another three minutes."
+	return fmt.Sprintf("Email: Verification Pending, Please Verify or Resend in %d Seconds.", Seconds(e.Resend))
 }
 
 func (e *DuplicateEmailError) Status() int {
@@ -44,6 +83,51 @@ func (e *AccountFormatError) Message() *proto.ResponseMessage {
 	}
 }
 
+func (e *DomainNotAllowedError) Error() string {
+	return "Email: Email Domain Not Allowed."
+}
+
+func (e *DomainNotAllowedError) Status() int {
+	return http.StatusForbidden
+}
+
+func (e *DomainNotAllowedError) Message() *proto.ResponseMessage {
+	return &proto.ResponseMessage{
+		Code:    "A0423",
+		Message: e.Error(),
+	}
+}
+
+func (e *LinkInvalidError) Error() string {
+	return "Email: Verification Link Invalid."
+}
+
+func (e *LinkInvalidError) Status() int {
+	return http.StatusBadRequest
+}
+
+func (e *LinkInvalidError) Message() *proto.ResponseMessage {
+	return &proto.ResponseMessage{
+		Code:    "A0424",
+		Message: e.Error(),
+	}
+}
+
+func (e *LinkExpiredError) Error() string {
+	return "Email: Verification Link Expired or Already Used."
+}
+
+func (e *LinkExpiredError) Status() int {
+	return http.StatusGone
+}
+
+func (e *LinkExpiredError) Message() *proto.ResponseMessage {
+	return &proto.ResponseMessage{
+		Code:    "A0425",
+		Message: e.Error(),
+	}
+}
+
 func (e *AccountNotFoundError) Error() string {
 	return "Email: User hasn't requested a verfication code or the code has expired."
 }
@@ -83,12 +167,68 @@ func (e *CodeIncorrectError) Status() int {
 }
 
 func (e *CodeIncorrectError) Message() *proto.ResponseMessage {
+	remaining := e.Remaining
 	return &proto.ResponseMessage{
-		Code:    "A0422",
+		Code:      "A0422",
+		Message:   e.Error(),
+		Remaining: &remaining,
+	}
+}
+
+func (e *AttemptsExceededError) Error() string {
+	return fmt.Sprintf("Email: Too Many Incorrect Codes, Account Locked for %d Seconds.", Seconds(e.Lockout))
+}
+
+func (e *AttemptsExceededError) Status() int {
+	return http.StatusTooManyRequests
+}
+
+func (e *AttemptsExceededError) Message() *proto.ResponseMessage {
+	remaining := 0
+	return &proto.ResponseMessage{
+		Code:      "A0426",
+		Message:   e.Error(),
+		Remaining: &remaining,
+	}
+}
+
+func (e *AccountLockedError) Error() string {
+	return fmt.Sprintf("Email: Account Locked, Please Retry in %d Seconds.", Seconds(e.Retry))
+}
+
+func (e *AccountLockedError) Status() int {
+	return http.StatusTooManyRequests
+}
+
+func (e *AccountLockedError) Message() *proto.ResponseMessage {
+	remaining := 0
+	return &proto.ResponseMessage{
+		Code:      "A0427",
+		Message:   e.Error(),
+		Remaining: &remaining,
+	}
+}
+
+func (e *ResendCooldownError) Error() string {
+	return fmt.Sprintf("Email: Resend Cooling Down, Please Retry in %d Seconds.", Seconds(e.Resend))
+}
+
+func (e *ResendCooldownError) Status() int {
+	return http.StatusTooManyRequests
+}
+
+func (e *ResendCooldownError) Message() *proto.ResponseMessage {
+	return &proto.ResponseMessage{
+		Code:    "A0428",
 		Message: e.Error(),
 	}
 }
 
+// Seconds rounds d up to whole seconds for the clients.
+func Seconds(d time.Duration) int64 {
+	return int64((d + time.Second - 1) / time.Second)
+}
+
 func (e *EmailInternalError) Error() string {
 	return "Email: Internal Server Error."
 }
@@ -118,3 +258,27 @@ func (e *EmailDialingError) Message() *proto.ResponseMessage {
 		Message: e.Error(),
 	}
 }
+
+func (e *TemplateError) Error() string {
+	return fmt.Sprintf("Email: Invalid Template %s.", e.File)
+}
+
+func (e *DeliveryError) Error() string {
+	return fmt.Sprintf("Email: Delivery through %s failed: %s.", e.Backend, e.Reason)
+}
+
+func (e *BackendError) Error() string {
+	return fmt.Sprintf("Email: Unknown Mail Backend %s.", e.Backend)
+}
+
+func (e *TransportError) Error() string {
+	return fmt.Sprintf("Email: Invalid SMTP Transport, %s.", e.Reason)
+}
+
+func (e *DKIMError) Error() string {
+	return fmt.Sprintf("Email: Invalid DKIM Key %s, %s.", e.File, e.Reason)
+}
+
+func (e *ModeError) Error() string {
+	return fmt.Sprintf("Email: Invalid Verification Mode %s, %s.", e.Mode, e.Reason)
+}
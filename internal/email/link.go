@@ -0,0 +1,165 @@
+package email
+
+import (
+	"crypto/hmac"
+	crand "crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Cealgull/Verify/internal/cache"
+	"github.com/Cealgull/Verify/internal/proto"
+)
+
+// Verification modes, picking what Sign puts in the message.
+const (
+	ModeCode = "code"
+	ModeLink = "link"
+	ModeBoth = "both"
+)
+
+const linkPrefix = "email:link:"
+
+// WithMode picks whether Sign mails a code, a single use link or both.
+func WithMode(mode string) ManagerOption {
+	return func(mgr *EmailManager) error {
+		mgr.mode = mode
+		return nil
+	}
+}
+
+// WithLinkSecret sets the HMAC key of the magic link tokens. Without one a
+// random key is drawn, which voids the links on restart.
+func WithLinkSecret(secret []byte) ManagerOption {
+	return func(mgr *EmailManager) error {
+		mgr.secret = secret
+		return nil
+	}
+}
+
+func (m *EmailManager) sendsCode() bool {
+	return m.mode != ModeLink
+}
+
+func (m *EmailManager) sendsLink() bool {
+	return m.mode == ModeLink || m.mode == ModeBoth
+}
+
+func (m *EmailManager) mac(payload string) []byte {
+	h := hmac.New(sha256.New, m.secret)
+	h.Write([]byte(payload))
+	return h.Sum(nil)
+}
+
+// issueToken binds a fresh single use token for address to the cache. The
+// cache keeps the expiry and nonce the token carries besides the address,
+// so the token can be rebuilt when the mail is delivered.
+func (m *EmailManager) issueToken(address string) error {
+
+	nonce := make([]byte, 16)
+
+	if _, err := crand.Read(nonce); err != nil {
+		return err
+	}
+
+	expiry := time.Now().Add(m.ttl).Unix()
+
+	return m.cache.Set(linkPrefix+address, strconv.FormatInt(expiry, 10)+"\n"+hex.EncodeToString(nonce), m.ttl)
+}
+
+// token signs the link token of address from the value issueToken kept.
+func (m *EmailManager) token(address string, value string) string {
+	payload := address + "\n" + value
+	enc := base64.RawURLEncoding
+	return enc.EncodeToString([]byte(payload)) + "." + enc.EncodeToString(m.mac(payload))
+}
+
+// magicLink points the link page at token.
+func (m *EmailManager) magicLink(token string) string {
+
+	u, err := url.Parse(m.link)
+
+	if m.link == "" || err != nil {
+		return ""
+	}
+
+	q := u.Query()
+	q.Set("token", token)
+	u.RawQuery = q.Encode()
+
+	return u.String()
+}
+
+// Redeem consumes a magic link token, returning the verified address.
+func (m *EmailManager) Redeem(token string) (string, proto.VerifyError) {
+
+	enc := base64.RawURLEncoding
+	encoded, sig, _ := strings.Cut(token, ".")
+
+	payload, err := enc.DecodeString(encoded)
+	mac, merr := enc.DecodeString(sig)
+
+	if err != nil || merr != nil || !hmac.Equal(mac, m.mac(string(payload))) {
+		m.logger.Debugf("Invalid magic link token: %s.", token)
+		return "", &LinkInvalidError{}
+	}
+
+	fields := strings.Split(string(payload), "\n")
+
+	if len(fields) != 3 {
+		return "", &LinkInvalidError{}
+	}
+
+	address, value := fields[0], fields[1]+"\n"+fields[2]
+	expiry, err := strconv.ParseInt(fields[1], 10, 64)
+
+	if err != nil {
+		return "", &LinkInvalidError{}
+	}
+
+	m.logger.Infof("Redeeming magic link for %s.", address)
+
+	if time.Now().Unix() > expiry {
+		m.logger.Debugf("Magic link expired for account: %s.", address)
+		return "", &LinkExpiredError{}
+	}
+
+	if left, verr := m.locked(address); verr != nil {
+		return "", verr
+	} else if left > 0 {
+		m.logger.Debugf("Redeeming refused for locked account: %s.", address)
+		return "", &AccountLockedError{Retry: left}
+	}
+
+	// a stale link must not burn the one sent after it, so the token is
+	// consumed only while the cache still holds its nonce, in one step
+	redeemed, err := m.cache.CompareAndDel(linkPrefix+address, value)
+
+	if err != nil {
+		m.logger.Errorf("Redis failure when redeeming magic link for %s.", address)
+		return "", &EmailInternalError{}
+	}
+
+	if !redeemed {
+		m.logger.Debugf("Magic link already used or replaced for account: %s.", address)
+		return "", &LinkExpiredError{}
+	}
+
+	if err := m.cache.Del(address); err != nil {
+		if _, ok := err.(*cache.InternalError); ok {
+			m.logger.Errorf("Redis failure when deleting verification truth for %s.", address)
+			return "", &EmailInternalError{}
+		}
+	}
+
+	var _ = m.cache.Del(attemptsPrefix + address)
+	var _ = m.cache.Del(lockoutsPrefix + address)
+
+	m.logger.Infof("Magic link verification succeeded for account: %s.", address)
+
+	return address, nil
+}
@@ -0,0 +1,208 @@
+package email
+
+import (
+	"encoding/base64"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Cealgull/Verify/internal/cache"
+	mockcache "github.com/Cealgull/Verify/internal/cache/mock"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+// outbox keeps the messages handed to it instead of delivering them.
+type outbox struct {
+	mu   sync.Mutex
+	msgs []*Message
+}
+
+func (o *outbox) Send(from string, to string, m *Message) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.msgs = append(o.msgs, m)
+	return nil
+}
+
+func (o *outbox) last() *Message {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.msgs[len(o.msgs)-1]
+}
+
+// token pulls the magic link token out of a message.
+func (o *outbox) token(t *testing.T) string {
+	for _, field := range strings.Fields(o.last().Text) {
+		if u, err := url.Parse(field); err == nil && u.Query().Has("token") {
+			return u.Query().Get("token")
+		}
+	}
+	t.Fatal("no magic link in message")
+	return ""
+}
+
+func newLinkManager(t *testing.T, mode string, options ...ManagerOption) (*EmailManager, *outbox, *mockcache.MockCache) {
+
+	l, _ := zap.NewProduction()
+	box := &outbox{}
+
+	dialer, err := NewEmailDialer(l.Sugar(), WithMailer(box, "admin@example2.org"), WithToDom("example2.org"))
+	assert.NoError(t, err)
+
+	mc := mockcache.NewMockCache()
+
+	m, err := NewEmailManager(l.Sugar(), append([]ManagerOption{
+		WithEmailDialer(dialer),
+		WithEmailTemplate("The Verification is %06d"),
+		WithAccExp("^[a-zA-Z0-9-_\\.]{3,50}$"),
+		WithCodeExp("^\\d{6}$"),
+		WithCache(mc),
+		WithLink("https://verify.example2.org/redeem"),
+		WithMode(mode),
+	}, options...)...)
+	assert.NoError(t, err)
+
+	return m, box, mc
+}
+
+func TestLinkMode(t *testing.T) {
+
+	l, _ := zap.NewProduction()
+
+	_, err := NewEmailManager(l.Sugar(), WithMode("carrier pigeon"))
+	assert.IsType(t, &ModeError{}, err)
+	var _ = err.Error()
+
+	_, err = NewEmailManager(l.Sugar(), WithMode(ModeLink))
+	assert.IsType(t, &ModeError{}, err)
+
+	m, box, mc := newLinkManager(t, ModeLink, WithLinkSecret([]byte("secret")))
+
+	_, verr := m.Sign("user1")
+	assert.Nil(t, verr)
+
+	msg := box.last()
+	assert.NotContains(t, msg.Text, "The Verification is")
+	assert.True(t, strings.HasPrefix(msg.Text, "https://verify.example2.org/redeem?token="))
+
+	_, err = mc.Get("user1@example2.org")
+	assert.Error(t, err)
+
+	_, verr = m.Sign("user1")
+	assert.IsType(t, &DuplicateEmailError{}, verr)
+
+	token := box.token(t)
+
+	// a code can not complete the link mode
+	_, verr = m.Verify("user1@example2.org", "012345")
+	assert.IsType(t, &AccountNotFoundError{}, verr)
+
+	address, verr := m.Redeem(token)
+	assert.Nil(t, verr)
+	assert.Equal(t, "user1@example2.org", address)
+
+	_, verr = m.Redeem(token)
+	assert.IsType(t, &LinkExpiredError{}, verr)
+	var _ = verr.Status()
+	var _ = verr.Message()
+
+	// redeemed tokens free the account for another round
+	_, verr = m.Sign("user1")
+	assert.Nil(t, verr)
+	stale := token
+	token = box.token(t)
+	assert.NotEqual(t, stale, token)
+
+	_, verr = m.Redeem(stale)
+	assert.IsType(t, &LinkExpiredError{}, verr)
+
+	for _, bad := range []string{"", "garbage", token + "x", "x" + token, strings.Replace(token, ".", "", 1)} {
+		_, verr = m.Redeem(bad)
+		assert.IsType(t, &LinkInvalidError{}, verr, bad)
+		var _ = verr.Status()
+		var _ = verr.Message()
+	}
+
+	// signed by another key
+	other, _, _ := newLinkManager(t, ModeLink, WithLinkSecret([]byte("other")))
+	_, verr = other.Redeem(token)
+	assert.IsType(t, &LinkInvalidError{}, verr)
+
+	// expired, though validly signed
+	enc := base64.RawURLEncoding
+	payload := "user1@example2.org\n" + strconv.FormatInt(time.Now().Add(-time.Minute).Unix(), 10) + "\n00"
+	_, verr = m.Redeem(enc.EncodeToString([]byte(payload)) + "." + enc.EncodeToString(m.mac(payload)))
+	assert.IsType(t, &LinkExpiredError{}, verr)
+
+	payload = "user1@example2.org\nsoon\n00"
+	_, verr = m.Redeem(enc.EncodeToString([]byte(payload)) + "." + enc.EncodeToString(m.mac(payload)))
+	assert.IsType(t, &LinkInvalidError{}, verr)
+
+	mc.AddGetErr(linkPrefix+"user1@example2.org", &cache.InternalError{})
+	_, verr = m.Redeem(token)
+	assert.IsType(t, &EmailInternalError{}, verr)
+	mc.DelGetErr(linkPrefix + "user1@example2.org")
+
+	address, verr = m.Redeem(token)
+	assert.Nil(t, verr)
+	assert.Equal(t, "user1@example2.org", address)
+}
+
+func TestBothMode(t *testing.T) {
+
+	m, box, mc := newLinkManager(t, ModeBoth)
+
+	_, verr := m.Sign("user1")
+	assert.Nil(t, verr)
+
+	code, err := mc.Get("user1@example2.org")
+	assert.NoError(t, err)
+
+	lines := strings.Split(box.last().Text, "\n")
+	assert.Len(t, lines, 2)
+	assert.Equal(t, "The Verification is "+code, lines[0])
+
+	token := box.token(t)
+
+	// the code consumes the link too
+	ok, verr := m.Verify("user1", code)
+	assert.True(t, ok)
+	assert.Nil(t, verr)
+
+	_, verr = m.Redeem(token)
+	assert.IsType(t, &LinkExpiredError{}, verr)
+
+	// and the link consumes the code
+	_, verr = m.Sign("user1")
+	assert.Nil(t, verr)
+
+	code, _ = mc.Get("user1@example2.org")
+
+	_, verr = m.Redeem(box.token(t))
+	assert.Nil(t, verr)
+
+	_, verr = m.Verify("user1", code)
+	assert.IsType(t, &AccountNotFoundError{}, verr)
+
+	// templates drop the code in link mode
+	templates, err := LoadTemplates("testdata/templates", "en")
+	assert.NoError(t, err)
+
+	m, box, _ = newLinkManager(t, ModeLink, WithTemplates(templates))
+
+	_, verr = m.Sign("user2", "zh-CN")
+	assert.Nil(t, verr)
+
+	msg := box.last()
+	assert.Equal(t, "【Cealgull】验证您的账户", msg.Subject)
+	assert.NotContains(t, msg.Text, "验证码")
+	assert.Contains(t, msg.HTML, "https://verify.example2.org/redeem?token=")
+
+	address, verr := m.Redeem(box.token(t))
+	assert.Nil(t, verr)
+	assert.Equal(t, "user2@example2.org", address)
+}
@@ -0,0 +1,111 @@
+package email
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/Cealgull/Verify/internal/cache"
+	"github.com/Cealgull/Verify/internal/proto"
+)
+
+// Attempt limits applied unless configured otherwise.
+const (
+	DefaultAttempts       = 5
+	DefaultLockout        = time.Minute
+	DefaultLockoutCeiling = time.Hour
+)
+
+const (
+	attemptsPrefix = "email:attempts:"
+	lockPrefix     = "email:lock:"
+	lockoutsPrefix = "email:lockouts:"
+	// lockoutMemory is how long past lockouts keep escalating new ones.
+	lockoutMemory = 24 * time.Hour
+)
+
+// WithAttempts sets how many incorrect codes an account may try before
+// the code is dropped and the account locked out.
+func WithAttempts(n int) ManagerOption {
+	return func(mgr *EmailManager) error {
+		mgr.attempts = n
+		return nil
+	}
+}
+
+// WithLockout sets the first lockout, doubled on every further one within
+// a day up to ceiling.
+func WithLockout(base time.Duration, ceiling time.Duration) ManagerOption {
+	return func(mgr *EmailManager) error {
+		mgr.lockout = base
+		mgr.ceiling = ceiling
+		return nil
+	}
+}
+
+// locked reports whether address is locked out and for how long.
+func (m *EmailManager) locked(address string) (time.Duration, proto.VerifyError) {
+
+	until, err := m.cache.Get(lockPrefix + address)
+
+	if _, ok := err.(*cache.KeyError); ok {
+		return 0, nil
+	} else if err != nil {
+		m.logger.Errorf("Redis failure when checking lockout of %s.", address)
+		return 0, &EmailInternalError{}
+	}
+
+	ms, _ := strconv.ParseInt(until, 10, 64)
+
+	if left := time.Until(time.UnixMilli(ms)); left > 0 {
+		return left, nil
+	}
+
+	return 0, nil
+}
+
+// fail counts an incorrect code for address, locking it out once the
+// attempts run out.
+func (m *EmailManager) fail(address string) proto.VerifyError {
+
+	n, err := m.cache.Incr(attemptsPrefix+address, m.ttl)
+
+	if err != nil {
+		m.logger.Errorf("Redis failure when counting attempts of %s.", address)
+		return &EmailInternalError{}
+	}
+
+	if remaining := m.attempts - int(n); remaining > 0 {
+		return &CodeIncorrectError{Remaining: remaining}
+	}
+
+	m.forget(address)
+	var _ = m.cache.Del(attemptsPrefix + address)
+
+	k, err := m.cache.Incr(lockoutsPrefix+address, lockoutMemory)
+
+	if err != nil {
+		m.logger.Errorf("Redis failure when counting lockouts of %s.", address)
+		return &EmailInternalError{}
+	}
+
+	lockout := m.lockout
+
+	for i := int64(1); i < k && lockout < m.ceiling; i++ {
+		lockout *= 2
+	}
+
+	if lockout > m.ceiling {
+		lockout = m.ceiling
+	}
+
+	until := strconv.FormatInt(time.Now().Add(lockout).UnixMilli(), 10)
+
+	if err := m.cache.Set(lockPrefix+address, until, lockout); err != nil {
+		m.logger.Errorf("Redis failure when locking out %s.", address)
+		return &EmailInternalError{}
+	}
+
+	m.logger.Infof("Account %s locked out for %s after %d incorrect codes.", address, lockout, n)
+
+	return &AttemptsExceededError{Lockout: lockout}
+}
@@ -0,0 +1,158 @@
+package email
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Cealgull/Verify/internal/cache"
+	"github.com/stretchr/testify/assert"
+)
+
+// wrong returns a well formed code other than truth.
+func wrong(truth string) string {
+	if truth == "000000" {
+		return "000001"
+	}
+	return "000000"
+}
+
+func TestLockout(t *testing.T) {
+
+	m, _, mc := newLinkManager(t, ModeCode, WithAttempts(3), WithLockout(50*time.Millisecond, 120*time.Millisecond))
+
+	exhaust := func() {
+
+		_, verr := m.Sign("user1")
+		assert.Nil(t, verr)
+
+		truth, _ := mc.Get("user1@example2.org")
+
+		for remaining := 2; remaining > 0; remaining-- {
+			_, verr = m.Verify("user1", wrong(truth))
+			assert.Equal(t, &CodeIncorrectError{Remaining: remaining}, verr)
+			assert.Equal(t, remaining, *verr.Message().Remaining)
+		}
+
+		_, verr = m.Verify("user1", wrong(truth))
+		assert.IsType(t, &AttemptsExceededError{}, verr)
+		assert.Equal(t, 0, *verr.Message().Remaining)
+		var _ = verr.Status()
+		var _ = verr.Error()
+
+		// the code is gone and the account locked, even for the right code
+		_, err := mc.Get("user1@example2.org")
+		assert.Error(t, err)
+
+		_, verr = m.Verify("user1", truth)
+		assert.IsType(t, &AccountLockedError{}, verr)
+		var _ = verr.Status()
+		var _ = verr.Message()
+
+		_, verr = m.Sign("user1")
+		assert.IsType(t, &AccountLockedError{}, verr)
+	}
+
+	// lockouts double up to the ceiling
+	for _, lockout := range []time.Duration{50 * time.Millisecond, 100 * time.Millisecond, 120 * time.Millisecond} {
+		exhaust()
+		left, verr := m.locked("user1@example2.org")
+		assert.Nil(t, verr)
+		assert.InDelta(t, float64(lockout), float64(left), float64(20*time.Millisecond))
+		time.Sleep(lockout)
+	}
+
+	// a new code brings back every attempt and the right one resets the
+	// escalation
+	_, verr := m.Sign("user1")
+	assert.Nil(t, verr)
+
+	truth, _ := mc.Get("user1@example2.org")
+
+	_, verr = m.Verify("user1", wrong(truth))
+	assert.Equal(t, &CodeIncorrectError{Remaining: 2}, verr)
+
+	ok, verr := m.Verify("user1", truth)
+	assert.True(t, ok)
+	assert.Nil(t, verr)
+
+	exhaust()
+	left, _ := m.locked("user1@example2.org")
+	assert.InDelta(t, float64(50*time.Millisecond), float64(left), float64(20*time.Millisecond))
+
+	mc.AddGetErr(lockPrefix+"user2@example2.org", &cache.InternalError{})
+
+	_, verr = m.Sign("user2")
+	assert.IsType(t, &EmailInternalError{}, verr)
+
+	_, verr = m.Verify("user2", "012345")
+	assert.IsType(t, &EmailInternalError{}, verr)
+
+	_, verr = m.Sign("user3")
+	assert.Nil(t, verr)
+
+	truth, _ = mc.Get("user3@example2.org")
+	mc.AddSetErr(attemptsPrefix+"user3@example2.org", &cache.InternalError{})
+
+	_, verr = m.Verify("user3", wrong(truth))
+	assert.IsType(t, &EmailInternalError{}, verr)
+}
+
+func TestRedeemLockout(t *testing.T) {
+
+	m, box, mc := newLinkManager(t, ModeBoth, WithAttempts(3), WithLockout(50*time.Millisecond, 120*time.Millisecond))
+
+	_, verr := m.Sign("user1")
+	assert.Nil(t, verr)
+
+	truth, _ := mc.Get("user1@example2.org")
+	token := box.token(t)
+
+	for i := 0; i < 3; i++ {
+		_, verr = m.Verify("user1", wrong(truth))
+	}
+	assert.IsType(t, &AttemptsExceededError{}, verr)
+
+	// the link of a locked account is refused like its code
+	_, verr = m.Redeem(token)
+	assert.IsType(t, &AccountLockedError{}, verr)
+
+	time.Sleep(50 * time.Millisecond)
+
+	// a redeemed link resets the attempts and the escalation
+	_, verr = m.Sign("user1")
+	assert.Nil(t, verr)
+
+	truth, _ = mc.Get("user1@example2.org")
+
+	_, verr = m.Verify("user1", wrong(truth))
+	assert.Equal(t, &CodeIncorrectError{Remaining: 2}, verr)
+
+	_, verr = m.Redeem(box.token(t))
+	assert.Nil(t, verr)
+
+	for _, key := range []string{attemptsPrefix, lockoutsPrefix} {
+		_, err := mc.Get(key + "user1@example2.org")
+		assert.IsType(t, &cache.KeyError{}, err)
+	}
+
+	_, verr = m.Sign("user2")
+	assert.Nil(t, verr)
+
+	mc.AddGetErr(lockPrefix+"user2@example2.org", &cache.InternalError{})
+
+	_, verr = m.Redeem(box.token(t))
+	assert.IsType(t, &EmailInternalError{}, verr)
+}
+
+func TestLockoutDefaults(t *testing.T) {
+
+	m, _, _ := newLinkManager(t, ModeCode)
+	assert.Equal(t, DefaultAttempts, m.attempts)
+	assert.Equal(t, DefaultLockout, m.lockout)
+	assert.Equal(t, DefaultLockoutCeiling, m.ceiling)
+
+	m, _, _ = newLinkManager(t, ModeCode, WithLockout(2*time.Hour, 0))
+	assert.Equal(t, 2*time.Hour, m.ceiling)
+
+	assert.Equal(t, "Email: Account Locked, Please Retry in 2 Seconds.", (&AccountLockedError{Retry: 1500 * time.Millisecond}).Error())
+}
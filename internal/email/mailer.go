@@ -0,0 +1,255 @@
+package email
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	mail "github.com/xhit/go-simple-mail/v2"
+)
+
+const (
+	BackendSMTP     = "smtp"
+	BackendSendmail = "sendmail"
+	BackendMaildir  = "maildir"
+	BackendHTTP     = "http"
+)
+
+const DefaultSendmail = "/usr/sbin/sendmail"
+
+// Mailer delivers a rendered message from one address to another.
+type Mailer interface {
+	Send(from string, to string, m *Message) error
+}
+
+// compose builds the RFC 5322 message, as multipart/alternative when m
+// carries an HTML part.
+func compose(from string, to string, m *Message) (*mail.Email, error) {
+
+	msg := mail.NewMSG()
+	msg.SetFrom(from).
+		AddTo(to).
+		SetSubject(m.Subject).
+		SetBody(mail.TextPlain, m.Text)
+
+	if m.HTML != "" {
+		msg.AddAlternative(mail.TextHTML, m.HTML)
+	}
+
+	if m.dkim != nil {
+		msg.SetDkim(m.dkim.options)
+	}
+
+	return msg, msg.GetError()
+}
+
+// raw returns the message as it goes on the wire, with its DKIM signature
+// when signed.
+func raw(msg *mail.Email) string {
+	if msg.DkimMsg != "" {
+		return msg.DkimMsg
+	}
+	return msg.GetMessage()
+}
+
+// SMTPMailer sends through a pool of connections to the relay.
+type SMTPMailer struct {
+	pool *SMTPPool
+}
+
+// NewSMTPMailer checks the transport settings before any connection is
+// made, a nil transport keeps the library defaults.
+func NewSMTPMailer(host string, port int, username string, secret string, transport *Transport, options ...PoolOption) (*SMTPMailer, error) {
+
+	server := mail.NewSMTPClient()
+	server.Port = port
+	server.Host = host
+	server.Username = username
+	server.Password = secret
+	server.KeepAlive = true
+
+	if transport == nil {
+		transport = &Transport{}
+	}
+
+	starttls, err := transport.apply(server)
+
+	if err != nil {
+		return nil, err
+	}
+
+	pool := NewSMTPPool(server, options...)
+	pool.starttls = starttls
+
+	return &SMTPMailer{pool: pool}, nil
+}
+
+func (s *SMTPMailer) Send(from string, to string, m *Message) error {
+
+	msg, err := compose(from, to, m)
+
+	if err != nil {
+		return err
+	}
+
+	return s.pool.Send(msg)
+}
+
+func (s *SMTPMailer) Close() {
+	s.pool.Close()
+}
+
+// SendmailMailer pipes messages to a local sendmail compatible binary.
+type SendmailMailer struct {
+	path string
+}
+
+func NewSendmailMailer(path string) *SendmailMailer {
+	if path == "" {
+		path = DefaultSendmail
+	}
+	return &SendmailMailer{path: path}
+}
+
+func (s *SendmailMailer) Send(from string, to string, m *Message) error {
+
+	msg, err := compose(from, to, m)
+
+	if err != nil {
+		return err
+	}
+
+	cmd := exec.Command(s.path, "-i", "-f", from, "--", to)
+	cmd.Stdin = strings.NewReader(raw(msg))
+
+	if out, err := cmd.CombinedOutput(); err != nil {
+		reason := strings.TrimSpace(string(out))
+		if reason == "" {
+			reason = err.Error()
+		}
+		return &DeliveryError{Backend: BackendSendmail, Reason: reason}
+	}
+
+	return nil
+}
+
+// MaildirMailer drops messages into the new folder of a Maildir, which
+// makes it an outbox for development and testing.
+type MaildirMailer struct {
+	dir  string
+	host string
+	seq  uint64
+}
+
+func NewMaildirMailer(dir string) (*MaildirMailer, error) {
+
+	for _, sub := range []string{"tmp", "new", "cur"} {
+		if err := os.MkdirAll(filepath.Join(dir, sub), 0700); err != nil {
+			return nil, err
+		}
+	}
+
+	host, err := os.Hostname()
+
+	if err != nil {
+		host = "localhost"
+	}
+
+	host = strings.NewReplacer("/", "\\057", ":", "\\072").Replace(host)
+
+	return &MaildirMailer{dir: dir, host: host}, nil
+}
+
+func (d *MaildirMailer) Send(from string, to string, m *Message) error {
+
+	msg, err := compose(from, to, m)
+
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	name := fmt.Sprintf("%d.M%dP%dQ%d.%s", now.Unix(), now.Nanosecond()/1000,
+		os.Getpid(), atomic.AddUint64(&d.seq, 1), d.host)
+
+	tmp := filepath.Join(d.dir, "tmp", name)
+
+	if err := os.WriteFile(tmp, []byte(raw(msg)), 0600); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, filepath.Join(d.dir, "new", name))
+}
+
+// HTTPMail is the JSON body posted by HTTPMailer.
+type HTTPMail struct {
+	From    string `json:"from"`
+	To      string `json:"to"`
+	Subject string `json:"subject"`
+	Text    string `json:"text"`
+	HTML    string `json:"html,omitempty"`
+}
+
+// HTTPMailer posts messages to a JSON mail API, authenticated with a bearer
+// token when one is set. Signing is left to the API provider.
+type HTTPMailer struct {
+	endpoint string
+	token    string
+	client   *http.Client
+}
+
+func NewHTTPMailer(endpoint string, token string) *HTTPMailer {
+	return &HTTPMailer{
+		endpoint: endpoint,
+		token:    token,
+		client:   &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+func (h *HTTPMailer) Send(from string, to string, m *Message) error {
+
+	body, err := json.Marshal(&HTTPMail{
+		From:    from,
+		To:      to,
+		Subject: m.Subject,
+		Text:    m.Text,
+		HTML:    m.HTML,
+	})
+
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, h.endpoint, bytes.NewReader(body))
+
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+
+	if h.token != "" {
+		req.Header.Set("Authorization", "Bearer "+h.token)
+	}
+
+	resp, err := h.client.Do(req)
+
+	if err != nil {
+		return err
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		return &DeliveryError{Backend: BackendHTTP, Reason: resp.Status}
+	}
+
+	return nil
+}
@@ -0,0 +1,123 @@
+package email
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+var testMessage = &Message{Subject: "Verification", Text: "code 012345", HTML: "<p>code 012345</p>"}
+
+func TestMaildirMailer(t *testing.T) {
+
+	dir := t.TempDir()
+
+	_, err := NewMaildirMailer(filepath.Join(dir, "file"))
+	assert.NoError(t, err)
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "blocked"), nil, 0600))
+	_, err = NewMaildirMailer(filepath.Join(dir, "blocked"))
+	assert.Error(t, err)
+
+	m, err := NewMaildirMailer(filepath.Join(dir, "outbox"))
+	assert.NoError(t, err)
+
+	assert.Error(t, m.Send("not an address", "user@example2.org", testMessage))
+
+	l, _ := zap.NewProduction()
+	dialer, _ := NewEmailDialer(l.Sugar(), WithMailer(m, "admin@example2.org"), WithSubject("Fallback"))
+
+	assert.NoError(t, dialer.send("user@example2.org", testMessage))
+	assert.NoError(t, dialer.send("user@example2.org", &Message{Text: "plain"}))
+
+	entries, err := os.ReadDir(filepath.Join(dir, "outbox", "new"))
+	assert.NoError(t, err)
+	assert.Len(t, entries, 2)
+
+	var all string
+
+	for _, e := range entries {
+		data, err := os.ReadFile(filepath.Join(dir, "outbox", "new", e.Name()))
+		assert.NoError(t, err)
+		all += string(data)
+	}
+
+	assert.Contains(t, all, "To: <user@example2.org>")
+	assert.Contains(t, all, "multipart/alternative")
+	assert.Contains(t, all, "Subject: Verification")
+	assert.Contains(t, all, "Subject: Fallback")
+
+	tmp, _ := os.ReadDir(filepath.Join(dir, "outbox", "tmp"))
+	assert.Empty(t, tmp)
+}
+
+func TestSendmailMailer(t *testing.T) {
+
+	assert.Equal(t, DefaultSendmail, NewSendmailMailer("").path)
+
+	dir := t.TempDir()
+	out := filepath.Join(dir, "out")
+	script := filepath.Join(dir, "sendmail")
+
+	assert.NoError(t, os.WriteFile(script, []byte("#!/bin/sh\necho \"$@\" > "+out+".args\ncat > "+out+"\n"), 0700))
+
+	m := NewSendmailMailer(script)
+	assert.NoError(t, m.Send("admin@example2.org", "user@example2.org", testMessage))
+
+	args, _ := os.ReadFile(out + ".args")
+	assert.Equal(t, "-i -f admin@example2.org -- user@example2.org\n", string(args))
+
+	data, _ := os.ReadFile(out)
+	assert.Contains(t, string(data), "To: <user@example2.org>")
+
+	assert.Error(t, m.Send("not an address", "user@example2.org", testMessage))
+
+	failing := filepath.Join(dir, "failing")
+	assert.NoError(t, os.WriteFile(failing, []byte("#!/bin/sh\necho 'no such user' >&2\nexit 67\n"), 0700))
+
+	err := NewSendmailMailer(failing).Send("admin@example2.org", "user@example2.org", testMessage)
+	assert.IsType(t, &DeliveryError{}, err)
+	assert.Contains(t, err.Error(), "no such user")
+
+	err = NewSendmailMailer(filepath.Join(dir, "missing")).Send("admin@example2.org", "user@example2.org", testMessage)
+	assert.IsType(t, &DeliveryError{}, err)
+}
+
+func TestHTTPMailer(t *testing.T) {
+
+	var got HTTPMail
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		assert.Equal(t, "application/json", r.Header.Get("Content-Type"))
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&got))
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer srv.Close()
+
+	assert.NoError(t, NewHTTPMailer(srv.URL, "token").Send("admin@example2.org", "user@example2.org", testMessage))
+	assert.Equal(t, HTTPMail{
+		From:    "admin@example2.org",
+		To:      "user@example2.org",
+		Subject: "Verification",
+		Text:    "code 012345",
+		HTML:    "<p>code 012345</p>",
+	}, got)
+
+	err := NewHTTPMailer(srv.URL, "").Send("admin@example2.org", "user@example2.org", testMessage)
+	assert.IsType(t, &DeliveryError{}, err)
+	var _ = err.Error()
+
+	assert.Error(t, NewHTTPMailer("http://127.0.0.1:0", "").Send("admin@example2.org", "user@example2.org", testMessage))
+	assert.Error(t, NewHTTPMailer("://", "").Send("admin@example2.org", "user@example2.org", testMessage))
+
+	var _ = (&BackendError{Backend: "pigeon"}).Error()
+}
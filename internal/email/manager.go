@@ -1,14 +1,18 @@
 package email
 
 import (
+	crand "crypto/rand"
+	"encoding/hex"
 	"fmt"
 	"math/rand"
+	"net/url"
 	"regexp"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/Cealgull/Verify/internal/cache"
 	"github.com/Cealgull/Verify/internal/proto"
-	mail "github.com/xhit/go-simple-mail/v2"
 	"go.uber.org/zap"
 )
 
@@ -16,7 +20,8 @@ type EmailDialer struct {
 	from    string
 	todom   string
 	subject string
-	server  *mail.SMTPServer
+	mailer  Mailer
+	dkim    *DKIM
 	logger  *zap.SugaredLogger
 }
 
@@ -31,13 +36,11 @@ func WithSubject(subject string) DialerOption {
 
 func WithClient(host string, port int, from string, secret string) DialerOption {
 	return func(dialer *EmailDialer) error {
-		server := mail.NewSMTPClient()
-		server.Port = port
-		server.Host = host
-		server.Username = from
-		server.Password = secret
-		server.KeepAlive = true
-		dialer.server = server
+		mailer, err := NewSMTPMailer(host, port, from, secret, nil)
+		if err != nil {
+			return err
+		}
+		dialer.mailer = mailer
 		dialer.from = from
 		dialer.logger.Debugf("SMTP Server Host: %s", host)
 		dialer.logger.Debugf("SMTP Port: %d", port)
@@ -46,6 +49,25 @@ func WithClient(host string, port int, from string, secret string) DialerOption
 	}
 }
 
+// WithMailer delivers the mails of the dialer through m as from.
+func WithMailer(m Mailer, from string) DialerOption {
+	return func(dialer *EmailDialer) error {
+		dialer.mailer = m
+		dialer.from = from
+		dialer.logger.Debugf("Mail backend: %T", m)
+		dialer.logger.Debugf("Sender email: %s", from)
+		return nil
+	}
+}
+
+func WithDKIM(d *DKIM) DialerOption {
+	return func(dialer *EmailDialer) error {
+		dialer.dkim = d
+		dialer.logger.Debugf("DKIM signing as %s, selector %s", d.options.Domain, d.options.Selector)
+		return nil
+	}
+}
+
 func WithToDom(todom string) DialerOption {
 	return func(dialer *EmailDialer) error {
 		dialer.todom = todom
@@ -60,40 +82,48 @@ func NewEmailDialer(logger *zap.SugaredLogger, options ...DialerOption) (*EmailD
 	dialer.logger = logger
 
 	for _, option := range options {
-		err := option(&dialer)
-		var _ = err
+		if err := option(&dialer); err != nil {
+			return nil, err
+		}
 	}
 	return &dialer, nil
 }
 
-func (d *EmailDialer) send(account string, content string) error {
-	to := fmt.Sprintf("%s@%s", account, d.todom)
-	msg := mail.NewMSG()
-	msg.SetFrom(d.from).
-		AddTo(to).
-		SetSubject(d.subject).
-		SetBody(mail.TextPlain, content)
+// send delivers m to the address to.
+func (d *EmailDialer) send(to string, m *Message) error {
 
-	client, err := d.server.Connect()
+	msg := *m
 
-	if err != nil {
-		return err
+	if msg.Subject == "" {
+		msg.Subject = d.subject
 	}
 
-	d.logger.Debugf("Sending verification code to account: %s.", account)
+	msg.dkim = d.dkim
 
-	err = msg.Send(client)
+	d.logger.Debugf("Sending verification code to %s.", to)
 
-	return err
+	return d.mailer.Send(d.from, to, &msg)
 }
 
 type EmailManager struct {
-	dialer   *EmailDialer
-	logger   *zap.SugaredLogger
-	cache    cache.Cache
-	codeexp  *regexp.Regexp
-	accexp   *regexp.Regexp
-	template string
+	dialer    *EmailDialer
+	logger    *zap.SugaredLogger
+	cache     cache.Cache
+	codeexp   *regexp.Regexp
+	accexp    *regexp.Regexp
+	template  string
+	templates *Templates
+	link      string
+	domains   map[string]*Domain
+	order     []string
+	queue     *Queue
+	mode      string
+	secret    []byte
+	ttl       time.Duration
+	cooldown  time.Duration
+	attempts  int
+	lockout   time.Duration
+	ceiling   time.Duration
 }
 
 type ManagerOption func(mgr *EmailManager) error
@@ -105,6 +135,25 @@ func WithEmailTemplate(template string) ManagerOption {
 	}
 }
 
+// WithTemplates renders verification messages from localized templates
+// instead of the plain text format string.
+func WithTemplates(t *Templates) ManagerOption {
+	return func(mgr *EmailManager) error {
+		mgr.templates = t
+		return nil
+	}
+}
+
+// WithLink sets the verification page handed to the templates as Link,
+// with the account and code added to its query.
+func WithLink(base string) ManagerOption {
+	return func(mgr *EmailManager) error {
+		_, err := url.Parse(base)
+		mgr.link = base
+		return err
+	}
+}
+
 func WithCodeExp(rule string) ManagerOption {
 	return func(mgr *EmailManager) error {
 		var err error
@@ -135,92 +184,391 @@ func WithEmailDialer(dialer *EmailDialer) ManagerOption {
 	}
 }
 
+// WithQueue hands the mails to q instead of delivering them within Sign.
+func WithQueue(q *Queue) ManagerOption {
+	return func(mgr *EmailManager) error {
+		mgr.queue = q
+		return nil
+	}
+}
+
 func NewEmailManager(logger *zap.SugaredLogger, options ...ManagerOption) (*EmailManager, error) {
 
 	var mgr EmailManager
 	mgr.logger = logger
+	mgr.domains = make(map[string]*Domain)
 
 	for _, option := range options {
-		var _ = option(&mgr)
+		if err := option(&mgr); err != nil {
+			return nil, err
+		}
+	}
+
+	if len(mgr.order) == 0 && mgr.dialer != nil && mgr.dialer.todom != "" {
+		d, _ := NewDomain(mgr.dialer.todom)
+		var _ = WithDomains(d)(&mgr)
+	}
+
+	switch mgr.mode {
+	case "":
+		mgr.mode = ModeCode
+	case ModeCode:
+	case ModeLink, ModeBoth:
+		if mgr.link == "" {
+			return nil, &ModeError{Mode: mgr.mode, Reason: "a link page is required"}
+		}
+	default:
+		return nil, &ModeError{Mode: mgr.mode, Reason: "unknown mode"}
+	}
+
+	if mgr.sendsLink() && len(mgr.secret) == 0 {
+		mgr.secret = make([]byte, 32)
+		var _, _ = crand.Read(mgr.secret)
+	}
+
+	if mgr.ttl <= 0 {
+		mgr.ttl = DefaultCodeTTL
+	}
+
+	if mgr.cooldown <= 0 {
+		mgr.cooldown = DefaultCooldown
+	}
+
+	if mgr.cooldown > mgr.ttl {
+		mgr.cooldown = mgr.ttl
+	}
+
+	if mgr.attempts <= 0 {
+		mgr.attempts = DefaultAttempts
+	}
+
+	if mgr.lockout <= 0 {
+		mgr.lockout = DefaultLockout
+	}
+
+	if mgr.ceiling <= 0 {
+		mgr.ceiling = DefaultLockoutCeiling
+	}
+
+	if mgr.ceiling < mgr.lockout {
+		mgr.ceiling = mgr.lockout
+	}
+
+	if mgr.queue != nil {
+		mgr.queue.Start(mgr.deliver)
 	}
 
 	return &mgr, nil
 }
 
-func (m *EmailManager) Sign(account string) (int, proto.VerifyError) {
+func (m *EmailManager) verifyLink(account string, code string) string {
 
-	code := rand.Intn(1000000)
-	content := fmt.Sprintf(m.template, code)
+	u, err := url.Parse(m.link)
+
+	if m.link == "" || err != nil {
+		return ""
+	}
+
+	q := u.Query()
+	q.Set("account", account)
+	q.Set("code", code)
+	u.RawQuery = q.Encode()
+
+	return u.String()
+}
+
+// message renders the verification message of account, carrying the code,
+// the magic link or both depending on the mode.
+func (m *EmailManager) message(d *Domain, account string, code int, token string, preferences []string) (*Message, error) {
+
+	templates, template := d.templates, d.template
+
+	if templates == nil {
+		templates = m.templates
+	}
+
+	if template == "" {
+		template = m.template
+	}
+
+	var s, link string
+
+	if m.sendsCode() {
+		s = fmt.Sprintf("%06d", code)
+		link = m.verifyLink(account+"@"+d.name, s)
+	}
+
+	if token != "" {
+		link = m.magicLink(token)
+	}
 
-	m.logger.Infof("Signing verification code for %s.", account)
+	var msg *Message
+
+	if templates == nil {
+		var lines []string
+		if m.sendsCode() {
+			lines = append(lines, fmt.Sprintf(template, code))
+		}
+		if token != "" {
+			lines = append(lines, link)
+		}
+		msg = &Message{Text: strings.Join(lines, "\n")}
+	} else {
+		var err error
+		msg, err = templates.Render(&TemplateData{
+			Account: account,
+			Code:    s,
+			Expiry:  int(m.ttl / time.Minute),
+			Link:    link,
+		}, preferences...)
+		if err != nil {
+			return nil, err
+		}
+	}
 
-	if !m.accexp.Match([]byte(account)) {
-		m.logger.Debugf("Format checking failure for account: %s", account)
-		return -1, &AccountFormatError{}
+	if msg.Subject == "" {
+		msg.Subject = d.subject
 	}
 
-	count, err := m.cache.Exists(account)
+	return msg, nil
+}
+
+func jobID() string {
+	b := make([]byte, 8)
+	var _, _ = crand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// deliver composes the message of job and sends it through the route of
+// its domain.
+func (m *EmailManager) deliver(job *Job) error {
+
+	msg, err := m.compose(job)
 
 	if err != nil {
-		m.logger.Errorf("Redis failure when signing for %s.", account)
-		return -1, &EmailInternalError{}
+		return err
 	}
 
-	if count != 0 {
-		m.logger.Debugf("Email code duplicated for account: %s.", account)
-		return -1, &DuplicateEmailError{}
+	if msg == nil {
+		m.logger.Debugf("Verification of %s is gone, dropping email job %s.", job.To, job.ID)
+		return nil
 	}
 
-	if err := m.dialer.send(account, content); err != nil {
-		m.logger.Debugf("Email dialing for account: %s.", account)
-		return -1, &EmailDialingError{}
+	return m.send(job, msg)
+}
+
+// compose renders the message of job from the code and magic link pending
+// for its address. A nil message means the verification is no longer
+// pending, e.g. it was redeemed or has expired.
+func (m *EmailManager) compose(job *Job) (*Message, error) {
+
+	account, d, verr := m.resolve(job.To)
+
+	if verr != nil {
+		return nil, verr
+	}
+
+	var code int
+	var token string
+
+	if m.sendsCode() {
+		truth, err := m.cache.Get(job.To)
+		if _, ok := err.(*cache.KeyError); ok {
+			return nil, nil
+		} else if err != nil {
+			return nil, err
+		}
+		if code, err = strconv.Atoi(truth); err != nil {
+			return nil, err
+		}
+	}
+
+	if m.sendsLink() {
+		value, err := m.cache.Get(linkPrefix + job.To)
+		if _, ok := err.(*cache.KeyError); ok {
+			return nil, nil
+		} else if err != nil {
+			return nil, err
+		}
+		token = m.token(job.To, value)
+	}
+
+	return m.message(d, account, code, token, job.Preferences)
+}
+
+func (m *EmailManager) send(job *Job, msg *Message) error {
+
+	dialer := m.dialer
+
+	if d, ok := m.domains[job.Domain]; ok && d.dialer != nil {
+		dialer = d.dialer
 	}
 
-	if err := m.cache.Set(account, fmt.Sprintf("%06d", code), time.Duration(5)*time.Minute); err != nil {
-		m.logger.Errorf("Redis failure for setting verifcation code buffer for account: %s.", account)
+	return dialer.send(job.To, msg)
+}
+
+// Close stops the delivery queue, leaving the undelivered mails in the
+// cache.
+func (m *EmailManager) Close() {
+	if m.queue != nil {
+		m.queue.Stop()
+	}
+}
+
+// forget drops the code and magic link pending for address.
+func (m *EmailManager) forget(address string) {
+	var _ = m.cache.Del(address)
+	var _ = m.cache.Del(linkPrefix + address)
+}
+
+// Sign sends a new verification code to address, either a full address or
+// an account of the default domain. The preferences pick the template
+// locale, see Templates.Match.
+func (m *EmailManager) Sign(address string, preferences ...string) (int, proto.VerifyError) {
+	return m.sign(address, false, preferences)
+}
+
+func (m *EmailManager) sign(address string, resend bool, preferences []string) (int, proto.VerifyError) {
+
+	code := rand.Intn(1000000)
+
+	if resend {
+		m.logger.Infof("Resending verification code for %s.", address)
+	} else {
+		m.logger.Infof("Signing verification code for %s.", address)
+	}
+
+	account, d, verr := m.resolve(address)
+
+	if verr != nil {
+		return -1, verr
+	}
+
+	address = account + "@" + d.name
+
+	if left, verr := m.locked(address); verr != nil {
+		return -1, verr
+	} else if left > 0 {
+		m.logger.Debugf("Signing refused for locked account: %s.", address)
+		return -1, &AccountLockedError{Retry: left}
+	}
+
+	t, verr := m.pending(address)
+
+	if verr != nil {
+		return -1, verr
+	}
+
+	switch {
+	case resend && t == nil:
+		m.logger.Debugf("Nothing to resend for account: %s.", address)
+		return -1, &AccountNotFoundError{}
+	case resend && t.Resend > 0:
+		m.logger.Debugf("Resend cooling down for account: %s.", address)
+		return -1, &ResendCooldownError{Timing: *t}
+	case resend:
+		m.forget(address)
+	case t != nil:
+		m.logger.Debugf("Email code duplicated for account: %s.", address)
+		return -1, &DuplicateEmailError{Timing: *t}
+	default:
+		var _ = m.cache.Del(attemptsPrefix + address)
+	}
+
+	if m.sendsCode() {
+		if err := m.cache.Set(address, fmt.Sprintf("%06d", code), m.ttl); err != nil {
+			m.logger.Errorf("Redis failure for setting verifcation code buffer for account: %s.", address)
+			return -1, &EmailInternalError{}
+		}
+	}
+
+	if m.sendsLink() {
+		if err := m.issueToken(address); err != nil {
+			m.logger.Errorf("Issuing magic link for account %s failed.", address)
+			m.forget(address)
+			return -1, &EmailInternalError{}
+		}
+	}
+
+	job := Job{ID: jobID(), Domain: d.name, To: address, Preferences: preferences}
+
+	if m.queue != nil {
+		if err := m.queue.Enqueue(&job); err != nil {
+			m.logger.Errorf("Queueing verification email for account %s failed.", address)
+			m.forget(address)
+			return -1, &EmailInternalError{}
+		}
+		return code, nil
+	}
+
+	msg, err := m.compose(&job)
+
+	if err != nil || msg == nil {
+		m.logger.Errorf("Composing verification message for account %s failed.", address)
+		m.forget(address)
 		return -1, &EmailInternalError{}
 	}
 
+	if err := m.send(&job, msg); err != nil {
+		m.logger.Debugf("Email dialing for account: %s.", address)
+		m.forget(address)
+		return -1, &EmailDialingError{}
+	}
+
 	return code, nil
 }
 
-func (m *EmailManager) Verify(account string, guess string) (bool, proto.VerifyError) {
+func (m *EmailManager) Verify(address string, guess string) (bool, proto.VerifyError) {
+
+	m.logger.Infof("Verifying code for %s.", address)
 
-	m.logger.Infof("Verifying code for %s.", account)
+	account, d, verr := m.resolve(address)
 
-	if !m.accexp.Match([]byte(account)) {
-		m.logger.Debugf("Format checking error for account: %s.", account)
-		return false, &AccountFormatError{}
+	if verr != nil {
+		return false, verr
 	}
 
+	address = account + "@" + d.name
+
 	if !m.codeexp.Match([]byte(guess)) {
 		m.logger.Debugf("Format checking error for code: %s.", guess)
 		return false, &CodeFormatError{}
 	}
 
-	truth, err := m.cache.Get(account)
+	if left, verr := m.locked(address); verr != nil {
+		return false, verr
+	} else if left > 0 {
+		m.logger.Debugf("Verification refused for locked account: %s.", address)
+		return false, &AccountLockedError{Retry: left}
+	}
+
+	truth, err := m.cache.Get(address)
 
 	if _, ok := err.(*cache.InternalError); ok {
 		m.logger.Errorf("Redis Failure when getting verification truth for guess: %s", guess)
 		return false, &EmailInternalError{}
 	} else if _, ok := err.(*cache.KeyError); ok {
-		m.logger.Debugf("Account not signed for verification code: %s.", account)
+		m.logger.Debugf("Account not signed for verification code: %s.", address)
 		return false, &AccountNotFoundError{}
 	}
 
 	if guess != truth {
-		m.logger.Infof("Code verfication failed for account: %s.", account)
-		return false, &CodeIncorrectError{}
+		m.logger.Infof("Code verfication failed for account: %s.", address)
+		return false, m.fail(address)
 	}
 
-	err = m.cache.Del(account)
+	err = m.cache.Del(address)
 
 	if _, ok := err.(*cache.InternalError); ok {
-		m.logger.Errorf("Redis Failure when deleting verification truth for guess: %s", account)
+		m.logger.Errorf("Redis Failure when deleting verification truth for guess: %s", address)
 		return false, &EmailInternalError{}
 	}
 
-	m.logger.Infof("Code verification succeeded for account: %s.", account)
+	var _ = m.cache.Del(linkPrefix + address)
+	var _ = m.cache.Del(attemptsPrefix + address)
+	var _ = m.cache.Del(lockoutsPrefix + address)
+
+	m.logger.Infof("Code verification succeeded for account: %s.", address)
 
 	return true, nil
 
@@ -3,7 +3,9 @@ package email
 import (
 	"fmt"
 	"math/rand"
+	"strings"
 	"testing"
+	texttemplate "text/template"
 
 	"github.com/Cealgull/Verify/internal/cache"
 	mockcache "github.com/Cealgull/Verify/internal/cache/mock"
@@ -27,7 +29,7 @@ func TestFailedDialer(t *testing.T) {
 	)
 
 	assert.Nil(t, err)
-	err = dialer.send("somebody", "hello world")
+	err = dialer.send("somebody", &Message{Text: "hello world"})
 	assert.NotNil(t, err)
 }
 
@@ -36,10 +38,11 @@ func TestNewEmailManager(t *testing.T) {
 	l, _ := zap.NewProduction()
 
 	server = mocksmtp.New(mocksmtp.ConfigurationAttr{
-		PortNumber:              2333,
-		LogToStdout:             false,
-		LogServerActivity:       false,
-		BlacklistedRcpttoEmails: []string{"user3@example2.org"},
+		PortNumber:               2333,
+		LogToStdout:              false,
+		LogServerActivity:        false,
+		BlacklistedRcpttoEmails:  []string{"user3@example2.org"},
+		MultipleMessageReceiving: true,
 	})
 
 	err := server.Start()
@@ -58,6 +61,11 @@ func TestNewEmailManager(t *testing.T) {
 
 	c = mockcache.NewMockCache()
 
+	for _, option := range []ManagerOption{WithAccExp("["), WithCodeExp("("), WithLink("http://[::1")} {
+		_, err = NewEmailManager(l.Sugar(), WithEmailDialer(dialer), WithCache(c), option)
+		assert.Error(t, err)
+	}
+
 	mgr, err = NewEmailManager(
 		l.Sugar(),
 		WithEmailDialer(dialer),
@@ -83,7 +91,7 @@ func TestEmailSign(t *testing.T) {
 	var _ = err.Status()
 	var _ = err.Message()
 
-	c.AddGetErr("user1", &cache.InternalError{})
+	c.AddGetErr("user1@example2.org", &cache.InternalError{})
 	_, err = mgr.Sign("user1")
 	assert.IsType(t, &EmailInternalError{}, err)
 	var _ = err.Status()
@@ -94,7 +102,7 @@ func TestEmailSign(t *testing.T) {
 	var _ = err.Status()
 	var _ = err.Message()
 
-	c.AddSetErr("user2", &cache.InternalError{})
+	c.AddSetErr("user2@example2.org", &cache.InternalError{})
 	_, err = mgr.Sign("user2")
 	assert.IsType(t, &EmailInternalError{}, err)
 	var _ = err.Status()
@@ -147,7 +155,7 @@ func TestEmailVerify(t *testing.T) {
 	_, err = mgr.Verify("user4", fmt.Sprintf("%06d", code))
 	assert.IsType(t, &AccountNotFoundError{}, err)
 
-	c.AddDelErr("user6", &cache.InternalError{})
+	c.AddDelErr("user6@example2.org", &cache.InternalError{})
 
 	code, _ = mgr.Sign("user6")
 	_, err = mgr.Verify("user6", fmt.Sprintf("%06d", code))
@@ -156,6 +164,154 @@ func TestEmailVerify(t *testing.T) {
 
 }
 
+func TestTemplates(t *testing.T) {
+
+	_, err := LoadTemplates("./testdata/notexists", "en")
+	assert.Error(t, err)
+
+	_, err = LoadTemplates("./testdata/templates", "!!")
+	assert.IsType(t, &TemplateError{}, err)
+
+	_, err = LoadTemplates("./testdata/templates", "fr")
+	assert.IsType(t, &TemplateError{}, err)
+
+	for _, dir := range []string{"broken", "unknown", "missing"} {
+		_, err = LoadTemplates("./testdata/"+dir, "en")
+		assert.IsType(t, &TemplateError{}, err)
+		var _ = err.Error()
+	}
+
+	templates, err := LoadTemplates("./testdata/templates", "en")
+	assert.NoError(t, err)
+
+	assert.Equal(t, "en", templates.Match())
+	assert.Equal(t, "en", templates.Match("fr"))
+	assert.Equal(t, "zh-CN", templates.Match("", "zh-CN,zh;q=0.9,en;q=0.8"))
+	assert.Equal(t, "zh-CN", templates.Match("zh"))
+	assert.Equal(t, "en", templates.Match("en-GB", "zh-CN"))
+	assert.Equal(t, "en", templates.Match("invalid;;", "de"))
+
+	msg, err := templates.Render(&TemplateData{Account: "user", Code: "012345", Expiry: 5, Link: "https://example.org/?a=1&b=2"}, "zh-CN")
+	assert.NoError(t, err)
+	assert.Equal(t, "【Cealgull】验证码 012345", msg.Subject)
+	assert.Contains(t, msg.Text, "5 分钟")
+	assert.Contains(t, msg.Text, "https://example.org/?a=1&b=2")
+	assert.Contains(t, msg.HTML, "https://example.org/?a=1&amp;b=2")
+
+	msg, err = templates.Render(&TemplateData{Account: "<b>user</b>", Code: "012345", Expiry: 5})
+	assert.NoError(t, err)
+	assert.Contains(t, msg.HTML, "&lt;b&gt;user&lt;/b&gt;")
+	assert.NotContains(t, msg.Text, "verify by opening")
+}
+
+func TestTemplatedSign(t *testing.T) {
+
+	l, _ := zap.NewProduction()
+
+	templates, err := LoadTemplates("./testdata/templates", "en")
+	assert.NoError(t, err)
+
+	mgr, _ := NewEmailManager(
+		l.Sugar(),
+		WithEmailDialer(mgr.dialer),
+		WithTemplates(templates),
+		WithLink("https://verify.example.org/email"),
+		WithAccExp("^[a-zA-Z0-9-_\\.]{3,50}$"),
+		WithCodeExp("^\\d{6}$"),
+		WithCache(c),
+	)
+
+	assert.Equal(t, "https://verify.example.org/email?account=user7&code=012345", mgr.verifyLink("user7", "012345"))
+
+	_, verr := mgr.Sign("user7", "", "zh-CN")
+	assert.Nil(t, verr)
+
+	var data string
+
+	for _, msg := range server.Messages() {
+		if strings.Contains(msg.MsgRequest(), "user7@example2.org") {
+			data = msg.MsgRequest()
+		}
+	}
+
+	assert.Contains(t, data, "multipart/alternative")
+	assert.Contains(t, data, "text/html")
+
+	// templates failing at render time
+	templates.locales["en"].text = texttemplate.Must(texttemplate.New("body").Parse("{{.Code.Missing}}"))
+	_, verr = mgr.Sign("user8")
+	assert.IsType(t, &EmailInternalError{}, verr)
+}
+
+func TestEmailDomains(t *testing.T) {
+
+	l, _ := zap.NewProduction()
+
+	route, _ := NewEmailDialer(
+		l.Sugar(),
+		WithClient("localhost", 2333, "admin@example3.org", "secret"),
+	)
+
+	_, err := NewDomain("example4.org", WithDomainAccExp("(["))
+	assert.Error(t, err)
+
+	student, _ := NewDomain("Example2.org", WithDomainAccExp("^[0-9]{6}$"))
+	staff, _ := NewDomain("example3.org",
+		WithDomainSubject("Staff Verification"),
+		WithDomainTemplate("Staff code %06d"),
+		WithDomainDialer(route),
+	)
+
+	assert.Equal(t, "example2.org", student.Name())
+
+	mgr, _ := NewEmailManager(
+		l.Sugar(),
+		WithEmailDialer(mgr.dialer),
+		WithEmailTemplate("The Verification is %06d"),
+		WithAccExp("^[a-zA-Z0-9-_\\.]{3,50}$"),
+		WithCodeExp("^\\d{6}$"),
+		WithCache(c),
+		WithDomains(student, staff, student),
+	)
+
+	_, verr := mgr.Sign("user9@example5.org")
+	assert.IsType(t, &DomainNotAllowedError{}, verr)
+	var _ = verr.Status()
+	var _ = verr.Message()
+
+	_, verr = mgr.Verify("user9@example5.org", "123456")
+	assert.IsType(t, &DomainNotAllowedError{}, verr)
+
+	_, verr = mgr.Sign("user9")
+	assert.IsType(t, &AccountFormatError{}, verr)
+
+	code, verr := mgr.Sign("200001")
+	assert.Nil(t, verr)
+
+	f, _ := mgr.Verify("200001@EXAMPLE2.ORG", fmt.Sprintf("%06d", code))
+	assert.True(t, f)
+
+	code, verr = mgr.Sign("user9@example3.org")
+	assert.Nil(t, verr)
+
+	var data string
+
+	for _, msg := range server.Messages() {
+		if strings.Contains(msg.MsgRequest(), "user9@example3.org") {
+			data = msg.MsgRequest()
+		}
+	}
+
+	assert.Contains(t, data, "Staff Verification")
+	assert.Contains(t, data, fmt.Sprintf("Staff code %06d", code))
+
+	_, verr = mgr.Verify("user9", fmt.Sprintf("%06d", code))
+	assert.IsType(t, &AccountFormatError{}, verr)
+
+	f, _ = mgr.Verify("user9@example3.org", fmt.Sprintf("%06d", code))
+	assert.True(t, f)
+}
+
 func TestCloseServer(t *testing.T) {
 	assert.NoError(t, server.Stop())
 }
@@ -0,0 +1,204 @@
+package email
+
+import (
+	"crypto/tls"
+	"errors"
+	"net/textproto"
+	"sync/atomic"
+	"time"
+
+	mail "github.com/xhit/go-simple-mail/v2"
+)
+
+const (
+	defaultPoolSize    = 4
+	defaultIdleTimeout = 30 * time.Second
+	defaultHealthCheck = 5 * time.Second
+)
+
+type pooled struct {
+	client *mail.SMTPClient
+	used   time.Time
+}
+
+// SMTPPool keeps at most size authenticated clients open to one relay.
+// Clients idle longer than the idle timeout are closed, those idle longer
+// than the health check interval are probed with NOOP before reuse.
+type SMTPPool struct {
+	server *mail.SMTPServer
+	idle   chan *pooled
+	slots  chan struct{}
+	expire time.Duration
+	check  time.Duration
+	dials  int64
+	// starttls fails the connections on which the relay did not upgrade
+	starttls bool
+}
+
+type PoolOption func(p *SMTPPool)
+
+func WithPoolSize(size int) PoolOption {
+	return func(p *SMTPPool) {
+		if size > 0 {
+			p.idle = make(chan *pooled, size)
+			p.slots = make(chan struct{}, size)
+		}
+	}
+}
+
+func WithIdleTimeout(timeout time.Duration) PoolOption {
+	return func(p *SMTPPool) {
+		if timeout > 0 {
+			p.expire = timeout
+		}
+	}
+}
+
+func WithHealthCheck(interval time.Duration) PoolOption {
+	return func(p *SMTPPool) {
+		if interval > 0 {
+			p.check = interval
+		}
+	}
+}
+
+func NewSMTPPool(server *mail.SMTPServer, options ...PoolOption) *SMTPPool {
+
+	p := SMTPPool{
+		server: server,
+		expire: defaultIdleTimeout,
+		check:  defaultHealthCheck,
+	}
+
+	WithPoolSize(defaultPoolSize)(&p)
+
+	for _, option := range options {
+		option(&p)
+	}
+
+	return &p
+}
+
+// get hands out an idle client, or dials a new one while the pool has room.
+// It blocks when all clients are busy.
+func (p *SMTPPool) get() (*pooled, error) {
+
+	for {
+		var pc *pooled
+
+		select {
+		case pc = <-p.idle:
+		default:
+			select {
+			case pc = <-p.idle:
+			case p.slots <- struct{}{}:
+				return p.dial()
+			}
+		}
+
+		idle := time.Since(pc.used)
+
+		if idle >= p.expire || idle >= p.check && pc.client.Noop() != nil {
+			p.discard(pc)
+			continue
+		}
+
+		return pc, nil
+	}
+}
+
+func (p *SMTPPool) dial() (*pooled, error) {
+
+	atomic.AddInt64(&p.dials, 1)
+
+	server := *p.server
+	var secured int32
+
+	if p.starttls {
+		config := server.TLSConfig.Clone()
+		verify := config.VerifyConnection
+		config.VerifyConnection = func(cs tls.ConnectionState) error {
+			atomic.StoreInt32(&secured, 1)
+			if verify != nil {
+				return verify(cs)
+			}
+			return nil
+		}
+		server.TLSConfig = config
+	}
+
+	client, err := server.Connect()
+
+	if err == nil && p.starttls && atomic.LoadInt32(&secured) == 0 {
+		var _ = client.Close()
+		err = &TransportError{Reason: "relay did not offer STARTTLS"}
+	}
+
+	if err != nil {
+		<-p.slots
+		return nil, err
+	}
+
+	return &pooled{client: client}, nil
+}
+
+// put returns pc after use, resetting the session when the relay rejected
+// the message.
+func (p *SMTPPool) put(pc *pooled, err error) {
+
+	if err != nil && pc.client.Reset() != nil {
+		p.discard(pc)
+		return
+	}
+
+	pc.used = time.Now()
+	p.idle <- pc
+}
+
+func (p *SMTPPool) discard(pc *pooled) {
+	var _ = pc.client.Close()
+	<-p.slots
+}
+
+// Send delivers msg, redialing once when a pooled connection turns out to
+// be broken.
+func (p *SMTPPool) Send(msg *mail.Email) error {
+
+	for retry := true; ; retry = false {
+
+		pc, err := p.get()
+
+		if err != nil {
+			return err
+		}
+
+		fresh := pc.used.IsZero()
+		err = msg.Send(pc.client)
+
+		var reply *textproto.Error
+
+		if err == nil || errors.As(err, &reply) {
+			p.put(pc, err)
+			return err
+		}
+
+		p.discard(pc)
+
+		if fresh || !retry {
+			return err
+		}
+	}
+}
+
+// Close quits the idle clients.
+func (p *SMTPPool) Close() {
+	for {
+		select {
+		case pc := <-p.idle:
+			var _ = pc.client.Quit()
+			p.discard(pc)
+		default:
+			return
+		}
+	}
+}
@@ -0,0 +1,153 @@
+package email
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	mocksmtp "github.com/mocktools/go-smtp-mock/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+func startMockSMTP(tb testing.TB, port int) *mocksmtp.Server {
+	s := mocksmtp.New(mocksmtp.ConfigurationAttr{
+		PortNumber:               port,
+		BlacklistedRcpttoEmails:  []string{"rejected@example2.org"},
+		MultipleMessageReceiving: true,
+	})
+	assert.NoError(tb, s.Start())
+	tb.Cleanup(func() { var _ = s.Stop() })
+	return s
+}
+
+func newPoolMailer(tb testing.TB, port int, options ...PoolOption) *SMTPMailer {
+	m, err := NewSMTPMailer("localhost", port, "admin@example2.org", "secret", nil, options...)
+	assert.NoError(tb, err)
+	return m
+}
+
+func TestSMTPPool(t *testing.T) {
+
+	startMockSMTP(t, 2334)
+
+	m := newPoolMailer(t, 2334, WithPoolSize(3))
+	p := m.pool
+	defer m.Close()
+
+	for i := 0; i < 5; i++ {
+		assert.NoError(t, m.Send("admin@example2.org", "user@example2.org", testMessage))
+	}
+
+	assert.EqualValues(t, 1, atomic.LoadInt64(&p.dials))
+
+	// rejected recipients keep the connection
+	assert.Error(t, m.Send("admin@example2.org", "rejected@example2.org", testMessage))
+	assert.NoError(t, m.Send("admin@example2.org", "user@example2.org", testMessage))
+	assert.EqualValues(t, 1, atomic.LoadInt64(&p.dials))
+
+	var wg sync.WaitGroup
+
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			assert.NoError(t, m.Send("admin@example2.org", fmt.Sprintf("user%d@example2.org", i), testMessage))
+		}(i)
+	}
+
+	wg.Wait()
+
+	assert.LessOrEqual(t, atomic.LoadInt64(&p.dials), int64(3))
+	assert.LessOrEqual(t, len(p.slots), 3)
+
+	// a connection dropped by the relay is redialed
+	m = newPoolMailer(t, 2334, WithPoolSize(1))
+	p = m.pool
+
+	assert.NoError(t, m.Send("admin@example2.org", "user@example2.org", testMessage))
+	pc := <-p.idle
+	var _ = pc.client.Close()
+	p.idle <- pc
+
+	assert.NoError(t, m.Send("admin@example2.org", "user@example2.org", testMessage))
+	assert.EqualValues(t, 2, atomic.LoadInt64(&p.dials))
+}
+
+func TestSMTPPoolExpiry(t *testing.T) {
+
+	startMockSMTP(t, 2335)
+
+	m := newPoolMailer(t, 2335,
+		WithPoolSize(1), WithIdleTimeout(20*time.Millisecond), WithHealthCheck(time.Millisecond))
+	p := m.pool
+
+	assert.NoError(t, m.Send("admin@example2.org", "user@example2.org", testMessage))
+
+	// probed with NOOP and reused
+	time.Sleep(5 * time.Millisecond)
+	assert.NoError(t, m.Send("admin@example2.org", "user@example2.org", testMessage))
+	assert.EqualValues(t, 1, atomic.LoadInt64(&p.dials))
+
+	// failing the health check
+	pc := <-p.idle
+	var _ = pc.client.Close()
+	p.idle <- pc
+	time.Sleep(5 * time.Millisecond)
+	assert.NoError(t, m.Send("admin@example2.org", "user@example2.org", testMessage))
+	assert.EqualValues(t, 2, atomic.LoadInt64(&p.dials))
+
+	// expired while idle
+	time.Sleep(30 * time.Millisecond)
+	assert.NoError(t, m.Send("admin@example2.org", "user@example2.org", testMessage))
+	assert.EqualValues(t, 3, atomic.LoadInt64(&p.dials))
+
+	m.Close()
+	assert.Zero(t, len(p.slots))
+
+	assert.Error(t, newPoolMailer(t, 0).Send("admin@example2.org", "user@example2.org", testMessage))
+}
+
+func BenchmarkSMTPPooled(b *testing.B) {
+
+	startMockSMTP(b, 2336)
+
+	m := newPoolMailer(b, 2336, WithPoolSize(8))
+	defer m.Close()
+
+	b.ResetTimer()
+
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			if err := m.Send("admin@example2.org", "user@example2.org", testMessage); err != nil {
+				b.Error(err)
+			}
+		}
+	})
+}
+
+// BenchmarkSMTPUnpooled dials for every message as the dialer used to.
+func BenchmarkSMTPUnpooled(b *testing.B) {
+
+	startMockSMTP(b, 2337)
+
+	m := newPoolMailer(b, 2337)
+
+	b.ResetTimer()
+
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			msg, _ := compose("admin@example2.org", "user@example2.org", testMessage)
+			client, err := m.pool.server.Connect()
+			if err != nil {
+				b.Error(err)
+				continue
+			}
+			if err := msg.Send(client); err != nil {
+				b.Error(err)
+			}
+			var _ = client.Close()
+		}
+	})
+}
@@ -0,0 +1,339 @@
+package email
+
+import (
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/Cealgull/Verify/internal/cache"
+	"go.uber.org/zap"
+)
+
+const (
+	defaultQueueKey = "email:queue"
+	defaultWorkers  = 4
+	defaultRetries  = 5
+	defaultBackoff  = 5 * time.Second
+	defaultCeiling  = 10 * time.Minute
+	defaultPoll     = time.Second
+
+	// defaultLease bounds how long a claimed job may stay in flight before
+	// it is handed to another worker, e.g. after a restart.
+	defaultLease = time.Minute
+
+	// leaseMargin is what a lease keeps beyond the longest delivery.
+	leaseMargin = 30 * time.Second
+)
+
+// Job is a verification mail waiting for delivery. Domain picks the SMTP
+// route. The job carries no secret, the message is composed from the
+// pending code or link when it is delivered.
+type Job struct {
+	ID          string    `json:"id"`
+	Domain      string    `json:"domain"`
+	To          string    `json:"to"`
+	Preferences []string  `json:"preferences,omitempty"`
+	Attempts    int       `json:"attempts"`
+	Error       string    `json:"error,omitempty"`
+	Failed      time.Time `json:"failed"`
+}
+
+// Queue keeps the delivery jobs in three sorted sets of the cache, scored
+// by unix milliseconds: pending jobs by the time they are due, in flight
+// jobs by the end of their lease and dead letters by the time they failed.
+type Queue struct {
+	cache   cache.Cache
+	logger  *zap.SugaredLogger
+	pending string
+	flight  string
+	dead    string
+	workers int
+	retries int
+	backoff time.Duration
+	ceiling time.Duration
+	poll    time.Duration
+	lease   time.Duration
+	deliver func(job *Job) error
+	wake    chan struct{}
+	stop    chan struct{}
+	wg      sync.WaitGroup
+}
+
+type QueueOption func(q *Queue) error
+
+func WithWorkers(n int) QueueOption {
+	return func(q *Queue) error {
+		if n > 0 {
+			q.workers = n
+		}
+		return nil
+	}
+}
+
+// WithRetries sets how many delivery attempts a job gets before it becomes
+// a dead letter.
+func WithRetries(n int) QueueOption {
+	return func(q *Queue) error {
+		if n > 0 {
+			q.retries = n
+		}
+		return nil
+	}
+}
+
+// WithBackoff doubles the retry delay from base after each failed attempt,
+// up to ceiling.
+func WithBackoff(base time.Duration, ceiling time.Duration) QueueOption {
+	return func(q *Queue) error {
+		if base > 0 {
+			q.backoff = base
+		}
+		if ceiling > 0 {
+			q.ceiling = ceiling
+		}
+		return nil
+	}
+}
+
+func WithPoll(poll time.Duration) QueueOption {
+	return func(q *Queue) error {
+		if poll > 0 {
+			q.poll = poll
+		}
+		return nil
+	}
+}
+
+// WithSendTimeout lengthens the lease of claimed jobs beyond deliveries
+// taking up to timeout, so a slow relay does not get a job claimed by
+// another worker and sent twice.
+func WithSendTimeout(timeout time.Duration) QueueOption {
+	return func(q *Queue) error {
+		if lease := timeout + leaseMargin; lease > q.lease {
+			q.lease = lease
+		}
+		return nil
+	}
+}
+
+func WithQueueKey(key string) QueueOption {
+	return func(q *Queue) error {
+		q.pending = key
+		q.flight = key + ":flight"
+		q.dead = key + ":dead"
+		return nil
+	}
+}
+
+func NewQueue(logger *zap.SugaredLogger, c cache.Cache, options ...QueueOption) (*Queue, error) {
+
+	q := Queue{
+		cache:   c,
+		logger:  logger,
+		workers: defaultWorkers,
+		retries: defaultRetries,
+		backoff: defaultBackoff,
+		ceiling: defaultCeiling,
+		poll:    defaultPoll,
+		lease:   defaultLease,
+	}
+
+	var _ = WithQueueKey(defaultQueueKey)(&q)
+
+	for _, option := range options {
+		if err := option(&q); err != nil {
+			return nil, err
+		}
+	}
+
+	return &q, nil
+}
+
+func score(t time.Time) float64 {
+	return float64(t.UnixMilli())
+}
+
+func (q *Queue) push(set string, at time.Time, job *Job) error {
+
+	data, err := json.Marshal(job)
+
+	if err != nil {
+		return err
+	}
+
+	return q.cache.ZAdd(set, score(at), string(data))
+}
+
+// Enqueue stores job for immediate delivery.
+func (q *Queue) Enqueue(job *Job) error {
+
+	if err := q.push(q.pending, time.Now(), job); err != nil {
+		return err
+	}
+
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+
+	return nil
+}
+
+// DeadLetters lists the jobs which ran out of retries, oldest first.
+func (q *Queue) DeadLetters() ([]*Job, error) {
+
+	members, err := q.cache.ZRangeByScore(q.dead, score(time.Now()), 0)
+
+	if err != nil {
+		return nil, err
+	}
+
+	jobs := make([]*Job, 0, len(members))
+
+	for _, member := range members {
+		var job Job
+		if json.Unmarshal([]byte(member), &job) == nil {
+			jobs = append(jobs, &job)
+		}
+	}
+
+	return jobs, nil
+}
+
+// Start runs the workers delivering jobs through deliver, beginning with
+// those left in flight by a previous run.
+func (q *Queue) Start(deliver func(job *Job) error) {
+
+	q.deliver = deliver
+	q.wake = make(chan struct{}, 1)
+	q.stop = make(chan struct{})
+
+	for i := 0; i < q.workers; i++ {
+		q.wg.Add(1)
+		go q.work()
+	}
+}
+
+// Stop waits for the workers to finish their current job. Unfinished jobs
+// stay in the cache for the next Start.
+func (q *Queue) Stop() {
+	close(q.stop)
+	q.wg.Wait()
+}
+
+func (q *Queue) work() {
+
+	defer q.wg.Done()
+
+	ticker := time.NewTicker(q.poll)
+	defer ticker.Stop()
+
+	for {
+		q.recover(time.Now())
+		for q.next(time.Now()) {
+		}
+		select {
+		case <-q.stop:
+			return
+		case <-q.wake:
+		case <-ticker.C:
+		}
+	}
+}
+
+// recover moves the jobs whose lease expired back to the pending set.
+func (q *Queue) recover(now time.Time) {
+
+	members, err := q.cache.ZRangeByScore(q.flight, score(now), int64(q.workers))
+
+	if err != nil {
+		q.logger.Errorf("Listing in flight email jobs failed. err: %s", err.Error())
+		return
+	}
+
+	for _, member := range members {
+		if _, err := q.cache.ZMove(q.flight, q.pending, score(now), member); err != nil {
+			q.logger.Errorf("Requeueing an expired email job failed. err: %s", err.Error())
+		}
+	}
+}
+
+// next claims and runs a due job, reporting whether it found one.
+func (q *Queue) next(now time.Time) bool {
+
+	select {
+	case <-q.stop:
+		return false
+	default:
+	}
+
+	members, err := q.cache.ZRangeByScore(q.pending, score(now), int64(q.workers))
+
+	if err != nil {
+		q.logger.Errorf("Listing pending email jobs failed. err: %s", err.Error())
+		return false
+	}
+
+	for _, member := range members {
+
+		// the job is leased in the same step it leaves the pending set, so
+		// only one worker claims it and a crash leaves it in flight
+		if ok, err := q.cache.ZMove(q.pending, q.flight, score(now.Add(q.lease)), member); err != nil || !ok {
+			continue
+		}
+
+		var job Job
+
+		if err := json.Unmarshal([]byte(member), &job); err != nil {
+			q.logger.Errorf("Dropping malformed email job %s.", member)
+			var _, _ = q.cache.ZRem(q.flight, member)
+			return true
+		}
+
+		q.run(&job)
+
+		if _, err := q.cache.ZRem(q.flight, member); err != nil {
+			q.logger.Errorf("Releasing email job %s failed. err: %s", job.ID, err.Error())
+		}
+
+		return true
+	}
+
+	return false
+}
+
+func (q *Queue) run(job *Job) {
+
+	job.Attempts++
+
+	err := q.deliver(job)
+
+	if err == nil {
+		q.logger.Debugf("Delivered email job %s to %s.", job.ID, job.To)
+		return
+	}
+
+	job.Error = err.Error()
+	now := time.Now()
+
+	if job.Attempts >= q.retries {
+		q.logger.Errorf("Email job %s to %s failed %d times, giving up. err: %s", job.ID, job.To, job.Attempts, job.Error)
+		job.Failed = now
+		if err := q.push(q.dead, now, job); err != nil {
+			q.logger.Errorf("Storing dead email job %s failed. err: %s", job.ID, err.Error())
+		}
+		return
+	}
+
+	delay := q.backoff << (job.Attempts - 1)
+
+	if delay > q.ceiling || delay <= 0 {
+		delay = q.ceiling
+	}
+
+	q.logger.Infof("Email job %s to %s failed, retrying in %s. err: %s", job.ID, job.To, delay, job.Error)
+
+	if err := q.push(q.pending, now.Add(delay), job); err != nil {
+		q.logger.Errorf("Rescheduling email job %s failed. err: %s", job.ID, err.Error())
+	}
+}
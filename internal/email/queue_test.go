@@ -0,0 +1,236 @@
+package email
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Cealgull/Verify/internal/cache"
+	mockcache "github.com/Cealgull/Verify/internal/cache/mock"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+type recorder struct {
+	mu    sync.Mutex
+	fails int
+	jobs  []Job
+}
+
+func (r *recorder) deliver(job *Job) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.jobs = append(r.jobs, *job)
+	if r.fails != 0 {
+		r.fails--
+		return errors.New("relay unavailable")
+	}
+	return nil
+}
+
+func (r *recorder) attempts() []Job {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]Job(nil), r.jobs...)
+}
+
+func newTestQueue(t *testing.T, c cache.Cache, options ...QueueOption) *Queue {
+	l, _ := zap.NewProduction()
+	options = append([]QueueOption{WithPoll(5 * time.Millisecond), WithBackoff(time.Millisecond, 4*time.Millisecond)}, options...)
+	q, err := NewQueue(l.Sugar(), c, options...)
+	assert.NoError(t, err)
+	return q
+}
+
+func TestQueueRetry(t *testing.T) {
+
+	c := mockcache.NewMockCache()
+	q := newTestQueue(t, c, WithWorkers(2), WithRetries(5))
+	r := &recorder{fails: 2}
+
+	q.Start(r.deliver)
+	defer q.Stop()
+
+	assert.NoError(t, q.Enqueue(&Job{ID: "1", To: "user@example2.org", Preferences: []string{"zh"}}))
+
+	assert.Eventually(t, func() bool { return len(r.attempts()) == 3 }, time.Second, 5*time.Millisecond)
+
+	jobs := r.attempts()
+	assert.Equal(t, 3, jobs[2].Attempts)
+	assert.Equal(t, []string{"zh"}, jobs[2].Preferences)
+
+	time.Sleep(20 * time.Millisecond)
+	assert.Len(t, r.attempts(), 3)
+
+	dead, err := q.DeadLetters()
+	assert.NoError(t, err)
+	assert.Empty(t, dead)
+}
+
+func TestQueueDeadLetter(t *testing.T) {
+
+	c := mockcache.NewMockCache()
+	q := newTestQueue(t, c, WithRetries(3), WithQueueKey("test:queue"))
+	r := &recorder{fails: 100}
+
+	q.Start(r.deliver)
+
+	assert.NoError(t, q.Enqueue(&Job{ID: "2", To: "user@example2.org"}))
+
+	var dead []*Job
+
+	assert.Eventually(t, func() bool {
+		dead, _ = q.DeadLetters()
+		return len(dead) == 1
+	}, time.Second, 5*time.Millisecond)
+
+	q.Stop()
+
+	assert.Len(t, r.attempts(), 3)
+	assert.Equal(t, "2", dead[0].ID)
+	assert.Equal(t, 3, dead[0].Attempts)
+	assert.Equal(t, "relay unavailable", dead[0].Error)
+	assert.False(t, dead[0].Failed.IsZero())
+
+	c.AddSetsErr("test:queue:dead", &cache.InternalError{})
+	_, err := q.DeadLetters()
+	assert.Error(t, err)
+}
+
+func TestQueueRestart(t *testing.T) {
+
+	c := mockcache.NewMockCache()
+	q := newTestQueue(t, c)
+
+	// a job queued while no worker runs and one left in flight by a crash
+	assert.NoError(t, q.Enqueue(&Job{ID: "3"}))
+	data, _ := json.Marshal(&Job{ID: "4", Attempts: 1})
+	assert.NoError(t, c.ZAdd(defaultQueueKey+":flight", score(time.Now().Add(-time.Second)), string(data)))
+	assert.NoError(t, c.ZAdd(defaultQueueKey, 0, "malformed"))
+
+	r := &recorder{}
+	q.Start(r.deliver)
+
+	assert.Eventually(t, func() bool { return len(r.attempts()) == 2 }, time.Second, 5*time.Millisecond)
+	q.Stop()
+
+	ids := []string{r.attempts()[0].ID, r.attempts()[1].ID}
+	assert.ElementsMatch(t, []string{"3", "4"}, ids)
+
+	for _, set := range []string{defaultQueueKey, defaultQueueKey + ":flight"} {
+		left, _ := c.ZRangeByScore(set, score(time.Now().Add(time.Hour)), 0)
+		assert.Empty(t, left)
+	}
+
+	c.AddSetsErr(defaultQueueKey, &cache.InternalError{})
+	assert.Error(t, q.Enqueue(&Job{ID: "5"}))
+}
+
+func TestQueueLease(t *testing.T) {
+
+	c := mockcache.NewMockCache()
+
+	q := newTestQueue(t, c, WithSendTimeout(time.Second))
+	assert.Equal(t, defaultLease, q.lease)
+
+	// a lease outlasts the slowest delivery
+	q = newTestQueue(t, c, WithSendTimeout(2*time.Minute))
+	assert.Equal(t, 2*time.Minute+leaseMargin, q.lease)
+
+	assert.NoError(t, q.Enqueue(&Job{ID: "7"}))
+
+	now := time.Now()
+	var leased []string
+
+	q.deliver = func(job *Job) error {
+		flight := defaultQueueKey + ":flight"
+		early, _ := c.ZRangeByScore(flight, score(now.Add(2*time.Minute)), 0)
+		assert.Empty(t, early)
+		leased, _ = c.ZRangeByScore(flight, score(now.Add(3*time.Minute)), 0)
+		return nil
+	}
+
+	assert.True(t, q.next(now))
+	assert.Len(t, leased, 1)
+}
+
+func TestQueuedSign(t *testing.T) {
+
+	l, _ := zap.NewProduction()
+	dir := t.TempDir()
+
+	outbox, err := NewMaildirMailer(dir)
+	assert.NoError(t, err)
+
+	dialer, _ := NewEmailDialer(l.Sugar(), WithMailer(outbox, "admin@example2.org"), WithToDom("example2.org"))
+
+	c := mockcache.NewMockCache()
+	q := newTestQueue(t, c)
+
+	mgr, _ := NewEmailManager(
+		l.Sugar(),
+		WithEmailDialer(dialer),
+		WithEmailTemplate("The Verification is %06d"),
+		WithAccExp("^[a-zA-Z0-9-_\\.]{3,50}$"),
+		WithCodeExp("^\\d{6}$"),
+		WithCache(c),
+		WithQueue(q),
+	)
+
+	q.Stop()
+
+	code, verr := mgr.Sign("user1")
+	assert.Nil(t, verr)
+
+	truth, err := c.Get("user1@example2.org")
+	assert.NoError(t, err)
+	assert.Equal(t, fmt.Sprintf("%06d", code), truth)
+
+	// the queue keeps the address only, the code stays under its own key
+	queued, err := c.ZRangeByScore(defaultQueueKey, score(time.Now()), 0)
+	assert.NoError(t, err)
+	assert.Len(t, queued, 1)
+	assert.NotContains(t, queued[0], truth)
+
+	q.Start(mgr.deliver)
+
+	assert.Eventually(t, func() bool {
+		entries, _ := os.ReadDir(filepath.Join(dir, "new"))
+		return len(entries) == 1
+	}, time.Second, 5*time.Millisecond)
+
+	entries, _ := os.ReadDir(filepath.Join(dir, "new"))
+	mail, err := os.ReadFile(filepath.Join(dir, "new", entries[0].Name()))
+	assert.NoError(t, err)
+	assert.Contains(t, string(mail), "The Verification is "+truth)
+
+	// a job whose verification was redeemed meanwhile is dropped
+	assert.NoError(t, q.Enqueue(&Job{ID: "6", Domain: "example2.org", To: "user3@example2.org"}))
+
+	assert.Eventually(t, func() bool {
+		left, _ := c.ZRangeByScore(defaultQueueKey, score(time.Now().Add(time.Hour)), 0)
+		flight, _ := c.ZRangeByScore(defaultQueueKey+":flight", score(time.Now().Add(time.Hour)), 0)
+		return len(left) == 0 && len(flight) == 0
+	}, time.Second, 5*time.Millisecond)
+
+	entries, _ = os.ReadDir(filepath.Join(dir, "new"))
+	assert.Len(t, entries, 1)
+
+	dead, err := q.DeadLetters()
+	assert.NoError(t, err)
+	assert.Empty(t, dead)
+
+	c.AddSetsErr(defaultQueueKey, &cache.InternalError{})
+	_, verr = mgr.Sign("user2")
+	assert.IsType(t, &EmailInternalError{}, verr)
+
+	_, err = c.Get("user2@example2.org")
+	assert.IsType(t, &cache.KeyError{}, err)
+
+	mgr.Close()
+}
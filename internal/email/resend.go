@@ -0,0 +1,91 @@
+package email
+
+import (
+	"time"
+
+	"github.com/Cealgull/Verify/internal/cache"
+	"github.com/Cealgull/Verify/internal/proto"
+)
+
+// Code lifetime and resend cooldown applied unless configured otherwise.
+const (
+	DefaultCodeTTL  = 5 * time.Minute
+	DefaultCooldown = time.Minute
+)
+
+// Timing tells how long a pending verification lives and how long until
+// it may be sent again.
+type Timing struct {
+	TTL    time.Duration
+	Resend time.Duration
+}
+
+// WithCodeTTL sets how long codes and magic links stay valid.
+func WithCodeTTL(ttl time.Duration) ManagerOption {
+	return func(mgr *EmailManager) error {
+		mgr.ttl = ttl
+		return nil
+	}
+}
+
+// WithCooldown sets how long after sending a verification Resend refuses
+// to send it again.
+func WithCooldown(cooldown time.Duration) ManagerOption {
+	return func(mgr *EmailManager) error {
+		mgr.cooldown = cooldown
+		return nil
+	}
+}
+
+// pending returns the timing of the verification pending for address, or
+// nil without one. The time until resend follows from the time to live, as
+// every verification starts with the full lifetime.
+func (m *EmailManager) pending(address string) (*Timing, proto.VerifyError) {
+
+	key := address
+
+	if !m.sendsCode() {
+		key = linkPrefix + address
+	}
+
+	ttl, err := m.cache.TTL(key)
+
+	if _, ok := err.(*cache.KeyError); ok {
+		return nil, nil
+	} else if err != nil {
+		m.logger.Errorf("Redis failure when inspecting verification of %s.", address)
+		return nil, &EmailInternalError{}
+	}
+
+	resend := ttl - (m.ttl - m.cooldown)
+
+	if resend < 0 {
+		resend = 0
+	}
+
+	return &Timing{TTL: ttl, Resend: resend}, nil
+}
+
+// Pending returns the timing of the verification pending for address.
+func (m *EmailManager) Pending(address string) (*Timing, proto.VerifyError) {
+
+	account, d, verr := m.resolve(address)
+
+	if verr != nil {
+		return nil, verr
+	}
+
+	t, verr := m.pending(account + "@" + d.name)
+
+	if verr == nil && t == nil {
+		return nil, &AccountNotFoundError{}
+	}
+
+	return t, verr
+}
+
+// Resend replaces the pending verification of address with a fresh one
+// once the cooldown is over. Failed attempts carry over to the new code.
+func (m *EmailManager) Resend(address string, preferences ...string) (int, proto.VerifyError) {
+	return m.sign(address, true, preferences)
+}
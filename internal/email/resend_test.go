@@ -0,0 +1,108 @@
+package email
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Cealgull/Verify/internal/cache"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestResend(t *testing.T) {
+
+	m, box, mc := newLinkManager(t, ModeCode, WithCodeTTL(time.Minute), WithCooldown(100*time.Millisecond))
+
+	_, verr := m.Resend("user1")
+	assert.IsType(t, &AccountNotFoundError{}, verr)
+
+	_, verr = m.Pending("user1")
+	assert.IsType(t, &AccountNotFoundError{}, verr)
+
+	_, verr = m.Pending("@!#@")
+	assert.IsType(t, &AccountFormatError{}, verr)
+
+	_, verr = m.Sign("user1")
+	assert.Nil(t, verr)
+
+	timing, verr := m.Pending("user1")
+	assert.Nil(t, verr)
+	assert.InDelta(t, float64(time.Minute), float64(timing.TTL), float64(time.Second))
+	assert.InDelta(t, float64(100*time.Millisecond), float64(timing.Resend), float64(50*time.Millisecond))
+
+	_, verr = m.Sign("user1")
+	assert.IsType(t, &DuplicateEmailError{}, verr)
+	assert.Equal(t, "Email: Verification Pending, Please Verify or Resend in 1 Seconds.", verr.Error())
+	assert.Greater(t, verr.(*DuplicateEmailError).TTL, 59*time.Second)
+
+	_, verr = m.Resend("user1")
+	assert.IsType(t, &ResendCooldownError{}, verr)
+	var _ = verr.Status()
+	var _ = verr.Message()
+	var _ = verr.Error()
+
+	stale, _ := mc.Get("user1@example2.org")
+
+	_, verr = m.Verify("user1", wrong(stale))
+	assert.Equal(t, &CodeIncorrectError{Remaining: DefaultAttempts - 1}, verr)
+
+	time.Sleep(100 * time.Millisecond)
+
+	sent := len(box.msgs)
+
+	_, verr = m.Resend("user1")
+	assert.Nil(t, verr)
+	assert.Len(t, box.msgs, sent+1)
+
+	timing, _ = m.Pending("user1")
+	assert.Greater(t, timing.Resend, 50*time.Millisecond)
+
+	truth, _ := mc.Get("user1@example2.org")
+
+	// failed attempts survive the resend
+	_, verr = m.Verify("user1", wrong(truth))
+	assert.Equal(t, &CodeIncorrectError{Remaining: DefaultAttempts - 2}, verr)
+
+	ok, verr := m.Verify("user1", truth)
+	assert.True(t, ok)
+	assert.Nil(t, verr)
+
+	mc.AddGetErr("user2@example2.org", &cache.InternalError{})
+	_, verr = m.Resend("user2")
+	assert.IsType(t, &EmailInternalError{}, verr)
+	_, verr = m.Pending("user2")
+	assert.IsType(t, &EmailInternalError{}, verr)
+}
+
+func TestResendLink(t *testing.T) {
+
+	m, box, _ := newLinkManager(t, ModeLink, WithCodeTTL(time.Minute), WithCooldown(time.Nanosecond))
+
+	_, verr := m.Sign("user1")
+	assert.Nil(t, verr)
+
+	stale := box.token(t)
+
+	timing, verr := m.Pending("user1")
+	assert.Nil(t, verr)
+	assert.Greater(t, timing.TTL, 59*time.Second)
+	assert.Zero(t, timing.Resend)
+
+	_, verr = m.Resend("user1")
+	assert.Nil(t, verr)
+
+	_, verr = m.Redeem(stale)
+	assert.IsType(t, &LinkExpiredError{}, verr)
+
+	_, verr = m.Redeem(box.token(t))
+	assert.Nil(t, verr)
+}
+
+func TestTimingDefaults(t *testing.T) {
+
+	m, _, _ := newLinkManager(t, ModeCode)
+	assert.Equal(t, DefaultCodeTTL, m.ttl)
+	assert.Equal(t, DefaultCooldown, m.cooldown)
+
+	m, _, _ = newLinkManager(t, ModeCode, WithCodeTTL(30*time.Second), WithCooldown(time.Hour))
+	assert.Equal(t, 30*time.Second, m.cooldown)
+}
@@ -0,0 +1,204 @@
+package email
+
+import (
+	"bytes"
+	htmltemplate "html/template"
+	"os"
+	"path/filepath"
+	texttemplate "text/template"
+
+	"golang.org/x/text/language"
+)
+
+// Template files looked up in every locale directory. Only the text body
+// is required, the subject falls back to the one of the dialer.
+const (
+	SubjectFile = "subject.txt"
+	TextFile    = "body.txt"
+	HTMLFile    = "body.html"
+)
+
+// TemplateData holds the variables available to the templates.
+type TemplateData struct {
+	Account string
+	Code    string
+	Expiry  int
+	Link    string
+}
+
+// Message is a rendered verification message. An empty HTML part sends
+// plain text alone.
+type Message struct {
+	Subject string
+	Text    string
+	HTML    string
+	// dkim is set by the dialer right before delivery
+	dkim *DKIM
+}
+
+type locale struct {
+	subject *texttemplate.Template
+	text    *texttemplate.Template
+	html    *htmltemplate.Template
+}
+
+// Templates holds the verification message templates of every locale.
+type Templates struct {
+	locales map[string]*locale
+	tags    []language.Tag
+	matcher language.Matcher
+}
+
+// LoadTemplates reads one directory per locale under dir, named by its
+// BCP 47 tag. Every template is rendered once with sample data so broken
+// ones fail at startup instead of when a code is sent.
+func LoadTemplates(dir string, fallback string) (*Templates, error) {
+
+	entries, err := os.ReadDir(dir)
+
+	if err != nil {
+		return nil, err
+	}
+
+	def, err := language.Parse(fallback)
+
+	if err != nil {
+		return nil, &TemplateError{File: fallback}
+	}
+
+	t := &Templates{locales: make(map[string]*locale), tags: []language.Tag{def}}
+
+	for _, entry := range entries {
+
+		if !entry.IsDir() {
+			continue
+		}
+
+		tag, err := language.Parse(entry.Name())
+
+		if err != nil {
+			return nil, &TemplateError{File: entry.Name()}
+		}
+
+		l, err := loadLocale(filepath.Join(dir, entry.Name()))
+
+		if err != nil {
+			return nil, err
+		}
+
+		t.locales[tag.String()] = l
+
+		if tag != def {
+			t.tags = append(t.tags, tag)
+		}
+	}
+
+	if _, ok := t.locales[def.String()]; !ok {
+		return nil, &TemplateError{File: filepath.Join(dir, fallback)}
+	}
+
+	t.matcher = language.NewMatcher(t.tags)
+
+	return t, nil
+}
+
+func loadLocale(dir string) (*locale, error) {
+
+	var l locale
+	var err error
+
+	parse := func(name string, required bool, load func(file string) error) error {
+		file := filepath.Join(dir, name)
+		if _, err := os.Stat(file); err != nil {
+			if required || !os.IsNotExist(err) {
+				return &TemplateError{File: file}
+			}
+			return nil
+		}
+		if err := load(file); err != nil {
+			return &TemplateError{File: file}
+		}
+		return nil
+	}
+
+	if err = parse(SubjectFile, false, func(file string) (err error) {
+		l.subject, err = texttemplate.ParseFiles(file)
+		return err
+	}); err != nil {
+		return nil, err
+	}
+
+	if err = parse(TextFile, true, func(file string) (err error) {
+		l.text, err = texttemplate.ParseFiles(file)
+		return err
+	}); err != nil {
+		return nil, err
+	}
+
+	if err = parse(HTMLFile, false, func(file string) (err error) {
+		l.html, err = htmltemplate.ParseFiles(file)
+		return err
+	}); err != nil {
+		return nil, err
+	}
+
+	sample := &TemplateData{Account: "account", Code: "000000", Expiry: 5, Link: "https://example.org"}
+
+	if _, err := l.render(sample); err != nil {
+		return nil, &TemplateError{File: dir}
+	}
+
+	return &l, nil
+}
+
+func (l *locale) render(data *TemplateData) (*Message, error) {
+
+	var msg Message
+	var buf bytes.Buffer
+
+	if l.subject != nil {
+		if err := l.subject.Execute(&buf, data); err != nil {
+			return nil, err
+		}
+		msg.Subject = string(bytes.TrimSpace(buf.Bytes()))
+		buf.Reset()
+	}
+
+	if err := l.text.Execute(&buf, data); err != nil {
+		return nil, err
+	}
+
+	msg.Text = buf.String()
+	buf.Reset()
+
+	if l.html != nil {
+		if err := l.html.Execute(&buf, data); err != nil {
+			return nil, err
+		}
+		msg.HTML = buf.String()
+	}
+
+	return &msg, nil
+}
+
+// Match picks the locale for a list of preferences, each a language tag or
+// an Accept-Language header, the first one winning. Without any usable
+// preference the fallback locale is chosen.
+func (t *Templates) Match(preferences ...string) string {
+
+	var tags []language.Tag
+
+	for _, pref := range preferences {
+		parsed, _, _ := language.ParseAcceptLanguage(pref)
+		tags = append(tags, parsed...)
+	}
+
+	_, i, _ := t.matcher.Match(tags...)
+
+	return t.tags[i].String()
+}
+
+// Render renders the message of the locale matching the preferences.
+func (t *Templates) Render(data *TemplateData, preferences ...string) (*Message, error) {
+	return t.locales[t.Match(preferences...)].render(data)
+}
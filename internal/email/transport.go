@@ -0,0 +1,139 @@
+package email
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"os"
+	"time"
+
+	mail "github.com/xhit/go-simple-mail/v2"
+)
+
+const (
+	EncryptionNone     = "none"
+	EncryptionTLS      = "tls"
+	EncryptionSTARTTLS = "starttls"
+	// EncryptionOpportunistic upgrades with STARTTLS only when the relay
+	// offers it.
+	EncryptionOpportunistic = "starttls-optional"
+)
+
+const (
+	AuthAuto    = "auto"
+	AuthNone    = "none"
+	AuthPlain   = "plain"
+	AuthLogin   = "login"
+	AuthCRAMMD5 = "cram-md5"
+)
+
+var encryptions = map[string]mail.Encryption{
+	"":                      mail.EncryptionNone,
+	EncryptionNone:          mail.EncryptionNone,
+	EncryptionTLS:           mail.EncryptionSSLTLS,
+	EncryptionSTARTTLS:      mail.EncryptionSTARTTLS,
+	EncryptionOpportunistic: mail.EncryptionSTARTTLS,
+}
+
+var auths = map[string]mail.AuthType{
+	"":          mail.AuthAuto,
+	AuthAuto:    mail.AuthAuto,
+	AuthNone:    mail.AuthNone,
+	AuthPlain:   mail.AuthPlain,
+	AuthLogin:   mail.AuthLogin,
+	AuthCRAMMD5: mail.AuthCRAMMD5,
+}
+
+// Transport holds the SMTP connection settings. The zero value speaks
+// plaintext SMTP with the library defaults.
+type Transport struct {
+	Encryption     string
+	Auth           string
+	ConnectTimeout time.Duration
+	SendTimeout    time.Duration
+	CAFile         string
+	CertFile       string
+	KeyFile        string
+	Insecure       bool
+	Helo           string
+}
+
+// apply configures server from t, reporting whether the relay must accept
+// STARTTLS.
+func (t *Transport) apply(server *mail.SMTPServer) (bool, error) {
+
+	encryption, ok := encryptions[t.Encryption]
+
+	if !ok {
+		return false, &TransportError{Reason: "unknown encryption " + t.Encryption}
+	}
+
+	auth, ok := auths[t.Auth]
+
+	if !ok {
+		return false, &TransportError{Reason: "unknown auth mechanism " + t.Auth}
+	}
+
+	plaintext := encryption == mail.EncryptionNone
+	tlsfiles := t.CAFile != "" || t.CertFile != "" || t.KeyFile != ""
+
+	switch {
+	case plaintext && (tlsfiles || t.Insecure):
+		return false, &TransportError{Reason: "TLS settings given without encryption"}
+	case plaintext && (auth == mail.AuthPlain || auth == mail.AuthLogin):
+		return false, &TransportError{Reason: t.Auth + " auth sends the secret in clear without encryption"}
+	case t.Insecure && t.CAFile != "":
+		return false, &TransportError{Reason: "CA bundle given with TLS verification disabled"}
+	case (t.CertFile == "") != (t.KeyFile == ""):
+		return false, &TransportError{Reason: "client certificate and key must be given together"}
+	case t.ConnectTimeout < 0 || t.SendTimeout < 0:
+		return false, &TransportError{Reason: "negative timeout"}
+	}
+
+	server.Encryption = encryption
+	server.Authentication = auth
+
+	if t.ConnectTimeout != 0 {
+		server.ConnectTimeout = t.ConnectTimeout
+	}
+
+	if t.SendTimeout != 0 {
+		server.SendTimeout = t.SendTimeout
+	}
+
+	if t.Helo != "" {
+		server.Helo = t.Helo
+	}
+
+	if plaintext {
+		return false, nil
+	}
+
+	config := &tls.Config{
+		ServerName:         server.Host,
+		InsecureSkipVerify: t.Insecure,
+		MinVersion:         tls.VersionTLS12,
+	}
+
+	if t.CAFile != "" {
+		data, err := os.ReadFile(t.CAFile)
+		if err != nil {
+			return false, err
+		}
+		config.RootCAs = x509.NewCertPool()
+		if !config.RootCAs.AppendCertsFromPEM(data) {
+			return false, &TransportError{Reason: "no certificates in CA bundle " + t.CAFile}
+		}
+	}
+
+	if t.CertFile != "" {
+		cert, err := tls.LoadX509KeyPair(t.CertFile, t.KeyFile)
+		if err != nil {
+			return false, err
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+
+	server.TLSConfig = config
+
+	return t.Encryption == EncryptionSTARTTLS, nil
+}
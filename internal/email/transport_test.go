@@ -0,0 +1,234 @@
+package email
+
+import (
+	"bufio"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	mail "github.com/xhit/go-simple-mail/v2"
+	"go.uber.org/zap"
+)
+
+// writeCert writes a self signed certificate for localhost and its key as
+// PEM files under dir.
+func writeCert(t *testing.T, dir string, name string) (string, string, tls.Certificate) {
+
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: name},
+		DNSNames:              []string{"localhost"},
+		IPAddresses:           []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	assert.NoError(t, err)
+
+	pkcs8, _ := x509.MarshalPKCS8PrivateKey(key)
+
+	certfile := filepath.Join(dir, name+".crt")
+	keyfile := filepath.Join(dir, name+".key")
+
+	certpem := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keypem := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: pkcs8})
+
+	assert.NoError(t, os.WriteFile(certfile, certpem, 0600))
+	assert.NoError(t, os.WriteFile(keyfile, keypem, 0600))
+
+	pair, err := tls.X509KeyPair(certpem, keypem)
+	assert.NoError(t, err)
+
+	return certfile, keyfile, pair
+}
+
+// serveTLSSMTP speaks just enough implicit TLS SMTP to take messages and
+// reports the common name of the client certificate of each session.
+func serveTLSSMTP(t *testing.T, config *tls.Config) (int, chan string) {
+
+	l, err := tls.Listen("tcp", "127.0.0.1:0", config)
+	assert.NoError(t, err)
+	t.Cleanup(func() { var _ = l.Close() })
+
+	peers := make(chan string, 4)
+
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func(conn *tls.Conn) {
+				defer conn.Close()
+				r := bufio.NewReader(conn)
+				var _, _ = conn.Write([]byte("220 localhost ESMTP\r\n"))
+				data := false
+				for {
+					line, err := r.ReadString('\n')
+					if err != nil {
+						return
+					}
+					if data {
+						if line == ".\r\n" {
+							data = false
+							var _, _ = conn.Write([]byte("250 queued\r\n"))
+						}
+						continue
+					}
+					switch cmd := strings.ToUpper(strings.TrimSpace(line)); {
+					case strings.HasPrefix(cmd, "EHLO"):
+						state := conn.ConnectionState()
+						peer := ""
+						if len(state.PeerCertificates) != 0 {
+							peer = state.PeerCertificates[0].Subject.CommonName
+						}
+						peers <- peer
+						var _, _ = conn.Write([]byte("250 localhost\r\n"))
+					case cmd == "DATA":
+						data = true
+						var _, _ = conn.Write([]byte("354 go ahead\r\n"))
+					case cmd == "QUIT":
+						var _, _ = conn.Write([]byte("221 bye\r\n"))
+						return
+					default:
+						var _, _ = conn.Write([]byte("250 ok\r\n"))
+					}
+				}
+			}(conn.(*tls.Conn))
+		}
+	}()
+
+	return l.Addr().(*net.TCPAddr).Port, peers
+}
+
+func TestTransportValidation(t *testing.T) {
+
+	dir := t.TempDir()
+	certfile, keyfile, _ := writeCert(t, dir, "client")
+	garbage := filepath.Join(dir, "garbage.pem")
+	assert.NoError(t, os.WriteFile(garbage, []byte("garbage"), 0600))
+
+	for _, transport := range []*Transport{
+		{Encryption: "ssl3"},
+		{Auth: "kerberos"},
+		{CAFile: certfile},
+		{Insecure: true},
+		{Auth: AuthPlain},
+		{Encryption: EncryptionNone, Auth: AuthLogin},
+		{Encryption: EncryptionTLS, Insecure: true, CAFile: certfile},
+		{Encryption: EncryptionTLS, CertFile: certfile},
+		{Encryption: EncryptionSTARTTLS, KeyFile: keyfile},
+		{ConnectTimeout: -time.Second},
+		{Encryption: EncryptionTLS, CAFile: garbage},
+	} {
+		_, err := NewSMTPMailer("localhost", 25, "admin", "secret", transport)
+		assert.IsType(t, &TransportError{}, err, "%+v", transport)
+		var _ = err.Error()
+	}
+
+	_, err := NewSMTPMailer("localhost", 25, "admin", "secret", &Transport{Encryption: EncryptionTLS, CAFile: filepath.Join(dir, "missing")})
+	assert.Error(t, err)
+
+	_, err = NewSMTPMailer("localhost", 25, "admin", "secret", &Transport{Encryption: EncryptionTLS, CertFile: certfile, KeyFile: garbage})
+	assert.Error(t, err)
+
+	m, err := NewSMTPMailer("localhost", 25, "admin", "secret", &Transport{
+		Encryption:     EncryptionSTARTTLS,
+		Auth:           AuthCRAMMD5,
+		ConnectTimeout: time.Second,
+		SendTimeout:    2 * time.Second,
+		CAFile:         certfile,
+		CertFile:       certfile,
+		KeyFile:        keyfile,
+		Helo:           "verify.example.org",
+	})
+	assert.NoError(t, err)
+
+	server := m.pool.server
+	assert.Equal(t, mail.EncryptionSTARTTLS, server.Encryption)
+	assert.Equal(t, mail.AuthCRAMMD5, server.Authentication)
+	assert.Equal(t, time.Second, server.ConnectTimeout)
+	assert.Equal(t, 2*time.Second, server.SendTimeout)
+	assert.Equal(t, "verify.example.org", server.Helo)
+	assert.Equal(t, "localhost", server.TLSConfig.ServerName)
+	assert.NotNil(t, server.TLSConfig.RootCAs)
+	assert.Len(t, server.TLSConfig.Certificates, 1)
+	assert.True(t, m.pool.starttls)
+
+	m, err = NewSMTPMailer("localhost", 25, "admin", "secret", &Transport{Encryption: EncryptionOpportunistic, Insecure: true})
+	assert.NoError(t, err)
+	assert.False(t, m.pool.starttls)
+	assert.True(t, m.pool.server.TLSConfig.InsecureSkipVerify)
+
+	l, _ := zap.NewProduction()
+	_, err = NewEmailDialer(l.Sugar(), WithClient("localhost", 25, "admin", "secret"), WithToDom("example2.org"))
+	assert.NoError(t, err)
+}
+
+func TestTransportSTARTTLS(t *testing.T) {
+
+	startMockSMTP(t, 2338)
+
+	required, err := NewSMTPMailer("localhost", 2338, "admin@example2.org", "secret", &Transport{Encryption: EncryptionSTARTTLS})
+	assert.NoError(t, err)
+
+	err = required.Send("admin@example2.org", "user@example2.org", testMessage)
+	assert.IsType(t, &TransportError{}, err)
+	assert.Zero(t, len(required.pool.slots))
+
+	optional, err := NewSMTPMailer("localhost", 2338, "admin@example2.org", "secret", &Transport{Encryption: EncryptionOpportunistic})
+	assert.NoError(t, err)
+	assert.NoError(t, optional.Send("admin@example2.org", "user@example2.org", testMessage))
+}
+
+func TestTransportImplicitTLS(t *testing.T) {
+
+	dir := t.TempDir()
+	cafile, _, servercert := writeCert(t, dir, "relay")
+	certfile, keyfile, _ := writeCert(t, dir, "client")
+
+	port, peers := serveTLSSMTP(t, &tls.Config{
+		Certificates: []tls.Certificate{servercert},
+		ClientAuth:   tls.RequestClientCert,
+	})
+
+	m, err := NewSMTPMailer("localhost", port, "", "", &Transport{
+		Encryption: EncryptionTLS,
+		Auth:       AuthNone,
+		CAFile:     cafile,
+		CertFile:   certfile,
+		KeyFile:    keyfile,
+		Helo:       "verify.example.org",
+	})
+	assert.NoError(t, err)
+	assert.NoError(t, m.Send("admin@example2.org", "user@example2.org", testMessage))
+	assert.Equal(t, "client", <-peers)
+
+	untrusted, err := NewSMTPMailer("localhost", port, "", "", &Transport{Encryption: EncryptionTLS})
+	assert.NoError(t, err)
+	assert.Error(t, untrusted.Send("admin@example2.org", "user@example2.org", testMessage))
+
+	insecure, err := NewSMTPMailer("localhost", port, "", "", &Transport{Encryption: EncryptionTLS, Insecure: true})
+	assert.NoError(t, err)
+	assert.NoError(t, insecure.Send("admin@example2.org", "user@example2.org", testMessage))
+	assert.Equal(t, "", <-peers)
+}
@@ -0,0 +1,220 @@
+package fabric
+
+import (
+	"crypto/ed25519"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"strings"
+
+	"github.com/Cealgull/Verify/internal/proto"
+)
+
+// AttrOID is the certificate extension Fabric CA uses to carry ABAC attributes.
+var AttrOID = asn1.ObjectIdentifier{1, 2, 3, 4, 5, 6, 7, 8, 1}
+
+const (
+	EnrollmentID = "hf.EnrollmentID"
+	Type         = "hf.Type"
+	Affiliation  = "hf.Affiliation"
+)
+
+type AttributeRequest struct {
+	Name     string `json:"name"`
+	Optional bool   `json:"optional,omitempty"`
+}
+
+type EnrollmentRequest struct {
+	CSR      string              `json:"certificate_request"`
+	Profile  string              `json:"profile,omitempty"`
+	Label    string              `json:"label,omitempty"`
+	CAName   string              `json:"caname,omitempty"`
+	AttrReqs []*AttributeRequest `json:"attr_reqs,omitempty"`
+}
+
+type RevocationRequest struct {
+	Name   string `json:"id,omitempty"`
+	Serial string `json:"serial,omitempty"`
+	AKI    string `json:"aki,omitempty"`
+	Reason string `json:"reason,omitempty"`
+	CAName string `json:"caname,omitempty"`
+	GenCRL bool   `json:"gencrl,omitempty"`
+}
+
+type ServerInfo struct {
+	CAName                    string `json:"CAName"`
+	CAChain                   string `json:"CAChain"`
+	IssuerPublicKey           string `json:"IssuerPublicKey"`
+	IssuerRevocationPublicKey string `json:"IssuerRevocationPublicKey"`
+	Version                   string `json:"Version"`
+}
+
+type EnrollmentResponse struct {
+	Cert       string     `json:"Cert"`
+	ServerInfo ServerInfo `json:"ServerInfo"`
+}
+
+type RevokedCert struct {
+	Serial string `json:"Serial"`
+	AKI    string `json:"AKI"`
+}
+
+type RevocationResponse struct {
+	RevokedCerts []RevokedCert `json:"RevokedCerts"`
+	CRL          string        `json:"CRL"`
+}
+
+type ResponseError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+type Response struct {
+	Success  bool            `json:"success"`
+	Result   interface{}     `json:"result"`
+	Errors   []ResponseError `json:"errors"`
+	Messages []string        `json:"messages"`
+}
+
+type attributes struct {
+	Attrs map[string]string `json:"attrs"`
+}
+
+func NewResponse(result interface{}) *Response {
+	return &Response{
+		Success:  true,
+		Result:   result,
+		Errors:   []ResponseError{},
+		Messages: []string{},
+	}
+}
+
+func NewErrorResponse(err proto.VerifyError) *Response {
+	msg := err.Message()
+	return &Response{
+		Success: false,
+		Errors: []ResponseError{{
+			Code:    err.Status(),
+			Message: fmt.Sprintf("%s: %s", msg.Code, msg.Message),
+		}},
+		Messages: []string{},
+	}
+}
+
+// ParseCSR checks the self-signature of a PEM certificate request and
+// returns its ed25519 public key.
+func ParseCSR(data string) (ed25519.PublicKey, proto.VerifyError) {
+
+	p, _ := pem.Decode([]byte(data))
+
+	if p == nil || p.Type != "CERTIFICATE REQUEST" {
+		return nil, &CSRDecodeError{}
+	}
+
+	csr, err := x509.ParseCertificateRequest(p.Bytes)
+
+	if err != nil {
+		return nil, &CSRDecodeError{}
+	}
+
+	if err := csr.CheckSignature(); err != nil {
+		return nil, &CSRSignatureError{}
+	}
+
+	pub, ok := csr.PublicKey.(ed25519.PublicKey)
+
+	if !ok {
+		return nil, &CSRKeyTypeError{}
+	}
+
+	return pub, nil
+}
+
+// Attributes resolves the requested attributes against the values the CA
+// knows about and encodes them as a Fabric attribute extension. A nil
+// request list selects every known attribute, as Fabric CA does.
+func Attributes(reqs []*AttributeRequest, values map[string]string) (pkix.Extension, proto.VerifyError) {
+
+	attrs := attributes{Attrs: make(map[string]string)}
+
+	if reqs == nil {
+		for name, value := range values {
+			attrs.Attrs[name] = value
+		}
+	}
+
+	for _, req := range reqs {
+		if value, ok := values[req.Name]; ok {
+			attrs.Attrs[req.Name] = value
+		} else if !req.Optional {
+			return pkix.Extension{}, &AttributeNotFoundError{req.Name}
+		}
+	}
+
+	b, _ := json.Marshal(&attrs)
+
+	return pkix.Extension{Id: AttrOID, Critical: false, Value: b}, nil
+}
+
+// ParseToken verifies a Fabric CA authorization token of the form
+// "<base64 cert>.<base64 signature>" and returns the PEM certificate inside.
+// Both the current payload "method.b64(uri).b64(body).b64(cert)" and the
+// pre-1.4 payload "b64(body).b64(cert)" are accepted.
+func ParseToken(token string, method string, uri string, body []byte) ([]byte, proto.VerifyError) {
+
+	parts := strings.Split(token, ".")
+
+	if len(parts) != 2 {
+		return nil, &TokenFormatError{}
+	}
+
+	certpem, err := base64.StdEncoding.DecodeString(parts[0])
+
+	if err != nil {
+		return nil, &TokenFormatError{}
+	}
+
+	sig, err := base64.StdEncoding.DecodeString(parts[1])
+
+	if err != nil {
+		return nil, &TokenFormatError{}
+	}
+
+	p, _ := pem.Decode(certpem)
+
+	if p == nil {
+		return nil, &TokenFormatError{}
+	}
+
+	cert, err := x509.ParseCertificate(p.Bytes)
+
+	if err != nil {
+		return nil, &TokenFormatError{}
+	}
+
+	pub, ok := cert.PublicKey.(ed25519.PublicKey)
+
+	if !ok {
+		return nil, &TokenFormatError{}
+	}
+
+	b64body := base64.StdEncoding.EncodeToString(body)
+	b64uri := base64.StdEncoding.EncodeToString([]byte(uri))
+
+	payloads := []string{
+		method + "." + b64uri + "." + b64body + "." + parts[0],
+		b64body + "." + parts[0],
+	}
+
+	for _, payload := range payloads {
+		if ed25519.Verify(pub, []byte(payload), sig) {
+			return certpem, nil
+		}
+	}
+
+	return nil, &TokenSignatureError{}
+}
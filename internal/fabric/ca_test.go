@@ -0,0 +1,143 @@
+package fabric
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newCSR(t *testing.T, priv interface{}) string {
+	der, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+		Subject: pkix.Name{CommonName: "user1"},
+	}, priv)
+	assert.NoError(t, err)
+	return string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: der}))
+}
+
+func newCert(t *testing.T, pub ed25519.PublicKey, priv ed25519.PrivateKey) string {
+	der, err := x509.CreateCertificate(rand.Reader, &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		NotBefore:    time.Now(),
+	}, &x509.Certificate{}, pub, priv)
+	assert.NoError(t, err)
+	return string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}))
+}
+
+func TestParseCSR(t *testing.T) {
+
+	pub, priv, _ := ed25519.GenerateKey(nil)
+
+	_, err := ParseCSR("invalid")
+	assert.IsType(t, &CSRDecodeError{}, err)
+	var _ = err.Status()
+	var _ = err.Message()
+
+	_, err = ParseCSR(string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: []byte{0x01}})))
+	assert.IsType(t, &CSRDecodeError{}, err)
+
+	csr := newCSR(t, priv)
+	p, _ := pem.Decode([]byte(csr))
+	p.Bytes[len(p.Bytes)-1] ^= 0xff
+	_, err = ParseCSR(string(pem.EncodeToMemory(p)))
+	assert.IsType(t, &CSRSignatureError{}, err)
+	var _ = err.Status()
+	var _ = err.Message()
+
+	key, err := ParseCSR(newCSR(t, priv))
+	assert.Nil(t, err)
+	assert.Equal(t, pub, key)
+}
+
+func TestAttributes(t *testing.T) {
+
+	values := map[string]string{
+		EnrollmentID: "0xabc",
+		Type:         "client",
+	}
+
+	var attrs attributes
+
+	ext, err := Attributes(nil, values)
+	assert.Nil(t, err)
+	assert.Equal(t, AttrOID, ext.Id)
+	assert.NoError(t, json.Unmarshal(ext.Value, &attrs))
+	assert.Equal(t, values, attrs.Attrs)
+
+	ext, err = Attributes([]*AttributeRequest{
+		{Name: Type},
+		{Name: "custom", Optional: true},
+	}, values)
+	assert.Nil(t, err)
+	attrs = attributes{}
+	assert.NoError(t, json.Unmarshal(ext.Value, &attrs))
+	assert.Equal(t, map[string]string{Type: "client"}, attrs.Attrs)
+
+	_, err = Attributes([]*AttributeRequest{{Name: "custom"}}, values)
+	assert.IsType(t, &AttributeNotFoundError{}, err)
+	var _ = err.Status()
+	var _ = err.Message()
+}
+
+func TestParseToken(t *testing.T) {
+
+	pub, priv, _ := ed25519.GenerateKey(nil)
+	b64cert := base64.StdEncoding.EncodeToString([]byte(newCert(t, pub, priv)))
+	body := []byte(`{"serial":"01"}`)
+	b64body := base64.StdEncoding.EncodeToString(body)
+	b64uri := base64.StdEncoding.EncodeToString([]byte("/api/v1/revoke"))
+
+	sign := func(payload string) string {
+		return b64cert + "." + base64.StdEncoding.EncodeToString(ed25519.Sign(priv, []byte(payload)))
+	}
+
+	_, err := ParseToken("a.b.c", "POST", "/api/v1/revoke", body)
+	assert.IsType(t, &TokenFormatError{}, err)
+	var _ = err.Status()
+	var _ = err.Message()
+
+	_, err = ParseToken("!!.b", "POST", "/api/v1/revoke", body)
+	assert.IsType(t, &TokenFormatError{}, err)
+
+	_, err = ParseToken(b64cert+".!!", "POST", "/api/v1/revoke", body)
+	assert.IsType(t, &TokenFormatError{}, err)
+
+	_, err = ParseToken("YWJj.YWJj", "POST", "/api/v1/revoke", body)
+	assert.IsType(t, &TokenFormatError{}, err)
+
+	token := sign("POST." + b64uri + "." + b64body + "." + b64cert)
+	certpem, err := ParseToken(token, "POST", "/api/v1/revoke", body)
+	assert.Nil(t, err)
+	assert.NotNil(t, certpem)
+
+	token = sign(b64body + "." + b64cert)
+	_, err = ParseToken(token, "POST", "/api/v1/revoke", body)
+	assert.Nil(t, err)
+
+	_, err = ParseToken(token, "POST", "/api/v1/revoke", []byte("{}"))
+	assert.IsType(t, &TokenSignatureError{}, err)
+	var _ = err.Status()
+	var _ = err.Message()
+}
+
+func TestResponse(t *testing.T) {
+	resp := NewResponse(ServerInfo{CAName: "ca"})
+	assert.True(t, resp.Success)
+
+	resp = NewErrorResponse(&RevokeForbiddenError{})
+	assert.False(t, resp.Success)
+	assert.Equal(t, 403, resp.Errors[0].Code)
+
+	var _ = (&TokenMissingError{}).Message()
+	var _ = (&TokenMissingError{}).Status()
+	var _ = (&CSRKeyTypeError{}).Message()
+	var _ = (&CSRKeyTypeError{}).Status()
+}
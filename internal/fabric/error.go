@@ -0,0 +1,155 @@
+package fabric
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/Cealgull/Verify/internal/proto"
+)
+
+type CSRDecodeError struct{}
+type CSRSignatureError struct{}
+type CSRKeyTypeError struct{}
+type TokenMissingError struct{}
+type TokenFormatError struct{}
+type TokenSignatureError struct{}
+type RevokeForbiddenError struct{}
+type ReenrollKeyError struct{}
+type AttributeNotFoundError struct {
+	Name string
+}
+
+func (e *CSRDecodeError) Error() string {
+	return "Fabric: Certificate Request Decode Error."
+}
+
+func (e *CSRDecodeError) Status() int {
+	return http.StatusBadRequest
+}
+
+func (e *CSRDecodeError) Message() *proto.ResponseMessage {
+	return &proto.ResponseMessage{
+		Code:    "F1001",
+		Message: e.Error(),
+	}
+}
+
+func (e *CSRSignatureError) Error() string {
+	return "Fabric: Certificate Request Signature Invalid."
+}
+
+func (e *CSRSignatureError) Status() int {
+	return http.StatusBadRequest
+}
+
+func (e *CSRSignatureError) Message() *proto.ResponseMessage {
+	return &proto.ResponseMessage{
+		Code:    "F1002",
+		Message: e.Error(),
+	}
+}
+
+func (e *CSRKeyTypeError) Error() string {
+	return "Fabric: Certificate Request Key Not Matched With ed25519."
+}
+
+func (e *CSRKeyTypeError) Status() int {
+	return http.StatusBadRequest
+}
+
+func (e *CSRKeyTypeError) Message() *proto.ResponseMessage {
+	return &proto.ResponseMessage{
+		Code:    "F1003",
+		Message: e.Error(),
+	}
+}
+
+func (e *TokenMissingError) Error() string {
+	return "Fabric: Authorization Token Missing in Header."
+}
+
+func (e *TokenMissingError) Status() int {
+	return http.StatusUnauthorized
+}
+
+func (e *TokenMissingError) Message() *proto.ResponseMessage {
+	return &proto.ResponseMessage{
+		Code:    "F2001",
+		Message: e.Error(),
+	}
+}
+
+func (e *TokenFormatError) Error() string {
+	return "Fabric: Authorization Token Format Error."
+}
+
+func (e *TokenFormatError) Status() int {
+	return http.StatusUnauthorized
+}
+
+func (e *TokenFormatError) Message() *proto.ResponseMessage {
+	return &proto.ResponseMessage{
+		Code:    "F2002",
+		Message: e.Error(),
+	}
+}
+
+func (e *TokenSignatureError) Error() string {
+	return "Fabric: Authorization Token Signature Invalid."
+}
+
+func (e *TokenSignatureError) Status() int {
+	return http.StatusUnauthorized
+}
+
+func (e *TokenSignatureError) Message() *proto.ResponseMessage {
+	return &proto.ResponseMessage{
+		Code:    "F2003",
+		Message: e.Error(),
+	}
+}
+
+func (e *RevokeForbiddenError) Error() string {
+	return "Fabric: Only The Token Certificate Can Be Revoked."
+}
+
+func (e *RevokeForbiddenError) Status() int {
+	return http.StatusForbidden
+}
+
+func (e *RevokeForbiddenError) Message() *proto.ResponseMessage {
+	return &proto.ResponseMessage{
+		Code:    "F2004",
+		Message: e.Error(),
+	}
+}
+
+func (e *ReenrollKeyError) Error() string {
+	return "Fabric: Reenrollment Must Keep The Token Certificate Key, Enroll New Keys Instead."
+}
+
+func (e *ReenrollKeyError) Status() int {
+	return http.StatusForbidden
+}
+
+func (e *ReenrollKeyError) Message() *proto.ResponseMessage {
+	return &proto.ResponseMessage{
+		Code:    "F2005",
+		Message: e.Error(),
+	}
+}
+
+func (e *AttributeNotFoundError) Error() string {
+	return fmt.Sprintf("Fabric: Requested Attribute %s Not Available.", e.Name)
+}
+
+func (e *AttributeNotFoundError) Status() int {
+	return http.StatusBadRequest
+}
+
+func (e *AttributeNotFoundError) Message() *proto.ResponseMessage {
+	return &proto.ResponseMessage{
+		Code:    "F1004",
+		Message: e.Error(),
+	}
+}
@@ -0,0 +1,97 @@
+package federation
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"time"
+)
+
+// Partner is a certificate authority of a federated deployment.
+type Partner struct {
+	Organization string   `json:"organization"`
+	Domain       string   `json:"domain,omitempty"`
+	Certificates []string `json:"certificates"`
+	Revoked      []string `json:"revoked,omitempty"`
+	Expires      int64    `json:"expires,omitempty"`
+}
+
+// Bundle is the trust statement an operator publishes for its partners.
+// Sequence must grow with every bundle so older ones cannot be replayed.
+type Bundle struct {
+	Operator string    `json:"operator"`
+	Sequence uint64    `json:"sequence"`
+	Issued   int64     `json:"issued"`
+	Expires  int64     `json:"expires"`
+	Partners []Partner `json:"partners"`
+}
+
+// SignedBundle carries the serialized bundle, the fingerprint of the
+// operator certificate and the ed25519 signature over the bundle bytes.
+type SignedBundle struct {
+	Bundle    string `json:"bundle"`
+	Kid       string `json:"kid"`
+	Signature string `json:"signature"`
+}
+
+// Fingerprint is the hex encoded sha256 of the DER certificate.
+func Fingerprint(cert *x509.Certificate) string {
+	sum := sha256.Sum256(cert.Raw)
+	return hex.EncodeToString(sum[:])
+}
+
+// NewBundle describes the chain of this deployment as a partner entry.
+func NewBundle(operator string, sequence uint64, ttl time.Duration, partners ...Partner) *Bundle {
+	now := time.Now()
+	return &Bundle{
+		Operator: operator,
+		Sequence: sequence,
+		Issued:   now.Unix(),
+		Expires:  now.Add(ttl).Unix(),
+		Partners: partners,
+	}
+}
+
+func NewPartner(organization string, domain string, chain ...*x509.Certificate) Partner {
+
+	p := Partner{Organization: organization, Domain: domain}
+
+	for _, c := range chain {
+		p.Certificates = append(p.Certificates, string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: c.Raw})))
+	}
+
+	return p
+}
+
+// Sign serializes the bundle and signs it with the key of the operator
+// certificate, which has to be an ed25519 key.
+func Sign(b *Bundle, signer crypto.Signer, operator *x509.Certificate) (*SignedBundle, error) {
+
+	if _, ok := operator.PublicKey.(ed25519.PublicKey); !ok {
+		return nil, &OperatorFormatError{File: operator.Subject.CommonName}
+	}
+
+	payload, err := json.Marshal(b)
+
+	if err != nil {
+		return nil, err
+	}
+
+	sig, err := signer.Sign(rand.Reader, payload, crypto.Hash(0))
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &SignedBundle{
+		Bundle:    base64.StdEncoding.EncodeToString(payload),
+		Kid:       Fingerprint(operator),
+		Signature: base64.StdEncoding.EncodeToString(sig),
+	}, nil
+}
@@ -0,0 +1,130 @@
+package federation
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/Cealgull/Verify/internal/proto"
+)
+
+type BundleFormatError struct{}
+type BundleSignatureError struct{}
+type BundleExpiredError struct{}
+type BundleStaleError struct {
+	Sequence uint64
+}
+type OperatorUnknownError struct{}
+type BundleNotFoundError struct{}
+type FederationInternalError struct{}
+type OperatorFormatError struct {
+	File string
+}
+
+func (e *BundleFormatError) Error() string {
+	return "Federation: Trust Bundle Malformed."
+}
+
+func (e *BundleFormatError) Status() int {
+	return http.StatusBadRequest
+}
+
+func (e *BundleFormatError) Message() *proto.ResponseMessage {
+	return &proto.ResponseMessage{
+		Code:    "G1001",
+		Message: e.Error(),
+	}
+}
+
+func (e *BundleSignatureError) Error() string {
+	return "Federation: Trust Bundle Signature Invalid."
+}
+
+func (e *BundleSignatureError) Status() int {
+	return http.StatusUnauthorized
+}
+
+func (e *BundleSignatureError) Message() *proto.ResponseMessage {
+	return &proto.ResponseMessage{
+		Code:    "G1002",
+		Message: e.Error(),
+	}
+}
+
+func (e *BundleExpiredError) Error() string {
+	return "Federation: Trust Bundle Expired."
+}
+
+func (e *BundleExpiredError) Status() int {
+	return http.StatusBadRequest
+}
+
+func (e *BundleExpiredError) Message() *proto.ResponseMessage {
+	return &proto.ResponseMessage{
+		Code:    "G1003",
+		Message: e.Error(),
+	}
+}
+
+func (e *BundleStaleError) Error() string {
+	return fmt.Sprintf("Federation: Trust Bundle Not Newer Than Sequence %d.", e.Sequence)
+}
+
+func (e *BundleStaleError) Status() int {
+	return http.StatusConflict
+}
+
+func (e *BundleStaleError) Message() *proto.ResponseMessage {
+	return &proto.ResponseMessage{
+		Code:    "G1004",
+		Message: e.Error(),
+	}
+}
+
+func (e *OperatorUnknownError) Error() string {
+	return "Federation: Trust Bundle Signed By Unknown Operator."
+}
+
+func (e *OperatorUnknownError) Status() int {
+	return http.StatusUnauthorized
+}
+
+func (e *OperatorUnknownError) Message() *proto.ResponseMessage {
+	return &proto.ResponseMessage{
+		Code:    "G1005",
+		Message: e.Error(),
+	}
+}
+
+func (e *BundleNotFoundError) Error() string {
+	return "Federation: Trust Bundle Not Found."
+}
+
+func (e *BundleNotFoundError) Status() int {
+	return http.StatusNotFound
+}
+
+func (e *BundleNotFoundError) Message() *proto.ResponseMessage {
+	return &proto.ResponseMessage{
+		Code:    "G1006",
+		Message: e.Error(),
+	}
+}
+
+func (e *FederationInternalError) Error() string {
+	return "Federation: Internal Server Error."
+}
+
+func (e *FederationInternalError) Status() int {
+	return http.StatusInternalServerError
+}
+
+func (e *FederationInternalError) Message() *proto.ResponseMessage {
+	return &proto.ResponseMessage{
+		Code:    "G1007",
+		Message: e.Error(),
+	}
+}
+
+func (e *OperatorFormatError) Error() string {
+	return fmt.Sprintf("Federation: Operator Certificate %s Is Not An ed25519 Certificate.", e.File)
+}
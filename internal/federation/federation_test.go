@@ -0,0 +1,250 @@
+package federation
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+var logger *zap.SugaredLogger
+
+func init() {
+	l, _ := zap.NewDevelopment()
+	logger = l.Sugar()
+}
+
+func newCA(t *testing.T, name string) (*x509.Certificate, ed25519.PrivateKey) {
+
+	pub, priv, _ := ed25519.GenerateKey(nil)
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: name, Organization: []string{name}},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, pub, priv)
+	assert.NoError(t, err)
+
+	ca, _ := x509.ParseCertificate(der)
+
+	return ca, priv
+}
+
+func sign(t *testing.T, b *Bundle, priv ed25519.PrivateKey, operator *x509.Certificate) []byte {
+	signed, err := Sign(b, priv, operator)
+	assert.NoError(t, err)
+	data, _ := json.Marshal(signed)
+	return data
+}
+
+func TestNewRegistry(t *testing.T) {
+
+	operator, _ := newCA(t, "Campus A")
+
+	file := filepath.Join(t.TempDir(), "operators.pem")
+	assert.NoError(t, os.WriteFile(file, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: operator.Raw}), 0600))
+
+	r, err := NewRegistry(logger, WithOperatorFiles(file))
+	assert.NoError(t, err)
+	assert.Contains(t, r.operators, Fingerprint(operator))
+
+	_, err = NewRegistry(logger, WithOperatorFiles("./notexists"))
+	assert.Error(t, err)
+
+	assert.NoError(t, os.WriteFile(file, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: []byte("garbage")}), 0600))
+	_, err = NewRegistry(logger, WithOperatorFiles(file))
+	assert.IsType(t, &OperatorFormatError{}, err)
+
+	priv, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	template := &x509.Certificate{SerialNumber: big.NewInt(1), Subject: pkix.Name{CommonName: "ecdsa"}}
+	der, _ := x509.CreateCertificate(rand.Reader, template, template, &priv.PublicKey, priv)
+	ec, _ := x509.ParseCertificate(der)
+
+	assert.NoError(t, os.WriteFile(file, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600))
+	_, err = NewRegistry(logger, WithOperatorFiles(file))
+	assert.IsType(t, &OperatorFormatError{}, err)
+
+	_, err = NewRegistry(logger, WithOperators(ec))
+	assert.IsType(t, &OperatorFormatError{}, err)
+
+	_, err = Sign(NewBundle("ecdsa", 1, time.Hour), priv, ec)
+	assert.IsType(t, &OperatorFormatError{}, err)
+	assert.NotEmpty(t, err.Error())
+}
+
+func TestLoad(t *testing.T) {
+
+	operator, opriv := newCA(t, "Campus A")
+	partner, _ := newCA(t, "Campus B")
+	other, _ := newCA(t, "Campus C")
+	rogue, rpriv := newCA(t, "Rogue")
+
+	r, err := NewRegistry(logger, WithOperators(operator))
+	assert.NoError(t, err)
+
+	b := NewBundle("Campus A", 1, time.Hour,
+		NewPartner("Campus B", "b.example.edu", partner),
+		NewPartner("Campus C", "c.example.edu", other),
+	)
+
+	bundle, verr := r.Load(sign(t, b, opriv, operator))
+	assert.Nil(t, verr)
+	assert.Equal(t, uint64(1), bundle.Sequence)
+	assert.Len(t, r.Anchors(), 2)
+
+	statuses := r.Bundles()
+	assert.Len(t, statuses, 1)
+	assert.Equal(t, []string{"Campus B", "Campus C"}, statuses[0].Organizations)
+
+	// replays and older bundles are rejected
+	_, verr = r.Load(sign(t, b, opriv, operator))
+	assert.IsType(t, &BundleStaleError{}, verr)
+	assert.Equal(t, 409, verr.Status())
+	assert.Equal(t, "G1004", verr.Message().Code)
+
+	// partners missing from a newer bundle are no longer trusted
+	b = NewBundle("Campus A", 2, time.Hour, NewPartner("Campus B", "", partner))
+	_, verr = r.Load(sign(t, b, opriv, operator))
+	assert.Nil(t, verr)
+	anchors := r.Anchors()
+	assert.Len(t, anchors, 1)
+	assert.Equal(t, "Campus B", anchors[0].Organization)
+	assert.Equal(t, partner.Raw, anchors[0].Certificate.Raw)
+
+	_, verr = r.Load(sign(t, NewBundle("Rogue", 3, time.Hour, NewPartner("Rogue", "", rogue)), rpriv, rogue))
+	assert.IsType(t, &OperatorUnknownError{}, verr)
+
+	signed, _ := Sign(NewBundle("Campus A", 3, time.Hour, NewPartner("Rogue", "", rogue)), rpriv, rogue)
+	signed.Kid = Fingerprint(operator)
+	data, _ := json.Marshal(signed)
+	_, verr = r.Load(data)
+	assert.IsType(t, &BundleSignatureError{}, verr)
+
+	_, verr = r.Load(sign(t, NewBundle("Campus A", 3, -time.Minute, NewPartner("Campus B", "", partner)), opriv, operator))
+	assert.IsType(t, &BundleExpiredError{}, verr)
+
+	for _, p := range []Partner{
+		{Organization: "", Certificates: []string{"x"}},
+		{Organization: "Campus B"},
+		{Organization: "Campus B", Certificates: []string{"garbage"}},
+		{Organization: "Campus B", Certificates: []string{string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: []byte("garbage")}))}},
+	} {
+		_, verr = r.Load(sign(t, NewBundle("Campus A", 3, time.Hour, p), opriv, operator))
+		assert.IsType(t, &BundleFormatError{}, verr)
+	}
+
+	payload := base64.StdEncoding.EncodeToString([]byte("garbage"))
+	sig := base64.StdEncoding.EncodeToString(ed25519.Sign(opriv, []byte("garbage")))
+
+	for _, s := range []*SignedBundle{
+		{Bundle: "!!", Kid: Fingerprint(operator)},
+		{Bundle: payload, Kid: Fingerprint(operator), Signature: "!!"},
+		{Bundle: payload, Kid: Fingerprint(operator), Signature: sig},
+	} {
+		data, _ = json.Marshal(s)
+		_, verr = r.Load(data)
+		assert.Error(t, verr)
+	}
+
+	_, verr = r.Load([]byte("garbage"))
+	assert.IsType(t, &BundleFormatError{}, verr)
+
+	assert.IsType(t, &BundleNotFoundError{}, r.Remove("unknown"))
+	assert.Nil(t, r.Remove(Fingerprint(operator)))
+	assert.Empty(t, r.Anchors())
+	assert.Empty(t, r.Bundles())
+}
+
+func TestExpiry(t *testing.T) {
+
+	operator, opriv := newCA(t, "Campus A")
+	partner, _ := newCA(t, "Campus B")
+	other, _ := newCA(t, "Campus C")
+
+	r, err := NewRegistry(logger, WithOperators(operator))
+	assert.NoError(t, err)
+
+	short := NewPartner("Campus C", "", other)
+	short.Expires = time.Now().Add(time.Minute).Unix()
+	short.Revoked = []string{"2a"}
+
+	_, verr := r.Load(sign(t, NewBundle("Campus A", 1, time.Hour, NewPartner("Campus B", "", partner), short), opriv, operator))
+	assert.Nil(t, verr)
+	assert.Len(t, r.Anchors(), 2)
+
+	for _, a := range r.Anchors() {
+		if a.Organization == "Campus C" {
+			assert.True(t, a.Revoked(&x509.Certificate{SerialNumber: big.NewInt(42)}))
+			assert.False(t, a.Revoked(&x509.Certificate{SerialNumber: big.NewInt(43)}))
+		}
+	}
+
+	r.now = func() time.Time { return time.Now().Add(2 * time.Minute) }
+	assert.Len(t, r.Anchors(), 1)
+
+	r.now = func() time.Time { return time.Now().Add(2 * time.Hour) }
+	assert.Empty(t, r.Anchors())
+}
+
+func TestDirectory(t *testing.T) {
+
+	operator, opriv := newCA(t, "Campus A")
+	partner, _ := newCA(t, "Campus B")
+	dir := filepath.Join(t.TempDir(), "bundles")
+
+	r, err := NewRegistry(logger, WithOperators(operator), WithDirectory(dir))
+	assert.NoError(t, err)
+
+	_, verr := r.Load(sign(t, NewBundle("Campus A", 1, time.Hour, NewPartner("Campus B", "", partner)), opriv, operator))
+	assert.Nil(t, verr)
+
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "broken.json"), []byte("garbage"), 0600))
+
+	restored, err := NewRegistry(logger, WithOperators(operator), WithDirectory(dir))
+	assert.NoError(t, err)
+	assert.Len(t, restored.Anchors(), 1)
+
+	assert.Nil(t, restored.Remove(Fingerprint(operator)))
+	_, err = os.Stat(filepath.Join(dir, Fingerprint(operator)+".json"))
+	assert.True(t, os.IsNotExist(err))
+
+	restored, err = NewRegistry(logger, WithOperators(operator), WithDirectory(dir))
+	assert.NoError(t, err)
+	assert.Empty(t, restored.Anchors())
+
+	file := filepath.Join(t.TempDir(), "file")
+	assert.NoError(t, os.WriteFile(file, nil, 0600))
+	_, err = NewRegistry(logger, WithDirectory(filepath.Join(file, "bundles")))
+	assert.Error(t, err)
+}
+
+func TestErrors(t *testing.T) {
+	for _, err := range []interface {
+		Error() string
+		Status() int
+	}{
+		&BundleFormatError{}, &BundleSignatureError{}, &BundleExpiredError{}, &BundleStaleError{},
+		&OperatorUnknownError{}, &BundleNotFoundError{}, &FederationInternalError{},
+	} {
+		assert.NotEmpty(t, err.Error())
+		assert.NotZero(t, err.Status())
+	}
+}
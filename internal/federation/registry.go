@@ -0,0 +1,317 @@
+package federation
+
+import (
+	"crypto/ed25519"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/Cealgull/Verify/internal/proto"
+	"github.com/Cealgull/Verify/pkg/sm2"
+	"go.uber.org/zap"
+)
+
+// Anchor is a partner certificate authority trusted through a bundle.
+type Anchor struct {
+	Certificate  *x509.Certificate
+	Organization string
+	revoked      map[string]struct{}
+}
+
+// Status summarizes an accepted bundle.
+type Status struct {
+	Kid           string   `json:"kid"`
+	Operator      string   `json:"operator"`
+	Sequence      uint64   `json:"sequence"`
+	Expires       int64    `json:"expires"`
+	Organizations []string `json:"organizations"`
+}
+
+type entry struct {
+	bundle  *Bundle
+	anchors []*Anchor
+	expires []int64
+}
+
+type Registry struct {
+	logger    *zap.SugaredLogger
+	mtx       sync.RWMutex
+	operators map[string]*x509.Certificate
+	bundles   map[string]*entry
+	dir       string
+	now       func() time.Time
+}
+
+type Option func(r *Registry) error
+
+func (a *Anchor) Revoked(cert *x509.Certificate) bool {
+	_, ok := a.revoked[cert.SerialNumber.Text(16)]
+	return ok
+}
+
+func WithOperators(certs ...*x509.Certificate) Option {
+	return func(r *Registry) error {
+		for _, c := range certs {
+			if _, ok := c.PublicKey.(ed25519.PublicKey); !ok {
+				return &OperatorFormatError{File: c.Subject.CommonName}
+			}
+			r.operators[Fingerprint(c)] = c
+		}
+		return nil
+	}
+}
+
+// WithOperatorFiles pins the certificates whose keys may sign bundles.
+func WithOperatorFiles(files ...string) Option {
+	return func(r *Registry) error {
+
+		for _, file := range files {
+
+			data, err := os.ReadFile(file)
+
+			if err != nil {
+				return err
+			}
+
+			for block, rest := pem.Decode(data); block != nil; block, rest = pem.Decode(rest) {
+
+				c, err := x509.ParseCertificate(block.Bytes)
+
+				if err != nil {
+					return &OperatorFormatError{File: file}
+				}
+
+				if _, ok := c.PublicKey.(ed25519.PublicKey); !ok {
+					return &OperatorFormatError{File: file}
+				}
+
+				r.operators[Fingerprint(c)] = c
+			}
+		}
+
+		return nil
+	}
+}
+
+// WithDirectory persists accepted bundles so they survive restarts.
+func WithDirectory(dir string) Option {
+	return func(r *Registry) error {
+		r.dir = dir
+		return os.MkdirAll(dir, 0700)
+	}
+}
+
+func NewRegistry(logger *zap.SugaredLogger, options ...Option) (*Registry, error) {
+
+	r := &Registry{
+		logger:    logger,
+		operators: make(map[string]*x509.Certificate),
+		bundles:   make(map[string]*entry),
+		now:       time.Now,
+	}
+
+	for _, option := range options {
+		if err := option(r); err != nil {
+			return nil, err
+		}
+	}
+
+	if r.dir == "" {
+		return r, nil
+	}
+
+	files, _ := filepath.Glob(filepath.Join(r.dir, "*.json"))
+
+	for _, file := range files {
+
+		data, err := os.ReadFile(file)
+
+		if err == nil {
+			_, err = r.load(data, false)
+		}
+
+		if err != nil {
+			logger.Warnf("Skipping stored trust bundle %s. err: %s", file, err.Error())
+		}
+	}
+
+	return r, nil
+}
+
+// Load verifies a signed bundle and replaces the previous bundle of the
+// same operator. Partners missing from the new bundle are no longer trusted.
+func (r *Registry) Load(data []byte) (*Bundle, proto.VerifyError) {
+	return r.load(data, true)
+}
+
+func (r *Registry) load(data []byte, persist bool) (*Bundle, proto.VerifyError) {
+
+	var signed SignedBundle
+
+	if err := json.Unmarshal(data, &signed); err != nil {
+		return nil, &BundleFormatError{}
+	}
+
+	operator, ok := r.operators[signed.Kid]
+
+	if !ok {
+		r.logger.Debugf("Trust bundle signed by unknown operator %s.", signed.Kid)
+		return nil, &OperatorUnknownError{}
+	}
+
+	payload, err := base64.StdEncoding.DecodeString(signed.Bundle)
+
+	if err != nil {
+		return nil, &BundleFormatError{}
+	}
+
+	sig, err := base64.StdEncoding.DecodeString(signed.Signature)
+
+	if err != nil || !ed25519.Verify(operator.PublicKey.(ed25519.PublicKey), payload, sig) {
+		return nil, &BundleSignatureError{}
+	}
+
+	var bundle Bundle
+
+	if err := json.Unmarshal(payload, &bundle); err != nil {
+		return nil, &BundleFormatError{}
+	}
+
+	if bundle.Expires <= r.now().Unix() {
+		return nil, &BundleExpiredError{}
+	}
+
+	e := &entry{bundle: &bundle}
+
+	for _, p := range bundle.Partners {
+
+		if p.Organization == "" || len(p.Certificates) == 0 {
+			return nil, &BundleFormatError{}
+		}
+
+		revoked := make(map[string]struct{}, len(p.Revoked))
+
+		for _, serial := range p.Revoked {
+			revoked[serial] = struct{}{}
+		}
+
+		for _, s := range p.Certificates {
+
+			block, _ := pem.Decode([]byte(s))
+
+			if block == nil {
+				return nil, &BundleFormatError{}
+			}
+
+			c, err := sm2.ParseCertificate(block.Bytes)
+
+			if err != nil {
+				return nil, &BundleFormatError{}
+			}
+
+			e.anchors = append(e.anchors, &Anchor{Certificate: c, Organization: p.Organization, revoked: revoked})
+			e.expires = append(e.expires, p.Expires)
+		}
+	}
+
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+
+	if prev, ok := r.bundles[signed.Kid]; ok && prev.bundle.Sequence >= bundle.Sequence {
+		return nil, &BundleStaleError{Sequence: prev.bundle.Sequence}
+	}
+
+	if persist && r.dir != "" {
+		if err := os.WriteFile(filepath.Join(r.dir, signed.Kid+".json"), data, 0600); err != nil {
+			r.logger.Errorf("Failed persisting the trust bundle. err: %s", err.Error())
+			return nil, &FederationInternalError{}
+		}
+	}
+
+	r.bundles[signed.Kid] = e
+
+	r.logger.Infof("Accepted trust bundle %d of operator %s with %d partners.", bundle.Sequence, bundle.Operator, len(bundle.Partners))
+
+	return &bundle, nil
+}
+
+// Remove withdraws the trust placed in the bundle of an operator.
+func (r *Registry) Remove(kid string) proto.VerifyError {
+
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+
+	if _, ok := r.bundles[kid]; !ok {
+		return &BundleNotFoundError{}
+	}
+
+	if r.dir != "" {
+		err := os.Remove(filepath.Join(r.dir, kid+".json"))
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			r.logger.Errorf("Failed removing the trust bundle. err: %s", err.Error())
+			return &FederationInternalError{}
+		}
+	}
+
+	delete(r.bundles, kid)
+
+	r.logger.Infof("Removed trust bundle of operator %s.", kid)
+
+	return nil
+}
+
+// Anchors returns the partner authorities of all unexpired bundles.
+func (r *Registry) Anchors() []*Anchor {
+
+	r.mtx.RLock()
+	defer r.mtx.RUnlock()
+
+	now := r.now().Unix()
+
+	var anchors []*Anchor
+
+	for _, e := range r.bundles {
+
+		if e.bundle.Expires <= now {
+			continue
+		}
+
+		for i, a := range e.anchors {
+			if e.expires[i] == 0 || e.expires[i] > now {
+				anchors = append(anchors, a)
+			}
+		}
+	}
+
+	return anchors
+}
+
+func (r *Registry) Bundles() []*Status {
+
+	r.mtx.RLock()
+	defer r.mtx.RUnlock()
+
+	var statuses []*Status
+
+	for kid, e := range r.bundles {
+
+		s := &Status{Kid: kid, Operator: e.bundle.Operator, Sequence: e.bundle.Sequence, Expires: e.bundle.Expires}
+
+		for _, p := range e.bundle.Partners {
+			s.Organizations = append(s.Organizations, p.Organization)
+		}
+
+		statuses = append(statuses, s)
+	}
+
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].Kid < statuses[j].Kid })
+
+	return statuses
+}
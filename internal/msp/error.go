@@ -0,0 +1,48 @@
+package msp
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/Cealgull/Verify/internal/proto"
+)
+
+type MSPInternalError struct{}
+type IdentityIncompleteError struct{}
+type CertificateFileError struct {
+	File string
+}
+
+func (e *MSPInternalError) Error() string {
+	return "MSP: Internal Server Error."
+}
+
+func (e *MSPInternalError) Status() int {
+	return http.StatusInternalServerError
+}
+
+func (e *MSPInternalError) Message() *proto.ResponseMessage {
+	return &proto.ResponseMessage{
+		Code:    "M1001",
+		Message: e.Error(),
+	}
+}
+
+func (e *IdentityIncompleteError) Error() string {
+	return "MSP: Identity Missing CA or Signing Certificate."
+}
+
+func (e *IdentityIncompleteError) Status() int {
+	return http.StatusBadRequest
+}
+
+func (e *IdentityIncompleteError) Message() *proto.ResponseMessage {
+	return &proto.ResponseMessage{
+		Code:    "M1002",
+		Message: e.Error(),
+	}
+}
+
+func (e *CertificateFileError) Error() string {
+	return fmt.Sprintf("MSP: No Valid Certificate in %s.", e.File)
+}
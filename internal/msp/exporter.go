@@ -0,0 +1,301 @@
+package msp
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/Cealgull/Verify/internal/proto"
+	"github.com/Cealgull/Verify/pkg/sm2"
+	"go.uber.org/zap"
+)
+
+const (
+	CACERTS           = "cacerts"
+	SIGNCERTS         = "signcerts"
+	INTERMEDIATECERTS = "intermediatecerts"
+	ADMINCERTS        = "admincerts"
+	CONFIG            = "config.yaml"
+)
+
+var folders = []string{CACERTS, SIGNCERTS, INTERMEDIATECERTS, ADMINCERTS}
+
+type Identity struct {
+	CA            *x509.Certificate
+	Intermediates []*x509.Certificate
+	Admins        []*x509.Certificate
+	Sign          *x509.Certificate
+}
+
+// NewIdentity places the root of a CA chain under cacerts and every
+// certificate below it under intermediatecerts.
+func NewIdentity(chain []*x509.Certificate, sign *x509.Certificate) *Identity {
+
+	id := &Identity{Sign: sign}
+
+	if len(chain) > 0 {
+		id.CA = chain[len(chain)-1]
+		id.Intermediates = chain[:len(chain)-1]
+	}
+
+	return id
+}
+
+type entry struct {
+	path string
+	data []byte
+}
+
+type Exporter struct {
+	logger   *zap.SugaredLogger
+	client   string
+	peer     string
+	admin    string
+	orderer  string
+	cacertfn string
+	admins   []*x509.Certificate
+}
+
+type Option func(e *Exporter) error
+
+func WithClientOU(ou string) Option {
+	return func(e *Exporter) error {
+		if ou != "" {
+			e.client = ou
+		}
+		return nil
+	}
+}
+
+func WithPeerOU(ou string) Option {
+	return func(e *Exporter) error {
+		if ou != "" {
+			e.peer = ou
+		}
+		return nil
+	}
+}
+
+func WithAdminOU(ou string) Option {
+	return func(e *Exporter) error {
+		if ou != "" {
+			e.admin = ou
+		}
+		return nil
+	}
+}
+
+func WithOrdererOU(ou string) Option {
+	return func(e *Exporter) error {
+		if ou != "" {
+			e.orderer = ou
+		}
+		return nil
+	}
+}
+
+// WithAdminCerts places the certificates of the PEM bundle in file under
+// admincerts of every exported tree.
+func WithAdminCerts(file string) Option {
+	return func(e *Exporter) error {
+		if file == "" {
+			return nil
+		}
+		certs, err := LoadCertificates(file)
+		e.admins = certs
+		return err
+	}
+}
+
+// LoadCertificates reads every certificate of the PEM bundle in file.
+func LoadCertificates(file string) ([]*x509.Certificate, error) {
+
+	b, err := os.ReadFile(file)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var certs []*x509.Certificate
+
+	for block, rest := pem.Decode(b); block != nil; block, rest = pem.Decode(rest) {
+
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+
+		cert, err := sm2.ParseCertificate(block.Bytes)
+
+		if err != nil {
+			return nil, &CertificateFileError{File: file}
+		}
+
+		certs = append(certs, cert)
+	}
+
+	if len(certs) == 0 {
+		return nil, &CertificateFileError{File: file}
+	}
+
+	return certs, nil
+}
+
+func NewExporter(logger *zap.SugaredLogger, options ...Option) (*Exporter, error) {
+
+	e := &Exporter{
+		logger:   logger,
+		client:   "Cealgull Project",
+		peer:     "peer",
+		admin:    "admin",
+		orderer:  "orderer",
+		cacertfn: "ca-cert.pem",
+	}
+
+	for _, option := range options {
+		if err := option(e); err != nil {
+			return nil, err
+		}
+	}
+
+	return e, nil
+}
+
+func encodeCert(cert *x509.Certificate) []byte {
+	return pem.EncodeToMemory(&pem.Block{
+		Type:  "CERTIFICATE",
+		Bytes: cert.Raw,
+	})
+}
+
+func (e *Exporter) config() []byte {
+
+	cacert := filepath.ToSlash(filepath.Join(CACERTS, e.cacertfn))
+
+	identifier := func(kind string, ou string) string {
+		return fmt.Sprintf("  %sOUIdentifier:\n"+
+			"    Certificate: %s\n"+
+			"    OrganizationalUnitIdentifier: %q\n", kind, cacert, ou)
+	}
+
+	return []byte("NodeOUs:\n" +
+		"  Enable: true\n" +
+		identifier("Client", e.client) +
+		identifier("Peer", e.peer) +
+		identifier("Admin", e.admin) +
+		identifier("Orderer", e.orderer))
+}
+
+func (e *Exporter) entries(id *Identity) ([]entry, proto.VerifyError) {
+
+	if id.CA == nil || id.Sign == nil {
+		return nil, &IdentityIncompleteError{}
+	}
+
+	entries := []entry{
+		{filepath.Join(CACERTS, e.cacertfn), encodeCert(id.CA)},
+		{filepath.Join(SIGNCERTS, "cert.pem"), encodeCert(id.Sign)},
+		{CONFIG, e.config()},
+	}
+
+	for i, cert := range id.Intermediates {
+		entries = append(entries, entry{
+			filepath.Join(INTERMEDIATECERTS, fmt.Sprintf("intermediate-%d.pem", i)),
+			encodeCert(cert),
+		})
+	}
+
+	admins := append(append([]*x509.Certificate{}, id.Admins...), e.admins...)
+
+	for i, cert := range admins {
+		entries = append(entries, entry{
+			filepath.Join(ADMINCERTS, fmt.Sprintf("admin-%d.pem", i)),
+			encodeCert(cert),
+		})
+	}
+
+	return entries, nil
+}
+
+func (e *Exporter) WriteDir(dir string, id *Identity) proto.VerifyError {
+
+	entries, verr := e.entries(id)
+
+	if verr != nil {
+		return verr
+	}
+
+	e.logger.Infof("Writing MSP directory tree to %s.", dir)
+
+	for _, folder := range folders {
+		if err := os.MkdirAll(filepath.Join(dir, folder), 0o755); err != nil {
+			e.logger.Errorf("Failed creating MSP folder %s. err: %s", folder, err.Error())
+			return &MSPInternalError{}
+		}
+	}
+
+	for _, ent := range entries {
+		if err := os.WriteFile(filepath.Join(dir, ent.path), ent.data, 0o644); err != nil {
+			e.logger.Errorf("Failed writing MSP file %s. err: %s", ent.path, err.Error())
+			return &MSPInternalError{}
+		}
+	}
+
+	return nil
+}
+
+func (e *Exporter) WriteArchive(w io.Writer, id *Identity) proto.VerifyError {
+
+	entries, verr := e.entries(id)
+
+	if verr != nil {
+		return verr
+	}
+
+	zw := gzip.NewWriter(w)
+	tw := tar.NewWriter(zw)
+	now := time.Now()
+
+	for _, folder := range folders {
+		hdr := &tar.Header{
+			Typeflag: tar.TypeDir,
+			Name:     "msp/" + folder + "/",
+			Mode:     0o755,
+			ModTime:  now,
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return &MSPInternalError{}
+		}
+	}
+
+	for _, ent := range entries {
+		hdr := &tar.Header{
+			Typeflag: tar.TypeReg,
+			Name:     "msp/" + filepath.ToSlash(ent.path),
+			Mode:     0o644,
+			Size:     int64(len(ent.data)),
+			ModTime:  now,
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return &MSPInternalError{}
+		}
+		if _, err := tw.Write(ent.data); err != nil {
+			return &MSPInternalError{}
+		}
+	}
+
+	if err := tw.Close(); err != nil {
+		return &MSPInternalError{}
+	}
+
+	if err := zw.Close(); err != nil {
+		return &MSPInternalError{}
+	}
+
+	return nil
+}
@@ -0,0 +1,197 @@
+package msp
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Cealgull/Verify/pkg/sm2"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+var exporter *Exporter
+var ca *x509.Certificate
+
+func TestNewExporter(t *testing.T) {
+
+	l, _ := zap.NewProduction()
+
+	var err error
+	exporter, err = NewExporter(
+		l.Sugar(),
+		WithClientOU("client"),
+		WithPeerOU(""),
+		WithAdminOU("admin"),
+		WithOrdererOU("orderer"),
+	)
+	assert.NoError(t, err)
+	assert.Equal(t, "client", exporter.client)
+	assert.Equal(t, "peer", exporter.peer)
+
+	_, err = NewExporter(l.Sugar(), WithAdminCerts("./testdata/missing.pem"))
+	assert.Error(t, err)
+
+	_, err = NewExporter(l.Sugar(), WithAdminCerts("./exporter.go"))
+	assert.IsType(t, &CertificateFileError{}, err)
+	var _ = err.Error()
+
+	b, _ := os.ReadFile("./testdata/cert.pem")
+	p, _ := pem.Decode(b)
+	ca, err = x509.ParseCertificate(p.Bytes)
+	assert.NoError(t, err)
+}
+
+func TestNewIdentity(t *testing.T) {
+
+	id := NewIdentity(nil, ca)
+	assert.Nil(t, id.CA)
+
+	id = NewIdentity([]*x509.Certificate{ca}, ca)
+	assert.Equal(t, ca, id.CA)
+	assert.Empty(t, id.Intermediates)
+
+	root := &x509.Certificate{}
+	id = NewIdentity([]*x509.Certificate{ca, root}, ca)
+	assert.Equal(t, root, id.CA)
+	assert.Equal(t, []*x509.Certificate{ca}, id.Intermediates)
+}
+
+func TestWriteDir(t *testing.T) {
+
+	dir := t.TempDir()
+
+	err := exporter.WriteDir(dir, &Identity{CA: ca})
+	assert.IsType(t, &IdentityIncompleteError{}, err)
+	var _ = err.Status()
+	var _ = err.Message()
+
+	err = exporter.WriteDir(dir, &Identity{
+		CA:            ca,
+		Sign:          ca,
+		Intermediates: []*x509.Certificate{ca},
+	})
+	assert.Nil(t, err)
+
+	for _, folder := range folders {
+		info, err := os.Stat(filepath.Join(dir, folder))
+		assert.NoError(t, err)
+		assert.True(t, info.IsDir())
+	}
+
+	b, _ := os.ReadFile(filepath.Join(dir, SIGNCERTS, "cert.pem"))
+	assert.Equal(t, encodeCert(ca), b)
+
+	b, _ = os.ReadFile(filepath.Join(dir, INTERMEDIATECERTS, "intermediate-0.pem"))
+	assert.Equal(t, encodeCert(ca), b)
+
+	b, _ = os.ReadFile(filepath.Join(dir, CONFIG))
+	assert.Contains(t, string(b), "Enable: true")
+	assert.Contains(t, string(b), "OrganizationalUnitIdentifier: \"client\"")
+	assert.Contains(t, string(b), "Certificate: cacerts/ca-cert.pem")
+
+	f, _ := os.CreateTemp(dir, "file")
+	err = exporter.WriteDir(f.Name(), &Identity{CA: ca, Sign: ca})
+	assert.IsType(t, &MSPInternalError{}, err)
+	var _ = err.Status()
+	var _ = err.Message()
+}
+
+func TestWriteArchive(t *testing.T) {
+
+	var buf bytes.Buffer
+
+	err := exporter.WriteArchive(&buf, &Identity{Sign: ca})
+	assert.IsType(t, &IdentityIncompleteError{}, err)
+
+	err = exporter.WriteArchive(&buf, &Identity{
+		CA:     ca,
+		Sign:   ca,
+		Admins: []*x509.Certificate{ca},
+	})
+	assert.Nil(t, err)
+
+	zr, gerr := gzip.NewReader(&buf)
+	assert.NoError(t, gerr)
+	tr := tar.NewReader(zr)
+
+	names := map[string]bool{}
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		assert.NoError(t, err)
+		names[hdr.Name] = true
+	}
+
+	assert.True(t, names["msp/intermediatecerts/"])
+	assert.True(t, names["msp/cacerts/ca-cert.pem"])
+	assert.True(t, names["msp/admincerts/admin-0.pem"])
+	assert.True(t, names["msp/config.yaml"])
+
+	for name := range names {
+		assert.True(t, strings.HasPrefix(name, "msp/"))
+	}
+}
+
+func TestAdminCerts(t *testing.T) {
+
+	l, _ := zap.NewProduction()
+
+	e, err := NewExporter(l.Sugar(), WithAdminCerts("./testdata/cert.pem"))
+	assert.NoError(t, err)
+	assert.Equal(t, []*x509.Certificate{ca}, e.admins)
+
+	dir := t.TempDir()
+	assert.Nil(t, e.WriteDir(dir, &Identity{CA: ca, Sign: ca, Admins: []*x509.Certificate{ca}}))
+
+	entries, _ := os.ReadDir(filepath.Join(dir, ADMINCERTS))
+	assert.Len(t, entries, 2)
+
+	b, _ := os.ReadFile(filepath.Join(dir, ADMINCERTS, "admin-1.pem"))
+	assert.Equal(t, encodeCert(ca), b)
+}
+
+func TestSM2Certificates(t *testing.T) {
+
+	priv, err := sm2.GenerateKey()
+	assert.NoError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "SM2 CA"},
+		NotBefore:             time.Now(),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+
+	der, err := sm2.CreateCertificate(rand.Reader, template, template, priv.Public(), priv)
+	assert.NoError(t, err)
+
+	file := filepath.Join(t.TempDir(), "sm2.pem")
+	assert.NoError(t, os.WriteFile(file, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600))
+
+	certs, err := LoadCertificates(file)
+	assert.NoError(t, err)
+	assert.Len(t, certs, 1)
+	assert.IsType(t, &sm2.PublicKey{}, certs[0].PublicKey)
+
+	dir := t.TempDir()
+	assert.Nil(t, exporter.WriteDir(dir, &Identity{CA: certs[0], Sign: certs[0], Admins: certs}))
+
+	b, _ := os.ReadFile(filepath.Join(dir, ADMINCERTS, "admin-0.pem"))
+	assert.Equal(t, encodeCert(certs[0]), b)
+}
@@ -0,0 +1,124 @@
+package policy
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/Cealgull/Verify/internal/proto"
+)
+
+type ForbiddenKeyError struct{}
+type AlgorithmError struct {
+	Algorithm string
+}
+type WindowError struct{}
+type ResignLimitError struct {
+	Limit int64
+}
+type EpochCapError struct {
+	Cap int64
+}
+type PolicyInternalError struct{}
+type CacheMissingError struct{}
+type RuleFormatError struct {
+	Rule  string
+	Value string
+}
+
+func (e *ForbiddenKeyError) Error() string {
+	return "Policy: Rule forbidden Denied Issuance. Public Key Is Forbidden."
+}
+
+func (e *ForbiddenKeyError) Status() int {
+	return http.StatusForbidden
+}
+
+func (e *ForbiddenKeyError) Message() *proto.ResponseMessage {
+	return &proto.ResponseMessage{
+		Code:    "R1001",
+		Message: e.Error(),
+	}
+}
+
+func (e *AlgorithmError) Error() string {
+	return fmt.Sprintf("Policy: Rule algorithms Denied Issuance. Algorithm %s Not Allowed.", e.Algorithm)
+}
+
+func (e *AlgorithmError) Status() int {
+	return http.StatusForbidden
+}
+
+func (e *AlgorithmError) Message() *proto.ResponseMessage {
+	return &proto.ResponseMessage{
+		Code:    "R1002",
+		Message: e.Error(),
+	}
+}
+
+func (e *WindowError) Error() string {
+	return "Policy: Rule windows Denied Issuance. Outside The Allowed Time Windows."
+}
+
+func (e *WindowError) Status() int {
+	return http.StatusForbidden
+}
+
+func (e *WindowError) Message() *proto.ResponseMessage {
+	return &proto.ResponseMessage{
+		Code:    "R1003",
+		Message: e.Error(),
+	}
+}
+
+func (e *ResignLimitError) Error() string {
+	return fmt.Sprintf("Policy: Rule resigns Denied Issuance. At Most %d Re-signs Per Key Per Day.", e.Limit)
+}
+
+func (e *ResignLimitError) Status() int {
+	return http.StatusTooManyRequests
+}
+
+func (e *ResignLimitError) Message() *proto.ResponseMessage {
+	return &proto.ResponseMessage{
+		Code:    "R1004",
+		Message: e.Error(),
+	}
+}
+
+func (e *EpochCapError) Error() string {
+	return fmt.Sprintf("Policy: Rule epoch Denied Issuance. At Most %d Certificates Per Epoch.", e.Cap)
+}
+
+func (e *EpochCapError) Status() int {
+	return http.StatusTooManyRequests
+}
+
+func (e *EpochCapError) Message() *proto.ResponseMessage {
+	return &proto.ResponseMessage{
+		Code:    "R1005",
+		Message: e.Error(),
+	}
+}
+
+func (e *PolicyInternalError) Error() string {
+	return "Policy: Internal Server Error."
+}
+
+func (e *PolicyInternalError) Status() int {
+	return http.StatusInternalServerError
+}
+
+func (e *PolicyInternalError) Message() *proto.ResponseMessage {
+	return &proto.ResponseMessage{
+		Code:    "R1006",
+		Message: e.Error(),
+	}
+}
+
+func (e *RuleFormatError) Error() string {
+	return fmt.Sprintf("Policy: Rule %s Has Invalid Value %s.", e.Rule, e.Value)
+}
+
+func (e *CacheMissingError) Error() string {
+	return "Policy: Counting Rules Require A Cache."
+}
@@ -0,0 +1,291 @@
+package policy
+
+import (
+	"encoding/base64"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/Cealgull/Verify/internal/cache"
+	"github.com/Cealgull/Verify/internal/proto"
+	"go.uber.org/zap"
+)
+
+const (
+	RuleForbidden  = "forbidden"
+	RuleAlgorithms = "algorithms"
+	RuleWindows    = "windows"
+	RuleResigns    = "resigns"
+	RuleEpoch      = "epoch"
+)
+
+const (
+	Ed25519 = "ed25519"
+	SM2     = "sm2"
+)
+
+// Request describes a single certificate issuance to be authorized.
+// Algorithm is the algorithm of the submitted key and Signature the one
+// the authority signs the certificate with.
+type Request struct {
+	Pub       []byte
+	Algorithm string
+	Signature string
+	Resign    bool
+	counted   []string
+}
+
+type window struct {
+	start int
+	end   int
+}
+
+// Policy evaluates the configured issuance rules. Rules left unset are
+// not enforced.
+type Policy struct {
+	logger     *zap.SugaredLogger
+	cache      cache.Cache
+	resigns    int64
+	algorithms map[string]bool
+	forbidden  map[string]bool
+	windows    []window
+	location   *time.Location
+	epoch      time.Duration
+	cap        int64
+	now        func() time.Time
+}
+
+type Option func(p *Policy) error
+
+// WithMaxResigns limits how many times a key may be re-signed per day.
+func WithMaxResigns(n int) Option {
+	return func(p *Policy) error {
+		p.resigns = int64(n)
+		return nil
+	}
+}
+
+func WithAlgorithms(algorithms ...string) Option {
+	return func(p *Policy) error {
+		for _, alg := range algorithms {
+			p.algorithms[strings.ToLower(alg)] = true
+		}
+		return nil
+	}
+}
+
+// WithForbiddenKeys denies issuance to the given base64 public keys.
+func WithForbiddenKeys(keys ...string) Option {
+	return func(p *Policy) error {
+		for _, key := range keys {
+			pub, err := base64.StdEncoding.DecodeString(key)
+			if err != nil {
+				return &RuleFormatError{RuleForbidden, key}
+			}
+			p.forbidden[string(pub)] = true
+		}
+		return nil
+	}
+}
+
+func parseClock(s string) (int, bool) {
+	t, err := time.Parse("15:04", strings.TrimSpace(s))
+	if err != nil {
+		return 0, false
+	}
+	return t.Hour()*60 + t.Minute(), true
+}
+
+// WithWindows restricts issuance to time-of-day windows written as
+// "HH:MM-HH:MM". A window whose end precedes its start wraps past midnight.
+func WithWindows(windows ...string) Option {
+	return func(p *Policy) error {
+		for _, w := range windows {
+
+			from, to, ok := strings.Cut(w, "-")
+			start, sok := parseClock(from)
+			end, eok := parseClock(to)
+
+			if !ok || !sok || !eok || start == end {
+				return &RuleFormatError{RuleWindows, w}
+			}
+
+			p.windows = append(p.windows, window{start, end})
+		}
+		return nil
+	}
+}
+
+// WithLocation sets the time zone the daily rules are evaluated in.
+func WithLocation(name string) Option {
+	return func(p *Policy) error {
+		if name == "" {
+			return nil
+		}
+		loc, err := time.LoadLocation(name)
+		if err != nil {
+			return &RuleFormatError{RuleWindows, name}
+		}
+		p.location = loc
+		return nil
+	}
+}
+
+// WithEpochCap limits the number of certificates issued within every epoch
+// of the given length in seconds.
+func WithEpochCap(epoch int64, n int) Option {
+	return func(p *Policy) error {
+		if epoch < 0 || n > 0 && epoch == 0 {
+			return &RuleFormatError{RuleEpoch, fmt.Sprint(epoch)}
+		}
+		p.epoch = time.Duration(epoch) * time.Second
+		p.cap = int64(n)
+		return nil
+	}
+}
+
+func WithCache(c cache.Cache) Option {
+	return func(p *Policy) error {
+		p.cache = c
+		return nil
+	}
+}
+
+func NewPolicy(logger *zap.SugaredLogger, options ...Option) (*Policy, error) {
+
+	p := &Policy{
+		logger:     logger,
+		algorithms: make(map[string]bool),
+		forbidden:  make(map[string]bool),
+		location:   time.UTC,
+		now:        time.Now,
+	}
+
+	for _, option := range options {
+		if err := option(p); err != nil {
+			return nil, err
+		}
+	}
+
+	if (p.resigns > 0 || p.cap > 0) && p.cache == nil {
+		return nil, &CacheMissingError{}
+	}
+
+	return p, nil
+}
+
+func (p *Policy) inWindow(t time.Time) bool {
+
+	if len(p.windows) == 0 {
+		return true
+	}
+
+	minute := t.Hour()*60 + t.Minute()
+
+	for _, w := range p.windows {
+		if w.start < w.end && minute >= w.start && minute < w.end {
+			return true
+		}
+		if w.start > w.end && (minute >= w.start || minute < w.end) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (p *Policy) count(req *Request, key string, expiration time.Duration) (int64, proto.VerifyError) {
+
+	n, err := p.cache.Incr(key, expiration)
+
+	if err != nil {
+		p.logger.Errorf("Redis failure happened when counting %s. err: %s.", key, err.Error())
+		return 0, &PolicyInternalError{}
+	}
+
+	req.counted = append(req.counted, key)
+
+	return n, nil
+}
+
+// Release gives back the quota an evaluated request consumed, for
+// issuances that fail after being authorized.
+func (p *Policy) Release(req *Request) {
+
+	for _, key := range req.counted {
+		if _, err := p.cache.Decr(key); err != nil {
+			p.logger.Errorf("Redis failure happened when releasing %s. err: %s.", key, err.Error())
+		}
+	}
+
+	req.counted = nil
+}
+
+// Evaluate checks the request against every rule and returns the error of
+// the first rule that denies it. Counting rules are evaluated last so that
+// requests rejected by the other rules do not consume any quota, and a
+// denied request gives back what it counted.
+func (p *Policy) Evaluate(req *Request) proto.VerifyError {
+
+	err := p.evaluate(req)
+
+	if err != nil {
+		p.Release(req)
+	}
+
+	return err
+}
+
+func (p *Policy) evaluate(req *Request) proto.VerifyError {
+
+	now := p.now().In(p.location)
+	key := base64.StdEncoding.EncodeToString(req.Pub)
+
+	if p.forbidden[string(req.Pub)] {
+		p.logger.Infof("Policy rule %s denied public key %s.", RuleForbidden, key)
+		return &ForbiddenKeyError{}
+	}
+
+	for _, alg := range []string{req.Algorithm, req.Signature} {
+		if len(p.algorithms) != 0 && alg != "" && !p.algorithms[strings.ToLower(alg)] {
+			p.logger.Infof("Policy rule %s denied algorithm %s.", RuleAlgorithms, alg)
+			return &AlgorithmError{alg}
+		}
+	}
+
+	if !p.inWindow(now) {
+		p.logger.Infof("Policy rule %s denied issuance at %s.", RuleWindows, now.Format("15:04"))
+		return &WindowError{}
+	}
+
+	if req.Resign && p.resigns > 0 {
+
+		n, err := p.count(req, fmt.Sprintf("policy:%s:%s:%s", RuleResigns, now.Format("2006-01-02"), key), 24*time.Hour)
+
+		if err != nil {
+			return err
+		}
+
+		if n > p.resigns {
+			p.logger.Infof("Policy rule %s denied public key %s.", RuleResigns, key)
+			return &ResignLimitError{p.resigns}
+		}
+	}
+
+	if p.cap > 0 {
+
+		epoch := now.Unix() / int64(p.epoch/time.Second)
+		n, err := p.count(req, fmt.Sprintf("policy:%s:%d", RuleEpoch, epoch), p.epoch)
+
+		if err != nil {
+			return err
+		}
+
+		if n > p.cap {
+			p.logger.Infof("Policy rule %s denied issuance in epoch %d.", RuleEpoch, epoch)
+			return &EpochCapError{p.cap}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,158 @@
+package policy
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/Cealgull/Verify/internal/cache"
+	"github.com/Cealgull/Verify/internal/cache/mock"
+	"github.com/Cealgull/Verify/internal/proto"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+func at(clock string) func() time.Time {
+	t, _ := time.Parse(time.RFC3339, "2024-05-01T"+clock+":00Z")
+	return func() time.Time { return t }
+}
+
+func TestNewPolicy(t *testing.T) {
+
+	l, _ := zap.NewProduction()
+	logger := l.Sugar()
+
+	invalid := []Option{
+		WithForbiddenKeys("not base64!"),
+		WithWindows("08:00"),
+		WithWindows("08:00-25:00"),
+		WithWindows("08:00-08:00"),
+		WithLocation("Nowhere/Unknown"),
+		WithEpochCap(-1, 0),
+		WithEpochCap(0, 10),
+		WithMaxResigns(3),
+	}
+
+	for _, option := range invalid {
+		p, err := NewPolicy(logger, option)
+		assert.Nil(t, p)
+		assert.Error(t, err)
+		var _ = err.Error()
+	}
+
+	p, err := NewPolicy(logger, WithLocation(""))
+	assert.NoError(t, err)
+
+	pub, _, _ := ed25519.GenerateKey(nil)
+	assert.Nil(t, p.Evaluate(&Request{Pub: pub, Algorithm: "sm2", Resign: true}))
+}
+
+func TestEvaluate(t *testing.T) {
+
+	l, _ := zap.NewProduction()
+	logger := l.Sugar()
+	c := mock.NewMockCache()
+
+	forbidden, _, _ := ed25519.GenerateKey(nil)
+	pub, _, _ := ed25519.GenerateKey(nil)
+
+	p, err := NewPolicy(
+		logger,
+		WithForbiddenKeys(base64.StdEncoding.EncodeToString(forbidden)),
+		WithAlgorithms("Ed25519"),
+		WithWindows("08:00-12:00", "22:00-02:00"),
+		WithLocation("Asia/Shanghai"),
+		WithMaxResigns(2),
+		WithEpochCap(3600, 3),
+		WithCache(c),
+	)
+	assert.NoError(t, err)
+
+	// 02:00 UTC is 10:00 in Shanghai
+	p.now = at("02:00")
+
+	var verr proto.VerifyError
+
+	verr = p.Evaluate(&Request{Pub: forbidden, Algorithm: Ed25519})
+	assert.IsType(t, &ForbiddenKeyError{}, verr)
+
+	verr = p.Evaluate(&Request{Pub: pub, Algorithm: "sm2"})
+	assert.IsType(t, &AlgorithmError{}, verr)
+	assert.Contains(t, verr.Message().Message, "sm2")
+
+	p.now = at("06:00")
+	verr = p.Evaluate(&Request{Pub: pub, Algorithm: Ed25519})
+	assert.IsType(t, &WindowError{}, verr)
+
+	// 15:30 UTC is 23:30 in Shanghai, inside the window across midnight
+	p.now = at("15:30")
+	assert.Nil(t, p.Evaluate(&Request{Pub: pub, Algorithm: Ed25519, Resign: true}))
+	assert.Nil(t, p.Evaluate(&Request{Pub: pub, Algorithm: Ed25519, Resign: true}))
+
+	verr = p.Evaluate(&Request{Pub: pub, Algorithm: Ed25519, Resign: true})
+	assert.IsType(t, &ResignLimitError{}, verr)
+	assert.Contains(t, verr.Message().Message, "resigns")
+
+	assert.Nil(t, p.Evaluate(&Request{Pub: pub, Algorithm: Ed25519}))
+
+	verr = p.Evaluate(&Request{Pub: pub, Algorithm: Ed25519})
+	assert.IsType(t, &EpochCapError{}, verr)
+	assert.Contains(t, verr.Message().Message, "epoch")
+
+	// the next day in Shanghai starts a new count for re-signs and the epoch
+	p.now = at("16:30")
+	assert.Nil(t, p.Evaluate(&Request{Pub: pub, Algorithm: Ed25519, Resign: true}))
+
+	codes := make(map[string]bool)
+	for _, e := range []proto.VerifyError{
+		&ForbiddenKeyError{}, &AlgorithmError{}, &WindowError{},
+		&ResignLimitError{}, &EpochCapError{}, &PolicyInternalError{},
+	} {
+		var _ = e.Status()
+		codes[e.Message().Code] = true
+	}
+	assert.Len(t, codes, 6)
+
+	p.now = at("17:30")
+	c.AddSetErr(fmt.Sprintf("policy:epoch:%d", p.now().Unix()/3600), &cache.InternalError{})
+	verr = p.Evaluate(&Request{Pub: pub, Algorithm: Ed25519})
+	assert.IsType(t, &PolicyInternalError{}, verr)
+
+	c.AddSetErr("policy:resigns:2024-05-02:"+base64.StdEncoding.EncodeToString(pub), &cache.InternalError{})
+	verr = p.Evaluate(&Request{Pub: pub, Algorithm: Ed25519, Resign: true})
+	assert.IsType(t, &PolicyInternalError{}, verr)
+}
+
+func TestRelease(t *testing.T) {
+
+	l, _ := zap.NewProduction()
+	logger := l.Sugar()
+	c := mock.NewMockCache()
+
+	pub, _, _ := ed25519.GenerateKey(nil)
+
+	p, err := NewPolicy(logger, WithAlgorithms(Ed25519), WithMaxResigns(1), WithEpochCap(3600, 1), WithCache(c))
+	assert.NoError(t, err)
+	p.now = at("10:00")
+
+	verr := p.Evaluate(&Request{Pub: pub, Algorithm: Ed25519, Signature: SM2})
+	assert.Equal(t, &AlgorithmError{SM2}, verr)
+
+	// a failed issuance gives back what it counted
+	req := &Request{Pub: pub, Algorithm: Ed25519, Signature: Ed25519, Resign: true}
+	assert.Nil(t, p.Evaluate(req))
+	p.Release(req)
+	assert.Nil(t, p.Evaluate(&Request{Pub: pub, Algorithm: Ed25519, Resign: true}))
+
+	// a denied request does not count either
+	epoch := fmt.Sprintf("policy:epoch:%d", p.now().Unix()/3600)
+	verr = p.Evaluate(&Request{Pub: pub, Algorithm: Ed25519})
+	assert.IsType(t, &EpochCapError{}, verr)
+	n, _ := c.Get(epoch)
+	assert.Equal(t, "1", n)
+
+	c.AddSetErr(epoch, &cache.InternalError{})
+	p.Release(&Request{counted: []string{epoch}})
+}
@@ -3,6 +3,8 @@ package proto
 type ResponseMessage struct {
 	Code    string `json:"code"`
 	Message string `json:"message"`
+	// Remaining counts the attempts left where they are limited.
+	Remaining *int `json:"remaining,omitempty"`
 }
 
 type VerifyError interface {
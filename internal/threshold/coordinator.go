@@ -0,0 +1,125 @@
+package threshold
+
+import (
+	"context"
+	"crypto"
+	"crypto/ed25519"
+	"io"
+	"time"
+
+	"github.com/Cealgull/Verify/pkg/frost"
+	"go.uber.org/zap"
+)
+
+// Coordinator drives the two FROST rounds across the signer nodes and
+// implements crypto.Signer, so it can stand in for the CA private key.
+type Coordinator struct {
+	logger       *zap.SugaredLogger
+	group        *frost.Group
+	participants []Participant
+	timeout      time.Duration
+}
+
+type CoordinatorOption func(c *Coordinator) error
+
+func WithParticipants(participants ...Participant) CoordinatorOption {
+	return func(c *Coordinator) error {
+		c.participants = append(c.participants, participants...)
+		return nil
+	}
+}
+
+func WithTimeout(timeout time.Duration) CoordinatorOption {
+	return func(c *Coordinator) error {
+		if timeout > 0 {
+			c.timeout = timeout
+		}
+		return nil
+	}
+}
+
+func NewCoordinator(logger *zap.SugaredLogger, group *frost.Group, options ...CoordinatorOption) (*Coordinator, error) {
+
+	c := &Coordinator{
+		logger:  logger,
+		group:   group,
+		timeout: 10 * time.Second,
+	}
+
+	for _, option := range options {
+		if err := option(c); err != nil {
+			return nil, err
+		}
+	}
+
+	if len(c.participants) < group.Threshold {
+		return nil, &ThresholdUnavailableError{}
+	}
+
+	return c, nil
+}
+
+func (c *Coordinator) Public() crypto.PublicKey {
+	return ed25519.PublicKey(c.group.PublicKey)
+}
+
+func (c *Coordinator) Sign(rand io.Reader, msg []byte, opts crypto.SignerOpts) ([]byte, error) {
+
+	if opts.HashFunc() != crypto.Hash(0) {
+		return nil, &SignRequestError{}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+	defer cancel()
+
+	var signers []Participant
+	var commitments []frost.Commitment
+
+	for _, p := range c.participants {
+
+		if len(signers) == c.group.Threshold {
+			break
+		}
+
+		commitment, err := p.Commit(ctx)
+
+		if err != nil {
+			c.logger.Warnf("Signer unavailable during commitment round. err: %s", err.Error())
+			continue
+		}
+
+		signers = append(signers, p)
+		commitments = append(commitments, *commitment)
+	}
+
+	if len(signers) < c.group.Threshold {
+		c.logger.Errorf("Only %d of %d required signers committed.", len(signers), c.group.Threshold)
+		return nil, &ThresholdUnavailableError{}
+	}
+
+	req := &SignRequest{Message: msg, Commitments: commitments}
+	shares := make([]frost.SignatureShare, len(signers))
+
+	for i, p := range signers {
+
+		share, err := p.Sign(ctx, req)
+
+		if err != nil {
+			c.logger.Errorf("Signer failed during signing round. err: %s", err.Error())
+			return nil, err
+		}
+
+		shares[i] = *share
+	}
+
+	sig, err := frost.Aggregate(c.group, msg, commitments, shares)
+
+	if err != nil {
+		c.logger.Errorf("Failed aggregating signature shares. err: %s", err.Error())
+		return nil, &ThresholdInternalError{}
+	}
+
+	c.logger.Infof("Threshold signature aggregated from %d signers.", len(signers))
+
+	return sig, nil
+}
@@ -0,0 +1,112 @@
+package threshold
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/Cealgull/Verify/internal/proto"
+)
+
+type ThresholdInternalError struct{}
+type ThresholdUnavailableError struct{}
+type NonceNotFoundError struct{}
+type SignRequestError struct{}
+type SignerRejectedError struct{}
+type ShareFormatError struct{}
+type ProfileError struct {
+	Reason string
+}
+
+func (e *ThresholdInternalError) Error() string {
+	return "Threshold: Internal Server Error."
+}
+
+func (e *ThresholdInternalError) Status() int {
+	return http.StatusInternalServerError
+}
+
+func (e *ThresholdInternalError) Message() *proto.ResponseMessage {
+	return &proto.ResponseMessage{
+		Code:    "T1001",
+		Message: e.Error(),
+	}
+}
+
+func (e *ThresholdUnavailableError) Error() string {
+	return "Threshold: Not Enough Signers Available."
+}
+
+func (e *ThresholdUnavailableError) Status() int {
+	return http.StatusServiceUnavailable
+}
+
+func (e *ThresholdUnavailableError) Message() *proto.ResponseMessage {
+	return &proto.ResponseMessage{
+		Code:    "T1002",
+		Message: e.Error(),
+	}
+}
+
+func (e *NonceNotFoundError) Error() string {
+	return "Threshold: Commitment Unknown or Expired."
+}
+
+func (e *NonceNotFoundError) Status() int {
+	return http.StatusBadRequest
+}
+
+func (e *NonceNotFoundError) Message() *proto.ResponseMessage {
+	return &proto.ResponseMessage{
+		Code:    "T1003",
+		Message: e.Error(),
+	}
+}
+
+func (e *SignRequestError) Error() string {
+	return "Threshold: Invalid Signing Request."
+}
+
+func (e *SignRequestError) Status() int {
+	return http.StatusBadRequest
+}
+
+func (e *SignRequestError) Message() *proto.ResponseMessage {
+	return &proto.ResponseMessage{
+		Code:    "T1004",
+		Message: e.Error(),
+	}
+}
+
+func (e *SignerRejectedError) Error() string {
+	return "Threshold: Remote Signer Rejected The Request."
+}
+
+func (e *SignerRejectedError) Status() int {
+	return http.StatusBadGateway
+}
+
+func (e *SignerRejectedError) Message() *proto.ResponseMessage {
+	return &proto.ResponseMessage{
+		Code:    "T1005",
+		Message: e.Error(),
+	}
+}
+
+func (e *ShareFormatError) Error() string {
+	return "Threshold: Key Share File Missing Group Description."
+}
+
+func (e *ProfileError) Error() string {
+	return fmt.Sprintf("Threshold: Signing Request Outside The Issuance Profile, %s.", e.Reason)
+}
+
+func (e *ProfileError) Status() int {
+	return http.StatusForbidden
+}
+
+func (e *ProfileError) Message() *proto.ResponseMessage {
+	return &proto.ResponseMessage{
+		Code:    "T1006",
+		Message: e.Error(),
+	}
+}
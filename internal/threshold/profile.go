@@ -0,0 +1,74 @@
+package threshold
+
+import (
+	"bytes"
+	"crypto/x509"
+	"encoding/asn1"
+	"math/big"
+
+	"github.com/Cealgull/Verify/internal/cert"
+)
+
+// units are the organizational units of the issuance profile.
+var units = map[string]bool{cert.UnitProject: true, cert.UnitPairwise: true}
+
+// parseTBS parses a TBSCertificate by wrapping it into a certificate with
+// an empty signature.
+func parseTBS(tbs []byte) (*x509.Certificate, *ProfileError) {
+
+	var inner struct {
+		Raw       asn1.RawContent
+		Version   int `asn1:"optional,explicit,default:0,tag:0"`
+		Serial    *big.Int
+		Algorithm asn1.RawValue
+	}
+
+	if rest, err := asn1.Unmarshal(tbs, &inner); err != nil || len(rest) != 0 {
+		return nil, &ProfileError{Reason: "not a TBSCertificate"}
+	}
+
+	der, err := asn1.Marshal(struct {
+		TBS       asn1.RawValue
+		Algorithm asn1.RawValue
+		Signature asn1.BitString
+	}{asn1.RawValue{FullBytes: tbs}, inner.Algorithm, asn1.BitString{Bytes: []byte{0}, BitLength: 8}})
+
+	if err != nil {
+		return nil, &ProfileError{Reason: "not a TBSCertificate"}
+	}
+
+	c, err := x509.ParseCertificate(der)
+
+	if err != nil {
+		return nil, &ProfileError{Reason: "not a TBSCertificate"}
+	}
+
+	return c, nil
+}
+
+// checkProfile refuses to co-sign anything but an end entity certificate
+// of the issuance profile issued by this CA, so a leaked token or a rogue
+// coordinator can not obtain arbitrary CA signatures.
+func (s *Signer) checkProfile(msg []byte) *ProfileError {
+
+	c, perr := parseTBS(msg)
+
+	if perr != nil {
+		return perr
+	}
+
+	switch {
+	case !bytes.Equal(c.RawIssuer, s.issuer.RawSubject):
+		return &ProfileError{Reason: "issuer is not this CA"}
+	case len(c.AuthorityKeyId) != 0 && len(s.issuer.SubjectKeyId) != 0 && !bytes.Equal(c.AuthorityKeyId, s.issuer.SubjectKeyId):
+		return &ProfileError{Reason: "authority key is not this CA"}
+	case c.IsCA || c.KeyUsage&(x509.KeyUsageCertSign|x509.KeyUsageCRLSign) != 0:
+		return &ProfileError{Reason: "certificate of a CA"}
+	case len(c.Subject.Organization) != 1 || c.Subject.Organization[0] != cert.SubjectOrganization:
+		return &ProfileError{Reason: "subject organization outside the profile"}
+	case len(c.Subject.OrganizationalUnit) != 1 || !units[c.Subject.OrganizationalUnit[0]]:
+		return &ProfileError{Reason: "subject unit outside the profile"}
+	}
+
+	return nil
+}
@@ -0,0 +1,83 @@
+package threshold
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/Cealgull/Verify/internal/proto"
+	"github.com/Cealgull/Verify/pkg/frost"
+)
+
+// Remote is a participant reached over the signer endpoints of another
+// Verify node.
+type Remote struct {
+	url    string
+	token  string
+	client *http.Client
+}
+
+func NewRemote(url string, token string) *Remote {
+	return &Remote{
+		url:    strings.TrimRight(url, "/"),
+		token:  token,
+		client: &http.Client{Timeout: 5 * time.Second},
+	}
+}
+
+func (r *Remote) post(ctx context.Context, path string, body interface{}, result interface{}) proto.VerifyError {
+
+	b, _ := json.Marshal(body)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, r.url+path, bytes.NewReader(b))
+
+	if err != nil {
+		return &ThresholdUnavailableError{}
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+r.token)
+
+	resp, err := r.client.Do(req)
+
+	if err != nil {
+		return &ThresholdUnavailableError{}
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return &SignerRejectedError{}
+	}
+
+	if json.NewDecoder(resp.Body).Decode(result) != nil {
+		return &SignerRejectedError{}
+	}
+
+	return nil
+}
+
+func (r *Remote) Commit(ctx context.Context) (*frost.Commitment, proto.VerifyError) {
+
+	var commitment frost.Commitment
+
+	if err := r.post(ctx, "/threshold/commit", struct{}{}, &commitment); err != nil {
+		return nil, err
+	}
+
+	return &commitment, nil
+}
+
+func (r *Remote) Sign(ctx context.Context, req *SignRequest) (*frost.SignatureShare, proto.VerifyError) {
+
+	var share frost.SignatureShare
+
+	if err := r.post(ctx, "/threshold/sign", req, &share); err != nil {
+		return nil, err
+	}
+
+	return &share, nil
+}
@@ -0,0 +1,73 @@
+package threshold
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/Cealgull/Verify/pkg/frost"
+)
+
+func LoadShare(file string) (*frost.Share, error) {
+
+	b, err := os.ReadFile(file)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var share frost.Share
+
+	if err := json.Unmarshal(b, &share); err != nil {
+		return nil, err
+	}
+
+	if share.Group == nil {
+		return nil, &ShareFormatError{}
+	}
+
+	return &share, nil
+}
+
+func LoadGroup(file string) (*frost.Group, error) {
+
+	b, err := os.ReadFile(file)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var group frost.Group
+
+	if err := json.Unmarshal(b, &group); err != nil {
+		return nil, err
+	}
+
+	return &group, nil
+}
+
+func WriteShares(dir string, group *frost.Group, shares []*frost.Share) error {
+
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return err
+	}
+
+	b, _ := json.MarshalIndent(group, "", "  ")
+
+	if err := os.WriteFile(filepath.Join(dir, "group.json"), b, 0o644); err != nil {
+		return err
+	}
+
+	for _, share := range shares {
+
+		b, _ := json.MarshalIndent(share, "", "  ")
+		file := filepath.Join(dir, fmt.Sprintf("share-%d.json", share.ID))
+
+		if err := os.WriteFile(file, b, 0o600); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
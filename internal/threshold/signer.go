@@ -0,0 +1,126 @@
+package threshold
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/hex"
+	"sync"
+	"time"
+
+	"github.com/Cealgull/Verify/internal/proto"
+	"github.com/Cealgull/Verify/pkg/frost"
+	"go.uber.org/zap"
+)
+
+type SignRequest struct {
+	Message     []byte             `json:"message"`
+	Commitments []frost.Commitment `json:"commitments"`
+}
+
+type Participant interface {
+	Commit(ctx context.Context) (*frost.Commitment, proto.VerifyError)
+	Sign(ctx context.Context, req *SignRequest) (*frost.SignatureShare, proto.VerifyError)
+}
+
+type pending struct {
+	nonces  *frost.Nonces
+	expires time.Time
+}
+
+type Signer struct {
+	logger *zap.SugaredLogger
+	share  *frost.Share
+	issuer *x509.Certificate
+	ttl    time.Duration
+	nonces map[string]*pending
+	mtx    sync.Mutex
+}
+
+// NewSigner serves the key share, co-signing certificates issued by the CA
+// certificate issuer only.
+func NewSigner(logger *zap.SugaredLogger, share *frost.Share, issuer *x509.Certificate) *Signer {
+	return &Signer{
+		logger: logger,
+		share:  share,
+		issuer: issuer,
+		ttl:    time.Minute,
+		nonces: make(map[string]*pending),
+	}
+}
+
+func (s *Signer) ID() uint16 {
+	return s.share.ID
+}
+
+func (s *Signer) Commit(ctx context.Context) (*frost.Commitment, proto.VerifyError) {
+
+	nonces, commitment, err := frost.Commit(s.share, rand.Reader)
+
+	if err != nil {
+		s.logger.Errorf("Failed generating signing nonces. err: %s", err.Error())
+		return nil, &ThresholdInternalError{}
+	}
+
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	now := time.Now()
+
+	for k, p := range s.nonces {
+		if now.After(p.expires) {
+			delete(s.nonces, k)
+		}
+	}
+
+	s.nonces[hex.EncodeToString(commitment.Hiding)] = &pending{nonces, now.Add(s.ttl)}
+
+	s.logger.Debugf("Signer %d committed to a new nonce pair.", s.share.ID)
+
+	return commitment, nil
+}
+
+func (s *Signer) Sign(ctx context.Context, req *SignRequest) (*frost.SignatureShare, proto.VerifyError) {
+
+	var own *frost.Commitment
+
+	for i := range req.Commitments {
+		if req.Commitments[i].ID == s.share.ID {
+			own = &req.Commitments[i]
+		}
+	}
+
+	if own == nil {
+		s.logger.Debugf("Signer %d missing from the commitment list.", s.share.ID)
+		return nil, &NonceNotFoundError{}
+	}
+
+	if err := s.checkProfile(req.Message); err != nil {
+		s.logger.Warnf("Signer %d refused to sign outside the issuance profile: %s.", s.share.ID, err.Reason)
+		return nil, err
+	}
+
+	key := hex.EncodeToString(own.Hiding)
+
+	// Nonces are removed before signing so that they can never be used twice.
+	s.mtx.Lock()
+	p, ok := s.nonces[key]
+	delete(s.nonces, key)
+	s.mtx.Unlock()
+
+	if !ok || time.Now().After(p.expires) {
+		s.logger.Debugf("Signer %d has no live nonce for commitment %s.", s.share.ID, key)
+		return nil, &NonceNotFoundError{}
+	}
+
+	share, err := frost.Sign(s.share, p.nonces, req.Message, req.Commitments)
+
+	if err != nil {
+		s.logger.Debugf("Signer %d refused the signing request. err: %s", s.share.ID, err.Error())
+		return nil, &SignRequestError{}
+	}
+
+	s.logger.Infof("Signer %d produced a signature share.", s.share.ID)
+
+	return share, nil
+}
@@ -0,0 +1,317 @@
+package threshold
+
+import (
+	"context"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	mockcache "github.com/Cealgull/Verify/internal/cache/mock"
+	"github.com/Cealgull/Verify/internal/cert"
+	"github.com/Cealgull/Verify/internal/proto"
+	"github.com/Cealgull/Verify/pkg/frost"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+var logger *zap.SugaredLogger
+var priv ed25519.PrivateKey
+var group *frost.Group
+var shares []*frost.Share
+var ca *x509.Certificate
+var leaf []byte
+
+// tbs returns the TBSCertificate the CA would sign for template.
+func tbs(template *x509.Certificate, issuer *x509.Certificate) []byte {
+	pub, _, _ := ed25519.GenerateKey(nil)
+	template.SerialNumber = big.NewInt(1)
+	der, _ := x509.CreateCertificate(rand.Reader, template, issuer, pub, priv)
+	c, _ := x509.ParseCertificate(der)
+	return c.RawTBSCertificate
+}
+
+func profile(unit string) *x509.Certificate {
+	return &x509.Certificate{Subject: pkix.Name{
+		CommonName:         "0x00",
+		Organization:       []string{cert.SubjectOrganization},
+		OrganizationalUnit: []string{unit},
+	}}
+}
+
+type failing struct {
+	commit bool
+}
+
+func (f *failing) Commit(ctx context.Context) (*frost.Commitment, proto.VerifyError) {
+	if f.commit {
+		return nil, &ThresholdUnavailableError{}
+	}
+	return &frost.Commitment{ID: 3, Hiding: group.PublicKey, Binding: group.PublicKey}, nil
+}
+
+func (f *failing) Sign(ctx context.Context, req *SignRequest) (*frost.SignatureShare, proto.VerifyError) {
+	return nil, &SignerRejectedError{}
+}
+
+func TestShareFiles(t *testing.T) {
+
+	dir := t.TempDir()
+	assert.NoError(t, WriteShares(dir, group, shares))
+
+	share, err := LoadShare(filepath.Join(dir, "share-2.json"))
+	assert.NoError(t, err)
+	assert.Equal(t, uint16(2), share.ID)
+	assert.Equal(t, group.PublicKey, share.Group.PublicKey)
+
+	g, err := LoadGroup(filepath.Join(dir, "group.json"))
+	assert.NoError(t, err)
+	assert.Equal(t, group, g)
+
+	_, err = LoadShare(filepath.Join(dir, "notexists"))
+	assert.Error(t, err)
+	_, err = LoadGroup(filepath.Join(dir, "notexists"))
+	assert.Error(t, err)
+
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "invalid.json"), []byte("{"), 0o600))
+	_, err = LoadShare(filepath.Join(dir, "invalid.json"))
+	assert.Error(t, err)
+	_, err = LoadGroup(filepath.Join(dir, "invalid.json"))
+	assert.Error(t, err)
+
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "nogroup.json"), []byte("{}"), 0o600))
+	_, err = LoadShare(filepath.Join(dir, "nogroup.json"))
+	assert.IsType(t, &ShareFormatError{}, err)
+	var _ = err.Error()
+
+	f, _ := os.CreateTemp(dir, "file")
+	assert.Error(t, WriteShares(f.Name(), group, shares))
+}
+
+func TestCoordinatorSign(t *testing.T) {
+
+	_, err := NewCoordinator(logger, group, WithParticipants(NewSigner(logger, shares[0], ca)))
+	assert.IsType(t, &ThresholdUnavailableError{}, err)
+
+	coord, err := NewCoordinator(
+		logger,
+		group,
+		WithTimeout(time.Second),
+		WithParticipants(&failing{commit: true}),
+		WithParticipants(NewSigner(logger, shares[0], ca), NewSigner(logger, shares[2], ca)),
+	)
+	assert.NoError(t, err)
+	assert.Equal(t, priv.Public(), coord.Public())
+
+	msg := leaf
+
+	_, err = coord.Sign(rand.Reader, msg, crypto.SHA256)
+	assert.IsType(t, &SignRequestError{}, err)
+
+	sig, err := coord.Sign(rand.Reader, msg, crypto.Hash(0))
+	assert.NoError(t, err)
+	assert.True(t, ed25519.Verify(priv.Public().(ed25519.PublicKey), msg, sig))
+
+	// not enough signers left after the failing one
+	coord, _ = NewCoordinator(logger, group, WithParticipants(
+		&failing{commit: true},
+		NewSigner(logger, shares[0], ca),
+	), WithParticipants(&failing{commit: true}))
+	_, err = coord.Sign(rand.Reader, msg, crypto.Hash(0))
+	assert.IsType(t, &ThresholdUnavailableError{}, err)
+
+	// signer failing in the second round
+	coord, _ = NewCoordinator(logger, group, WithParticipants(
+		NewSigner(logger, shares[0], ca),
+		&failing{},
+	))
+	_, err = coord.Sign(rand.Reader, msg, crypto.Hash(0))
+	assert.IsType(t, &SignerRejectedError{}, err)
+}
+
+func TestSignerNonces(t *testing.T) {
+
+	s1 := NewSigner(logger, shares[0], ca)
+	s2 := NewSigner(logger, shares[1], ca)
+	assert.Equal(t, uint16(1), s1.ID())
+
+	ctx := context.Background()
+	c1, _ := s1.Commit(ctx)
+	c2, _ := s2.Commit(ctx)
+
+	req := &SignRequest{Message: leaf, Commitments: []frost.Commitment{*c1, *c2}}
+
+	_, err := NewSigner(logger, shares[2], ca).Sign(ctx, req)
+	assert.IsType(t, &NonceNotFoundError{}, err)
+	var _ = err.Status()
+	var _ = err.Message()
+
+	_, err = s1.Sign(ctx, &SignRequest{Message: leaf, Commitments: []frost.Commitment{*c1}})
+	assert.IsType(t, &SignRequestError{}, err)
+	var _ = err.Status()
+	var _ = err.Message()
+
+	// the nonce was consumed by the refused request
+	_, err = s1.Sign(ctx, req)
+	assert.IsType(t, &NonceNotFoundError{}, err)
+
+	_, err = s2.Sign(ctx, req)
+	assert.Nil(t, err)
+
+	// nonces are single use
+	_, err = s2.Sign(ctx, req)
+	assert.IsType(t, &NonceNotFoundError{}, err)
+
+	// expired nonces are rejected and swept
+	s1.ttl = -time.Second
+	c1, _ = s1.Commit(ctx)
+	c1, _ = s1.Commit(ctx)
+	assert.Len(t, s1.nonces, 1)
+	_, err = s1.Sign(ctx, &SignRequest{Message: leaf, Commitments: []frost.Commitment{*c1}})
+	assert.IsType(t, &NonceNotFoundError{}, err)
+}
+
+func TestSignerProfile(t *testing.T) {
+
+	ctx := context.Background()
+
+	other := &x509.Certificate{Subject: pkix.Name{CommonName: "Other CA"}}
+	rogue := profile(cert.UnitProject)
+	rogue.IsCA, rogue.BasicConstraintsValid = true, true
+	signing := profile(cert.UnitPairwise)
+	signing.KeyUsage = x509.KeyUsageCertSign
+
+	for _, msg := range [][]byte{
+		[]byte("msg"),
+		append(append([]byte{}, leaf...), 0),
+		tbs(profile(cert.UnitProject), other),
+		tbs(rogue, ca),
+		tbs(signing, ca),
+		tbs(profile("Cealgull Admin"), ca),
+		tbs(&x509.Certificate{Subject: pkix.Name{OrganizationalUnit: []string{cert.UnitProject}}}, ca),
+	} {
+		s := NewSigner(logger, shares[0], ca)
+		c, _ := s.Commit(ctx)
+		_, err := s.Sign(ctx, &SignRequest{Message: msg, Commitments: []frost.Commitment{*c}})
+		assert.IsType(t, &ProfileError{}, err)
+		var _ = err.Status()
+		var _ = err.Message()
+	}
+
+	s1, s2 := NewSigner(logger, shares[0], ca), NewSigner(logger, shares[1], ca)
+	c1, _ := s1.Commit(ctx)
+	c2, _ := s2.Commit(ctx)
+
+	req := &SignRequest{Message: tbs(profile(cert.UnitPairwise), ca), Commitments: []frost.Commitment{*c1, *c2}}
+	_, err := s1.Sign(ctx, req)
+	assert.Nil(t, err)
+}
+
+func TestRemote(t *testing.T) {
+
+	signer := NewSigner(logger, shares[1], ca)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/threshold/commit", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		c, _ := signer.Commit(r.Context())
+		_ = json.NewEncoder(w).Encode(c)
+	})
+	mux.HandleFunc("/threshold/sign", func(w http.ResponseWriter, r *http.Request) {
+		var req SignRequest
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		if _, err := signer.Sign(r.Context(), &req); err != nil {
+			w.WriteHeader(err.Status())
+			return
+		}
+		// a truncated body must be rejected by the remote client
+		_, _ = w.Write([]byte("{"))
+	})
+
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	ctx := context.Background()
+
+	_, err := NewRemote(srv.URL, "wrong").Commit(ctx)
+	assert.IsType(t, &SignerRejectedError{}, err)
+	var _ = err.Status()
+	var _ = err.Message()
+
+	_, err = NewRemote("http://127.0.0.1:0", "token").Commit(ctx)
+	assert.IsType(t, &ThresholdUnavailableError{}, err)
+	var _ = err.Status()
+	var _ = err.Message()
+
+	_, err = NewRemote(":invalid", "token").Commit(ctx)
+	assert.IsType(t, &ThresholdUnavailableError{}, err)
+
+	remote := NewRemote(srv.URL+"/", "token")
+	c, err := remote.Commit(ctx)
+	assert.Nil(t, err)
+	assert.Equal(t, uint16(2), c.ID)
+
+	_, err = remote.Sign(ctx, &SignRequest{Message: leaf})
+	assert.IsType(t, &SignerRejectedError{}, err)
+
+	local := NewSigner(logger, shares[0], ca)
+	c1, _ := local.Commit(ctx)
+	_, err = remote.Sign(ctx, &SignRequest{Message: leaf, Commitments: []frost.Commitment{*c1, *c}})
+	assert.IsType(t, &SignerRejectedError{}, err)
+}
+
+func TestCertificateAuthority(t *testing.T) {
+
+	coord, err := NewCoordinator(logger, group, WithParticipants(
+		NewSigner(logger, shares[1], ca),
+		NewSigner(logger, shares[2], ca),
+	))
+	assert.NoError(t, err)
+
+	cm, err := cert.NewCertManager(
+		logger,
+		cert.WithCertificate("./testdata/cert.pem"),
+		cert.WithSigner(coord),
+		cert.WithCache(mockcache.NewMockCache()),
+	)
+	assert.NoError(t, err)
+
+	pub, _, _ := ed25519.GenerateKey(nil)
+	issued, verr := cm.SignCSR(base64.StdEncoding.EncodeToString(pub))
+	assert.Nil(t, verr)
+
+	org, verr := cm.VerifyCert(issued)
+	assert.NotEmpty(t, org)
+	assert.Nil(t, verr)
+
+	var _ = (&ThresholdInternalError{}).Status()
+	var _ = (&ThresholdInternalError{}).Message()
+}
+
+func TestMain(m *testing.M) {
+
+	l, _ := zap.NewProduction()
+	logger = l.Sugar()
+
+	priv, _ = cert.LoadPrivateKey("./testdata/priv.pem")
+	group, shares, _ = frost.Split(priv, 2, 3, rand.Reader)
+
+	chain, _ := cert.LoadCertificateChain("./testdata/cert.pem")
+	ca = chain[0]
+	leaf = tbs(profile(cert.UnitProject), ca)
+
+	m.Run()
+}
@@ -0,0 +1,268 @@
+package verify
+
+import (
+	"io"
+	"net/http"
+
+	"github.com/Cealgull/Verify/internal/acme"
+	"github.com/Cealgull/Verify/internal/proto"
+	"github.com/labstack/echo/v4"
+)
+
+const HeaderReplayNonce = "Replay-Nonce"
+
+// WithACME serves the ACME protocol with am. Resource URLs are built on
+// base, or on the scheme and host of each request when base is empty.
+func WithACME(am *acme.Manager, base string) ServerOption {
+	return func(v *VerificationServer) {
+		v.am = am
+		v.abase = base
+	}
+}
+
+func (v *VerificationServer) registerACME() {
+
+	if v.am == nil {
+		return
+	}
+
+	g := v.ec.Group("/acme")
+	g.GET("/directory", v.acmeDirectory)
+	g.HEAD("/new-nonce", v.acmeNonce)
+	g.GET("/new-nonce", v.acmeNonce)
+	g.POST("/new-account", v.acmeNewAccount)
+	g.POST("/account/:id", v.acmeAccount)
+	g.POST("/new-order", v.acmeNewOrder)
+	g.POST("/order/:id", v.acmeOrder)
+	g.POST("/order/:id/finalize", v.acmeFinalize)
+	g.POST("/authz/:id", v.acmeAuthz)
+	g.POST("/chall/:id", v.acmeChallenge)
+	g.POST("/cert/:id", v.acmeCert)
+}
+
+func (v *VerificationServer) acmeBase(c echo.Context) string {
+	if v.abase != "" {
+		return v.abase
+	}
+	return c.Scheme() + "://" + c.Request().Host
+}
+
+// acmeHeaders sets the fresh nonce and the directory link every ACME
+// response carries.
+func (v *VerificationServer) acmeHeaders(c echo.Context) proto.VerifyError {
+
+	nonce, err := v.am.NewNonce()
+
+	if err != nil {
+		return err
+	}
+
+	h := c.Response().Header()
+	h.Set(HeaderReplayNonce, nonce)
+	h.Set(echo.HeaderCacheControl, "no-store")
+	h.Add("Link", "<"+v.acmeBase(c)+"/acme/directory>;rel=\"index\"")
+
+	return nil
+}
+
+func (v *VerificationServer) acmeError(c echo.Context, err proto.VerifyError) error {
+	_ = v.acmeHeaders(c)
+	c.Response().Header().Set(echo.HeaderContentType, acme.MIMEApplicationProblem)
+	return c.JSON(err.Status(), acme.NewProblem(err))
+}
+
+func (v *VerificationServer) acmeRespond(c echo.Context, status int, location string, body interface{}) error {
+
+	if err := v.acmeHeaders(c); err != nil {
+		return v.acmeError(c, err)
+	}
+
+	if location != "" {
+		c.Response().Header().Set(echo.HeaderLocation, location)
+	}
+
+	return c.JSON(status, body)
+}
+
+func (v *VerificationServer) acmeRequest(c echo.Context) (*acme.Request, proto.VerifyError) {
+
+	body, err := io.ReadAll(c.Request().Body)
+
+	if err != nil {
+		return nil, &acme.MalformedError{Detail: "Request Body Unreadable"}
+	}
+
+	return v.am.Verify(body, v.acmeBase(c)+c.Request().URL.Path)
+}
+
+func (v *VerificationServer) acmeDirectory(c echo.Context) error {
+	return c.JSON(http.StatusOK, acme.NewDirectory(v.acmeBase(c)))
+}
+
+func (v *VerificationServer) acmeNonce(c echo.Context) error {
+
+	if err := v.acmeHeaders(c); err != nil {
+		return v.acmeError(c, err)
+	}
+
+	if c.Request().Method == http.MethodHead {
+		return c.NoContent(http.StatusOK)
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+func (v *VerificationServer) acmeNewAccount(c echo.Context) error {
+
+	req, err := v.acmeRequest(c)
+
+	if err != nil {
+		return v.acmeError(c, err)
+	}
+
+	acct, id, created, err := v.am.NewAccount(req)
+
+	if err != nil {
+		return v.acmeError(c, err)
+	}
+
+	status := http.StatusOK
+
+	if created {
+		status = http.StatusCreated
+	}
+
+	return v.acmeRespond(c, status, acme.Link(v.acmeBase(c), "account", id), acct)
+}
+
+func (v *VerificationServer) acmeAccount(c echo.Context) error {
+
+	req, err := v.acmeRequest(c)
+
+	if err != nil {
+		return v.acmeError(c, err)
+	}
+
+	acct, err := v.am.Account(req, c.Param("id"))
+
+	if err != nil {
+		return v.acmeError(c, err)
+	}
+
+	return v.acmeRespond(c, http.StatusOK, "", acct)
+}
+
+func (v *VerificationServer) acmeNewOrder(c echo.Context) error {
+
+	req, err := v.acmeRequest(c)
+
+	if err != nil {
+		return v.acmeError(c, err)
+	}
+
+	order, err := v.am.NewOrder(req)
+
+	if err != nil {
+		return v.acmeError(c, err)
+	}
+
+	base := v.acmeBase(c)
+
+	return v.acmeRespond(c, http.StatusCreated, acme.Link(base, "order", order.ID), order.Object(base))
+}
+
+func (v *VerificationServer) acmeOrder(c echo.Context) error {
+
+	req, err := v.acmeRequest(c)
+
+	if err != nil {
+		return v.acmeError(c, err)
+	}
+
+	order, err := v.am.Order(req, c.Param("id"))
+
+	if err != nil {
+		return v.acmeError(c, err)
+	}
+
+	return v.acmeRespond(c, http.StatusOK, "", order.Object(v.acmeBase(c)))
+}
+
+func (v *VerificationServer) acmeAuthz(c echo.Context) error {
+
+	req, err := v.acmeRequest(c)
+
+	if err != nil {
+		return v.acmeError(c, err)
+	}
+
+	authz, err := v.am.Authorization(req, c.Param("id"))
+
+	if err != nil {
+		return v.acmeError(c, err)
+	}
+
+	return v.acmeRespond(c, http.StatusOK, "", authz.Object(v.acmeBase(c)))
+}
+
+func (v *VerificationServer) acmeChallenge(c echo.Context) error {
+
+	req, err := v.acmeRequest(c)
+
+	if err != nil {
+		return v.acmeError(c, err)
+	}
+
+	authz, err := v.am.Respond(req, c.Param("id"), v.sm.Verify)
+
+	if err != nil {
+		return v.acmeError(c, err)
+	}
+
+	base := v.acmeBase(c)
+	c.Response().Header().Add("Link", "<"+acme.Link(base, "authz", authz.ID)+">;rel=\"up\"")
+
+	return v.acmeRespond(c, http.StatusOK, "", authz.Challenge(base))
+}
+
+func (v *VerificationServer) acmeFinalize(c echo.Context) error {
+
+	req, err := v.acmeRequest(c)
+
+	if err != nil {
+		return v.acmeError(c, err)
+	}
+
+	order, err := v.am.Finalize(req, c.Param("id"), func(pubb64 string) ([]byte, proto.VerifyError) {
+		return v.cm.SignCSR(pubb64)
+	})
+
+	if err != nil {
+		return v.acmeError(c, err)
+	}
+
+	base := v.acmeBase(c)
+
+	return v.acmeRespond(c, http.StatusOK, acme.Link(base, "order", order.ID), order.Object(base))
+}
+
+func (v *VerificationServer) acmeCert(c echo.Context) error {
+
+	req, err := v.acmeRequest(c)
+
+	if err != nil {
+		return v.acmeError(c, err)
+	}
+
+	cert, err := v.am.Certificate(req, c.Param("id"))
+
+	if err != nil {
+		return v.acmeError(c, err)
+	}
+
+	if err := v.acmeHeaders(c); err != nil {
+		return v.acmeError(c, err)
+	}
+
+	return c.Blob(http.StatusOK, acme.MIMEApplicationCertChain, append(cert, encodeChain(v.cm.Chain())...))
+}
@@ -0,0 +1,67 @@
+package verify
+
+import (
+	"bytes"
+	"crypto/subtle"
+
+	"github.com/Cealgull/Verify/internal/msp"
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+)
+
+const MIMEApplicationGzip = "application/gzip"
+
+func (v *VerificationServer) registerAdmin() {
+
+	if v.adm == "" {
+		return
+	}
+
+	g := v.ec.Group("/admin")
+	g.Use(middleware.KeyAuth(func(key string, c echo.Context) (bool, error) {
+		return subtle.ConstantTimeCompare([]byte(key), []byte(v.adm)) == 1, nil
+	}))
+
+	if v.me != nil {
+		g.GET("/msp", v.mspExport)
+		g.POST("/msp", v.mspExport)
+	}
+
+	if v.fr != nil {
+		g.GET("/federation", v.federationList)
+		g.POST("/federation", v.federationLoad)
+		g.DELETE("/federation/:kid", v.federationRemove)
+	}
+}
+
+func (v *VerificationServer) mspExport(c echo.Context) error {
+
+	id := msp.NewIdentity(v.cm.Chain(), v.cm.Certificate())
+
+	if c.Request().Method == "POST" {
+
+		var req CACert
+
+		if c.Bind(&req) != nil {
+			return c.JSON(berr.Status(), berr.Message())
+		}
+
+		cert, err := v.cm.VerifiedCert([]byte(req.Cert))
+
+		if err != nil {
+			return c.JSON(err.Status(), err.Message())
+		}
+
+		id.Sign = cert
+	}
+
+	var buf bytes.Buffer
+
+	if err := v.me.WriteArchive(&buf, id); err != nil {
+		return c.JSON(err.Status(), err.Message())
+	}
+
+	c.Response().Header().Set(echo.HeaderContentDisposition, "attachment; filename=\"msp.tar.gz\"")
+
+	return c.Blob(success.Status(), MIMEApplicationGzip, buf.Bytes())
+}
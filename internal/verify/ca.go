@@ -0,0 +1,103 @@
+package verify
+
+import (
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+
+	"github.com/Cealgull/Verify/pkg/c509"
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	MIMEApplicationPEM    = "application/x-pem-file"
+	MIMEApplicationPKIX   = "application/pkix-cert"
+	MIMEApplicationJWKSet = "application/jwk-set+json"
+	MIMEApplicationC509   = c509.MIMEType
+	HeaderCertFingerprint = "X-Certificate-Fingerprint"
+	defaultCAMaxAge       = 3600
+)
+
+func WithCAMaxAge(seconds int) ServerOption {
+	return func(v *VerificationServer) {
+		if seconds > 0 {
+			v.maxage = seconds
+		}
+	}
+}
+
+func (v *VerificationServer) registerCA() {
+	v.ec.GET("/ca/cert.pem", v.caCertPEM)
+	v.ec.GET("/ca/cert.der", v.caCertDER)
+	v.ec.GET("/ca/chain.pem", v.caChainPEM)
+	v.ec.GET("/ca/jwks.json", v.caJWKS)
+}
+
+func encodeChain(chain []*x509.Certificate) []byte {
+
+	var data []byte
+
+	for _, cert := range chain {
+		data = append(data, pem.EncodeToMemory(&pem.Block{
+			Type:  "CERTIFICATE",
+			Bytes: cert.Raw,
+		})...)
+	}
+
+	return data
+}
+
+// caReply serves data of a trust anchor route with the shared caching
+// headers. The ETag hashes the body itself, so every representation has its
+// own and a chain change invalidates chain.pem even if the leaf stays.
+func (v *VerificationServer) caReply(c echo.Context, mime string, data []byte) error {
+
+	sum := sha256.Sum256(data)
+	etag := fmt.Sprintf("\"%s\"", hex.EncodeToString(sum[:]))
+
+	h := c.Response().Header()
+	h.Set(echo.HeaderCacheControl, fmt.Sprintf("public, max-age=%d", v.maxage))
+	h.Set("ETag", etag)
+	h.Set(HeaderCertFingerprint, "sha256:"+v.cm.Fingerprint())
+
+	if c.Request().Header.Get("If-None-Match") == etag {
+		return c.NoContent(http.StatusNotModified)
+	}
+
+	return c.Blob(http.StatusOK, mime, data)
+}
+
+func (v *VerificationServer) caCertPEM(c echo.Context) error {
+
+	data := pem.EncodeToMemory(&pem.Block{
+		Type:  "CERTIFICATE",
+		Bytes: v.cm.Certificate().Raw,
+	})
+
+	return v.caReply(c, MIMEApplicationPEM, data)
+}
+
+func (v *VerificationServer) caCertDER(c echo.Context) error {
+	return v.caReply(c, MIMEApplicationPKIX, v.cm.Certificate().Raw)
+}
+
+func (v *VerificationServer) caChainPEM(c echo.Context) error {
+	return v.caReply(c, MIMEApplicationPEM, encodeChain(v.cm.Chain()))
+}
+
+func (v *VerificationServer) caJWKS(c echo.Context) error {
+
+	jwks, err := v.cm.JWKS()
+
+	if err != nil {
+		return c.JSON(err.Status(), err.Message())
+	}
+
+	data, _ := json.Marshal(jwks)
+
+	return v.caReply(c, MIMEApplicationJWKSet, data)
+}
@@ -0,0 +1,106 @@
+package verify
+
+import (
+	"net/http"
+
+	"github.com/Cealgull/Verify/internal/credential"
+	"github.com/Cealgull/Verify/internal/proto"
+	"github.com/labstack/echo/v4"
+)
+
+type CredentialRequest struct {
+	Secret string `json:"secret"`
+}
+
+type CredentialNonce struct {
+	Nonce string `json:"nonce"`
+}
+
+type CredentialVerification struct {
+	proto.ResponseMessage
+	Nonce      string            `json:"nonce"`
+	Attributes map[string]string `json:"attributes"`
+}
+
+func WithCredentials(cr *credential.Manager) ServerOption {
+	return func(v *VerificationServer) {
+		v.cr = cr
+	}
+}
+
+func (v *VerificationServer) registerCredential() {
+
+	if v.cr == nil {
+		return
+	}
+
+	v.ec.GET("/credential/key", v.credentialKey)
+	v.ec.GET("/credential/nonce", v.credentialNonce)
+	v.ec.POST("/credential/sign", v.credentialSign)
+	v.ec.POST("/credential/verify", v.credentialVerify)
+}
+
+func (v *VerificationServer) credentialKey(c echo.Context) error {
+	return c.JSON(http.StatusOK, v.cr.Key())
+}
+
+// credentialNonce hands out the nonce the next presentation to this
+// verifier must be bound to.
+func (v *VerificationServer) credentialNonce(c echo.Context) error {
+
+	nonce, err := v.cr.Nonce()
+
+	if err != nil {
+		return c.JSON(err.Status(), err.Message())
+	}
+
+	return c.JSON(http.StatusOK, CredentialNonce{nonce})
+}
+
+// credentialSign issues a BBS credential to a holder proving membership
+// with a ring signature over its secret, like certSign does for keys.
+func (v *VerificationServer) credentialSign(c echo.Context) error {
+
+	var req CredentialRequest
+
+	if c.Bind(&req) != nil {
+		return c.JSON(berr.Status(), berr.Message())
+	}
+
+	sigb64 := c.Request().Header.Get("signature")
+
+	if sigb64 == "" {
+		return c.JSON(bsig.Status(), bsig.Message())
+	}
+
+	ok, err := v.sm.Verify(req.Secret, sigb64)
+
+	if !ok && err != nil {
+		return c.JSON(err.Status(), err.Message())
+	}
+
+	cred, err := v.cr.Issue(req.Secret)
+
+	if err != nil {
+		return c.JSON(err.Status(), err.Message())
+	}
+
+	return c.JSON(http.StatusOK, cred)
+}
+
+func (v *VerificationServer) credentialVerify(c echo.Context) error {
+
+	var req credential.Presentation
+
+	if c.Bind(&req) != nil {
+		return c.JSON(berr.Status(), berr.Message())
+	}
+
+	attrs, err := v.cr.Verify(&req)
+
+	if err != nil {
+		return c.JSON(err.Status(), err.Message())
+	}
+
+	return c.JSON(success.Status(), CredentialVerification{*success.Message(), req.Nonce, attrs})
+}
@@ -0,0 +1,221 @@
+package verify
+
+import (
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/Cealgull/Verify/internal/fabric"
+	"github.com/Cealgull/Verify/internal/proto"
+	"github.com/labstack/echo/v4"
+)
+
+const fabricVersion = "1.5.0"
+
+var btoken *fabric.TokenMissingError = &fabric.TokenMissingError{}
+
+func WithCAName(name string) ServerOption {
+	return func(v *VerificationServer) {
+		v.caname = name
+	}
+}
+
+func (v *VerificationServer) registerFabric() {
+	v.ec.GET("/api/v1/cainfo", v.fabricCAInfo)
+	v.ec.POST("/api/v1/cainfo", v.fabricCAInfo)
+	v.ec.POST("/api/v1/enroll", v.fabricEnroll)
+	v.ec.POST("/api/v1/reenroll", v.fabricReenroll)
+	v.ec.POST("/api/v1/revoke", v.fabricRevoke)
+}
+
+func fabricError(c echo.Context, err proto.VerifyError) error {
+	return c.JSON(err.Status(), fabric.NewErrorResponse(err))
+}
+
+func (v *VerificationServer) fabricServerInfo() fabric.ServerInfo {
+
+	return fabric.ServerInfo{
+		CAName:  v.caname,
+		CAChain: base64.StdEncoding.EncodeToString(encodeChain(v.cm.Chain())),
+		Version: fabricVersion,
+	}
+}
+
+// fabricToken authenticates a request with a Fabric CA token and returns the
+// certificate inside it together with the raw request body.
+func (v *VerificationServer) fabricToken(c echo.Context) (*x509.Certificate, []byte, proto.VerifyError) {
+
+	token := c.Request().Header.Get(echo.HeaderAuthorization)
+
+	if token == "" {
+		return nil, nil, btoken
+	}
+
+	body, err := io.ReadAll(c.Request().Body)
+
+	if err != nil {
+		return nil, nil, berr
+	}
+
+	certpem, verr := fabric.ParseToken(token, c.Request().Method, c.Request().URL.RequestURI(), body)
+
+	if verr != nil {
+		return nil, nil, verr
+	}
+
+	cert, verr := v.cm.VerifiedCert(certpem)
+
+	if verr != nil {
+		return nil, nil, verr
+	}
+
+	return cert, body, nil
+}
+
+func (v *VerificationServer) fabricIssue(c echo.Context, req *fabric.EnrollmentRequest, resign bool) error {
+
+	pub, err := fabric.ParseCSR(req.CSR)
+
+	if err != nil {
+		return fabricError(c, err)
+	}
+
+	ext, err := fabric.Attributes(req.AttrReqs, map[string]string{
+		fabric.EnrollmentID: v.cm.Address(pub),
+		fabric.Type:         "client",
+		fabric.Affiliation:  "",
+	})
+
+	if err != nil {
+		return fabricError(c, err)
+	}
+
+	pubb64 := base64.StdEncoding.EncodeToString(pub)
+
+	var cert []byte
+
+	if resign {
+		cert, err = v.cm.ResignCSR(pubb64, ext)
+	} else {
+		cert, err = v.cm.SignCSR(pubb64, ext)
+	}
+
+	if err != nil {
+		return fabricError(c, err)
+	}
+
+	return c.JSON(http.StatusCreated, fabric.NewResponse(&fabric.EnrollmentResponse{
+		Cert:       base64.StdEncoding.EncodeToString(cert),
+		ServerInfo: v.fabricServerInfo(),
+	}))
+}
+
+func (v *VerificationServer) fabricCAInfo(c echo.Context) error {
+	return c.JSON(http.StatusOK, fabric.NewResponse(v.fabricServerInfo()))
+}
+
+func (v *VerificationServer) fabricEnroll(c echo.Context) error {
+
+	var req fabric.EnrollmentRequest
+
+	if c.Bind(&req) != nil {
+		return fabricError(c, berr)
+	}
+
+	// The enrollment secret of the basic authorization carries the ring
+	// signature over the base64 public key of the certificate request.
+	_, sigb64, ok := c.Request().BasicAuth()
+
+	if !ok {
+		sigb64 = c.Request().Header.Get("signature")
+	}
+
+	if sigb64 == "" {
+		return fabricError(c, bsig)
+	}
+
+	pub, err := fabric.ParseCSR(req.CSR)
+
+	if err != nil {
+		return fabricError(c, err)
+	}
+
+	ok, err = v.sm.Verify(base64.StdEncoding.EncodeToString(pub), sigb64)
+
+	if !ok && err != nil {
+		return fabricError(c, err)
+	}
+
+	return v.fabricIssue(c, &req, false)
+}
+
+func (v *VerificationServer) fabricReenroll(c echo.Context) error {
+
+	cert, body, err := v.fabricToken(c)
+
+	if err != nil {
+		return fabricError(c, err)
+	}
+
+	var req fabric.EnrollmentRequest
+
+	if json.Unmarshal(body, &req) != nil {
+		return fabricError(c, berr)
+	}
+
+	pub, err := fabric.ParseCSR(req.CSR)
+
+	if err != nil {
+		return fabricError(c, err)
+	}
+
+	old, _ := x509.MarshalPKIXPublicKey(cert.PublicKey)
+	cur, _ := x509.MarshalPKIXPublicKey(pub)
+
+	// a new key has to join the anonymity set through /enroll and its ring
+	// signature, the token certificate only vouches for its own key
+	if string(old) != string(cur) {
+		return fabricError(c, &fabric.ReenrollKeyError{})
+	}
+
+	return v.fabricIssue(c, &req, true)
+}
+
+func (v *VerificationServer) fabricRevoke(c echo.Context) error {
+
+	cert, body, err := v.fabricToken(c)
+
+	if err != nil {
+		return fabricError(c, err)
+	}
+
+	var req fabric.RevocationRequest
+
+	if json.Unmarshal(body, &req) != nil {
+		return fabricError(c, berr)
+	}
+
+	serial := strings.TrimLeft(strings.ToLower(req.Serial), "0")
+	aki := hex.EncodeToString(cert.AuthorityKeyId)
+
+	if req.Serial == "" && req.Name != cert.Subject.CommonName ||
+		req.Serial != "" && serial != cert.SerialNumber.Text(16) ||
+		req.AKI != "" && strings.ToLower(req.AKI) != aki {
+		return fabricError(c, &fabric.RevokeForbiddenError{})
+	}
+
+	if err := v.cm.Revoke(cert); err != nil {
+		return fabricError(c, err)
+	}
+
+	return c.JSON(http.StatusOK, fabric.NewResponse(&fabric.RevocationResponse{
+		RevokedCerts: []fabric.RevokedCert{{
+			Serial: cert.SerialNumber.Text(16),
+			AKI:    aki,
+		}},
+	}))
+}
@@ -0,0 +1,48 @@
+package verify
+
+import (
+	"io"
+
+	"github.com/Cealgull/Verify/internal/federation"
+	"github.com/labstack/echo/v4"
+)
+
+type FederationBundles struct {
+	Bundles []*federation.Status `json:"bundles"`
+}
+
+// WithFederation lets administrators manage the partner trust bundles
+// under /admin/federation.
+func WithFederation(r *federation.Registry) ServerOption {
+	return func(v *VerificationServer) {
+		v.fr = r
+	}
+}
+
+func (v *VerificationServer) federationList(c echo.Context) error {
+	return c.JSON(success.Status(), FederationBundles{v.fr.Bundles()})
+}
+
+func (v *VerificationServer) federationLoad(c echo.Context) error {
+
+	data, err := io.ReadAll(c.Request().Body)
+
+	if err != nil {
+		return c.JSON(berr.Status(), berr.Message())
+	}
+
+	if _, verr := v.fr.Load(data); verr != nil {
+		return c.JSON(verr.Status(), verr.Message())
+	}
+
+	return c.JSON(success.Status(), FederationBundles{v.fr.Bundles()})
+}
+
+func (v *VerificationServer) federationRemove(c echo.Context) error {
+
+	if err := v.fr.Remove(c.Param("kid")); err != nil {
+		return c.JSON(err.Status(), err.Message())
+	}
+
+	return c.JSON(success.Status(), success.Message())
+}
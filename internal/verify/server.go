@@ -2,59 +2,164 @@ package verify
 
 import (
 	"fmt"
+	"io"
 	"net/http"
+	"strings"
 
+	"github.com/Cealgull/Verify/internal/acme"
 	"github.com/Cealgull/Verify/internal/cert"
+	"github.com/Cealgull/Verify/internal/credential"
 	"github.com/Cealgull/Verify/internal/email"
+	"github.com/Cealgull/Verify/internal/federation"
 	"github.com/Cealgull/Verify/internal/keyset"
+	"github.com/Cealgull/Verify/internal/msp"
+	"github.com/Cealgull/Verify/internal/proto"
+	"github.com/Cealgull/Verify/internal/threshold"
 	"github.com/Cealgull/Verify/pkg/turnstile"
 	"github.com/labstack/echo/v4"
 	"github.com/labstack/echo/v4/middleware"
 )
 
 type VerificationServer struct {
-	addr string
-	ec   *echo.Echo
-	em   *email.EmailManager
-	cm   *cert.CertManager
-	sm   *keyset.KeyManager
-	ts   *turnstile.Turnstile
+	addr   string
+	ec     *echo.Echo
+	em     *email.EmailManager
+	cm     *cert.CertManager
+	sm     *keyset.KeyManager
+	ts     *turnstile.Turnstile
+	me     *msp.Exporter
+	adm    string
+	caname string
+	maxage int
+	tsig   *threshold.Signer
+	ttok   string
+	am     *acme.Manager
+	abase  string
+	fr     *federation.Registry
+	cr     *credential.Manager
+}
+
+type ServerOption func(v *VerificationServer)
+
+func WithAdminToken(token string) ServerOption {
+	return func(v *VerificationServer) {
+		v.adm = token
+	}
+}
+
+func WithMSPExporter(me *msp.Exporter) ServerOption {
+	return func(v *VerificationServer) {
+		v.me = me
+	}
 }
 
 type EmailRequest struct {
 	Account string `json:"account"`
 	Code    string `json:"code"`
+	Locale  string `json:"locale,omitempty"`
+	Domain  string `json:"domain,omitempty"`
+}
+
+// Address joins the account with the requested domain unless the account
+// is a full address already.
+func (r *EmailRequest) Address() string {
+	if r.Domain == "" || strings.Contains(r.Account, "@") {
+		return r.Account
+	}
+	return r.Account + "@" + r.Domain
+}
+
+// EmailTiming tells in seconds how long the pending verification lives
+// and when it may be resent.
+type EmailTiming struct {
+	proto.ResponseMessage
+	TTL    int64 `json:"ttl"`
+	Resend int64 `json:"resend"`
+}
+
+// RedeemRequest carries a magic link token in a JSON body.
+type RedeemRequest struct {
+	Token string `json:"token"`
 }
 
 type CertRequest struct {
 	Pub string `json:"pub"`
 }
 
+type PairwiseRequest struct {
+	Pub      string `json:"pub"`
+	Audience string `json:"audience"`
+	Key      string `json:"key"`
+}
+
 type CACert struct {
 	Cert string `json:"cert"`
 }
 
+type CertVerification struct {
+	proto.ResponseMessage
+	Organization string `json:"organization"`
+}
+
+type CertBatchRequest struct {
+	Pubs []string `json:"pubs"`
+}
+
+type BatchCert struct {
+	Pub   string                 `json:"pub"`
+	Cert  string                 `json:"cert,omitempty"`
+	Error *proto.ResponseMessage `json:"error,omitempty"`
+}
+
+type CACertBatch struct {
+	Certs []BatchCert `json:"certs"`
+}
+
 var berr *GenericBindingError = &GenericBindingError{}
 var bsig *SignatureMissingError = &SignatureMissingError{}
 var success *VerifySuccess = &VerifySuccess{}
 
-func NewVerificationServer(host string, port int, em *email.EmailManager, cm *cert.CertManager, km *keyset.KeyManager, ts *turnstile.Turnstile) *VerificationServer {
+func NewVerificationServer(host string, port int, em *email.EmailManager, cm *cert.CertManager, km *keyset.KeyManager, ts *turnstile.Turnstile, options ...ServerOption) *VerificationServer {
 
 	addr := fmt.Sprintf("%s:%d", host, port)
 	ec := echo.New()
 	ec.HideBanner = true
-	v := VerificationServer{addr, ec, em, cm, km, ts}
+	v := VerificationServer{addr: addr, ec: ec, em: em, cm: cm, sm: km, ts: ts, maxage: defaultCAMaxAge}
+	for _, option := range options {
+		option(&v)
+	}
 	v.ec.Use(middleware.Logger())
 	v.ec.Use(middleware.Recover())
 	v.ec.POST("/email/sign", v.emailSign)
+	v.ec.POST("/email/resend", v.emailResend)
 	v.ec.POST("/email/verify", v.emailVerify)
+	// the mailed link opens a page which posts its token here, as a GET
+	// would let mail scanners prefetching the link burn the token
+	v.ec.POST("/email/redeem", v.emailRedeem)
 	v.ec.POST("/cert/sign", v.certSign)
+	v.ec.POST("/cert/sign/batch", v.certSignBatch)
 	v.ec.POST("/cert/verify", v.certVerify)
 	v.ec.POST("/cert/resign", v.certResign)
+	v.ec.POST("/cert/pairwise", v.certPairwise)
+	v.ec.POST("/cert/convert", v.certConvert)
+	v.registerCA()
+	v.registerFabric()
+	v.registerThreshold()
+	v.registerACME()
+	v.registerCredential()
+	v.registerAdmin()
 	return &v
 }
 
 func (v *VerificationServer) emailSign(c echo.Context) error {
+	return v.emailSend(c, v.em.Sign)
+}
+
+func (v *VerificationServer) emailResend(c echo.Context) error {
+	return v.emailSend(c, v.em.Resend)
+}
+
+func (v *VerificationServer) emailSend(c echo.Context, send func(string, ...string) (int, proto.VerifyError)) error {
 
 	var req EmailRequest
 
@@ -62,13 +167,31 @@ func (v *VerificationServer) emailSign(c echo.Context) error {
 		return c.JSON(berr.Status(), berr.Message())
 	}
 
-	_, err := v.em.Sign(req.Account)
+	_, err := send(req.Address(), req.Locale, c.Request().Header.Get("Accept-Language"))
 
-	if err != nil {
+	switch e := err.(type) {
+	case nil:
+	case *email.DuplicateEmailError:
+		return c.JSON(err.Status(), timed(err.Message(), &e.Timing))
+	case *email.ResendCooldownError:
+		return c.JSON(err.Status(), timed(err.Message(), &e.Timing))
+	default:
 		return c.JSON(err.Status(), err.Message())
 	}
 
-	return c.JSON(success.Status(), success.Message())
+	t, _ := v.em.Pending(req.Address())
+
+	return c.JSON(success.Status(), timed(success.Message(), t))
+}
+
+// timed attaches the timing of the pending verification to msg, if known.
+func timed(msg *proto.ResponseMessage, t *email.Timing) any {
+
+	if t == nil {
+		return msg
+	}
+
+	return &EmailTiming{ResponseMessage: *msg, TTL: email.Seconds(t.TTL), Resend: email.Seconds(t.Resend)}
 }
 
 func (v *VerificationServer) emailVerify(c echo.Context) error {
@@ -78,16 +201,32 @@ func (v *VerificationServer) emailVerify(c echo.Context) error {
 		return c.JSON(berr.Status(), berr.Message())
 	}
 
-	success, err := v.em.Verify(req.Account, req.Code)
+	success, err := v.em.Verify(req.Address(), req.Code)
 
 	if !success && err != nil {
-		return c.JSON(err.Status(), berr.Message())
+		return c.JSON(err.Status(), err.Message())
 	}
 
 	return c.JSON(http.StatusOK, v.sm.Dispatch())
 
 }
 
+func (v *VerificationServer) emailRedeem(c echo.Context) error {
+	var req RedeemRequest
+
+	if c.Bind(&req) != nil || req.Token == "" {
+		return c.JSON(berr.Status(), berr.Message())
+	}
+
+	_, err := v.em.Redeem(req.Token)
+
+	if err != nil {
+		return c.JSON(err.Status(), err.Message())
+	}
+
+	return c.JSON(http.StatusOK, v.sm.Dispatch())
+}
+
 func (v *VerificationServer) certSign(c echo.Context) error {
 	var req CertRequest
 
@@ -101,6 +240,12 @@ func (v *VerificationServer) certSign(c echo.Context) error {
 		return c.JSON(bsig.Status(), bsig.Message())
 	}
 
+	mime, err := v.issuedFormat(c)
+
+	if err != nil {
+		return c.JSON(err.Status(), err.Message())
+	}
+
 	ok, err := v.sm.Verify(req.Pub, sigb64)
 
 	// fmt.Printf(err.Error())
@@ -115,7 +260,50 @@ func (v *VerificationServer) certSign(c echo.Context) error {
 		return c.JSON(err.Status(), err.Message())
 	}
 
-	return c.JSON(http.StatusOK, CACert{string(cert)})
+	return certReply(c, mime, cert)
+}
+
+func (v *VerificationServer) certSignBatch(c echo.Context) error {
+	var req CertBatchRequest
+
+	if c.Bind(&req) != nil {
+		return c.JSON(berr.Status(), berr.Message())
+	}
+
+	sigb64 := c.Request().Header.Get("signature")
+
+	if sigb64 == "" {
+		return c.JSON(bsig.Status(), bsig.Message())
+	}
+
+	msg, err := v.cm.CanonicalBatch(req.Pubs)
+
+	if err != nil {
+		return c.JSON(err.Status(), err.Message())
+	}
+
+	ok, err := v.sm.Verify(msg, sigb64)
+
+	if !ok && err != nil {
+		return c.JSON(err.Status(), err.Message())
+	}
+
+	certs, err := v.cm.SignCSRBatch(req.Pubs)
+
+	if err != nil {
+		return c.JSON(err.Status(), err.Message())
+	}
+
+	resp := CACertBatch{Certs: make([]BatchCert, len(certs))}
+
+	for i, cert := range certs {
+		resp.Certs[i] = BatchCert{Pub: cert.Pub, Cert: string(cert.Cert)}
+		if cert.Err != nil {
+			resp.Certs[i].Error = cert.Err.Message()
+		}
+	}
+
+	return c.JSON(http.StatusOK, resp)
 }
 
 func (v *VerificationServer) certResign(c echo.Context) error {
@@ -125,30 +313,156 @@ func (v *VerificationServer) certResign(c echo.Context) error {
 		return c.JSON(berr.Status(), berr.Message())
 	}
 
+	mime, err := v.issuedFormat(c)
+
+	if err != nil {
+		return c.JSON(err.Status(), err.Message())
+	}
+
 	cert, err := v.cm.ResignCSR(req.Pub)
 
 	if err != nil {
 		return c.JSON(err.Status(), err.Message())
 	}
 
-	return c.JSON(success.Status(), CACert{string(cert)})
+	return certReply(c, mime, cert)
 
 }
 
-func (v *VerificationServer) certVerify(c echo.Context) error {
-	var req CACert
+// certPairwise issues an audience specific certificate. The signature
+// header carries the ed25519 signature of the master key over
+// cert.PairwiseMessage.
+func (v *VerificationServer) certPairwise(c echo.Context) error {
+	var req PairwiseRequest
 
 	if c.Bind(&req) != nil {
 		return c.JSON(berr.Status(), berr.Message())
 	}
 
-	ok, err := v.cm.VerifyCert([]byte(req.Cert))
+	sigb64 := c.Request().Header.Get("signature")
 
-	if !ok && err != nil {
+	if sigb64 == "" {
+		return c.JSON(bsig.Status(), bsig.Message())
+	}
+
+	mime, err := v.issuedFormat(c)
+
+	if err != nil {
+		return c.JSON(err.Status(), err.Message())
+	}
+
+	cert, err := v.cm.SignPairwise(req.Pub, req.Audience, req.Key, sigb64)
+
+	if err != nil {
+		return c.JSON(err.Status(), err.Message())
+	}
+
+	return certReply(c, mime, cert)
+}
+
+// certFormat picks the first certificate encoding of the Accept header the
+// server produces, JSON wrapped PEM when none is listed.
+func certFormat(c echo.Context) string {
+
+	for _, r := range strings.Split(c.Request().Header.Get(echo.HeaderAccept), ",") {
+		mime, _, _ := strings.Cut(r, ";")
+		switch mime = strings.TrimSpace(mime); mime {
+		case MIMEApplicationC509, MIMEApplicationPKIX, MIMEApplicationPEM, echo.MIMEApplicationJSON:
+			return mime
+		}
+	}
+
+	return echo.MIMEApplicationJSON
+}
+
+// issuedFormat negotiates the format of a certificate about to be issued
+// and checks the authority can issue it in that format.
+func (v *VerificationServer) issuedFormat(c echo.Context) (string, proto.VerifyError) {
+
+	mime := certFormat(c)
+
+	if mime == MIMEApplicationC509 {
+		if err := v.cm.CheckC509(); err != nil {
+			return "", err
+		}
+	}
+
+	return mime, nil
+}
+
+// certReply answers with a certificate bundle in the given format.
+func certReply(c echo.Context, mime string, data []byte) error {
+
+	var err proto.VerifyError
+
+	switch mime {
+	case MIMEApplicationC509:
+		data, err = cert.EncodeC509(data)
+	case MIMEApplicationPKIX:
+		data, err = cert.EncodeX509(data)
+	default:
+		data, err = cert.EncodePEM(data)
+	}
+
+	if err != nil {
+		return c.JSON(err.Status(), err.Message())
+	}
+
+	if mime == echo.MIMEApplicationJSON {
+		return c.JSON(http.StatusOK, CACert{string(data)})
+	}
+
+	return c.Blob(http.StatusOK, mime, data)
+}
+
+// certConvert re-encodes a certificate between C509 and X.509 without
+// verifying it.
+func (v *VerificationServer) certConvert(c echo.Context) error {
+
+	data, rerr := certBody(c)
+
+	if rerr != nil {
+		return c.JSON(berr.Status(), berr.Message())
+	}
+
+	return certReply(c, certFormat(c), data)
+}
+
+// certBody reads a certificate bundle either raw from the request body,
+// when sent as DER, PEM or C509, or from the cert field of a JSON request.
+func certBody(c echo.Context) ([]byte, error) {
+
+	mime, _, _ := strings.Cut(c.Request().Header.Get(echo.HeaderContentType), ";")
+
+	switch strings.TrimSpace(mime) {
+	case MIMEApplicationPKIX, MIMEApplicationPEM, MIMEApplicationC509, echo.MIMEOctetStream:
+		return io.ReadAll(c.Request().Body)
+	}
+
+	var req CACert
+
+	if err := c.Bind(&req); err != nil {
+		return nil, err
+	}
+
+	return []byte(req.Cert), nil
+}
+
+func (v *VerificationServer) certVerify(c echo.Context) error {
+
+	data, rerr := certBody(c)
+
+	if rerr != nil {
+		return c.JSON(berr.Status(), berr.Message())
+	}
+
+	org, err := v.cm.VerifyCert(data)
+
+	if err != nil {
 		return c.JSON(err.Status(), err.Message())
 	}
 
-	return c.JSON(success.Status(), success.Message())
+	return c.JSON(success.Status(), CertVerification{*success.Message(), org})
 
 }
 
@@ -3,22 +3,39 @@ package verify
 import (
 	"bytes"
 	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
 	"encoding/base64"
 	"encoding/json"
+	"encoding/pem"
 	"fmt"
 	"io"
-	"math/rand"
+	"math/big"
+	mathrand "math/rand"
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"path/filepath"
 	"strings"
 	"testing"
+	"time"
 
+	"github.com/Cealgull/Verify/internal/acme"
 	"github.com/Cealgull/Verify/internal/cache"
 	mockcache "github.com/Cealgull/Verify/internal/cache/mock"
 	"github.com/Cealgull/Verify/internal/cert"
+	"github.com/Cealgull/Verify/internal/credential"
 	"github.com/Cealgull/Verify/internal/email"
+	"github.com/Cealgull/Verify/internal/fabric"
+	"github.com/Cealgull/Verify/internal/federation"
 	"github.com/Cealgull/Verify/internal/keyset"
+	"github.com/Cealgull/Verify/internal/msp"
+	"github.com/Cealgull/Verify/internal/proto"
+	"github.com/Cealgull/Verify/internal/threshold"
+	"github.com/Cealgull/Verify/pkg/bbs"
+	"github.com/Cealgull/Verify/pkg/frost"
 	"github.com/Cealgull/Verify/pkg/keypair"
 	"github.com/Cealgull/Verify/pkg/turnstile"
 	"github.com/labstack/echo/v4"
@@ -36,6 +53,7 @@ var km *keyset.KeyManager
 var errjson = "114514"
 var code string
 var cacert CACert
+var admin = "admintoken"
 
 func TestNewVerificationServer(t *testing.T) {
 
@@ -82,12 +100,31 @@ func TestNewVerificationServer(t *testing.T) {
 		logger,
 		cert.WithCertificate("./testdata/cert.pem"),
 		cert.WithPrivateKey("./testdata/priv.pem"),
+		cert.WithPairwiseSecret("pairwise secret"),
 		cert.WithCache(mc),
 	)
 
 	assert.NoError(t, err)
 
-	verify = NewVerificationServer("0.0.0.1", 20000, em, cm, km, ts)
+	me, err := msp.NewExporter(logger)
+	assert.NoError(t, err)
+
+	am, err := acme.NewManager(logger, acme.WithCache(mc))
+	assert.NoError(t, err)
+
+	sk, err := bbs.KeyGen(bytes.Repeat([]byte{1}, 32), credential.Header)
+	assert.NoError(t, err)
+
+	cr, err := credential.NewManager(logger, credential.WithSecretKey(sk), credential.WithGroup("students"), credential.WithCache(mc))
+	assert.NoError(t, err)
+
+	verify = NewVerificationServer("0.0.0.1", 20000, em, cm, km, ts,
+		WithAdminToken(admin),
+		WithMSPExporter(me),
+		WithCAMaxAge(60),
+		WithACME(am, ""),
+		WithCredentials(cr),
+	)
 
 }
 
@@ -128,11 +165,73 @@ func TestSignHandler(t *testing.T) {
 	c = verify.ec.NewContext(req, rec)
 	assert.NoError(t, verify.emailSign(c))
 
+	signRequest = EmailRequest{
+		Account: "user1",
+		Domain:  "example5.org",
+	}
+
+	data, _ = json.Marshal(&signRequest)
+
+	req = httptest.NewRequest(http.MethodPost, "/email/sign", bytes.NewReader(data))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	rec = httptest.NewRecorder()
+	c = verify.ec.NewContext(req, rec)
+	assert.NoError(t, verify.emailSign(c))
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+
 	var err error
-	code, err = mc.Get("user1")
+	code, err = mc.Get("user1@example2.org")
 	assert.NoError(t, err)
 }
 
+func TestResendHandler(t *testing.T) {
+
+	send := func(uri string, account string) (*httptest.ResponseRecorder, *EmailTiming) {
+		data, _ := json.Marshal(&EmailRequest{Account: account})
+		req := httptest.NewRequest(http.MethodPost, uri, bytes.NewReader(data))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		verify.ec.ServeHTTP(rec, req)
+		var timing EmailTiming
+		_ = json.Unmarshal(rec.Body.Bytes(), &timing)
+		return rec, &timing
+	}
+
+	rec, timing := send("/email/sign", "user7")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.EqualValues(t, email.DefaultCodeTTL/time.Second, timing.TTL)
+	assert.EqualValues(t, email.DefaultCooldown/time.Second, timing.Resend)
+
+	rec, timing = send("/email/sign", "user7")
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Equal(t, "A0110", timing.Code)
+	assert.Greater(t, timing.TTL, int64(0))
+
+	rec, timing = send("/email/resend", "user7")
+	assert.Equal(t, http.StatusTooManyRequests, rec.Code)
+	assert.Equal(t, "A0428", timing.Code)
+	assert.Greater(t, timing.Resend, int64(0))
+
+	rec, _ = send("/email/resend", "user8")
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+
+	req := httptest.NewRequest(http.MethodPost, "/email/resend", strings.NewReader(errjson))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	rec = httptest.NewRecorder()
+	verify.ec.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+
+	// past the cooldown the code is sent again
+	assert.NoError(t, mc.Set("user7@example2.org", "000000", email.DefaultCodeTTL-email.DefaultCooldown))
+
+	rec, timing = send("/email/resend", "user7")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.EqualValues(t, email.DefaultCodeTTL/time.Second, timing.TTL)
+
+	resent, _ := mc.Get("user7@example2.org")
+	assert.Regexp(t, "^[0-9]{6}$", resent)
+}
+
 func TestVerifyHandler(t *testing.T) {
 
 	req := httptest.NewRequest(http.MethodPost, "/email/verify", strings.NewReader(errjson))
@@ -158,7 +257,7 @@ func TestVerifyHandler(t *testing.T) {
 	var wrongCode string
 
 	for {
-		wrongCode = fmt.Sprintf("%06d", rand.Intn(100000))
+		wrongCode = fmt.Sprintf("%06d", mathrand.Intn(100000))
 		if wrongCode != code {
 			break
 		}
@@ -179,9 +278,15 @@ func TestVerifyHandler(t *testing.T) {
 
 	assert.Equal(t, http.StatusBadRequest, rec.Code)
 
+	var incorrect proto.ResponseMessage
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &incorrect))
+	assert.Equal(t, "A0422", incorrect.Code)
+	assert.Equal(t, email.DefaultAttempts-1, *incorrect.Remaining)
+
 	signRequest = EmailRequest{
 		Account: "user1",
 		Code:    code,
+		Domain:  "example2.org",
 	}
 
 	data, _ = json.Marshal(&signRequest)
@@ -196,6 +301,85 @@ func TestVerifyHandler(t *testing.T) {
 	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &kp))
 }
 
+// linkbox keeps the magic links mailed by the link mode manager.
+type linkbox struct {
+	links []string
+}
+
+func (b *linkbox) Send(from string, to string, m *email.Message) error {
+	b.links = append(b.links, strings.TrimSpace(m.Text))
+	return nil
+}
+
+func TestRedeemHandler(t *testing.T) {
+
+	l, _ := zap.NewProduction()
+	box := &linkbox{}
+
+	linkDialer, err := email.NewEmailDialer(l.Sugar(), email.WithMailer(box, "user1@example1.org"), email.WithToDom("example2.org"))
+	assert.NoError(t, err)
+
+	em, err := email.NewEmailManager(
+		l.Sugar(),
+		email.WithEmailDialer(linkDialer),
+		email.WithCache(mockcache.NewMockCache()),
+		email.WithAccExp("^[a-zA-Z0-9-_\\.]{3,50}$"),
+		email.WithEmailTemplate("this is a testing code %06d"),
+		email.WithLink("https://verify.example2.org/redeem"),
+		email.WithMode(email.ModeLink),
+	)
+	assert.NoError(t, err)
+
+	saved := verify.em
+	verify.em = em
+	defer func() { verify.em = saved }()
+
+	data, _ := json.Marshal(&EmailRequest{Account: "user1"})
+	req := httptest.NewRequest(http.MethodPost, "/email/sign", bytes.NewReader(data))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	rec := httptest.NewRecorder()
+	verify.ec.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Len(t, box.links, 1)
+
+	link := box.links[0]
+	token := link[strings.Index(link, "token=")+len("token="):]
+
+	req = httptest.NewRequest(http.MethodPost, "/email/redeem", strings.NewReader(errjson))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	rec = httptest.NewRecorder()
+	verify.ec.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+
+	data, _ = json.Marshal(&RedeemRequest{Token: "garbage"})
+	req = httptest.NewRequest(http.MethodPost, "/email/redeem", bytes.NewReader(data))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	rec = httptest.NewRecorder()
+	verify.ec.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+
+	rec = httptest.NewRecorder()
+	verify.ec.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/email/redeem?token="+token, nil))
+	assert.Equal(t, http.StatusMethodNotAllowed, rec.Code)
+
+	data, _ = json.Marshal(&RedeemRequest{Token: token})
+	req = httptest.NewRequest(http.MethodPost, "/email/redeem", bytes.NewReader(data))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	rec = httptest.NewRecorder()
+	verify.ec.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	var pair keypair.RingKeyPair
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &pair))
+
+	data, _ = json.Marshal(&RedeemRequest{Token: token})
+	req = httptest.NewRequest(http.MethodPost, "/email/redeem", bytes.NewReader(data))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	rec = httptest.NewRecorder()
+	verify.ec.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusGone, rec.Code)
+}
+
 var pubb64 string
 
 func TestCertSign(t *testing.T) {
@@ -254,6 +438,69 @@ func TestCertSign(t *testing.T) {
 
 }
 
+func TestCertSignBatch(t *testing.T) {
+
+	var pubs []string
+	for i := 0; i < 3; i++ {
+		pub, _, _ := ed25519.GenerateKey(nil)
+		pubs = append(pubs, base64.StdEncoding.EncodeToString(pub))
+	}
+	pubs = append(pubs, "invalid")
+
+	kp = km.Dispatch()
+	msg, _ := verify.cm.CanonicalBatch(pubs)
+	sigb64 := keypair.RingSign(kp, msg)
+	data, _ := json.Marshal(&CertBatchRequest{pubs})
+
+	serve := func(body []byte, sig string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/cert/sign/batch", bytes.NewReader(body))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		if sig != "" {
+			req.Header.Set("signature", sig)
+		}
+		rec := httptest.NewRecorder()
+		c := verify.ec.NewContext(req, rec)
+		assert.NoError(t, verify.certSignBatch(c))
+		return rec
+	}
+
+	// test binding error
+	assert.Equal(t, http.StatusBadRequest, serve([]byte(errjson), sigb64).Code)
+
+	// test signature missing
+	assert.Equal(t, http.StatusBadRequest, serve(data, "").Code)
+
+	// test empty batch
+	empty, _ := json.Marshal(&CertBatchRequest{})
+	assert.Equal(t, http.StatusBadRequest, serve(empty, sigb64).Code)
+
+	// test signature over a different list
+	other, _ := json.Marshal(&CertBatchRequest{pubs[:2]})
+	assert.Equal(t, http.StatusUnauthorized, serve(other, sigb64).Code)
+
+	// test registration failure
+	mc.AddSetsErr("pub", &cache.InternalError{})
+	assert.Equal(t, http.StatusInternalServerError, serve(data, sigb64).Code)
+	mc.DelSetsErr("pub")
+
+	// test OK in any key order
+	reversed := []string{pubs[3], pubs[2], pubs[1], pubs[0]}
+	data, _ = json.Marshal(&CertBatchRequest{reversed})
+	rec := serve(data, sigb64)
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	var resp CACertBatch
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+	assert.Len(t, resp.Certs, 4)
+	assert.Equal(t, "invalid", resp.Certs[0].Pub)
+	assert.NotNil(t, resp.Certs[0].Error)
+	for _, cert := range resp.Certs[1:] {
+		assert.Nil(t, cert.Error)
+		_, err := verify.cm.VerifyCert([]byte(cert.Cert))
+		assert.Nil(t, err)
+	}
+}
+
 func TestCertResign(t *testing.T) {
 
 	pubnew, _, _ := ed25519.GenerateKey(nil)
@@ -317,6 +564,873 @@ func TestCertVerify(t *testing.T) {
 	assert.NoError(t, verify.certVerify(c))
 	assert.Equal(t, http.StatusOK, rec.Code)
 
+	var verification CertVerification
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &verification))
+	assert.Equal(t, "N0001", verification.Code)
+	assert.Equal(t, "Internet Widgits Pty Ltd", verification.Organization)
+
+	// testing DER, PEM and base64 DER encodings
+	p, _ := pem.Decode([]byte(cacert.Cert))
+	b64, _ := json.Marshal(&CACert{base64.StdEncoding.EncodeToString(p.Bytes)})
+
+	bodies := []struct {
+		mime string
+		body []byte
+	}{
+		{MIMEApplicationPKIX, p.Bytes},
+		{echo.MIMEOctetStream, p.Bytes},
+		{MIMEApplicationPEM + "; charset=utf-8", []byte(cacert.Cert)},
+		{echo.MIMEApplicationJSON, b64},
+	}
+
+	for _, b := range bodies {
+		req = httptest.NewRequest(http.MethodPost, "/cert/verify", bytes.NewReader(b.body))
+		rec = httptest.NewRecorder()
+		req.Header.Set(echo.HeaderContentType, b.mime)
+		c = verify.ec.NewContext(req, rec)
+		assert.NoError(t, verify.certVerify(c))
+		assert.Equal(t, http.StatusOK, rec.Code, b.mime)
+	}
+
+	req = httptest.NewRequest(http.MethodPost, "/cert/verify", bytes.NewReader(p.Bytes[:16]))
+	rec = httptest.NewRecorder()
+	req.Header.Set(echo.HeaderContentType, MIMEApplicationPKIX)
+	c = verify.ec.NewContext(req, rec)
+	assert.NoError(t, verify.certVerify(c))
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+
+}
+
+func TestCertPairwise(t *testing.T) {
+
+	masterpub, masterpriv, _ := ed25519.GenerateKey(nil)
+	master := base64.StdEncoding.EncodeToString(masterpub)
+	_, verr := verify.cm.SignCSR(master)
+	assert.Nil(t, verr)
+
+	pub, _, _ := ed25519.GenerateKey(nil)
+	key := base64.StdEncoding.EncodeToString(pub)
+	audience := "https://forum.example.org"
+	sig := base64.StdEncoding.EncodeToString(ed25519.Sign(masterpriv, []byte(cert.PairwiseMessage(audience, key))))
+
+	serve := func(body []byte, sigb64 string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/cert/pairwise", bytes.NewReader(body))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		if sigb64 != "" {
+			req.Header.Set("signature", sigb64)
+		}
+		rec := httptest.NewRecorder()
+		verify.ec.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := serve([]byte(errjson), sig)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+
+	data, _ := json.Marshal(&PairwiseRequest{master, audience, key})
+
+	rec = serve(data, "")
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+
+	data, _ = json.Marshal(&PairwiseRequest{master, "https://chat.example.org", key})
+	rec = serve(data, sig)
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+
+	data, _ = json.Marshal(&PairwiseRequest{master, audience, key})
+	rec = serve(data, sig)
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	var resp CACert
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+
+	issued, verr := verify.cm.VerifiedCert([]byte(resp.Cert))
+	assert.Nil(t, verr)
+	assert.Equal(t, verify.cm.PairwiseAddress(masterpub, audience), issued.Subject.CommonName)
+	assert.Equal(t, audience, issued.URIs[0].String())
+}
+
+func TestCertC509(t *testing.T) {
+
+	serve := func(uri string, mime string, accept string, body []byte, sigb64 string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, uri, bytes.NewReader(body))
+		req.Header.Set(echo.HeaderContentType, mime)
+		req.Header.Set(echo.HeaderAccept, accept)
+		if sigb64 != "" {
+			req.Header.Set("signature", sigb64)
+		}
+		rec := httptest.NewRecorder()
+		verify.ec.ServeHTTP(rec, req)
+		return rec
+	}
+
+	pub, _, _ := ed25519.GenerateKey(nil)
+	pubb64 := base64.StdEncoding.EncodeToString(pub)
+	data, _ := json.Marshal(&CertRequest{pubb64})
+
+	rec := serve("/cert/sign", echo.MIMEApplicationJSON, "text/html, "+MIMEApplicationC509+";q=0.9", data, keypair.RingSign(km.Dispatch(), pubb64))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, MIMEApplicationC509, rec.Header().Get(echo.HeaderContentType))
+	compact := rec.Body.Bytes()
+
+	rec = serve("/cert/verify", MIMEApplicationC509, "", compact, "")
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	// an authority outside the C509 profile refuses before it signs
+	l, _ := zap.NewProduction()
+	dir := t.TempDir()
+	_, err := cert.GenerateAuthority(filepath.Join(dir, "priv.pem"), filepath.Join(dir, "cert.pem"), cert.SM2, pkix.Name{CommonName: "SM2 CA"}, time.Hour)
+	assert.NoError(t, err)
+	sm2cm, err := cert.NewCertManager(l.Sugar(), cert.WithPrivateKey(filepath.Join(dir, "priv.pem")), cert.WithCertificate(filepath.Join(dir, "cert.pem")), cert.WithCache(mc))
+	assert.NoError(t, err)
+
+	cm := verify.cm
+	verify.cm = sm2cm
+	other, _, _ := ed25519.GenerateKey(nil)
+	otherb64 := base64.StdEncoding.EncodeToString(other)
+	body, _ := json.Marshal(&CertRequest{otherb64})
+	rec = serve("/cert/sign", echo.MIMEApplicationJSON, MIMEApplicationC509, body, keypair.RingSign(km.Dispatch(), otherb64))
+	assert.Equal(t, http.StatusNotAcceptable, rec.Code)
+	registered, _ := mc.SIsmember("pub", otherb64)
+	assert.False(t, registered)
+	rec = serve("/cert/resign", echo.MIMEApplicationJSON, MIMEApplicationC509, data, "")
+	assert.Equal(t, http.StatusNotAcceptable, rec.Code)
+	verify.cm = cm
+
+	rec = serve("/cert/convert", MIMEApplicationC509, MIMEApplicationPKIX, compact, "")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	der := rec.Body.Bytes()
+
+	rec = serve("/cert/convert", MIMEApplicationPKIX, "", der, "")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	var resp CACert
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+
+	rec = serve("/cert/convert", echo.MIMEApplicationJSON, MIMEApplicationPEM, rec.Body.Bytes(), "")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, resp.Cert, rec.Body.String())
+
+	rec = serve("/cert/convert", MIMEApplicationPEM, MIMEApplicationC509, []byte(resp.Cert), "")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, compact, rec.Body.Bytes())
+
+	rec = serve("/cert/convert", MIMEApplicationC509, MIMEApplicationPKIX, compact[:10], "")
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+
+	rec = serve("/cert/convert", echo.MIMEApplicationJSON, "", []byte(errjson), "")
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+
+	// certificates outside the profile cannot be sent compact
+	issuer := verify.cm.Certificate()
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "leaf"},
+		ExtraExtensions: []pkix.Extension{
+			{Id: []int{1, 3, 6, 1, 4, 1, 99999, 1}, Critical: true, Value: []byte{0x05, 0x00}},
+		},
+	}
+	priv, _ := cert.LoadPrivateKey("./testdata/priv.pem")
+	der, _ = x509.CreateCertificate(rand.Reader, template, issuer, pub, priv)
+
+	rec = serve("/cert/convert", MIMEApplicationPKIX, MIMEApplicationC509, der, "")
+	assert.Equal(t, http.StatusNotAcceptable, rec.Code)
+}
+
+func TestCredential(t *testing.T) {
+
+	serve := func(method string, uri string, body []byte, sigb64 string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, uri, bytes.NewReader(body))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		if sigb64 != "" {
+			req.Header.Set("signature", sigb64)
+		}
+		rec := httptest.NewRecorder()
+		verify.ec.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := serve(http.MethodGet, "/credential/key", nil, "")
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	var key credential.IssuerKey
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &key))
+
+	secret := base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{7}, 32))
+	data, _ := json.Marshal(&CredentialRequest{secret})
+	kp := km.Dispatch()
+
+	rec = serve(http.MethodPost, "/credential/sign", []byte(errjson), "")
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+
+	rec = serve(http.MethodPost, "/credential/sign", data, "")
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+
+	rec = serve(http.MethodPost, "/credential/sign", data, keypair.RingSign(kp, "other"))
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+
+	short, _ := json.Marshal(&CredentialRequest{"AAAA"})
+	rec = serve(http.MethodPost, "/credential/sign", short, keypair.RingSign(kp, "AAAA"))
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+
+	rec = serve(http.MethodPost, "/credential/sign", data, keypair.RingSign(kp, secret))
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	var cred credential.Credential
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &cred))
+
+	// the prover cannot pick the nonce itself
+	p, err := credential.Present(&key, &cred, "nonce", credential.AttrGroup)
+	assert.NoError(t, err)
+	data, _ = json.Marshal(p)
+	rec = serve(http.MethodPost, "/credential/verify", data, "")
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+
+	rec = serve(http.MethodGet, "/credential/nonce", nil, "")
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	var nonce CredentialNonce
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &nonce))
+
+	p, err = credential.Present(&key, &cred, nonce.Nonce, credential.AttrGroup)
+	assert.NoError(t, err)
+	data, _ = json.Marshal(p)
+
+	rec = serve(http.MethodPost, "/credential/verify", data, "")
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	var verification CredentialVerification
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &verification))
+	assert.Equal(t, nonce.Nonce, verification.Nonce)
+	assert.Equal(t, map[string]string{credential.AttrGroup: "students"}, verification.Attributes)
+
+	// and the nonce is used up by the first presentation
+	rec = serve(http.MethodPost, "/credential/verify", data, "")
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+
+	rec = serve(http.MethodPost, "/credential/verify", []byte(errjson), "")
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+}
+
+func fabricToken(priv ed25519.PrivateKey, certpem []byte, method string, uri string, body []byte) string {
+	b64cert := base64.StdEncoding.EncodeToString(certpem)
+	payload := method + "." + base64.StdEncoding.EncodeToString([]byte(uri)) + "." +
+		base64.StdEncoding.EncodeToString(body) + "." + b64cert
+	return b64cert + "." + base64.StdEncoding.EncodeToString(ed25519.Sign(priv, []byte(payload)))
+}
+
+func fabricCSR(priv ed25519.PrivateKey) string {
+	der, _ := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+		Subject: pkix.Name{CommonName: "user1"},
+	}, priv)
+	return string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: der}))
+}
+
+func serveFabric(method string, uri string, body []byte, header map[string]string) (*httptest.ResponseRecorder, *fabric.Response) {
+	req := httptest.NewRequest(method, uri, bytes.NewReader(body))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	for k, v := range header {
+		req.Header.Set(k, v)
+	}
+	rec := httptest.NewRecorder()
+	verify.ec.ServeHTTP(rec, req)
+	var resp fabric.Response
+	_ = json.Unmarshal(rec.Body.Bytes(), &resp)
+	return rec, &resp
+}
+
+var fabricCert []byte
+var fabricPriv ed25519.PrivateKey
+
+func TestFabricCAInfo(t *testing.T) {
+	rec, resp := serveFabric(http.MethodGet, "/api/v1/cainfo", nil, nil)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.True(t, resp.Success)
+	info := resp.Result.(map[string]interface{})
+	assert.NotEmpty(t, info["CAChain"])
+}
+
+func TestFabricEnroll(t *testing.T) {
+
+	pub, priv, _ := ed25519.GenerateKey(nil)
+	fabricPriv = priv
+	kp = km.Dispatch()
+	sigb64 := keypair.RingSign(kp, base64.StdEncoding.EncodeToString(pub))
+
+	data, _ := json.Marshal(&fabric.EnrollmentRequest{CSR: fabricCSR(priv)})
+
+	// test binding error
+	rec, resp := serveFabric(http.MethodPost, "/api/v1/enroll", []byte(errjson), nil)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.False(t, resp.Success)
+
+	// test signature missing
+	rec, _ = serveFabric(http.MethodPost, "/api/v1/enroll", data, nil)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+
+	// test invalid csr
+	bad, _ := json.Marshal(&fabric.EnrollmentRequest{CSR: "invalid"})
+	rec, _ = serveFabric(http.MethodPost, "/api/v1/enroll", bad, map[string]string{"signature": sigb64})
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+
+	// test wrong ring signature
+	basic := "Basic " + base64.StdEncoding.EncodeToString([]byte("user1:"+keypair.RingSign(kp, "other")))
+	rec, _ = serveFabric(http.MethodPost, "/api/v1/enroll", data, map[string]string{echo.HeaderAuthorization: basic})
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+
+	// test unavailable attribute
+	attr, _ := json.Marshal(&fabric.EnrollmentRequest{
+		CSR:      fabricCSR(priv),
+		AttrReqs: []*fabric.AttributeRequest{{Name: "custom"}},
+	})
+	rec, _ = serveFabric(http.MethodPost, "/api/v1/enroll", attr, map[string]string{"signature": sigb64})
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+
+	// test OK with ring signature as enrollment secret
+	basic = "Basic " + base64.StdEncoding.EncodeToString([]byte("user1:"+sigb64))
+	rec, resp = serveFabric(http.MethodPost, "/api/v1/enroll", data, map[string]string{echo.HeaderAuthorization: basic})
+	assert.Equal(t, http.StatusCreated, rec.Code)
+	assert.True(t, resp.Success)
+
+	result := resp.Result.(map[string]interface{})
+	fabricCert, _ = base64.StdEncoding.DecodeString(result["Cert"].(string))
+	p, _ := pem.Decode(fabricCert)
+	cert, err := x509.ParseCertificate(p.Bytes)
+	assert.NoError(t, err)
+
+	found := false
+	for _, ext := range cert.Extensions {
+		if ext.Id.Equal(fabric.AttrOID) {
+			found = true
+			assert.Contains(t, string(ext.Value), cert.Subject.CommonName)
+		}
+	}
+	assert.True(t, found)
+}
+
+func TestFabricReenroll(t *testing.T) {
+
+	uri := "/api/v1/reenroll"
+
+	// test token missing
+	rec, _ := serveFabric(http.MethodPost, uri, nil, nil)
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+
+	// test invalid token
+	rec, _ = serveFabric(http.MethodPost, uri, nil, map[string]string{echo.HeaderAuthorization: "a.b"})
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+
+	// test binding error
+	token := fabricToken(fabricPriv, fabricCert, http.MethodPost, uri, []byte(errjson))
+	rec, _ = serveFabric(http.MethodPost, uri, []byte(errjson), map[string]string{echo.HeaderAuthorization: token})
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+
+	// test invalid csr
+	data, _ := json.Marshal(&fabric.EnrollmentRequest{CSR: "invalid"})
+	token = fabricToken(fabricPriv, fabricCert, http.MethodPost, uri, data)
+	rec, _ = serveFabric(http.MethodPost, uri, data, map[string]string{echo.HeaderAuthorization: token})
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+
+	// test OK with the same key
+	data, _ = json.Marshal(&fabric.EnrollmentRequest{CSR: fabricCSR(fabricPriv)})
+	token = fabricToken(fabricPriv, fabricCert, http.MethodPost, uri, data)
+	rec, _ = serveFabric(http.MethodPost, uri, data, map[string]string{echo.HeaderAuthorization: token})
+	assert.Equal(t, http.StatusCreated, rec.Code)
+
+	// test a new key is refused
+	_, priv, _ := ed25519.GenerateKey(nil)
+	data, _ = json.Marshal(&fabric.EnrollmentRequest{CSR: fabricCSR(priv)})
+	token = fabricToken(fabricPriv, fabricCert, http.MethodPost, uri, data)
+	rec, resp := serveFabric(http.MethodPost, uri, data, map[string]string{echo.HeaderAuthorization: token})
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+	assert.False(t, resp.Success)
+}
+
+func TestFabricRevoke(t *testing.T) {
+
+	uri := "/api/v1/revoke"
+
+	p, _ := pem.Decode(fabricCert)
+	cert, _ := x509.ParseCertificate(p.Bytes)
+
+	// test binding error
+	token := fabricToken(fabricPriv, fabricCert, http.MethodPost, uri, []byte(errjson))
+	rec, _ := serveFabric(http.MethodPost, uri, []byte(errjson), map[string]string{echo.HeaderAuthorization: token})
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+
+	// test revoking another certificate
+	data, _ := json.Marshal(&fabric.RevocationRequest{Serial: "01"})
+	token = fabricToken(fabricPriv, fabricCert, http.MethodPost, uri, data)
+	rec, _ = serveFabric(http.MethodPost, uri, data, map[string]string{echo.HeaderAuthorization: token})
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+
+	// test cache failure
+	data, _ = json.Marshal(&fabric.RevocationRequest{Serial: cert.SerialNumber.Text(16)})
+	token = fabricToken(fabricPriv, fabricCert, http.MethodPost, uri, data)
+	mc.AddSetsErr("revoked", &cache.InternalError{})
+	rec, _ = serveFabric(http.MethodPost, uri, data, map[string]string{echo.HeaderAuthorization: token})
+	assert.Equal(t, http.StatusInternalServerError, rec.Code)
+	mc.DelSetsErr("revoked")
+
+	// test OK
+	data, _ = json.Marshal(&fabric.RevocationRequest{Name: cert.Subject.CommonName})
+	token = fabricToken(fabricPriv, fabricCert, http.MethodPost, uri, data)
+	rec, resp := serveFabric(http.MethodPost, uri, data, map[string]string{echo.HeaderAuthorization: token})
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.True(t, resp.Success)
+
+	// test revoked certificate can no longer authenticate
+	rec, _ = serveFabric(http.MethodPost, uri, data, map[string]string{echo.HeaderAuthorization: token})
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+
+	data, _ = json.Marshal(&CACert{string(fabricCert)})
+	req := httptest.NewRequest(http.MethodPost, "/cert/verify", bytes.NewReader(data))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	rec = httptest.NewRecorder()
+	c := verify.ec.NewContext(req, rec)
+	assert.NoError(t, verify.certVerify(c))
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+}
+
+func TestCADistribution(t *testing.T) {
+
+	routes := map[string]string{
+		"/ca/cert.pem":  MIMEApplicationPEM,
+		"/ca/cert.der":  MIMEApplicationPKIX,
+		"/ca/chain.pem": MIMEApplicationPEM,
+		"/ca/jwks.json": MIMEApplicationJWKSet,
+	}
+
+	etags := map[string]bool{}
+
+	for route, mime := range routes {
+
+		req := httptest.NewRequest(http.MethodGet, route, nil)
+		rec := httptest.NewRecorder()
+		verify.ec.ServeHTTP(rec, req)
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, mime, rec.Header().Get(echo.HeaderContentType))
+		assert.Equal(t, "public, max-age=60", rec.Header().Get(echo.HeaderCacheControl))
+		assert.Equal(t, "sha256:"+verify.cm.Fingerprint(), rec.Header().Get(HeaderCertFingerprint))
+
+		etag := rec.Header().Get("ETag")
+		sum := sha256.Sum256(rec.Body.Bytes())
+		assert.Equal(t, fmt.Sprintf("\"%x\"", sum), etag)
+		etags[etag] = true
+
+		req = httptest.NewRequest(http.MethodGet, route, nil)
+		req.Header.Set("If-None-Match", etag)
+		rec = httptest.NewRecorder()
+		verify.ec.ServeHTTP(rec, req)
+		assert.Equal(t, http.StatusNotModified, rec.Code)
+	}
+
+	// the single certificate chain shares the body of cert.pem
+	assert.Len(t, etags, len(routes)-1)
+
+	req := httptest.NewRequest(http.MethodGet, "/ca/cert.der", nil)
+	rec := httptest.NewRecorder()
+	verify.ec.ServeHTTP(rec, req)
+	ca, err := x509.ParseCertificate(rec.Body.Bytes())
+	assert.NoError(t, err)
+	assert.True(t, ca.Equal(verify.cm.Certificate()))
+
+	req = httptest.NewRequest(http.MethodGet, "/ca/jwks.json", nil)
+	rec = httptest.NewRecorder()
+	verify.ec.ServeHTTP(rec, req)
+	var jwks cert.JWKSet
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &jwks))
+	assert.Equal(t, base64.RawURLEncoding.EncodeToString(ca.PublicKey.(ed25519.PublicKey)), jwks.Keys[0].X)
+}
+
+func TestMSPExport(t *testing.T) {
+
+	// testing missing admin token
+	req := httptest.NewRequest(http.MethodGet, "/admin/msp", nil)
+	rec := httptest.NewRecorder()
+	verify.ec.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+
+	// testing wrong admin token
+	req = httptest.NewRequest(http.MethodGet, "/admin/msp", nil)
+	req.Header.Set(echo.HeaderAuthorization, "Bearer wrongtoken")
+	rec = httptest.NewRecorder()
+	verify.ec.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+
+	// testing CA msp
+	req = httptest.NewRequest(http.MethodGet, "/admin/msp", nil)
+	req.Header.Set(echo.HeaderAuthorization, "Bearer "+admin)
+	rec = httptest.NewRecorder()
+	verify.ec.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, MIMEApplicationGzip, rec.Header().Get(echo.HeaderContentType))
+
+	// testing binding error
+	req = httptest.NewRequest(http.MethodPost, "/admin/msp", strings.NewReader(errjson))
+	req.Header.Set(echo.HeaderAuthorization, "Bearer "+admin)
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	rec = httptest.NewRecorder()
+	verify.ec.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+
+	// testing unsigned cert
+	f, _ := os.Open("./testdata/cert_unsigned.pem")
+	data, _ := io.ReadAll(f)
+	data, _ = json.Marshal(&CACert{string(data)})
+	req = httptest.NewRequest(http.MethodPost, "/admin/msp", bytes.NewReader(data))
+	req.Header.Set(echo.HeaderAuthorization, "Bearer "+admin)
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	rec = httptest.NewRecorder()
+	verify.ec.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+
+	// testing issued cert msp
+	data, _ = json.Marshal(&cacert)
+	req = httptest.NewRequest(http.MethodPost, "/admin/msp", bytes.NewReader(data))
+	req.Header.Set(echo.HeaderAuthorization, "Bearer "+admin)
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	rec = httptest.NewRecorder()
+	verify.ec.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusOK, rec.Code)
+}
+
+func TestThresholdCluster(t *testing.T) {
+
+	l, _ := zap.NewProduction()
+	logger := l.Sugar()
+
+	priv, _ := cert.LoadPrivateKey("./testdata/priv.pem")
+	group, shares, err := frost.Split(priv, 2, 3, rand.Reader)
+	assert.NoError(t, err)
+
+	chain, err := cert.LoadCertificateChain("./testdata/cert.pem")
+	assert.NoError(t, err)
+
+	var participants []threshold.Participant
+
+	for i, share := range shares {
+		node := NewVerificationServer("127.0.0.1", 0, nil, nil, nil, nil,
+			WithThresholdSigner(threshold.NewSigner(logger, share, chain[0]), "token"))
+		srv := httptest.NewServer(node.ec)
+		defer srv.Close()
+		token := "token"
+		if i == 0 {
+			// the first node refuses the coordinator
+			token = "wrong"
+		}
+		participants = append(participants, threshold.NewRemote(srv.URL, token))
+	}
+
+	coord, err := threshold.NewCoordinator(logger, group, threshold.WithParticipants(participants...))
+	assert.NoError(t, err)
+
+	cm, err := cert.NewCertManager(
+		logger,
+		cert.WithCertificate("./testdata/cert.pem"),
+		cert.WithSigner(coord),
+		cert.WithCache(mockcache.NewMockCache()),
+	)
+	assert.NoError(t, err)
+
+	pub, _, _ := ed25519.GenerateKey(nil)
+	issued, verr := cm.SignCSR(base64.StdEncoding.EncodeToString(pub))
+	assert.Nil(t, verr)
+
+	_, verr = verify.cm.VerifyCert(issued)
+	assert.Nil(t, verr)
+
+	// signer endpoints reject malformed requests
+	node := NewVerificationServer("127.0.0.1", 0, nil, nil, nil, nil,
+		WithThresholdSigner(threshold.NewSigner(logger, shares[0], chain[0]), "token"))
+
+	req := httptest.NewRequest(http.MethodPost, "/threshold/sign", strings.NewReader(errjson))
+	req.Header.Set(echo.HeaderAuthorization, "Bearer token")
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	rec := httptest.NewRecorder()
+	node.ec.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+
+	data, _ := json.Marshal(&threshold.SignRequest{Message: []byte("msg")})
+	req = httptest.NewRequest(http.MethodPost, "/threshold/sign", bytes.NewReader(data))
+	req.Header.Set(echo.HeaderAuthorization, "Bearer token")
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	rec = httptest.NewRecorder()
+	node.ec.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+
+	// the token alone does not get arbitrary messages signed
+	req = httptest.NewRequest(http.MethodPost, "/threshold/commit", nil)
+	req.Header.Set(echo.HeaderAuthorization, "Bearer token")
+	rec = httptest.NewRecorder()
+	node.ec.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	var commitment frost.Commitment
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &commitment))
+
+	data, _ = json.Marshal(&threshold.SignRequest{Message: []byte("msg"), Commitments: []frost.Commitment{commitment}})
+	req = httptest.NewRequest(http.MethodPost, "/threshold/sign", bytes.NewReader(data))
+	req.Header.Set(echo.HeaderAuthorization, "Bearer token")
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	rec = httptest.NewRecorder()
+	node.ec.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+}
+
+// acmePost sends a JWS signed by priv to url, identified by kid when set.
+func acmePost(t *testing.T, priv ed25519.PrivateKey, kid string, url string, payload interface{}) *httptest.ResponseRecorder {
+
+	rec := httptest.NewRecorder()
+	verify.ec.ServeHTTP(rec, httptest.NewRequest(http.MethodHead, "/acme/new-nonce", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	header := acme.Header{Alg: "EdDSA", Nonce: rec.Header().Get(HeaderReplayNonce), URL: url}
+
+	if kid == "" {
+		header.JWK = &acme.JWK{Kty: "OKP", Crv: "Ed25519", X: base64.RawURLEncoding.EncodeToString(priv.Public().(ed25519.PublicKey))}
+	} else {
+		header.Kid = kid
+	}
+
+	protected, _ := json.Marshal(&header)
+
+	var body []byte
+
+	if payload != nil {
+		body, _ = json.Marshal(payload)
+	}
+
+	jws := acme.JWS{
+		Protected: base64.RawURLEncoding.EncodeToString(protected),
+		Payload:   base64.RawURLEncoding.EncodeToString(body),
+	}
+	jws.Signature = base64.RawURLEncoding.EncodeToString(ed25519.Sign(priv, []byte(jws.Protected+"."+jws.Payload)))
+
+	data, _ := json.Marshal(&jws)
+
+	req := httptest.NewRequest(http.MethodPost, url, bytes.NewReader(data))
+	req.Header.Set(echo.HeaderContentType, acme.MIMEApplicationJOSE)
+	rec = httptest.NewRecorder()
+	verify.ec.ServeHTTP(rec, req)
+
+	assert.NotEmpty(t, rec.Header().Get(HeaderReplayNonce))
+
+	return rec
+}
+
+func TestACMEIssuance(t *testing.T) {
+
+	rec := httptest.NewRecorder()
+	verify.ec.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/acme/directory", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	var dir acme.Directory
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &dir))
+	assert.Equal(t, "http://example.com/acme/new-account", dir.NewAccount)
+
+	rec = httptest.NewRecorder()
+	verify.ec.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, dir.NewNonce, nil))
+	assert.Equal(t, http.StatusNoContent, rec.Code)
+	assert.NotEmpty(t, rec.Header().Get(HeaderReplayNonce))
+
+	_, accpriv, _ := ed25519.GenerateKey(nil)
+
+	rec = acmePost(t, accpriv, "", dir.NewAccount, &acme.AccountRequest{TermsOfServiceAgreed: true})
+	assert.Equal(t, http.StatusCreated, rec.Code)
+	kid := rec.Header().Get(echo.HeaderLocation)
+
+	rec = acmePost(t, accpriv, "", dir.NewAccount, &acme.AccountRequest{})
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, kid, rec.Header().Get(echo.HeaderLocation))
+
+	rec = acmePost(t, accpriv, kid, kid, nil)
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	pub, priv, _ := ed25519.GenerateKey(nil)
+	pubb64 := base64.StdEncoding.EncodeToString(pub)
+
+	rec = acmePost(t, accpriv, kid, dir.NewOrder, &acme.OrderRequest{Identifiers: []acme.Identifier{{Type: "dns", Value: "example.org"}}})
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Equal(t, acme.MIMEApplicationProblem, rec.Header().Get(echo.HeaderContentType))
+
+	var problem acme.Problem
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &problem))
+	assert.Equal(t, acme.ErrorNS+"rejectedIdentifier", problem.Type)
+
+	rec = acmePost(t, accpriv, kid, dir.NewOrder, &acme.OrderRequest{Identifiers: []acme.Identifier{{Type: acme.IdentifierPubKey, Value: pubb64}}})
+	assert.Equal(t, http.StatusCreated, rec.Code)
+	orderURL := rec.Header().Get(echo.HeaderLocation)
+
+	var order acme.OrderObject
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &order))
+	assert.Equal(t, acme.StatusPending, order.Status)
+
+	rec = acmePost(t, accpriv, kid, order.Authorizations[0], nil)
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	var authz acme.AuthorizationObject
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &authz))
+	challenge := authz.Challenges[0]
+	assert.Equal(t, acme.ChallengeRingSignature, challenge.Type)
+
+	csr, _ := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{}, priv)
+	finalize := &acme.FinalizeRequest{CSR: base64.RawURLEncoding.EncodeToString(csr)}
+
+	rec = acmePost(t, accpriv, kid, order.Finalize, finalize)
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+
+	// the ring signature covers the key authorization of the challenge
+	thumbprint := (&acme.JWK{Kty: "OKP", Crv: "Ed25519", X: base64.RawURLEncoding.EncodeToString(accpriv.Public().(ed25519.PublicKey))}).Thumbprint()
+	kp = km.Dispatch()
+	sigb64 := keypair.RingSign(kp, challenge.Token+"."+thumbprint)
+
+	rec = acmePost(t, accpriv, kid, challenge.URL, &acme.ChallengeRequest{Signature: sigb64})
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Header().Values("Link"), "<"+order.Authorizations[0]+">;rel=\"up\"")
+
+	var validated acme.ChallengeObject
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &validated))
+	assert.Equal(t, acme.StatusValid, validated.Status)
+
+	rec = acmePost(t, accpriv, kid, orderURL, nil)
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &order))
+	assert.Equal(t, acme.StatusReady, order.Status)
+
+	rec = acmePost(t, accpriv, kid, order.Finalize, finalize)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &order))
+	assert.Equal(t, acme.StatusValid, order.Status)
+
+	rec = acmePost(t, accpriv, kid, order.Certificate, nil)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, acme.MIMEApplicationCertChain, rec.Header().Get(echo.HeaderContentType))
+
+	leaf, rest := pem.Decode(rec.Body.Bytes())
+	assert.NotNil(t, leaf)
+	issued, err := verify.cm.VerifiedCert(pem.EncodeToMemory(leaf))
+	assert.Nil(t, err)
+	assert.Equal(t, verify.cm.Address(pub), issued.Subject.CommonName)
+	assert.Equal(t, encodeChain(verify.cm.Chain()), rest)
+
+	// a second order for the same key fails a forged challenge
+	rec = acmePost(t, accpriv, kid, dir.NewOrder, &acme.OrderRequest{Identifiers: []acme.Identifier{{Type: acme.IdentifierPubKey, Value: pubb64}}})
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &order))
+	rec = acmePost(t, accpriv, kid, order.Authorizations[0], nil)
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &authz))
+
+	rec = acmePost(t, accpriv, kid, authz.Challenges[0].URL, &acme.ChallengeRequest{Signature: sigb64})
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &validated))
+	assert.Equal(t, acme.StatusInvalid, validated.Status)
+
+	// unknown resources and unsigned requests are rejected
+	rec = acmePost(t, accpriv, kid, "http://example.com/acme/order/x", nil)
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+
+	req := httptest.NewRequest(http.MethodPost, dir.NewOrder, strings.NewReader("{}"))
+	rec = httptest.NewRecorder()
+	verify.ec.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+}
+
+func newTestCA(t *testing.T, org string, parent *x509.Certificate, signer ed25519.PrivateKey) (*x509.Certificate, ed25519.PrivateKey) {
+
+	pub, priv, _ := ed25519.GenerateKey(nil)
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: org, Organization: []string{org}},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		BasicConstraintsValid: true,
+		IsCA:                  parent == nil,
+	}
+
+	if parent == nil {
+		parent, signer = template, priv
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, pub, signer)
+	assert.NoError(t, err)
+
+	c, _ := x509.ParseCertificate(der)
+
+	return c, priv
+}
+
+func TestFederation(t *testing.T) {
+
+	l, _ := zap.NewProduction()
+	logger := l.Sugar()
+
+	operator, operatorpriv := newTestCA(t, "Campus A", nil, nil)
+	partner, partnerpriv := newTestCA(t, "Campus B", nil, nil)
+	leaf, _ := newTestCA(t, "0xpartner", partner, partnerpriv)
+
+	fr, err := federation.NewRegistry(logger, federation.WithOperators(operator))
+	assert.NoError(t, err)
+
+	cm, err := cert.NewCertManager(
+		logger,
+		cert.WithCertificate("./testdata/cert.pem"),
+		cert.WithPrivateKey("./testdata/priv.pem"),
+		cert.WithFederation(fr),
+		cert.WithCache(mc),
+	)
+	assert.NoError(t, err)
+
+	server := NewVerificationServer("0.0.0.1", 20001, nil, cm, km, nil,
+		WithAdminToken(admin),
+		WithFederation(fr),
+	)
+
+	serve := func(method string, uri string, body []byte) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, uri, bytes.NewReader(body))
+		req.Header.Set(echo.HeaderAuthorization, "Bearer "+admin)
+		req.Header.Set(echo.HeaderContentType, MIMEApplicationPEM)
+		rec := httptest.NewRecorder()
+		server.ec.ServeHTTP(rec, req)
+		return rec
+	}
+
+	leafpem := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: leaf.Raw})
+
+	rec := serve(http.MethodPost, "/cert/verify", leafpem)
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+
+	signed, err := federation.Sign(federation.NewBundle("Campus A", 1, time.Hour,
+		federation.NewPartner("Campus B", "b.example.edu", partner)), operatorpriv, operator)
+	assert.NoError(t, err)
+	data, _ := json.Marshal(signed)
+
+	rec = serve(http.MethodPost, "/admin/federation", data)
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	rec = serve(http.MethodPost, "/admin/federation", data)
+	assert.Equal(t, http.StatusConflict, rec.Code)
+
+	rec = serve(http.MethodGet, "/admin/federation", nil)
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	var bundles FederationBundles
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &bundles))
+	assert.Len(t, bundles.Bundles, 1)
+	assert.Equal(t, signed.Kid, bundles.Bundles[0].Kid)
+
+	rec = serve(http.MethodPost, "/cert/verify", leafpem)
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	var verification CertVerification
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &verification))
+	assert.Equal(t, "Campus B", verification.Organization)
+
+	rec = serve(http.MethodDelete, "/admin/federation/"+signed.Kid, nil)
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	rec = serve(http.MethodDelete, "/admin/federation/"+signed.Kid, nil)
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+
+	rec = serve(http.MethodPost, "/cert/verify", leafpem)
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
 }
 
 func TestServerStart(t *testing.T) {
@@ -0,0 +1,60 @@
+package verify
+
+import (
+	"crypto/subtle"
+	"net/http"
+
+	"github.com/Cealgull/Verify/internal/threshold"
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+)
+
+func WithThresholdSigner(signer *threshold.Signer, token string) ServerOption {
+	return func(v *VerificationServer) {
+		v.tsig = signer
+		v.ttok = token
+	}
+}
+
+func (v *VerificationServer) registerThreshold() {
+
+	if v.tsig == nil || v.ttok == "" {
+		return
+	}
+
+	g := v.ec.Group("/threshold")
+	g.Use(middleware.KeyAuth(func(key string, c echo.Context) (bool, error) {
+		return subtle.ConstantTimeCompare([]byte(key), []byte(v.ttok)) == 1, nil
+	}))
+
+	g.POST("/commit", v.thresholdCommit)
+	g.POST("/sign", v.thresholdSign)
+}
+
+func (v *VerificationServer) thresholdCommit(c echo.Context) error {
+
+	commitment, err := v.tsig.Commit(c.Request().Context())
+
+	if err != nil {
+		return c.JSON(err.Status(), err.Message())
+	}
+
+	return c.JSON(http.StatusOK, commitment)
+}
+
+func (v *VerificationServer) thresholdSign(c echo.Context) error {
+
+	var req threshold.SignRequest
+
+	if c.Bind(&req) != nil {
+		return c.JSON(berr.Status(), berr.Message())
+	}
+
+	share, err := v.tsig.Sign(c.Request().Context(), &req)
+
+	if err != nil {
+		return c.JSON(err.Status(), err.Message())
+	}
+
+	return c.JSON(http.StatusOK, share)
+}
@@ -1,24 +1,29 @@
 package main
 
 import (
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/Cealgull/Verify/internal/acme"
 	"github.com/Cealgull/Verify/internal/cache"
 	"github.com/Cealgull/Verify/internal/cert"
 	"github.com/Cealgull/Verify/internal/config"
+	"github.com/Cealgull/Verify/internal/credential"
 	"github.com/Cealgull/Verify/internal/email"
+	"github.com/Cealgull/Verify/internal/federation"
 	"github.com/Cealgull/Verify/internal/keyset"
+	"github.com/Cealgull/Verify/internal/msp"
+	"github.com/Cealgull/Verify/internal/policy"
+	"github.com/Cealgull/Verify/internal/threshold"
 	"github.com/Cealgull/Verify/internal/verify"
 	"github.com/Cealgull/Verify/pkg/turnstile"
 	"github.com/spf13/viper"
 	"go.uber.org/zap"
 )
 
-func main() {
-
-	l, _ := zap.NewProduction(
-		zap.WithCaller(true),
-	)
-
-	logger := l.Sugar()
+func loadConfig(logger *zap.SugaredLogger) *config.VerifyConfig {
 
 	logger.Debug("Loading Verification Server Configuration.")
 
@@ -42,46 +47,171 @@ func main() {
 		logger.Panic(err.Error())
 	}
 
-	logger.Debug("Initializing the email dialer.")
+	return &vericonf
+}
+
+// sendTimeout is the longest an SMTP delivery may take on any route.
+func sendTimeout(vericonf *config.VerifyConfig) time.Duration {
+
+	timeout := vericonf.Email.Dialer.Connect + vericonf.Email.Dialer.Send
+
+	for _, conf := range vericonf.Email.Domains {
+		if t := conf.Dialer.Connect + conf.Dialer.Send; t > timeout {
+			timeout = t
+		}
+	}
+
+	return time.Duration(timeout) * time.Second
+}
+
+func newMailer(conf config.Dialer) (email.Mailer, error) {
+	switch conf.Backend {
+	case "", email.BackendSMTP:
+		return email.NewSMTPMailer(conf.Host, conf.Port, conf.From, conf.Secret,
+			&email.Transport{
+				Encryption:     conf.Encryption,
+				Auth:           conf.Auth,
+				ConnectTimeout: time.Duration(conf.Connect) * time.Second,
+				SendTimeout:    time.Duration(conf.Send) * time.Second,
+				CAFile:         conf.Ca,
+				CertFile:       conf.Cert,
+				KeyFile:        conf.Key,
+				Insecure:       conf.Insecure,
+				Helo:           conf.Helo,
+			},
+			email.WithPoolSize(conf.Pool),
+			email.WithIdleTimeout(time.Duration(conf.Idle)*time.Second),
+			email.WithHealthCheck(time.Duration(conf.Check)*time.Second),
+		)
+	case email.BackendSendmail:
+		return email.NewSendmailMailer(conf.Sendmail), nil
+	case email.BackendMaildir:
+		return email.NewMaildirMailer(conf.Maildir)
+	case email.BackendHTTP:
+		return email.NewHTTPMailer(conf.Endpoint, conf.Token), nil
+	}
+	return nil, &email.BackendError{Backend: conf.Backend}
+}
+
+func newEmailDialer(logger *zap.SugaredLogger, conf config.Dialer, extra ...email.DialerOption) *email.EmailDialer {
+
+	mailer, err := newMailer(conf)
+
+	if err != nil {
+		logger.Panic(err.Error())
+	}
+
+	options := append([]email.DialerOption{email.WithMailer(mailer, conf.From)}, extra...)
+
+	if conf.Dkim.Key != "" {
+
+		logger.Debug("Loading the DKIM signing key.")
+
+		d, err := email.LoadDKIM(conf.Dkim.Domain, conf.Dkim.Selector, conf.Dkim.Key, conf.Dkim.Headers)
+
+		if err != nil {
+			logger.Panic(err.Error())
+		}
+
+		options = append(options, email.WithDKIM(d))
+	}
+
+	dialer, err := email.NewEmailDialer(logger, options...)
+
+	if err != nil {
+		logger.Panic(err.Error())
+	}
+
+	return dialer
+}
+
+func newThresholdSigner(logger *zap.SugaredLogger, vericonf *config.VerifyConfig) *threshold.Signer {
+
+	if vericonf.Threshold.Share == "" {
+		return nil
+	}
+
+	logger.Debug("Loading the threshold key share.")
+
+	share, err := threshold.LoadShare(vericonf.Threshold.Share)
+
+	if err != nil {
+		logger.Panic(err.Error())
+	}
+
+	chain, err := cert.LoadCertificateChain(vericonf.Cert.Cert)
+
+	if err != nil {
+		logger.Panic(err.Error())
+	}
+
+	return threshold.NewSigner(logger, share, chain[0])
+}
+
+func newCoordinator(logger *zap.SugaredLogger, vericonf *config.VerifyConfig, local *threshold.Signer) *threshold.Coordinator {
+
+	if vericonf.Threshold.Group == "" {
+		return nil
+	}
+
+	logger.Debug("Initializing the threshold signing coordinator.")
 
-	dialer, err := email.NewEmailDialer(
+	group, err := threshold.LoadGroup(vericonf.Threshold.Group)
+
+	if err != nil {
+		logger.Panic(err.Error())
+	}
+
+	var participants []threshold.Participant
+
+	if local != nil {
+		participants = append(participants, local)
+	}
+
+	for _, url := range vericonf.Threshold.Signers {
+		participants = append(participants, threshold.NewRemote(url, vericonf.Threshold.Token))
+	}
+
+	coord, err := threshold.NewCoordinator(
 		logger,
-		email.WithClient(vericonf.Email.Dialer.Host,
-			vericonf.Email.Dialer.Port,
-			vericonf.Email.Dialer.From,
-			vericonf.Email.Dialer.Secret),
-		email.WithToDom(vericonf.Email.Dialer.Todom),
-		email.WithSubject(vericonf.Email.Dialer.Subject),
+		group,
+		threshold.WithParticipants(participants...),
 	)
 
 	if err != nil {
 		logger.Panic(err.Error())
 	}
 
-	logger.Debug("Registering Redis cache for email manager.")
+	return coord
+}
 
-	c := cache.NewRedis(vericonf.Email.Redis.Host,
-		vericonf.Email.Redis.Port,
-		vericonf.Email.Redis.User,
-		vericonf.Email.Redis.Secret,
-		vericonf.Email.Redis.DB)
+func newPolicy(logger *zap.SugaredLogger, vericonf *config.VerifyConfig, c cache.Cache) *policy.Policy {
 
-	em, err := email.NewEmailManager(
+	logger.Debug("Loading the issuance policy.")
+
+	p, err := policy.NewPolicy(
 		logger,
-		email.WithCodeExp(vericonf.Email.Coderule),
-		email.WithEmailDialer(dialer),
-		email.WithCache(c),
-		email.WithAccExp(vericonf.Email.Accrule),
-		email.WithEmailTemplate(vericonf.Email.Template),
+		policy.WithMaxResigns(vericonf.Policy.Resigns),
+		policy.WithAlgorithms(vericonf.Policy.Algorithms...),
+		policy.WithForbiddenKeys(vericonf.Policy.Forbidden...),
+		policy.WithWindows(vericonf.Policy.Windows...),
+		policy.WithLocation(vericonf.Policy.Timezone),
+		policy.WithEpochCap(vericonf.Policy.Epoch, vericonf.Policy.Cap),
+		policy.WithCache(c),
 	)
 
 	if err != nil {
 		logger.Panic(err.Error())
 	}
 
+	return p
+}
+
+func newCertManager(logger *zap.SugaredLogger, vericonf *config.VerifyConfig, extra ...cert.Option) *cert.CertManager {
+
 	logger.Debug("Registering public key storage.")
 
-	c = cache.NewRedis(vericonf.Email.Redis.Host,
+	c := cache.NewRedis(vericonf.Email.Redis.Host,
 		vericonf.Email.Redis.Port,
 		vericonf.Email.Redis.User,
 		vericonf.Email.Redis.Secret,
@@ -90,17 +220,290 @@ func main() {
 
 	logger.Debug("Initializing the certificate authority.")
 
-	cm, err := cert.NewCertManager(
-		logger,
-		cert.WithPrivateKey(vericonf.Cert.Priv),
+	var options []cert.Option
+
+	if vericonf.Cert.Priv != "" {
+		options = append(options, cert.WithPrivateKey(vericonf.Cert.Priv))
+	}
+
+	if vericonf.Cert.Anchors != "" {
+		options = append(options, cert.WithTrustAnchors(vericonf.Cert.Anchors))
+	}
+
+	options = append(options,
 		cert.WithCertificate(vericonf.Cert.Cert),
+		cert.WithBatchLimit(vericonf.Cert.Batch),
+		cert.WithPairwiseSecret(vericonf.Cert.Pairwise),
+		cert.WithPolicy(newPolicy(logger, vericonf, c)),
 		cert.WithCache(c),
 	)
 
+	cm, err := cert.NewCertManager(logger, append(options, extra...)...)
+
 	if err != nil {
 		logger.Panic(err.Error())
 	}
 
+	return cm
+}
+
+func watchCertManager(logger *zap.SugaredLogger, cm *cert.CertManager) {
+
+	logger.Debug("Watching the certificate authority files for rotation.")
+
+	if err := cm.Watch(time.Second, make(chan struct{})); err != nil {
+		logger.Warnf("Failed watching the certificate authority files. err: %s", err.Error())
+	}
+
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+
+	go func() {
+		for range hup {
+			logger.Info("Received SIGHUP, reloading the certificate authority.")
+			_ = cm.Reload()
+		}
+	}()
+}
+
+func newACMEManager(logger *zap.SugaredLogger, vericonf *config.VerifyConfig) *acme.Manager {
+
+	logger.Debug("Registering ACME resource storage.")
+
+	c := cache.NewRedis(vericonf.Email.Redis.Host,
+		vericonf.Email.Redis.Port,
+		vericonf.Email.Redis.User,
+		vericonf.Email.Redis.Secret,
+		(vericonf.Email.Redis.DB+2)%10,
+	)
+
+	am, err := acme.NewManager(
+		logger,
+		acme.WithTTL(vericonf.Acme.Ttl),
+		acme.WithCache(c),
+	)
+
+	if err != nil {
+		logger.Panic(err.Error())
+	}
+
+	return am
+}
+
+func newFederation(logger *zap.SugaredLogger, vericonf *config.VerifyConfig) *federation.Registry {
+
+	if len(vericonf.Federation.Operators) == 0 {
+		return nil
+	}
+
+	logger.Debug("Loading the federation trust bundles.")
+
+	options := []federation.Option{federation.WithOperatorFiles(vericonf.Federation.Operators...)}
+
+	if vericonf.Federation.Dir != "" {
+		options = append(options, federation.WithDirectory(vericonf.Federation.Dir))
+	}
+
+	r, err := federation.NewRegistry(logger, options...)
+
+	if err != nil {
+		logger.Panic(err.Error())
+	}
+
+	return r
+}
+
+func newCredentialManager(logger *zap.SugaredLogger, vericonf *config.VerifyConfig) *credential.Manager {
+
+	if vericonf.Credential.Key == "" {
+		return nil
+	}
+
+	logger.Debug("Loading the credential issuer key.")
+
+	c := cache.NewRedis(vericonf.Email.Redis.Host,
+		vericonf.Email.Redis.Port,
+		vericonf.Email.Redis.User,
+		vericonf.Email.Redis.Secret,
+		(vericonf.Email.Redis.DB+3)%10,
+	)
+
+	cr, err := credential.NewManager(
+		logger,
+		credential.WithKey(vericonf.Credential.Key),
+		credential.WithCache(c),
+		credential.WithIssuer(vericonf.Credential.Issuer),
+		credential.WithGroup(vericonf.Credential.Group),
+		credential.WithEpoch(vericonf.Credential.Epoch),
+	)
+
+	if err != nil {
+		logger.Panic(err.Error())
+	}
+
+	return cr
+}
+
+func newMSPExporter(logger *zap.SugaredLogger, vericonf *config.VerifyConfig) *msp.Exporter {
+
+	logger.Debug("Initializing the MSP exporter.")
+
+	me, err := msp.NewExporter(
+		logger,
+		msp.WithClientOU(vericonf.MSP.Client),
+		msp.WithPeerOU(vericonf.MSP.Peer),
+		msp.WithAdminOU(vericonf.MSP.Admin),
+		msp.WithOrdererOU(vericonf.MSP.Orderer),
+		msp.WithAdminCerts(vericonf.MSP.Admincerts),
+	)
+
+	if err != nil {
+		logger.Panic(err.Error())
+	}
+
+	return me
+}
+
+func main() {
+
+	l, _ := zap.NewProduction(
+		zap.WithCaller(true),
+	)
+
+	logger := l.Sugar()
+
+	vericonf := loadConfig(logger)
+
+	if len(os.Args) > 1 {
+		runCommand(logger, vericonf, os.Args[1], os.Args[2:])
+		return
+	}
+
+	logger.Debug("Initializing the email dialer.")
+
+	dialer := newEmailDialer(logger, vericonf.Email.Dialer,
+		email.WithToDom(vericonf.Email.Dialer.Todom),
+		email.WithSubject(vericonf.Email.Dialer.Subject),
+	)
+
+	logger.Debug("Registering Redis cache for email manager.")
+
+	c := cache.NewRedis(vericonf.Email.Redis.Host,
+		vericonf.Email.Redis.Port,
+		vericonf.Email.Redis.User,
+		vericonf.Email.Redis.Secret,
+		vericonf.Email.Redis.DB)
+
+	options := []email.ManagerOption{
+		email.WithCodeExp(vericonf.Email.Coderule),
+		email.WithEmailDialer(dialer),
+		email.WithCache(c),
+		email.WithAccExp(vericonf.Email.Accrule),
+		email.WithEmailTemplate(vericonf.Email.Template),
+		email.WithLink(vericonf.Email.Link),
+		email.WithMode(vericonf.Email.Mode),
+		email.WithCodeTTL(time.Duration(vericonf.Email.Ttl) * time.Second),
+		email.WithCooldown(time.Duration(vericonf.Email.Cooldown) * time.Second),
+		email.WithAttempts(vericonf.Email.Lockout.Attempts),
+		email.WithLockout(time.Duration(vericonf.Email.Lockout.Base)*time.Second,
+			time.Duration(vericonf.Email.Lockout.Ceiling)*time.Second),
+	}
+
+	if vericonf.Email.Secret != "" {
+		options = append(options, email.WithLinkSecret([]byte(vericonf.Email.Secret)))
+	}
+
+	if vericonf.Email.Templates.Dir != "" {
+
+		logger.Debug("Loading the email templates.")
+
+		templates, err := email.LoadTemplates(vericonf.Email.Templates.Dir, vericonf.Email.Templates.Fallback)
+
+		if err != nil {
+			logger.Panic(err.Error())
+		}
+
+		options = append(options, email.WithTemplates(templates))
+	}
+
+	for _, conf := range vericonf.Email.Domains {
+
+		logger.Debugf("Allowing recipient domain %s.", conf.Name)
+
+		doptions := []email.DomainOption{
+			email.WithDomainSubject(conf.Subject),
+			email.WithDomainTemplate(conf.Template),
+		}
+
+		if conf.Accrule != "" {
+			doptions = append(doptions, email.WithDomainAccExp(conf.Accrule))
+		}
+
+		if conf.Templates != "" {
+			templates, err := email.LoadTemplates(conf.Templates, vericonf.Email.Templates.Fallback)
+			if err != nil {
+				logger.Panic(err.Error())
+			}
+			doptions = append(doptions, email.WithDomainTemplates(templates))
+		}
+
+		if conf.Dialer.Backend != "" || conf.Dialer.Host != "" {
+			route := newEmailDialer(logger, conf.Dialer,
+				email.WithSubject(vericonf.Email.Dialer.Subject),
+			)
+			doptions = append(doptions, email.WithDomainDialer(route))
+		}
+
+		domain, err := email.NewDomain(conf.Name, doptions...)
+
+		if err != nil {
+			logger.Panic(err.Error())
+		}
+
+		options = append(options, email.WithDomains(domain))
+	}
+
+	if vericonf.Email.Queue.Workers > 0 {
+
+		logger.Debug("Starting the email delivery queue.")
+
+		q, err := email.NewQueue(logger, c,
+			email.WithWorkers(vericonf.Email.Queue.Workers),
+			email.WithRetries(vericonf.Email.Queue.Retries),
+			email.WithBackoff(time.Duration(vericonf.Email.Queue.Backoff)*time.Second,
+				time.Duration(vericonf.Email.Queue.Ceiling)*time.Second),
+			email.WithSendTimeout(sendTimeout(vericonf)),
+		)
+
+		if err != nil {
+			logger.Panic(err.Error())
+		}
+
+		options = append(options, email.WithQueue(q))
+	}
+
+	em, err := email.NewEmailManager(logger, options...)
+
+	if err != nil {
+		logger.Panic(err.Error())
+	}
+
+	defer em.Close()
+
+	tsig := newThresholdSigner(logger, vericonf)
+
+	var signing []cert.Option
+
+	if coord := newCoordinator(logger, vericonf, tsig); coord != nil {
+		signing = append(signing, cert.WithSigner(coord))
+	}
+
+	fr := newFederation(logger, vericonf)
+
+	cm := newCertManager(logger, vericonf, append(signing, cert.WithFederation(fr))...)
+
+	watchCertManager(logger, cm)
+
 	logger.Debug("Initializing the signing utility.")
 
 	km, err := keyset.NewKeyManager(
@@ -119,7 +522,16 @@ func main() {
 
 	server := verify.NewVerificationServer(
 		vericonf.Verify.Host, vericonf.Verify.Port,
-		em, cm, km, ts)
+		em, cm, km, ts,
+		verify.WithAdminToken(vericonf.Verify.Admin),
+		verify.WithMSPExporter(newMSPExporter(logger, vericonf)),
+		verify.WithCAName(vericonf.Fabric.Caname),
+		verify.WithCAMaxAge(vericonf.Cert.Maxage),
+		verify.WithThresholdSigner(tsig, vericonf.Threshold.Token),
+		verify.WithACME(newACMEManager(logger, vericonf), vericonf.Acme.Base),
+		verify.WithFederation(fr),
+		verify.WithCredentials(newCredentialManager(logger, vericonf)),
+	)
 
 	logger.Info("Starting the server now.")
 
@@ -0,0 +1,289 @@
+// Package bbs implements BBS signatures over BLS12-381 following the
+// structure of draft-irtf-cfrg-bbs-signatures. A signature covers an
+// ordered list of messages, and its holder can derive zero-knowledge
+// proofs disclosing any subset of them. Proofs derived from the same
+// signature are unlinkable. The domain separation tags are specific to
+// this package, so keys and signatures do not interoperate with other
+// implementations of the draft.
+package bbs
+
+import (
+	"crypto"
+	"encoding/binary"
+	"errors"
+	"sync"
+
+	bls "github.com/cloudflare/circl/ecc/bls12381"
+	"github.com/cloudflare/circl/expander"
+)
+
+const apiID = "CEALGULL_BBS_BLS12381G1_XMD:SHA-256_SSWU_RO_"
+
+const (
+	// SecretKeySize is the length of an encoded secret key.
+	SecretKeySize = bls.ScalarSize
+	// PublicKeySize is the length of an encoded public key.
+	PublicKeySize = bls.G2SizeCompressed
+	// SignatureSize is the length of an encoded signature.
+	SignatureSize = bls.G1SizeCompressed + bls.ScalarSize
+)
+
+var (
+	ErrKeyMaterial = errors.New("bbs: key material shorter than 32 bytes")
+	ErrEncoding    = errors.New("bbs: invalid scalar or point encoding")
+	ErrMessages    = errors.New("bbs: message count does not match")
+	ErrIndex       = errors.New("bbs: disclosed index out of range or not ascending")
+	ErrSignature   = errors.New("bbs: signature verification failed")
+	ErrProof       = errors.New("bbs: proof verification failed")
+)
+
+type SecretKey struct {
+	x bls.Scalar
+}
+
+type PublicKey struct {
+	w bls.G2
+}
+
+type Signature struct {
+	a bls.G1
+	e bls.Scalar
+}
+
+type generators struct {
+	mtx sync.Mutex
+	p1  *bls.G1
+	q1  *bls.G1
+	h   []*bls.G1
+}
+
+var gens generators
+
+// get returns P1, Q1 and the first n message generators, deriving and
+// caching any that were not needed before.
+func (g *generators) get(n int) (*bls.G1, *bls.G1, []*bls.G1) {
+
+	g.mtx.Lock()
+	defer g.mtx.Unlock()
+
+	dst := []byte(apiID + "SIG_GENERATOR_DST_")
+
+	if g.p1 == nil {
+		g.p1, g.q1 = new(bls.G1), new(bls.G1)
+		g.p1.Hash([]byte(apiID+"BP_MESSAGE_GENERATOR_SEED"), dst)
+		g.q1.Hash(i2osp(0, 8), dst)
+	}
+
+	for i := len(g.h); i < n; i++ {
+		h := new(bls.G1)
+		h.Hash(i2osp(uint64(i+1), 8), dst)
+		g.h = append(g.h, h)
+	}
+
+	return g.p1, g.q1, g.h[:n]
+}
+
+func i2osp(n uint64, size int) []byte {
+	b := make([]byte, 8)
+	binary.BigEndian.PutUint64(b, n)
+	return b[8-size:]
+}
+
+func hashToScalar(msg []byte, dst string) *bls.Scalar {
+	uniform := expander.NewExpanderMD(crypto.SHA256, []byte(apiID+dst)).Expand(msg, 48)
+	s := new(bls.Scalar)
+	s.SetBytes(uniform)
+	return s
+}
+
+func scalarBytes(s *bls.Scalar) []byte {
+	b, _ := s.MarshalBinary()
+	return b
+}
+
+func decodeScalar(b []byte) (*bls.Scalar, error) {
+	s := new(bls.Scalar)
+	if len(b) != bls.ScalarSize || s.UnmarshalBinary(b) != nil {
+		return nil, ErrEncoding
+	}
+	return s, nil
+}
+
+func decodeG1(b []byte) (*bls.G1, error) {
+	g := new(bls.G1)
+	if len(b) != bls.G1SizeCompressed || b[0]&0x80 == 0 || g.SetBytes(b) != nil || g.IsIdentity() {
+		return nil, ErrEncoding
+	}
+	return g, nil
+}
+
+// messageScalars maps the messages to scalars.
+func messageScalars(msgs [][]byte) []*bls.Scalar {
+	scalars := make([]*bls.Scalar, len(msgs))
+	for i, m := range msgs {
+		scalars[i] = hashToScalar(m, "MAP_MSG_TO_SCALAR_AS_HASH_")
+	}
+	return scalars
+}
+
+// domain binds the key, the generators and the header.
+func domain(pk *PublicKey, q1 *bls.G1, h []*bls.G1, header []byte) *bls.Scalar {
+
+	buf := append([]byte{}, pk.w.BytesCompressed()...)
+	buf = append(buf, i2osp(uint64(len(h)), 8)...)
+	buf = append(buf, q1.BytesCompressed()...)
+
+	for _, g := range h {
+		buf = append(buf, g.BytesCompressed()...)
+	}
+
+	buf = append(buf, []byte(apiID)...)
+	buf = append(buf, i2osp(uint64(len(header)), 8)...)
+	buf = append(buf, header...)
+
+	return hashToScalar(buf, "H2S_")
+}
+
+// commitment computes B = P1 + Q1 * domain + H_1 * m_1 + ... + H_L * m_L.
+func commitment(p1 *bls.G1, q1 *bls.G1, h []*bls.G1, dom *bls.Scalar, msgs []*bls.Scalar) *bls.G1 {
+
+	b, t := new(bls.G1), new(bls.G1)
+	*b = *p1
+	t.ScalarMult(dom, q1)
+	b.Add(b, t)
+
+	for i, m := range msgs {
+		t.ScalarMult(m, h[i])
+		b.Add(b, t)
+	}
+
+	return b
+}
+
+// KeyGen derives a secret key from at least 32 bytes of key material.
+func KeyGen(material []byte, info []byte) (*SecretKey, error) {
+
+	if len(material) < 32 {
+		return nil, ErrKeyMaterial
+	}
+
+	buf := append(append([]byte{}, material...), i2osp(uint64(len(info)), 2)...)
+	buf = append(buf, info...)
+
+	sk := &SecretKey{x: *hashToScalar(buf, "KEYGEN_DST_")}
+
+	if sk.x.IsZero() == 1 {
+		return nil, ErrKeyMaterial
+	}
+
+	return sk, nil
+}
+
+func (sk *SecretKey) Bytes() []byte {
+	return scalarBytes(&sk.x)
+}
+
+func (sk *SecretKey) SetBytes(b []byte) error {
+	x, err := decodeScalar(b)
+	if err != nil || x.IsZero() == 1 {
+		return ErrEncoding
+	}
+	sk.x = *x
+	return nil
+}
+
+func (sk *SecretKey) PublicKey() *PublicKey {
+	pk := &PublicKey{}
+	pk.w.ScalarMult(&sk.x, bls.G2Generator())
+	return pk
+}
+
+func (pk *PublicKey) Bytes() []byte {
+	return pk.w.BytesCompressed()
+}
+
+func (pk *PublicKey) SetBytes(b []byte) error {
+	if len(b) != bls.G2SizeCompressed || b[0]&0x80 == 0 || pk.w.SetBytes(b) != nil || pk.w.IsIdentity() {
+		return ErrEncoding
+	}
+	return nil
+}
+
+func (s *Signature) Bytes() []byte {
+	return append(s.a.BytesCompressed(), scalarBytes(&s.e)...)
+}
+
+func (s *Signature) SetBytes(b []byte) error {
+
+	if len(b) != SignatureSize {
+		return ErrEncoding
+	}
+
+	a, err := decodeG1(b[:bls.G1SizeCompressed])
+
+	if err != nil {
+		return err
+	}
+
+	e, err := decodeScalar(b[bls.G1SizeCompressed:])
+
+	if err != nil {
+		return err
+	}
+
+	s.a, s.e = *a, *e
+
+	return nil
+}
+
+// Sign signs the messages under the header, which is bound to the
+// signature but not part of the messages a proof can hide.
+func Sign(sk *SecretKey, pk *PublicKey, header []byte, msgs [][]byte) (*Signature, error) {
+
+	p1, q1, h := gens.get(len(msgs))
+	dom := domain(pk, q1, h, header)
+	scalars := messageScalars(msgs)
+
+	buf := append([]byte{}, sk.Bytes()...)
+	for _, m := range scalars {
+		buf = append(buf, scalarBytes(m)...)
+	}
+	buf = append(buf, scalarBytes(dom)...)
+
+	e := hashToScalar(buf, "H2S_")
+
+	b := commitment(p1, q1, h, dom, scalars)
+
+	inv := new(bls.Scalar)
+	inv.Add(&sk.x, e)
+
+	if inv.IsZero() == 1 {
+		return nil, ErrSignature
+	}
+
+	inv.Inv(inv)
+
+	sig := &Signature{e: *e}
+	sig.a.ScalarMult(inv, b)
+
+	return sig, nil
+}
+
+// Verify checks e(A, W + BP2 * e) * e(B, -BP2) == 1.
+func Verify(pk *PublicKey, sig *Signature, header []byte, msgs [][]byte) error {
+
+	p1, q1, h := gens.get(len(msgs))
+	b := commitment(p1, q1, h, domain(pk, q1, h, header), messageScalars(msgs))
+
+	w := new(bls.G2)
+	w.ScalarMult(&sig.e, bls.G2Generator())
+	w.Add(w, &pk.w)
+
+	a := sig.a
+
+	if !bls.ProdPairFrac([]*bls.G1{&a, b}, []*bls.G2{w, bls.G2Generator()}, []int{1, -1}).IsIdentity() {
+		return ErrSignature
+	}
+
+	return nil
+}
@@ -0,0 +1,149 @@
+package bbs
+
+import (
+	"bytes"
+	"crypto/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var material = bytes.Repeat([]byte{0x42}, 32)
+
+func newKeys(t *testing.T) (*SecretKey, *PublicKey) {
+	sk, err := KeyGen(material, []byte("test"))
+	assert.NoError(t, err)
+	return sk, sk.PublicKey()
+}
+
+func TestKeys(t *testing.T) {
+
+	_, err := KeyGen(material[:31], nil)
+	assert.Equal(t, ErrKeyMaterial, err)
+
+	sk, pk := newKeys(t)
+
+	other, err := KeyGen(material, []byte("other"))
+	assert.NoError(t, err)
+	assert.NotEqual(t, sk.Bytes(), other.Bytes())
+
+	var decoded SecretKey
+	assert.NoError(t, decoded.SetBytes(sk.Bytes()))
+	assert.Equal(t, pk.Bytes(), decoded.PublicKey().Bytes())
+	assert.Equal(t, ErrEncoding, decoded.SetBytes(make([]byte, SecretKeySize)))
+	assert.Equal(t, ErrEncoding, decoded.SetBytes(bytes.Repeat([]byte{0xff}, SecretKeySize)))
+	assert.Equal(t, ErrEncoding, decoded.SetBytes(sk.Bytes()[1:]))
+
+	var pub PublicKey
+	assert.Len(t, pk.Bytes(), PublicKeySize)
+	assert.NoError(t, pub.SetBytes(pk.Bytes()))
+	assert.Equal(t, ErrEncoding, pub.SetBytes(pk.Bytes()[1:]))
+	infinity := make([]byte, PublicKeySize)
+	infinity[0] = 0xc0
+	assert.Equal(t, ErrEncoding, pub.SetBytes(infinity))
+}
+
+func TestSignVerify(t *testing.T) {
+
+	sk, pk := newKeys(t)
+	header := []byte("credential")
+	msgs := [][]byte{[]byte("secret"), []byte("Cealgull"), []byte("students"), []byte("2024")}
+
+	sig, err := Sign(sk, pk, header, msgs)
+	assert.NoError(t, err)
+	assert.NoError(t, Verify(pk, sig, header, msgs))
+
+	// signatures are deterministic
+	again, _ := Sign(sk, pk, header, msgs)
+	assert.Equal(t, sig.Bytes(), again.Bytes())
+
+	var decoded Signature
+	assert.Len(t, sig.Bytes(), SignatureSize)
+	assert.NoError(t, decoded.SetBytes(sig.Bytes()))
+	assert.NoError(t, Verify(pk, &decoded, header, msgs))
+
+	assert.Equal(t, ErrSignature, Verify(pk, sig, []byte("other"), msgs))
+	assert.Equal(t, ErrSignature, Verify(pk, sig, header, msgs[:3]))
+	assert.Equal(t, ErrSignature, Verify(pk, sig, header, [][]byte{msgs[0], msgs[1], msgs[2], []byte("2025")}))
+
+	_, otherpk := func() (*SecretKey, *PublicKey) {
+		sk, _ := KeyGen(material, []byte("other"))
+		return sk, sk.PublicKey()
+	}()
+	assert.Equal(t, ErrSignature, Verify(otherpk, sig, header, msgs))
+
+	assert.Equal(t, ErrEncoding, decoded.SetBytes(sig.Bytes()[1:]))
+	broken := sig.Bytes()
+	broken[0] &= 0x7f
+	assert.Equal(t, ErrEncoding, decoded.SetBytes(broken))
+	broken = sig.Bytes()
+	copy(broken[SignatureSize-SecretKeySize:], bytes.Repeat([]byte{0xff}, SecretKeySize))
+	assert.Equal(t, ErrEncoding, decoded.SetBytes(broken))
+
+	empty, err := Sign(sk, pk, nil, nil)
+	assert.NoError(t, err)
+	assert.NoError(t, Verify(pk, empty, nil, nil))
+}
+
+func TestProof(t *testing.T) {
+
+	sk, pk := newKeys(t)
+	header := []byte("credential")
+	ph := []byte("nonce")
+	msgs := [][]byte{[]byte("secret"), []byte("Cealgull"), []byte("students"), []byte("2024")}
+
+	sig, err := Sign(sk, pk, header, msgs)
+	assert.NoError(t, err)
+
+	for _, disclosed := range [][]int{{}, {1}, {2, 3}, {0, 1, 2, 3}} {
+
+		shown := make([][]byte, len(disclosed))
+		for k, i := range disclosed {
+			shown[k] = msgs[i]
+		}
+
+		proof, err := ProofGen(pk, sig, header, ph, msgs, disclosed, rand.Reader)
+		assert.NoError(t, err)
+		assert.Len(t, proof, proofFixedSize+32*(len(msgs)-len(disclosed)))
+		assert.NoError(t, ProofVerify(pk, proof, header, ph, shown, disclosed), disclosed)
+
+		// proofs of the same signature share no bytes an observer could link
+		other, _ := ProofGen(pk, sig, header, ph, msgs, disclosed, rand.Reader)
+		assert.NotEqual(t, proof[:48], other[:48])
+
+		assert.Equal(t, ErrProof, ProofVerify(pk, proof, header, []byte("replayed"), shown, disclosed))
+		assert.Equal(t, ErrProof, ProofVerify(pk, proof, []byte("other"), ph, shown, disclosed))
+	}
+
+	proof, err := ProofGen(pk, sig, header, ph, msgs, []int{2, 3}, rand.Reader)
+	assert.NoError(t, err)
+
+	assert.Equal(t, ErrProof, ProofVerify(pk, proof, header, ph, [][]byte{[]byte("teachers"), msgs[3]}, []int{2, 3}))
+	assert.Equal(t, ErrProof, ProofVerify(pk, proof, header, ph, [][]byte{msgs[1], msgs[3]}, []int{1, 3}))
+	assert.Equal(t, ErrProof, ProofVerify(pk, proof, header, ph, msgs[2:3], []int{2, 3}))
+	assert.Equal(t, ErrProof, ProofVerify(pk, proof[:len(proof)-1], header, ph, msgs[2:], []int{2, 3}))
+	assert.Equal(t, ErrProof, ProofVerify(pk, proof[:100], header, ph, msgs[2:], []int{2, 3}))
+	assert.Equal(t, ErrIndex, ProofVerify(pk, proof, header, ph, msgs[2:], []int{3, 2}))
+	assert.Equal(t, ErrIndex, ProofVerify(pk, proof, header, ph, msgs[2:], []int{2, 4}))
+
+	broken := append([]byte{}, proof...)
+	broken[0] &= 0x7f
+	assert.Equal(t, ErrProof, ProofVerify(pk, broken, header, ph, msgs[2:], []int{2, 3}))
+
+	broken = append([]byte{}, proof...)
+	copy(broken[len(broken)-32:], bytes.Repeat([]byte{0xff}, 32))
+	assert.Equal(t, ErrProof, ProofVerify(pk, broken, header, ph, msgs[2:], []int{2, 3}))
+
+	// a forged signature cannot produce a valid proof
+	forged, err := Sign(sk, pk, header, [][]byte{msgs[0], msgs[1], []byte("teachers"), msgs[3]})
+	assert.NoError(t, err)
+	proof, err = ProofGen(pk, forged, header, ph, msgs, []int{2, 3}, rand.Reader)
+	assert.NoError(t, err)
+	assert.Equal(t, ErrProof, ProofVerify(pk, proof, header, ph, msgs[2:], []int{2, 3}))
+
+	_, err = ProofGen(pk, sig, header, ph, msgs, []int{4}, rand.Reader)
+	assert.Equal(t, ErrIndex, err)
+
+	_, err = ProofGen(pk, sig, header, ph, msgs, nil, bytes.NewReader(nil))
+	assert.Error(t, err)
+}
@@ -0,0 +1,222 @@
+package bbs
+
+import (
+	"io"
+
+	bls "github.com/cloudflare/circl/ecc/bls12381"
+)
+
+const proofFixedSize = 3*bls.G1SizeCompressed + 4*bls.ScalarSize
+
+// checkIndexes validates the disclosed indexes, which must be ascending and
+// smaller than n, and returns the undisclosed ones.
+func checkIndexes(disclosed []int, n int) ([]int, error) {
+
+	var undisclosed []int
+	next := 0
+
+	for i := 0; i < n; i++ {
+		if next < len(disclosed) && disclosed[next] == i {
+			next++
+			continue
+		}
+		undisclosed = append(undisclosed, i)
+	}
+
+	if next != len(disclosed) {
+		return nil, ErrIndex
+	}
+
+	return undisclosed, nil
+}
+
+func challenge(abar, bbar, d, t1, t2 *bls.G1, disclosed []int, msgs []*bls.Scalar, dom *bls.Scalar, ph []byte) *bls.Scalar {
+
+	buf := i2osp(uint64(len(disclosed)), 8)
+
+	for k, i := range disclosed {
+		buf = append(buf, i2osp(uint64(i), 8)...)
+		buf = append(buf, scalarBytes(msgs[k])...)
+	}
+
+	for _, p := range []*bls.G1{abar, bbar, d, t1, t2} {
+		buf = append(buf, p.BytesCompressed()...)
+	}
+
+	buf = append(buf, scalarBytes(dom)...)
+	buf = append(buf, i2osp(uint64(len(ph)), 8)...)
+	buf = append(buf, ph...)
+
+	return hashToScalar(buf, "H2S_")
+}
+
+func randomScalar(rand io.Reader) (*bls.Scalar, error) {
+	s := new(bls.Scalar)
+	if err := s.Random(rand); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// ProofGen derives a proof of possession of sig which discloses the
+// messages at the ascending indexes in disclosed. The presentation header
+// ph, usually a nonce of the verifier, is bound to the proof.
+func ProofGen(pk *PublicKey, sig *Signature, header []byte, ph []byte, msgs [][]byte, disclosed []int, rand io.Reader) ([]byte, error) {
+
+	undisclosed, err := checkIndexes(disclosed, len(msgs))
+
+	if err != nil {
+		return nil, err
+	}
+
+	p1, q1, h := gens.get(len(msgs))
+	dom := domain(pk, q1, h, header)
+	scalars := messageScalars(msgs)
+
+	random := make([]*bls.Scalar, 5+len(undisclosed))
+
+	for i := range random {
+		if random[i], err = randomScalar(rand); err != nil {
+			return nil, err
+		}
+	}
+
+	r1, r2, et, r1t, r3t, mt := random[0], random[1], random[2], random[3], random[4], random[5:]
+
+	b := commitment(p1, q1, h, dom, scalars)
+
+	d, abar, bbar, t1, t2, t := new(bls.G1), new(bls.G1), new(bls.G1), new(bls.G1), new(bls.G1), new(bls.G1)
+
+	d.ScalarMult(r2, b)
+
+	r1r2 := new(bls.Scalar)
+	r1r2.Mul(r1, r2)
+	abar.ScalarMult(r1r2, &sig.a)
+
+	bbar.ScalarMult(r1, d)
+	t.ScalarMult(&sig.e, abar)
+	t.Neg()
+	bbar.Add(bbar, t)
+
+	t1.ScalarMult(et, abar)
+	t.ScalarMult(r1t, d)
+	t1.Add(t1, t)
+
+	t2.ScalarMult(r3t, d)
+	for k, j := range undisclosed {
+		t.ScalarMult(mt[k], h[j])
+		t2.Add(t2, t)
+	}
+
+	shown := make([]*bls.Scalar, len(disclosed))
+	for k, i := range disclosed {
+		shown[k] = scalars[i]
+	}
+
+	c := challenge(abar, bbar, d, t1, t2, disclosed, shown, dom, ph)
+
+	r3 := new(bls.Scalar)
+	r3.Inv(r2)
+
+	// e^ = e~ + e * c, r1^ = r1~ - r1 * c, r3^ = r3~ - r3 * c
+	response := func(tilde *bls.Scalar, secret *bls.Scalar, sign int) []byte {
+		s := new(bls.Scalar)
+		s.Mul(secret, c)
+		if sign < 0 {
+			s.Neg()
+		}
+		s.Add(s, tilde)
+		return scalarBytes(s)
+	}
+
+	proof := append([]byte{}, abar.BytesCompressed()...)
+	proof = append(proof, bbar.BytesCompressed()...)
+	proof = append(proof, d.BytesCompressed()...)
+	proof = append(proof, response(et, &sig.e, 1)...)
+	proof = append(proof, response(r1t, r1, -1)...)
+	proof = append(proof, response(r3t, r3, -1)...)
+
+	for k, j := range undisclosed {
+		proof = append(proof, response(mt[k], scalars[j], 1)...)
+	}
+
+	return append(proof, scalarBytes(c)...), nil
+}
+
+// ProofVerify checks a proof against the disclosed messages, given in the
+// order of their ascending indexes in disclosed.
+func ProofVerify(pk *PublicKey, proof []byte, header []byte, ph []byte, msgs [][]byte, disclosed []int) error {
+
+	if len(proof) < proofFixedSize || (len(proof)-proofFixedSize)%bls.ScalarSize != 0 || len(msgs) != len(disclosed) {
+		return ErrProof
+	}
+
+	n := len(disclosed) + (len(proof)-proofFixedSize)/bls.ScalarSize
+
+	undisclosed, err := checkIndexes(disclosed, n)
+
+	if err != nil {
+		return err
+	}
+
+	points := make([]*bls.G1, 3)
+
+	for i := range points {
+		if points[i], err = decodeG1(proof[i*bls.G1SizeCompressed : (i+1)*bls.G1SizeCompressed]); err != nil {
+			return ErrProof
+		}
+	}
+
+	abar, bbar, d := points[0], points[1], points[2]
+
+	rest := proof[3*bls.G1SizeCompressed:]
+	scalars := make([]*bls.Scalar, len(rest)/bls.ScalarSize)
+
+	for i := range scalars {
+		if scalars[i], err = decodeScalar(rest[i*bls.ScalarSize : (i+1)*bls.ScalarSize]); err != nil {
+			return ErrProof
+		}
+	}
+
+	eh, r1h, r3h, mh, c := scalars[0], scalars[1], scalars[2], scalars[3:len(scalars)-1], scalars[len(scalars)-1]
+
+	p1, q1, h := gens.get(n)
+	dom := domain(pk, q1, h, header)
+	shown := messageScalars(msgs)
+
+	t1, t2, t := new(bls.G1), new(bls.G1), new(bls.G1)
+
+	// T1 = Bbar * c + Abar * e^ + D * r1^
+	t1.ScalarMult(c, bbar)
+	t.ScalarMult(eh, abar)
+	t1.Add(t1, t)
+	t.ScalarMult(r1h, d)
+	t1.Add(t1, t)
+
+	// T2 = Bv * c + D * r3^ + H_j * m^_j for the undisclosed j
+	bv := commitment(p1, q1, nil, dom, nil)
+
+	for k, i := range disclosed {
+		t.ScalarMult(shown[k], h[i])
+		bv.Add(bv, t)
+	}
+
+	t2.ScalarMult(c, bv)
+	t.ScalarMult(r3h, d)
+	t2.Add(t2, t)
+
+	for k, j := range undisclosed {
+		t.ScalarMult(mh[k], h[j])
+		t2.Add(t2, t)
+	}
+
+	if challenge(abar, bbar, d, t1, t2, disclosed, shown, dom, ph).IsEqual(c) != 1 {
+		return ErrProof
+	}
+
+	if !bls.ProdPairFrac([]*bls.G1{abar, bbar}, []*bls.G2{&pk.w, bls.G2Generator()}, []int{1, -1}).IsIdentity() {
+		return ErrProof
+	}
+
+	return nil
+}
@@ -0,0 +1,286 @@
+// Package c509 converts X.509 certificates to and from C509, the CBOR
+// re-encoding of draft-ietf-cose-cbor-encoded-cert. A re-encoded
+// certificate keeps the X.509 signature, so its DER encoding is rebuilt
+// byte for byte before it is verified. The supported profile is the one
+// Verify issues: v3 certificates with ed25519 keys and signatures, names
+// of single valued string attributes and the common extensions. Others
+// are rejected rather than converted lossily.
+package c509
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/x509"
+	"encoding/asn1"
+	"errors"
+	"math/big"
+	"time"
+
+	"golang.org/x/crypto/cryptobyte"
+	cbasn1 "golang.org/x/crypto/cryptobyte/asn1"
+)
+
+// MIMEType is the media type of a C509 certificate.
+const MIMEType = "application/cose-c509-cert"
+
+// TypeReencoded marks a CBOR re-encoded X.509 certificate.
+const TypeReencoded = 3
+
+const (
+	algEd25519Signature = 12
+	algEd25519Key       = 10
+)
+
+var (
+	ErrEncoding    = errors.New("c509: invalid certificate encoding")
+	ErrUnsupported = errors.New("c509: certificate outside of the supported profile")
+)
+
+var (
+	oidEd25519 = asn1.ObjectIdentifier{1, 3, 101, 112}
+
+	// C509 attribute registry, positive for utf8String and negative for
+	// printableString values
+	attributes = []asn1.ObjectIdentifier{
+		{1, 2, 840, 113549, 1, 9, 1}, // emailAddress
+		{2, 5, 4, 3},                 // commonName
+		{2, 5, 4, 4},                 // surname
+		{2, 5, 4, 5},                 // serialNumber
+		{2, 5, 4, 6},                 // countryName
+		{2, 5, 4, 7},                 // localityName
+		{2, 5, 4, 8},                 // stateOrProvinceName
+		{2, 5, 4, 9},                 // streetAddress
+		{2, 5, 4, 10},                // organizationName
+		{2, 5, 4, 11},                // organizationalUnitName
+		{2, 5, 4, 12},                // title
+	}
+
+	// C509 extension registry
+	extSubjectKeyID     = asn1.ObjectIdentifier{2, 5, 29, 14}
+	extKeyUsage         = asn1.ObjectIdentifier{2, 5, 29, 15}
+	extSubjectAltName   = asn1.ObjectIdentifier{2, 5, 29, 17}
+	extBasicConstraints = asn1.ObjectIdentifier{2, 5, 29, 19}
+	extAuthorityKeyID   = asn1.ObjectIdentifier{2, 5, 29, 35}
+
+	extensions = map[int64]asn1.ObjectIdentifier{
+		1: extSubjectKeyID,
+		2: extKeyUsage,
+		3: extSubjectAltName,
+		4: extBasicConstraints,
+		7: extAuthorityKeyID,
+	}
+
+	// the 99991231235959Z notAfter of certificates without expiry
+	noExpiry = time.Date(9999, 12, 31, 23, 59, 59, 0, time.UTC)
+)
+
+// Issuable reports whether the certificates issuer signs can be in the
+// profile at all: issuer must sign with ed25519 and have a supported name.
+func Issuable(issuer *x509.Certificate) bool {
+
+	if _, ok := issuer.PublicKey.(ed25519.PublicKey); !ok {
+		return false
+	}
+
+	_, err := encodeName(nil, issuer.RawSubject)
+
+	return err == nil
+}
+
+// FromX509 re-encodes cert as C509.
+func FromX509(cert *x509.Certificate) ([]byte, error) {
+
+	if cert.Version != 3 || cert.SignatureAlgorithm != x509.PureEd25519 ||
+		cert.PublicKeyAlgorithm != x509.Ed25519 || cert.SerialNumber.Sign() < 0 {
+		return nil, ErrUnsupported
+	}
+
+	out := appendArray(nil, 11)
+	out = appendInt(out, TypeReencoded)
+	out = appendBytes(out, cert.SerialNumber.Bytes())
+	out = appendInt(out, algEd25519Signature)
+
+	var err error
+
+	if bytes.Equal(cert.RawIssuer, cert.RawSubject) {
+		out = appendNull(out)
+	} else if out, err = encodeName(out, cert.RawIssuer); err != nil {
+		return nil, err
+	}
+
+	out = appendInt(out, cert.NotBefore.Unix())
+
+	if cert.NotAfter.Equal(noExpiry) {
+		out = appendNull(out)
+	} else {
+		out = appendInt(out, cert.NotAfter.Unix())
+	}
+
+	if out, err = encodeName(out, cert.RawSubject); err != nil {
+		return nil, err
+	}
+
+	out = appendInt(out, algEd25519Key)
+	out = appendBytes(out, cert.PublicKey.(ed25519.PublicKey))
+
+	if out, err = encodeExtensions(out, cert.Extensions); err != nil {
+		return nil, err
+	}
+
+	out = appendBytes(out, cert.Signature)
+
+	// anything the profile cannot represent exactly would break the
+	// signature of the rebuilt certificate
+	if der, err := ToX509(out); err != nil || !bytes.Equal(der, cert.Raw) {
+		return nil, ErrUnsupported
+	}
+
+	return out, nil
+}
+
+// ToX509 rebuilds the DER encoded X.509 certificate of a C509 certificate.
+func ToX509(data []byte) ([]byte, error) {
+
+	d := &decoder{data: data}
+
+	if n, err := d.array(); err != nil || n != 11 {
+		return nil, ErrEncoding
+	}
+
+	if typ, err := d.int(); err != nil || typ != TypeReencoded {
+		return nil, ErrUnsupported
+	}
+
+	serial, err := d.bytes()
+
+	if err != nil || (len(serial) > 0 && serial[0] == 0) {
+		return nil, ErrEncoding
+	}
+
+	if alg, err := d.int(); err != nil || alg != algEd25519Signature {
+		return nil, ErrUnsupported
+	}
+
+	var issuer []byte
+	selfSigned := d.null()
+
+	if !selfSigned {
+		if issuer, err = decodeName(d); err != nil {
+			return nil, err
+		}
+	}
+
+	notBefore, err := d.int()
+
+	if err != nil {
+		return nil, ErrEncoding
+	}
+
+	notAfter := noExpiry
+
+	if !d.null() {
+		t, err := d.int()
+		if err != nil {
+			return nil, ErrEncoding
+		}
+		notAfter = time.Unix(t, 0)
+	}
+
+	subject, err := decodeName(d)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if selfSigned {
+		issuer = subject
+	}
+
+	if alg, err := d.int(); err != nil || alg != algEd25519Key {
+		return nil, ErrUnsupported
+	}
+
+	pub, err := d.bytes()
+
+	if err != nil || len(pub) != ed25519.PublicKeySize {
+		return nil, ErrEncoding
+	}
+
+	exts, err := decodeExtensions(d)
+
+	if err != nil {
+		return nil, err
+	}
+
+	sig, err := d.bytes()
+
+	if err != nil || len(d.data) != 0 {
+		return nil, ErrEncoding
+	}
+
+	var b cryptobyte.Builder
+
+	b.AddASN1(cbasn1.SEQUENCE, func(b *cryptobyte.Builder) {
+		b.AddASN1(cbasn1.SEQUENCE, func(b *cryptobyte.Builder) {
+			b.AddASN1(cbasn1.Tag(0).Constructed().ContextSpecific(), func(b *cryptobyte.Builder) {
+				b.AddASN1Int64(2)
+			})
+			b.AddASN1BigInt(new(big.Int).SetBytes(serial))
+			addAlgorithm(b)
+			b.AddBytes(issuer)
+			b.AddASN1(cbasn1.SEQUENCE, func(b *cryptobyte.Builder) {
+				addTime(b, time.Unix(notBefore, 0))
+				addTime(b, notAfter)
+			})
+			b.AddBytes(subject)
+			b.AddASN1(cbasn1.SEQUENCE, func(b *cryptobyte.Builder) {
+				addAlgorithm(b)
+				b.AddASN1BitString(pub)
+			})
+			if len(exts) > 0 {
+				b.AddASN1(cbasn1.Tag(3).Constructed().ContextSpecific(), func(b *cryptobyte.Builder) {
+					b.AddASN1(cbasn1.SEQUENCE, func(b *cryptobyte.Builder) {
+						b.AddBytes(exts)
+					})
+				})
+			}
+		})
+		addAlgorithm(b)
+		b.AddASN1BitString(sig)
+	})
+
+	return b.Bytes()
+}
+
+// Parse decodes a C509 certificate into its X.509 form.
+func Parse(data []byte) (*x509.Certificate, error) {
+
+	der, err := ToX509(data)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return x509.ParseCertificate(der)
+}
+
+func addAlgorithm(b *cryptobyte.Builder) {
+	b.AddASN1(cbasn1.SEQUENCE, func(b *cryptobyte.Builder) {
+		b.AddASN1ObjectIdentifier(oidEd25519)
+	})
+}
+
+// addTime follows RFC 5280, UTCTime through 2049 and GeneralizedTime
+// otherwise.
+func addTime(b *cryptobyte.Builder, t time.Time) {
+	t = t.UTC()
+	if t.Year() >= 1950 && t.Year() < 2050 {
+		b.AddASN1(cbasn1.UTCTime, func(b *cryptobyte.Builder) {
+			b.AddBytes([]byte(t.Format("060102150405Z")))
+		})
+	} else {
+		b.AddASN1(cbasn1.GeneralizedTime, func(b *cryptobyte.Builder) {
+			b.AddBytes([]byte(t.Format("20060102150405Z")))
+		})
+	}
+}
@@ -0,0 +1,186 @@
+package c509
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"math/big"
+	"net"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var caPriv ed25519.PrivateKey
+var ca *x509.Certificate
+
+func create(t *testing.T, template *x509.Certificate, parent *x509.Certificate, pub any) *x509.Certificate {
+
+	if template.SerialNumber == nil {
+		template.SerialNumber = big.NewInt(0x1234)
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, pub, caPriv)
+	assert.NoError(t, err)
+
+	cert, err := x509.ParseCertificate(der)
+	assert.NoError(t, err)
+
+	return cert
+}
+
+func roundTrip(t *testing.T, cert *x509.Certificate) []byte {
+
+	data, err := FromX509(cert)
+	assert.NoError(t, err)
+	assert.Less(t, len(data), len(cert.Raw))
+	assert.Equal(t, byte(0x8b), data[0])
+
+	der, err := ToX509(data)
+	assert.NoError(t, err)
+	assert.Equal(t, cert.Raw, der)
+
+	parsed, err := Parse(data)
+	assert.NoError(t, err)
+	assert.NoError(t, parsed.CheckSignatureFrom(ca))
+
+	return data
+}
+
+func TestSelfSigned(t *testing.T) {
+	data := roundTrip(t, ca)
+	// the issuer of a self signed certificate is omitted
+	assert.Equal(t, byte(0xf6), data[bytes.IndexByte(data, 0x0c)+1])
+}
+
+func TestLeaf(t *testing.T) {
+
+	pub, _, _ := ed25519.GenerateKey(nil)
+	u, _ := url.Parse("https://forum.example.org")
+
+	// issued leaves carry no expiry
+	roundTrip(t, create(t, &x509.Certificate{
+		Subject: pkix.Name{
+			CommonName:         "0x0123456789abcdef",
+			Organization:       []string{"Cealgull"},
+			OrganizationalUnit: []string{"Cealgull Pairwise"},
+		},
+		NotBefore: time.Now(),
+		URIs:      []*url.URL{u},
+	}, ca, pub))
+
+	roundTrip(t, create(t, &x509.Certificate{
+		Subject:               pkix.Name{CommonName: "leaf"},
+		NotBefore:             time.Unix(0, 0),
+		NotAfter:              time.Date(9999, 12, 31, 23, 59, 59, 0, time.UTC),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageDecipherOnly,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		MaxPathLenZero:        true,
+		DNSNames:              []string{"example.org"},
+		EmailAddresses:        []string{"user@example.org"},
+		IPAddresses:           []net.IP{net.ParseIP("127.0.0.1")},
+		ExtraExtensions: []pkix.Extension{
+			{Id: asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 99999, 1}, Value: []byte{0x05, 0x00}},
+		},
+	}, ca, pub))
+
+	roundTrip(t, create(t, &x509.Certificate{
+		Subject:   pkix.Name{CommonName: "leaf"},
+		NotBefore: time.Now(),
+		NotAfter:  time.Now().AddDate(60, 0, 0),
+		DNSNames:  []string{"example.org"},
+	}, ca, pub))
+}
+
+func TestUnsupported(t *testing.T) {
+
+	pub, _, _ := ed25519.GenerateKey(nil)
+	ec, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+
+	cert := create(t, &x509.Certificate{Subject: pkix.Name{CommonName: "ecdsa"}}, ca, &ec.PublicKey)
+	_, err := FromX509(cert)
+	assert.Equal(t, ErrUnsupported, err)
+
+	// nothing an ecdsa issuer signs is in the profile
+	assert.True(t, Issuable(ca))
+	assert.False(t, Issuable(cert))
+
+	// multi valued relative distinguished names
+	cert = create(t, &x509.Certificate{
+		RawSubject: []byte{
+			0x30, 0x1a, 0x31, 0x18,
+			0x30, 0x0a, 0x06, 0x03, 0x55, 0x04, 0x03, 0x0c, 0x03, 'o', 'n', 'e',
+			0x30, 0x0a, 0x06, 0x03, 0x55, 0x04, 0x0b, 0x0c, 0x03, 't', 'w', 'o',
+		},
+	}, ca, pub)
+	_, err = FromX509(cert)
+	assert.Equal(t, ErrUnsupported, err)
+	assert.False(t, Issuable(cert))
+
+	cert = create(t, &x509.Certificate{
+		Subject: pkix.Name{CommonName: "leaf"},
+		ExtraExtensions: []pkix.Extension{
+			{Id: asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 99999, 1}, Critical: true, Value: []byte{0x05, 0x00}},
+		},
+	}, ca, pub)
+	_, err = FromX509(cert)
+	assert.Equal(t, ErrUnsupported, err)
+}
+
+func TestMalformed(t *testing.T) {
+
+	data, err := FromX509(ca)
+	assert.NoError(t, err)
+
+	for i := range data {
+		_, err := ToX509(data[:i])
+		assert.Error(t, err)
+	}
+
+	_, err = ToX509(append(data, 0))
+	assert.Equal(t, ErrEncoding, err)
+
+	// non shortest integer encoding
+	_, err = ToX509([]byte{0x8b, 0x18, 0x03})
+	assert.Equal(t, ErrEncoding, err)
+
+	// natively signed certificates
+	_, err = ToX509(append([]byte{0x8b, 0x02}, make([]byte, 16)...))
+	assert.Equal(t, ErrUnsupported, err)
+
+	_, err = Parse([]byte{0x80})
+	assert.Equal(t, ErrEncoding, err)
+}
+
+func TestMain(m *testing.M) {
+
+	pub, priv, _ := ed25519.GenerateKey(nil)
+	caPriv = priv
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject: pkix.Name{
+			Country:      []string{"CN"},
+			Organization: []string{"Cealgull"},
+			CommonName:   "Cealgull CA",
+		},
+		NotBefore:             time.Now(),
+		NotAfter:              time.Now().AddDate(10, 0, 0),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+
+	der, _ := x509.CreateCertificate(rand.Reader, template, template, pub, priv)
+	ca, _ = x509.ParseCertificate(der)
+
+	m.Run()
+}
@@ -0,0 +1,161 @@
+package c509
+
+import (
+	"encoding/binary"
+)
+
+// The subset of CBOR (RFC 8949) C509 needs: integers, byte and text
+// strings, arrays and null, all with definite lengths.
+
+const (
+	majorUint  = 0
+	majorNint  = 1
+	majorBytes = 2
+	majorText  = 3
+	majorArray = 4
+	majorOther = 7
+
+	simpleNull = 22
+)
+
+func appendHead(b []byte, major byte, n uint64) []byte {
+	switch {
+	case n < 24:
+		return append(b, major<<5|byte(n))
+	case n <= 0xff:
+		return append(b, major<<5|24, byte(n))
+	case n <= 0xffff:
+		return binary.BigEndian.AppendUint16(append(b, major<<5|25), uint16(n))
+	case n <= 0xffffffff:
+		return binary.BigEndian.AppendUint32(append(b, major<<5|26), uint32(n))
+	default:
+		return binary.BigEndian.AppendUint64(append(b, major<<5|27), n)
+	}
+}
+
+func appendInt(b []byte, n int64) []byte {
+	if n < 0 {
+		return appendHead(b, majorNint, uint64(-1-n))
+	}
+	return appendHead(b, majorUint, uint64(n))
+}
+
+func appendBytes(b []byte, data []byte) []byte {
+	return append(appendHead(b, majorBytes, uint64(len(data))), data...)
+}
+
+func appendText(b []byte, s string) []byte {
+	return append(appendHead(b, majorText, uint64(len(s))), s...)
+}
+
+func appendArray(b []byte, n int) []byte {
+	return appendHead(b, majorArray, uint64(n))
+}
+
+func appendNull(b []byte) []byte {
+	return append(b, majorOther<<5|simpleNull)
+}
+
+type decoder struct {
+	data []byte
+}
+
+// head reads the initial byte and argument of the next item. Shortest
+// form encodings are required so every certificate has a single encoding.
+func (d *decoder) head() (byte, uint64, error) {
+
+	if len(d.data) == 0 {
+		return 0, 0, ErrEncoding
+	}
+
+	major, info := d.data[0]>>5, d.data[0]&0x1f
+	d.data = d.data[1:]
+
+	if info < 24 {
+		return major, uint64(info), nil
+	}
+
+	size := map[byte]int{24: 1, 25: 2, 26: 4, 27: 8}[info]
+
+	if size == 0 || len(d.data) < size {
+		return 0, 0, ErrEncoding
+	}
+
+	var n uint64
+
+	for _, c := range d.data[:size] {
+		n = n<<8 | uint64(c)
+	}
+
+	d.data = d.data[size:]
+
+	if appendHead(nil, major, n)[0]&0x1f != info {
+		return 0, 0, ErrEncoding
+	}
+
+	return major, n, nil
+}
+
+func (d *decoder) peek() byte {
+	if len(d.data) == 0 {
+		return 0xff
+	}
+	return d.data[0] >> 5
+}
+
+func (d *decoder) null() bool {
+	if len(d.data) > 0 && d.data[0] == majorOther<<5|simpleNull {
+		d.data = d.data[1:]
+		return true
+	}
+	return false
+}
+
+func (d *decoder) int() (int64, error) {
+
+	major, n, err := d.head()
+
+	if err != nil || (major != majorUint && major != majorNint) || n > 1<<63-1 {
+		return 0, ErrEncoding
+	}
+
+	if major == majorNint {
+		return -1 - int64(n), nil
+	}
+
+	return int64(n), nil
+}
+
+func (d *decoder) string(major byte) ([]byte, error) {
+
+	m, n, err := d.head()
+
+	if err != nil || m != major || uint64(len(d.data)) < n {
+		return nil, ErrEncoding
+	}
+
+	s := d.data[:n]
+	d.data = d.data[n:]
+
+	return s, nil
+}
+
+func (d *decoder) bytes() ([]byte, error) {
+	return d.string(majorBytes)
+}
+
+func (d *decoder) text() (string, error) {
+	s, err := d.string(majorText)
+	return string(s), err
+}
+
+func (d *decoder) array() (int, error) {
+
+	major, n, err := d.head()
+
+	if err != nil || major != majorArray || n > uint64(len(d.data)) {
+		return 0, ErrEncoding
+	}
+
+	return int(n), nil
+}
@@ -0,0 +1,327 @@
+package c509
+
+import (
+	"crypto/x509/pkix"
+	"encoding/asn1"
+
+	"golang.org/x/crypto/cryptobyte"
+	cbasn1 "golang.org/x/crypto/cryptobyte/asn1"
+)
+
+// subjectAltName general names C509 registers
+var generalNames = map[int64]bool{1: false, 2: false, 6: false, 7: true}
+
+// encodeExtensions appends the flattened (extensionID, extensionValue)
+// pairs. Registered extensions use their negated ID when critical, others
+// keep their OID and DER value and must not be critical.
+func encodeExtensions(out []byte, exts []pkix.Extension) ([]byte, error) {
+
+	out = appendArray(out, 2*len(exts))
+
+	for _, ext := range exts {
+
+		id := int64(0)
+
+		for k, oid := range extensions {
+			if oid.Equal(ext.Id) {
+				id = k
+			}
+		}
+
+		if id == 0 {
+			if ext.Critical {
+				return nil, ErrUnsupported
+			}
+			var b cryptobyte.Builder
+			b.AddASN1ObjectIdentifier(ext.Id)
+			der := cryptobyte.String(b.BytesOrPanic())
+			var content cryptobyte.String
+			der.ReadASN1(&content, cbasn1.OBJECT_IDENTIFIER)
+			out = appendBytes(out, content)
+			out = appendBytes(out, ext.Value)
+			continue
+		}
+
+		if ext.Critical {
+			out = appendInt(out, -id)
+		} else {
+			out = appendInt(out, id)
+		}
+
+		var err error
+
+		if out, err = encodeExtension(out, id, ext.Value); err != nil {
+			return nil, err
+		}
+	}
+
+	return out, nil
+}
+
+func encodeExtension(out []byte, id int64, value []byte) ([]byte, error) {
+
+	in := cryptobyte.String(value)
+
+	switch id {
+
+	case 1:
+		var ski cryptobyte.String
+		if !in.ReadASN1(&ski, cbasn1.OCTET_STRING) || !in.Empty() {
+			return nil, ErrUnsupported
+		}
+		return appendBytes(out, ski), nil
+
+	case 2:
+		var bits asn1.BitString
+		if !in.ReadASN1BitString(&bits) || !in.Empty() || bits.BitLength > 9 {
+			return nil, ErrUnsupported
+		}
+		usage := int64(0)
+		for i := 0; i < bits.BitLength; i++ {
+			usage |= int64(bits.At(i)) << i
+		}
+		return appendInt(out, usage), nil
+
+	case 3:
+		var names cryptobyte.String
+		if !in.ReadASN1(&names, cbasn1.SEQUENCE) || !in.Empty() {
+			return nil, ErrUnsupported
+		}
+		var pairs []byte
+		var tag cbasn1.Tag
+		var name cryptobyte.String
+		n := 0
+		for ; !names.Empty(); n++ {
+			if !names.ReadAnyASN1(&name, &tag) {
+				return nil, ErrUnsupported
+			}
+			typ := int64(tag ^ cbasn1.Tag(0).ContextSpecific())
+			binary, ok := generalNames[typ]
+			switch {
+			case !ok:
+				return nil, ErrUnsupported
+			case binary:
+				pairs = appendBytes(appendInt(pairs, typ), name)
+			default:
+				pairs = appendText(appendInt(pairs, typ), string(name))
+			}
+		}
+		// a lone dNSName is its text
+		if n == 1 && tag == cbasn1.Tag(2).ContextSpecific() {
+			return appendText(out, string(name)), nil
+		}
+		return append(appendArray(out, 2*n), pairs...), nil
+
+	case 4:
+		var seq cryptobyte.String
+		if !in.ReadASN1(&seq, cbasn1.SEQUENCE) || !in.Empty() {
+			return nil, ErrUnsupported
+		}
+		if seq.Empty() {
+			return appendInt(out, -2), nil
+		}
+		var ca bool
+		if !seq.ReadASN1Boolean(&ca) || !ca {
+			return nil, ErrUnsupported
+		}
+		if seq.Empty() {
+			return appendInt(out, -1), nil
+		}
+		var pathlen int64
+		if !seq.ReadASN1Integer(&pathlen) || !seq.Empty() || pathlen < 0 {
+			return nil, ErrUnsupported
+		}
+		return appendInt(out, pathlen), nil
+
+	case 7:
+		var seq, kid cryptobyte.String
+		if !in.ReadASN1(&seq, cbasn1.SEQUENCE) || !in.Empty() ||
+			!seq.ReadASN1(&kid, cbasn1.Tag(0).ContextSpecific()) || !seq.Empty() {
+			return nil, ErrUnsupported
+		}
+		return appendBytes(out, kid), nil
+	}
+
+	return nil, ErrUnsupported
+}
+
+// decodeExtensions reads the C509 extensions and returns the DER encoded
+// Extension sequences they stand for.
+func decodeExtensions(d *decoder) ([]byte, error) {
+
+	n, err := d.array()
+
+	if err != nil || n%2 != 0 {
+		return nil, ErrEncoding
+	}
+
+	var b cryptobyte.Builder
+
+	for i := 0; i < n/2; i++ {
+
+		var oid asn1.ObjectIdentifier
+		var value []byte
+		critical := false
+
+		if d.peek() == majorBytes {
+
+			content, err := d.bytes()
+
+			if err != nil {
+				return nil, err
+			}
+
+			var ob cryptobyte.Builder
+			ob.AddASN1(cbasn1.OBJECT_IDENTIFIER, func(b *cryptobyte.Builder) {
+				b.AddBytes(content)
+			})
+			der := cryptobyte.String(ob.BytesOrPanic())
+
+			if !der.ReadASN1ObjectIdentifier(&oid) {
+				return nil, ErrEncoding
+			}
+
+			if value, err = d.bytes(); err != nil {
+				return nil, err
+			}
+
+		} else {
+
+			id, err := d.int()
+
+			if err != nil {
+				return nil, err
+			}
+
+			if id < 0 {
+				id, critical = -id, true
+			}
+
+			var ok bool
+
+			if oid, ok = extensions[id]; !ok {
+				return nil, ErrUnsupported
+			}
+
+			if value, err = decodeExtension(d, id); err != nil {
+				return nil, err
+			}
+		}
+
+		b.AddASN1(cbasn1.SEQUENCE, func(b *cryptobyte.Builder) {
+			b.AddASN1ObjectIdentifier(oid)
+			if critical {
+				b.AddASN1Boolean(true)
+			}
+			b.AddASN1OctetString(value)
+		})
+	}
+
+	return b.Bytes()
+}
+
+func decodeExtension(d *decoder, id int64) ([]byte, error) {
+
+	var b cryptobyte.Builder
+
+	switch id {
+
+	case 1:
+		ski, err := d.bytes()
+		if err != nil {
+			return nil, err
+		}
+		b.AddASN1OctetString(ski)
+
+	case 2:
+		usage, err := d.int()
+		if err != nil || usage < 0 || usage >= 1<<9 {
+			return nil, ErrEncoding
+		}
+		var bits []byte
+		length := 0
+		for i := 0; i < 9; i++ {
+			if usage&(1<<i) != 0 {
+				for len(bits) <= i/8 {
+					bits = append(bits, 0)
+				}
+				bits[i/8] |= 0x80 >> (i % 8)
+				length = i + 1
+			}
+		}
+		b.AddASN1(cbasn1.BIT_STRING, func(b *cryptobyte.Builder) {
+			b.AddUint8(uint8(len(bits)*8 - length))
+			b.AddBytes(bits)
+		})
+
+	case 3:
+		var types []int64
+		var names [][]byte
+		if d.peek() == majorText {
+			dns, err := d.text()
+			if err != nil {
+				return nil, err
+			}
+			types, names = []int64{2}, [][]byte{[]byte(dns)}
+		} else {
+			n, err := d.array()
+			if err != nil || n%2 != 0 {
+				return nil, ErrEncoding
+			}
+			types, names = make([]int64, n/2), make([][]byte, n/2)
+			for i := range types {
+				if types[i], err = d.int(); err != nil {
+					return nil, err
+				}
+				binary, ok := generalNames[types[i]]
+				if !ok {
+					return nil, ErrUnsupported
+				}
+				if binary {
+					names[i], err = d.bytes()
+				} else {
+					var s string
+					s, err = d.text()
+					names[i] = []byte(s)
+				}
+				if err != nil {
+					return nil, err
+				}
+			}
+		}
+		b.AddASN1(cbasn1.SEQUENCE, func(b *cryptobyte.Builder) {
+			for i, typ := range types {
+				b.AddASN1(cbasn1.Tag(typ).ContextSpecific(), func(b *cryptobyte.Builder) {
+					b.AddBytes(names[i])
+				})
+			}
+		})
+
+	case 4:
+		pathlen, err := d.int()
+		if err != nil || pathlen < -2 {
+			return nil, ErrEncoding
+		}
+		b.AddASN1(cbasn1.SEQUENCE, func(b *cryptobyte.Builder) {
+			if pathlen != -2 {
+				b.AddASN1Boolean(true)
+			}
+			if pathlen >= 0 {
+				b.AddASN1Int64(pathlen)
+			}
+		})
+
+	case 7:
+		kid, err := d.bytes()
+		if err != nil {
+			return nil, err
+		}
+		b.AddASN1(cbasn1.SEQUENCE, func(b *cryptobyte.Builder) {
+			b.AddASN1(cbasn1.Tag(0).ContextSpecific(), func(b *cryptobyte.Builder) {
+				b.AddBytes(kid)
+			})
+		})
+	}
+
+	return b.Bytes()
+}
@@ -0,0 +1,136 @@
+package c509
+
+import (
+	"encoding/asn1"
+	"unicode/utf8"
+
+	"golang.org/x/crypto/cryptobyte"
+	cbasn1 "golang.org/x/crypto/cryptobyte/asn1"
+)
+
+func attribute(oid asn1.ObjectIdentifier) int64 {
+	for i, a := range attributes {
+		if a.Equal(oid) {
+			return int64(i)
+		}
+	}
+	return -1
+}
+
+// encodeName appends the C509 form of a DER encoded Name: the text of a
+// lone utf8String common name, otherwise the flattened attribute pairs.
+func encodeName(out []byte, raw []byte) ([]byte, error) {
+
+	in := cryptobyte.String(raw)
+	var rdns cryptobyte.String
+
+	if !in.ReadASN1(&rdns, cbasn1.SEQUENCE) || !in.Empty() {
+		return nil, ErrEncoding
+	}
+
+	var attrs []byte
+	var code int64
+	var value cryptobyte.String
+	n := 0
+
+	for ; !rdns.Empty(); n++ {
+
+		var set, atv cryptobyte.String
+		var oid asn1.ObjectIdentifier
+		var tag cbasn1.Tag
+
+		if !rdns.ReadASN1(&set, cbasn1.SET) || !set.ReadASN1(&atv, cbasn1.SEQUENCE) ||
+			!atv.ReadASN1ObjectIdentifier(&oid) || !atv.ReadAnyASN1(&value, &tag) || !atv.Empty() {
+			return nil, ErrEncoding
+		}
+
+		if code = attribute(oid); !set.Empty() || code < 0 || !utf8.Valid(value) {
+			return nil, ErrUnsupported
+		}
+
+		switch {
+		case code == 0 && tag == cbasn1.IA5String:
+		case code > 0 && tag == cbasn1.UTF8String:
+		case code > 0 && tag == cbasn1.PrintableString:
+			code = -code
+		default:
+			return nil, ErrUnsupported
+		}
+
+		attrs = appendInt(attrs, code)
+		attrs = appendText(attrs, string(value))
+	}
+
+	if n == 1 && code == 1 {
+		return appendText(out, string(value)), nil
+	}
+
+	return append(appendArray(out, 2*n), attrs...), nil
+}
+
+// decodeName reads a C509 Name and returns its DER encoding.
+func decodeName(d *decoder) ([]byte, error) {
+
+	var b cryptobyte.Builder
+
+	if d.peek() == majorText {
+		cn, err := d.text()
+		if err != nil {
+			return nil, err
+		}
+		b.AddASN1(cbasn1.SEQUENCE, func(b *cryptobyte.Builder) {
+			addAttribute(b, 1, cn)
+		})
+		return b.Bytes()
+	}
+
+	n, err := d.array()
+
+	if err != nil || n%2 != 0 {
+		return nil, ErrEncoding
+	}
+
+	codes := make([]int64, n/2)
+	values := make([]string, n/2)
+
+	for i := range codes {
+		if codes[i], err = d.int(); err != nil {
+			return nil, err
+		}
+		if codes[i] <= -int64(len(attributes)) || codes[i] >= int64(len(attributes)) {
+			return nil, ErrUnsupported
+		}
+		if values[i], err = d.text(); err != nil {
+			return nil, err
+		}
+	}
+
+	b.AddASN1(cbasn1.SEQUENCE, func(b *cryptobyte.Builder) {
+		for i, code := range codes {
+			addAttribute(b, code, values[i])
+		}
+	})
+
+	return b.Bytes()
+}
+
+func addAttribute(b *cryptobyte.Builder, code int64, value string) {
+
+	tag := cbasn1.UTF8String
+
+	switch {
+	case code == 0:
+		tag = cbasn1.IA5String
+	case code < 0:
+		tag, code = cbasn1.PrintableString, -code
+	}
+
+	b.AddASN1(cbasn1.SET, func(b *cryptobyte.Builder) {
+		b.AddASN1(cbasn1.SEQUENCE, func(b *cryptobyte.Builder) {
+			b.AddASN1ObjectIdentifier(attributes[code])
+			b.AddASN1(tag, func(b *cryptobyte.Builder) {
+				b.AddBytes([]byte(value))
+			})
+		})
+	})
+}
@@ -0,0 +1,375 @@
+// Package frost implements two-round FROST threshold signatures over
+// ed25519 as specified in RFC 9591, FROST(Ed25519, SHA-512). Aggregated
+// signatures are plain ed25519 signatures under the group public key.
+package frost
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/sha512"
+	"encoding/binary"
+	"errors"
+	"io"
+	"sort"
+
+	"filippo.io/edwards25519"
+)
+
+const contextString = "FROST-ED25519-SHA512-v1"
+
+var (
+	ErrThreshold       = errors.New("frost: invalid threshold parameters")
+	ErrIdentifier      = errors.New("frost: invalid participant identifier")
+	ErrCommitments     = errors.New("frost: invalid commitment list")
+	ErrEncoding        = errors.New("frost: invalid scalar or point encoding")
+	ErrShareInvalid    = errors.New("frost: signature share verification failed")
+	ErrSignatureFailed = errors.New("frost: aggregated signature verification failed")
+)
+
+// Group is the public description of a threshold key.
+type Group struct {
+	Threshold int               `json:"threshold"`
+	PublicKey []byte            `json:"public_key"`
+	Shares    map[uint16][]byte `json:"shares"`
+}
+
+// Share is the secret key share held by a single participant.
+type Share struct {
+	ID     uint16 `json:"id"`
+	Secret []byte `json:"secret"`
+	Group  *Group `json:"group"`
+}
+
+type Nonces struct {
+	hiding  *edwards25519.Scalar
+	binding *edwards25519.Scalar
+}
+
+type Commitment struct {
+	ID      uint16 `json:"id"`
+	Hiding  []byte `json:"hiding"`
+	Binding []byte `json:"binding"`
+}
+
+type SignatureShare struct {
+	ID uint16 `json:"id"`
+	Z  []byte `json:"z"`
+}
+
+func hashToScalar(parts ...[]byte) *edwards25519.Scalar {
+	h := sha512.New()
+	for _, p := range parts {
+		h.Write(p)
+	}
+	s, _ := edwards25519.NewScalar().SetUniformBytes(h.Sum(nil))
+	return s
+}
+
+func hash(parts ...[]byte) []byte {
+	h := sha512.New()
+	for _, p := range parts {
+		h.Write(p)
+	}
+	return h.Sum(nil)
+}
+
+func h1(m []byte) *edwards25519.Scalar {
+	return hashToScalar([]byte(contextString+"rho"), m)
+}
+
+func h2(m ...[]byte) *edwards25519.Scalar {
+	return hashToScalar(m...)
+}
+
+func h3(m ...[]byte) *edwards25519.Scalar {
+	return hashToScalar(append([][]byte{[]byte(contextString + "nonce")}, m...)...)
+}
+
+func h4(m []byte) []byte {
+	return hash([]byte(contextString+"msg"), m)
+}
+
+func h5(m []byte) []byte {
+	return hash([]byte(contextString+"com"), m)
+}
+
+func identifier(id uint16) *edwards25519.Scalar {
+	var b [32]byte
+	binary.LittleEndian.PutUint16(b[:], id)
+	s, _ := edwards25519.NewScalar().SetCanonicalBytes(b[:])
+	return s
+}
+
+func randomScalar(rand io.Reader) (*edwards25519.Scalar, error) {
+	var b [64]byte
+	if _, err := io.ReadFull(rand, b[:]); err != nil {
+		return nil, err
+	}
+	return edwards25519.NewScalar().SetUniformBytes(b[:])
+}
+
+func decodeScalar(b []byte) (*edwards25519.Scalar, error) {
+	s, err := edwards25519.NewScalar().SetCanonicalBytes(b)
+	if err != nil {
+		return nil, ErrEncoding
+	}
+	return s, nil
+}
+
+func decodePoint(b []byte) (*edwards25519.Point, error) {
+	p, err := edwards25519.NewIdentityPoint().SetBytes(b)
+	if err != nil {
+		return nil, ErrEncoding
+	}
+	return p, nil
+}
+
+// Split deals the ed25519 private key into n shares of which any t can sign.
+func Split(priv ed25519.PrivateKey, t int, n int, rand io.Reader) (*Group, []*Share, error) {
+
+	if t < 1 || n < t || n > 0xffff {
+		return nil, nil, ErrThreshold
+	}
+
+	digest := sha512.Sum512(priv.Seed())
+	secret, _ := edwards25519.NewScalar().SetBytesWithClamping(digest[:32])
+
+	coefficients := []*edwards25519.Scalar{secret}
+
+	for i := 1; i < t; i++ {
+		a, err := randomScalar(rand)
+		if err != nil {
+			return nil, nil, err
+		}
+		coefficients = append(coefficients, a)
+	}
+
+	group := &Group{
+		Threshold: t,
+		PublicKey: []byte(priv.Public().(ed25519.PublicKey)),
+		Shares:    make(map[uint16][]byte),
+	}
+
+	var shares []*Share
+
+	for i := 1; i <= n; i++ {
+
+		x := identifier(uint16(i))
+		y := edwards25519.NewScalar()
+
+		for j := len(coefficients) - 1; j >= 0; j-- {
+			y.MultiplyAdd(y, x, coefficients[j])
+		}
+
+		group.Shares[uint16(i)] = edwards25519.NewIdentityPoint().ScalarBaseMult(y).Bytes()
+		shares = append(shares, &Share{ID: uint16(i), Secret: y.Bytes(), Group: group})
+	}
+
+	return group, shares, nil
+}
+
+func nonceGenerate(secret []byte, rand io.Reader) (*edwards25519.Scalar, error) {
+	var b [32]byte
+	if _, err := io.ReadFull(rand, b[:]); err != nil {
+		return nil, err
+	}
+	return h3(b[:], secret), nil
+}
+
+// Commit runs the first round for the share and returns the secret nonces
+// together with the public commitment to them.
+func Commit(share *Share, rand io.Reader) (*Nonces, *Commitment, error) {
+
+	hiding, err := nonceGenerate(share.Secret, rand)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	binding, err := nonceGenerate(share.Secret, rand)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return &Nonces{hiding, binding}, &Commitment{
+		ID:      share.ID,
+		Hiding:  edwards25519.NewIdentityPoint().ScalarBaseMult(hiding).Bytes(),
+		Binding: edwards25519.NewIdentityPoint().ScalarBaseMult(binding).Bytes(),
+	}, nil
+}
+
+type session struct {
+	ids     []*edwards25519.Scalar
+	factors map[uint16]*edwards25519.Scalar
+	hiding  map[uint16]*edwards25519.Point
+	binding map[uint16]*edwards25519.Point
+	r       *edwards25519.Point
+	c       *edwards25519.Scalar
+}
+
+func newSession(group *Group, msg []byte, commitments []Commitment) (*session, error) {
+
+	if len(commitments) < group.Threshold {
+		return nil, ErrCommitments
+	}
+
+	sorted := make([]Commitment, len(commitments))
+	copy(sorted, commitments)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].ID < sorted[j].ID })
+
+	s := &session{
+		factors: make(map[uint16]*edwards25519.Scalar),
+		hiding:  make(map[uint16]*edwards25519.Point),
+		binding: make(map[uint16]*edwards25519.Point),
+	}
+
+	var encoded bytes.Buffer
+
+	for i, com := range sorted {
+
+		if com.ID == 0 || i > 0 && sorted[i-1].ID == com.ID {
+			return nil, ErrCommitments
+		}
+
+		if _, ok := group.Shares[com.ID]; !ok {
+			return nil, ErrIdentifier
+		}
+
+		d, err := decodePoint(com.Hiding)
+		if err != nil {
+			return nil, err
+		}
+
+		e, err := decodePoint(com.Binding)
+		if err != nil {
+			return nil, err
+		}
+
+		s.hiding[com.ID] = d
+		s.binding[com.ID] = e
+		s.ids = append(s.ids, identifier(com.ID))
+
+		encoded.Write(identifier(com.ID).Bytes())
+		encoded.Write(com.Hiding)
+		encoded.Write(com.Binding)
+	}
+
+	prefix := append([]byte{}, group.PublicKey...)
+	prefix = append(prefix, h4(msg)...)
+	prefix = append(prefix, h5(encoded.Bytes())...)
+
+	s.r = edwards25519.NewIdentityPoint()
+
+	for _, com := range sorted {
+		rho := h1(append(append([]byte{}, prefix...), identifier(com.ID).Bytes()...))
+		s.factors[com.ID] = rho
+		term := edwards25519.NewIdentityPoint().ScalarMult(rho, s.binding[com.ID])
+		term.Add(term, s.hiding[com.ID])
+		s.r.Add(s.r, term)
+	}
+
+	s.c = h2(s.r.Bytes(), group.PublicKey, msg)
+
+	return s, nil
+}
+
+func (s *session) lagrange(id uint16) *edwards25519.Scalar {
+
+	x := identifier(id)
+	num := identifier(1)
+	den := identifier(1)
+
+	for _, xj := range s.ids {
+		if xj.Equal(x) == 1 {
+			continue
+		}
+		num.Multiply(num, xj)
+		den.Multiply(den, edwards25519.NewScalar().Subtract(xj, x))
+	}
+
+	return num.Multiply(num, den.Invert(den))
+}
+
+// Sign runs the second round and produces the signature share of the
+// participant. The nonces must never be reused.
+func Sign(share *Share, nonces *Nonces, msg []byte, commitments []Commitment) (*SignatureShare, error) {
+
+	s, err := newSession(share.Group, msg, commitments)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if _, ok := s.factors[share.ID]; !ok {
+		return nil, ErrIdentifier
+	}
+
+	secret, err := decodeScalar(share.Secret)
+
+	if err != nil {
+		return nil, err
+	}
+
+	z := edwards25519.NewScalar().Multiply(s.lagrange(share.ID), secret)
+	z.Multiply(z, s.c)
+	z.MultiplyAdd(nonces.binding, s.factors[share.ID], z)
+	z.Add(z, nonces.hiding)
+
+	return &SignatureShare{ID: share.ID, Z: z.Bytes()}, nil
+}
+
+// Aggregate verifies every signature share and combines them into an
+// ed25519 signature over msg.
+func Aggregate(group *Group, msg []byte, commitments []Commitment, shares []SignatureShare) ([]byte, error) {
+
+	s, err := newSession(group, msg, commitments)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if len(shares) != len(commitments) {
+		return nil, ErrCommitments
+	}
+
+	z := edwards25519.NewScalar()
+	seen := make(map[uint16]bool)
+
+	for _, share := range shares {
+
+		if _, ok := s.factors[share.ID]; !ok || seen[share.ID] {
+			return nil, ErrIdentifier
+		}
+		seen[share.ID] = true
+
+		zi, err := decodeScalar(share.Z)
+		if err != nil {
+			return nil, err
+		}
+
+		pub, err := decodePoint(group.Shares[share.ID])
+		if err != nil {
+			return nil, err
+		}
+
+		lhs := edwards25519.NewIdentityPoint().ScalarBaseMult(zi)
+
+		rhs := edwards25519.NewIdentityPoint().ScalarMult(s.factors[share.ID], s.binding[share.ID])
+		rhs.Add(rhs, s.hiding[share.ID])
+		cl := edwards25519.NewScalar().Multiply(s.c, s.lagrange(share.ID))
+		rhs.Add(rhs, edwards25519.NewIdentityPoint().ScalarMult(cl, pub))
+
+		if lhs.Equal(rhs) != 1 {
+			return nil, ErrShareInvalid
+		}
+
+		z.Add(z, zi)
+	}
+
+	sig := append(s.r.Bytes(), z.Bytes()...)
+
+	if !ed25519.Verify(group.PublicKey, msg, sig) {
+		return nil, ErrSignatureFailed
+	}
+
+	return sig, nil
+}
@@ -0,0 +1,152 @@
+package frost
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func sign(t *testing.T, shares []*Share, msg []byte) ([]Commitment, []SignatureShare) {
+
+	var nonces []*Nonces
+	var commitments []Commitment
+
+	for _, share := range shares {
+		n, c, err := Commit(share, rand.Reader)
+		assert.NoError(t, err)
+		nonces = append(nonces, n)
+		commitments = append(commitments, *c)
+	}
+
+	var sigshares []SignatureShare
+
+	for i, share := range shares {
+		s, err := Sign(share, nonces[i], msg, commitments)
+		assert.NoError(t, err)
+		sigshares = append(sigshares, *s)
+	}
+
+	return commitments, sigshares
+}
+
+func TestSplit(t *testing.T) {
+
+	_, priv, _ := ed25519.GenerateKey(nil)
+
+	_, _, err := Split(priv, 0, 3, rand.Reader)
+	assert.ErrorIs(t, err, ErrThreshold)
+
+	_, _, err = Split(priv, 4, 3, rand.Reader)
+	assert.ErrorIs(t, err, ErrThreshold)
+
+	group, shares, err := Split(priv, 2, 3, rand.Reader)
+	assert.NoError(t, err)
+	assert.Len(t, shares, 3)
+	assert.Len(t, group.Shares, 3)
+	assert.Equal(t, []byte(priv.Public().(ed25519.PublicKey)), group.PublicKey)
+}
+
+func TestThresholdSign(t *testing.T) {
+
+	_, priv, _ := ed25519.GenerateKey(nil)
+	group, shares, _ := Split(priv, 3, 5, rand.Reader)
+	msg := []byte("hello world")
+
+	// every subset of the threshold size produces a valid signature
+	subsets := [][]*Share{
+		{shares[0], shares[1], shares[2]},
+		{shares[4], shares[2], shares[0]},
+		{shares[1], shares[3], shares[4]},
+		shares,
+	}
+
+	for _, subset := range subsets {
+		commitments, sigshares := sign(t, subset, msg)
+		sig, err := Aggregate(group, msg, commitments, sigshares)
+		assert.NoError(t, err)
+		assert.True(t, ed25519.Verify(priv.Public().(ed25519.PublicKey), msg, sig))
+	}
+}
+
+func TestThresholdSingle(t *testing.T) {
+
+	_, priv, _ := ed25519.GenerateKey(nil)
+	group, shares, _ := Split(priv, 1, 1, rand.Reader)
+	msg := []byte("hello world")
+
+	commitments, sigshares := sign(t, shares, msg)
+	sig, err := Aggregate(group, msg, commitments, sigshares)
+	assert.NoError(t, err)
+	assert.True(t, ed25519.Verify(group.PublicKey, msg, sig))
+}
+
+func TestThresholdFailures(t *testing.T) {
+
+	_, priv, _ := ed25519.GenerateKey(nil)
+	group, shares, _ := Split(priv, 2, 3, rand.Reader)
+	msg := []byte("hello world")
+
+	nonces, commitment, _ := Commit(shares[0], rand.Reader)
+
+	// below the threshold
+	_, err := Sign(shares[0], nonces, msg, []Commitment{*commitment})
+	assert.ErrorIs(t, err, ErrCommitments)
+
+	commitments, sigshares := sign(t, shares[:2], msg)
+
+	// participant missing from the commitment list
+	_, err = Sign(shares[2], nonces, msg, commitments)
+	assert.ErrorIs(t, err, ErrIdentifier)
+
+	// duplicated commitments
+	_, err = Sign(shares[0], nonces, msg, []Commitment{commitments[0], commitments[0]})
+	assert.ErrorIs(t, err, ErrCommitments)
+
+	// unknown participant
+	unknown := Commitment{ID: 9, Hiding: commitments[0].Hiding, Binding: commitments[0].Binding}
+	_, err = Sign(shares[0], nonces, msg, []Commitment{commitments[0], unknown})
+	assert.ErrorIs(t, err, ErrIdentifier)
+
+	// bad point encoding
+	bad := Commitment{ID: 2, Hiding: []byte{0x01}, Binding: commitments[1].Binding}
+	_, err = Sign(shares[0], nonces, msg, []Commitment{commitments[0], bad})
+	assert.ErrorIs(t, err, ErrEncoding)
+	bad = Commitment{ID: 2, Hiding: commitments[1].Hiding, Binding: []byte{0x01}}
+	_, err = Sign(shares[0], nonces, msg, []Commitment{commitments[0], bad})
+	assert.ErrorIs(t, err, ErrEncoding)
+
+	// bad secret encoding
+	broken := &Share{ID: 1, Secret: []byte{0x01}, Group: group}
+	_, err = Sign(broken, nonces, msg, commitments)
+	assert.ErrorIs(t, err, ErrEncoding)
+
+	// tampered signature share
+	tampered := []SignatureShare{sigshares[0], {ID: 2, Z: sigshares[0].Z}}
+	_, err = Aggregate(group, msg, commitments, tampered)
+	assert.ErrorIs(t, err, ErrShareInvalid)
+
+	// share for a different message
+	_, err = Aggregate(group, []byte("other"), commitments, sigshares)
+	assert.ErrorIs(t, err, ErrShareInvalid)
+
+	// missing and duplicated shares
+	_, err = Aggregate(group, msg, commitments, sigshares[:1])
+	assert.ErrorIs(t, err, ErrCommitments)
+	_, err = Aggregate(group, msg, commitments, []SignatureShare{sigshares[0], sigshares[0]})
+	assert.ErrorIs(t, err, ErrIdentifier)
+
+	// bad scalar encoding
+	_, err = Aggregate(group, msg, commitments, []SignatureShare{sigshares[0], {ID: 2, Z: []byte{0x01}}})
+	assert.ErrorIs(t, err, ErrEncoding)
+
+	_, err = Aggregate(group, msg, commitments[:1], sigshares[:1])
+	assert.ErrorIs(t, err, ErrCommitments)
+
+	// a group key that does not match the shares
+	other, _, _ := ed25519.GenerateKey(nil)
+	forged := &Group{Threshold: 2, PublicKey: other, Shares: group.Shares}
+	_, err = Aggregate(forged, msg, commitments, sigshares)
+	assert.Error(t, err)
+}
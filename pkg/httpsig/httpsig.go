@@ -0,0 +1,527 @@
+// Package httpsig authenticates HTTP requests signed with RFC 9421 HTTP
+// Message Signatures by the ed25519 key of a Verify issued certificate.
+// The certificate travels in the Verify-Certificate header as a structured
+// byte sequence and the address it was issued for is put into the request
+// context.
+package httpsig
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/Cealgull/Verify/pkg/sm2"
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	HeaderSignature      = "Signature"
+	HeaderSignatureInput = "Signature-Input"
+	HeaderContentDigest  = "Content-Digest"
+	HeaderCertificate    = "Verify-Certificate"
+)
+
+const Algorithm = "ed25519"
+
+var (
+	ErrMalformed        = errors.New("httpsig: malformed signature fields")
+	ErrMissingSignature = errors.New("httpsig: request is not signed")
+	ErrComponent        = errors.New("httpsig: required component not covered or missing")
+	ErrAlgorithm        = errors.New("httpsig: unsupported signature algorithm")
+	ErrExpired          = errors.New("httpsig: signature expired or created in the future")
+	ErrDigest           = errors.New("httpsig: content digest mismatch")
+	ErrCertificate      = errors.New("httpsig: certificate missing or invalid")
+	ErrUntrusted        = errors.New("httpsig: certificate not issued by a trusted CA")
+	ErrValidity         = errors.New("httpsig: certificate expired or not yet valid")
+	ErrRevoked          = errors.New("httpsig: certificate revoked")
+	ErrSignature        = errors.New("httpsig: signature verification failed")
+	ErrNoCA             = errors.New("httpsig: no CA certificate configured")
+)
+
+type contextKey struct{}
+
+// Identity is the authenticated signer of a request.
+type Identity struct {
+	Address     string
+	Certificate *x509.Certificate
+}
+
+// FromContext returns the identity the middleware stored in ctx.
+func FromContext(ctx context.Context) (*Identity, bool) {
+	id, ok := ctx.Value(contextKey{}).(*Identity)
+	return id, ok
+}
+
+// Address returns the Verify address of the signer of the request.
+func Address(ctx context.Context) (string, bool) {
+	if id, ok := FromContext(ctx); ok {
+		return id.Address, true
+	}
+	return "", false
+}
+
+// Revocation reports whether a certificate has been revoked.
+type Revocation interface {
+	Revoked(ctx context.Context, cert *x509.Certificate) (bool, error)
+}
+
+type Verifier struct {
+	cas        []*x509.Certificate
+	revocation Revocation
+	components []string
+	label      string
+	maxage     time.Duration
+	skew       time.Duration
+	now        func() time.Time
+}
+
+type Option func(v *Verifier) error
+
+// WithCABundle trusts every certificate in the PEM bundle as an issuer.
+func WithCABundle(bundle []byte) Option {
+	return func(v *Verifier) error {
+		for {
+			var p *pem.Block
+			if p, bundle = pem.Decode(bundle); p == nil {
+				return nil
+			}
+			cert, err := sm2.ParseCertificate(p.Bytes)
+			if err != nil {
+				return err
+			}
+			v.cas = append(v.cas, cert)
+		}
+	}
+}
+
+func WithCA(cas ...*x509.Certificate) Option {
+	return func(v *Verifier) error {
+		v.cas = append(v.cas, cas...)
+		return nil
+	}
+}
+
+func WithRevocation(r Revocation) Option {
+	return func(v *Verifier) error {
+		v.revocation = r
+		return nil
+	}
+}
+
+// WithComponents sets the components every signature must cover. It
+// defaults to @method, @authority and @path.
+func WithComponents(components ...string) Option {
+	return func(v *Verifier) error {
+		v.components = components
+		return nil
+	}
+}
+
+// WithLabel selects the signature to verify when a request carries several.
+// By default the first one is used.
+func WithLabel(label string) Option {
+	return func(v *Verifier) error {
+		v.label = label
+		return nil
+	}
+}
+
+// WithMaxAge bounds how long after its creation a signature is accepted.
+func WithMaxAge(d time.Duration) Option {
+	return func(v *Verifier) error {
+		if d > 0 {
+			v.maxage = d
+		}
+		return nil
+	}
+}
+
+func NewVerifier(options ...Option) (*Verifier, error) {
+
+	v := &Verifier{
+		components: []string{"@method", "@authority", "@path"},
+		maxage:     5 * time.Minute,
+		skew:       30 * time.Second,
+		now:        time.Now,
+	}
+
+	for _, option := range options {
+		if err := option(v); err != nil {
+			return nil, err
+		}
+	}
+
+	if len(v.cas) == 0 {
+		return nil, ErrNoCA
+	}
+
+	return v, nil
+}
+
+func scheme(r *http.Request) string {
+	if r.URL.Scheme != "" {
+		return r.URL.Scheme
+	}
+	if r.TLS != nil {
+		return "https"
+	}
+	return "http"
+}
+
+func authority(r *http.Request) string {
+	if r.Host != "" {
+		return strings.ToLower(r.Host)
+	}
+	return strings.ToLower(r.URL.Host)
+}
+
+// componentValue derives the value of a covered component as defined in
+// RFC 9421 section 2.
+func componentValue(r *http.Request, name string) (string, error) {
+
+	switch name {
+	case "@method":
+		return r.Method, nil
+	case "@authority":
+		return authority(r), nil
+	case "@scheme":
+		return scheme(r), nil
+	case "@target-uri":
+		return scheme(r) + "://" + authority(r) + r.URL.RequestURI(), nil
+	case "@request-target":
+		return r.URL.RequestURI(), nil
+	case "@path":
+		if p := r.URL.EscapedPath(); p != "" {
+			return p, nil
+		}
+		return "/", nil
+	case "@query":
+		return "?" + r.URL.RawQuery, nil
+	}
+
+	if strings.HasPrefix(name, "@") || name != strings.ToLower(name) {
+		return "", ErrComponent
+	}
+
+	values := r.Header.Values(name)
+
+	if len(values) == 0 {
+		return "", ErrComponent
+	}
+
+	for i := range values {
+		values[i] = strings.TrimSpace(values[i])
+	}
+
+	return strings.Join(values, ", "), nil
+}
+
+// signatureBase builds the signature base of RFC 9421 section 2.5 for the
+// covered components and their serialized signature parameters.
+func signatureBase(r *http.Request, components []string, params string) ([]byte, error) {
+
+	var b bytes.Buffer
+
+	for _, name := range components {
+
+		value, err := componentValue(r, name)
+
+		if err != nil {
+			return nil, err
+		}
+
+		fmt.Fprintf(&b, "\"%s\": %s\n", name, value)
+	}
+
+	fmt.Fprintf(&b, "\"@signature-params\": %s", params)
+
+	return b.Bytes(), nil
+}
+
+// ContentDigest computes the RFC 9530 Content-Digest field value for body.
+func ContentDigest(body []byte) string {
+	sum := sha256.Sum256(body)
+	return "sha-256=:" + base64.StdEncoding.EncodeToString(sum[:]) + ":"
+}
+
+func checkDigest(r *http.Request) error {
+
+	body, err := io.ReadAll(r.Body)
+
+	if err != nil {
+		return ErrDigest
+	}
+
+	r.Body = io.NopCloser(bytes.NewReader(body))
+
+	digests, _, err := parseDictionary(strings.Join(r.Header.Values(HeaderContentDigest), ", "))
+
+	if err != nil {
+		return ErrDigest
+	}
+
+	var expected []byte
+
+	if d, ok := digests["sha-512"]; ok {
+		sum := sha512.Sum512(body)
+		expected, _ = d.value.([]byte)
+		if bytes.Equal(expected, sum[:]) {
+			return nil
+		}
+	}
+
+	if d, ok := digests["sha-256"]; ok {
+		sum := sha256.Sum256(body)
+		expected, _ = d.value.([]byte)
+		if bytes.Equal(expected, sum[:]) {
+			return nil
+		}
+	}
+
+	return ErrDigest
+}
+
+func parseCertificate(r *http.Request) (*x509.Certificate, error) {
+
+	p := &parser{s: strings.TrimSpace(r.Header.Get(HeaderCertificate))}
+
+	if p.peek() != ':' {
+		return nil, ErrCertificate
+	}
+
+	value, err := p.bareItem()
+
+	if err != nil || !p.eof() {
+		return nil, ErrCertificate
+	}
+
+	cert, err := sm2.ParseCertificate(value.([]byte))
+
+	if err != nil {
+		return nil, ErrCertificate
+	}
+
+	return cert, nil
+}
+
+// valid reports whether cert is within its validity period. Verify leaves
+// the end of it unset, so a zero NotAfter does not expire.
+func valid(cert *x509.Certificate, now time.Time) bool {
+	return !now.Before(cert.NotBefore) && (cert.NotAfter.IsZero() || !now.After(cert.NotAfter))
+}
+
+func (v *Verifier) trusted(cert *x509.Certificate) error {
+
+	now := v.now()
+
+	for _, ca := range v.cas {
+		if sm2.CheckSignatureFrom(cert, ca) == nil {
+			if !valid(cert, now) || !valid(ca, now) {
+				return ErrValidity
+			}
+			return nil
+		}
+	}
+
+	return ErrUntrusted
+}
+
+func (v *Verifier) checkParams(params map[string]interface{}) error {
+
+	if alg, ok := params["alg"]; ok && alg != Algorithm {
+		return ErrAlgorithm
+	}
+
+	created, ok := params["created"].(int64)
+
+	if !ok {
+		return ErrMalformed
+	}
+
+	now := v.now()
+	t := time.Unix(created, 0)
+
+	if t.After(now.Add(v.skew)) || now.Sub(t) > v.maxage {
+		return ErrExpired
+	}
+
+	if expires, ok := params["expires"].(int64); ok && now.After(time.Unix(expires, 0)) {
+		return ErrExpired
+	}
+
+	return nil
+}
+
+// Verify authenticates the signature of r and returns its signer.
+func (v *Verifier) Verify(r *http.Request) (*Identity, error) {
+
+	input := strings.Join(r.Header.Values(HeaderSignatureInput), ", ")
+	sigs := strings.Join(r.Header.Values(HeaderSignature), ", ")
+
+	if input == "" || sigs == "" {
+		return nil, ErrMissingSignature
+	}
+
+	inputs, labels, err := parseDictionary(input)
+
+	if err != nil {
+		return nil, err
+	}
+
+	signatures, _, err := parseDictionary(sigs)
+
+	if err != nil {
+		return nil, err
+	}
+
+	label := v.label
+
+	if label == "" {
+		label = labels[0]
+	}
+
+	in, ok := inputs[label]
+	sig, sok := signatures[label]
+
+	if !ok || !sok || in.list == nil {
+		return nil, ErrMissingSignature
+	}
+
+	signature, ok := sig.value.([]byte)
+
+	if !ok {
+		return nil, ErrMalformed
+	}
+
+	covered := make([]string, len(in.list))
+	set := make(map[string]bool)
+
+	for i, it := range in.list {
+		name, ok := it.value.(string)
+		if !ok || len(it.params) != 0 || set[name] {
+			return nil, ErrMalformed
+		}
+		covered[i] = name
+		set[name] = true
+	}
+
+	required := v.components
+
+	if r.ContentLength != 0 && r.Body != nil && r.Body != http.NoBody {
+		required = append(append([]string{}, required...), "content-digest")
+	}
+
+	for _, name := range required {
+		if !set[name] {
+			return nil, ErrComponent
+		}
+	}
+
+	if err := v.checkParams(in.params); err != nil {
+		return nil, err
+	}
+
+	if set["content-digest"] {
+		if err := checkDigest(r); err != nil {
+			return nil, err
+		}
+	}
+
+	cert, err := parseCertificate(r)
+
+	if err != nil {
+		return nil, err
+	}
+
+	pub, ok := cert.PublicKey.(ed25519.PublicKey)
+
+	if !ok {
+		return nil, ErrCertificate
+	}
+
+	if err := v.trusted(cert); err != nil {
+		return nil, err
+	}
+
+	base, err := signatureBase(r, covered, in.raw)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if !ed25519.Verify(pub, base, signature) {
+		return nil, ErrSignature
+	}
+
+	if v.revocation != nil {
+
+		revoked, err := v.revocation.Revoked(r.Context(), cert)
+
+		if err != nil {
+			return nil, err
+		}
+
+		if revoked {
+			return nil, ErrRevoked
+		}
+	}
+
+	return &Identity{Address: cert.Subject.CommonName, Certificate: cert}, nil
+}
+
+func (v *Verifier) authenticate(r *http.Request) (*http.Request, error) {
+
+	id, err := v.Verify(r)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return r.WithContext(context.WithValue(r.Context(), contextKey{}, id)), nil
+}
+
+// Handler is the net/http middleware. Requests that fail verification are
+// answered with 401 Unauthorized.
+func (v *Verifier) Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		authed, err := v.authenticate(r)
+
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+
+		next.ServeHTTP(w, authed)
+	})
+}
+
+// Echo is the echo middleware. Requests that fail verification are
+// answered with 401 Unauthorized.
+func (v *Verifier) Echo() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+
+			authed, err := v.authenticate(c.Request())
+
+			if err != nil {
+				return echo.NewHTTPError(http.StatusUnauthorized, err.Error())
+			}
+
+			c.SetRequest(authed)
+
+			return next(c)
+		}
+	}
+}
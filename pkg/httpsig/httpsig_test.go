@@ -0,0 +1,511 @@
+package httpsig
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Cealgull/Verify/pkg/sm2"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func newCA(t *testing.T) (*x509.Certificate, ed25519.PrivateKey) {
+
+	pub, priv, _ := ed25519.GenerateKey(nil)
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Verify CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, pub, priv)
+	assert.NoError(t, err)
+
+	ca, _ := x509.ParseCertificate(der)
+
+	return ca, priv
+}
+
+// newLeaf issues a certificate shaped like the ones Verify issues.
+func newLeaf(t *testing.T, ca *x509.Certificate, capriv ed25519.PrivateKey, serial int64) ([]byte, ed25519.PrivateKey) {
+
+	pub, priv, _ := ed25519.GenerateKey(nil)
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: "0xuser" + big.NewInt(serial).String()},
+		NotBefore:    time.Now(),
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, ca, pub, capriv)
+	assert.NoError(t, err)
+
+	return der, priv
+}
+
+func TestSignatureBase(t *testing.T) {
+
+	// RFC 9421 appendix B.2.6
+	raw := "POST /foo?param=Value&Pet=dog HTTP/1.1\r\n" +
+		"Host: example.com\r\n" +
+		"Date: Tue, 20 Apr 2021 02:07:55 GMT\r\n" +
+		"Content-Type: application/json\r\n" +
+		"Content-Digest: sha-512=:WZDPaVn/7XgHaAy8pmojAkGWoRx2UFChF41A2svX+TaPm+AbwAgBWnrIiYllu7BNNyealdVLvRwEmTHWXvJwew==:\r\n" +
+		"Content-Length: 18\r\n\r\n" +
+		"{\"hello\": \"world\"}"
+
+	r, err := http.ReadRequest(bufio.NewReader(strings.NewReader(raw)))
+	assert.NoError(t, err)
+
+	inputs, labels, err := parseDictionary(`sig-b26=("date" "@method" "@path" "@authority" "content-type" "content-length");created=1618884473;keyid="test-key-ed25519"`)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"sig-b26"}, labels)
+
+	in := inputs["sig-b26"]
+	var covered []string
+	for _, it := range in.list {
+		covered = append(covered, it.value.(string))
+	}
+
+	base, err := signatureBase(r, covered, in.raw)
+	assert.NoError(t, err)
+
+	p, _ := pem.Decode([]byte("-----BEGIN PUBLIC KEY-----\nMCowBQYDK2VwAyEAJrQLj5P/89iXES9+vFgrIy29clF9CC/oPPsw3c5D0bs=\n-----END PUBLIC KEY-----\n"))
+	pub, err := x509.ParsePKIXPublicKey(p.Bytes)
+	assert.NoError(t, err)
+
+	sig, _ := base64.StdEncoding.DecodeString("wqcAqbmYJ2ji2glfAMaRy4gruYYnx2nEFN2HN6jrnDnQCK1u02Gb04v9EDgwUPiu4A0w6vuQv5lIp5WPpBKRCw==")
+	assert.True(t, ed25519.Verify(pub.(ed25519.PublicKey), base, sig))
+
+	assert.NoError(t, checkDigest(r))
+
+	r.URL.RawQuery = ""
+	for name, value := range map[string]string{
+		"@scheme":         "http",
+		"@target-uri":     "http://example.com/foo",
+		"@request-target": "/foo",
+		"@query":          "?",
+	} {
+		v, err := componentValue(r, name)
+		assert.NoError(t, err)
+		assert.Equal(t, value, v)
+	}
+
+	for _, name := range []string{"@unknown", "Date", "x-missing"} {
+		_, err := componentValue(r, name)
+		assert.Equal(t, ErrComponent, err)
+	}
+}
+
+func TestParseDictionary(t *testing.T) {
+
+	members, keys, err := parseDictionary(`a=?1, b=-12;x;y="q\"", c=tok/en:1, d=("x" 1);p=:AQ==:, e`)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"a", "b", "c", "d", "e"}, keys)
+	assert.Equal(t, true, members["a"].value)
+	assert.Equal(t, int64(-12), members["b"].value)
+	assert.Equal(t, `q"`, members["b"].params["y"])
+	assert.Equal(t, "tok/en:1", members["c"].value)
+	assert.Len(t, members["d"].list, 2)
+	assert.Equal(t, []byte{1}, members["d"].params["p"])
+	assert.Equal(t, `("x" 1);p=:AQ==:`, members["d"].raw)
+	assert.Equal(t, true, members["e"].value)
+
+	for _, s := range []string{
+		`A=1`, `a=`, `a=1,`, `a=1 b=2`, `a="open`, `a="\x"`, "a=\"\x01\"",
+		`a=:AQ==`, `a=:!!:`, `a=?2`, `a=12345678901234567`, `a=("x"`, `a=("x""y")`,
+		`a=1;B`, `a=1;b=`, `a=(1);B`, `a;B`, `a=@`,
+	} {
+		_, _, err := parseDictionary(s)
+		assert.Error(t, err, s)
+	}
+}
+
+func TestVerifier(t *testing.T) {
+
+	ca, capriv := newCA(t)
+	der, priv := newLeaf(t, ca, capriv, 7)
+	revokedder, revokedpriv := newLeaf(t, ca, capriv, 8)
+	other, otherpriv := newCA(t)
+	foreign, foreignpriv := newLeaf(t, other, otherpriv, 9)
+
+	_, err := NewVerifier()
+	assert.Equal(t, ErrNoCA, err)
+
+	_, err = NewVerifier(WithCABundle([]byte("-----BEGIN CERTIFICATE-----\nAAAA\n-----END CERTIFICATE-----\n")))
+	assert.Error(t, err)
+
+	v, err := NewVerifier(
+		WithCABundle(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ca.Raw})),
+		WithRevocation(NewSerials(big.NewInt(8))),
+		WithMaxAge(time.Minute),
+	)
+	assert.NoError(t, err)
+
+	components := []string{"@method", "@authority", "@path"}
+
+	newRequest := func(body string) *http.Request {
+		var r *http.Request
+		if body == "" {
+			r = httptest.NewRequest(http.MethodGet, "http://service.example/posts?page=1", nil)
+		} else {
+			r = httptest.NewRequest(http.MethodPost, "http://service.example/posts", strings.NewReader(body))
+		}
+		return r
+	}
+
+	var seen string
+
+	handler := v.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen, _ = Address(r.Context())
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	serve := func(r *http.Request) int {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, r)
+		return rec.Code
+	}
+
+	r := newRequest("")
+	assert.NoError(t, Sign(r, priv, der, "sig1", components...))
+	assert.Equal(t, http.StatusNoContent, serve(r))
+	assert.Equal(t, "0xuser7", seen)
+
+	r = newRequest(`{"title":"hello"}`)
+	assert.NoError(t, Sign(r, priv, der, "sig1", components...))
+	assert.Equal(t, http.StatusNoContent, serve(r))
+
+	// a tampered body no longer matches the covered digest
+	r = newRequest(`{"title":"hello"}`)
+	assert.NoError(t, Sign(r, priv, der, "sig1", components...))
+	r.Body = http.NoBody
+	r.Body = httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{"title":"bye"}`)).Body
+	_, err = v.Verify(r)
+	assert.Equal(t, ErrDigest, err)
+
+	// bodies must be covered by a digest
+	r = newRequest(`{"title":"hello"}`)
+	assert.NoError(t, Sign(r, priv, der, "sig1", components...))
+	r.Header.Set(HeaderSignatureInput, strings.Replace(r.Header.Get(HeaderSignatureInput), ` "content-digest"`, "", 1))
+	_, err = v.Verify(r)
+	assert.Equal(t, ErrComponent, err)
+
+	r = newRequest("")
+	assert.NoError(t, Sign(r, priv, der, "sig1", "@method"))
+	_, err = v.Verify(r)
+	assert.Equal(t, ErrComponent, err)
+
+	r = newRequest("")
+	assert.NoError(t, Sign(r, priv, der, "sig1", components...))
+	r.URL.Path = "/admin"
+	_, err = v.Verify(r)
+	assert.Equal(t, ErrSignature, err)
+
+	r = newRequest("")
+	assert.NoError(t, Sign(r, revokedpriv, revokedder, "sig1", components...))
+	_, err = v.Verify(r)
+	assert.Equal(t, ErrRevoked, err)
+
+	r = newRequest("")
+	assert.NoError(t, Sign(r, foreignpriv, foreign, "sig1", components...))
+	_, err = v.Verify(r)
+	assert.Equal(t, ErrUntrusted, err)
+
+	// certificates are only trusted within their validity period
+	expired := &x509.Certificate{
+		SerialNumber: big.NewInt(10),
+		Subject:      pkix.Name{CommonName: "0xuser10"},
+		NotBefore:    time.Now().Add(-2 * time.Hour),
+		NotAfter:     time.Now().Add(-time.Hour),
+	}
+	expiredder, err := x509.CreateCertificate(rand.Reader, expired, ca, priv.Public(), capriv)
+	assert.NoError(t, err)
+
+	r = newRequest("")
+	assert.NoError(t, Sign(r, priv, expiredder, "sig1", components...))
+	_, err = v.Verify(r)
+	assert.Equal(t, ErrValidity, err)
+
+	expired.NotBefore, expired.NotAfter = time.Now().Add(time.Hour), time.Time{}
+	futureder, err := x509.CreateCertificate(rand.Reader, expired, ca, priv.Public(), capriv)
+	assert.NoError(t, err)
+
+	r = newRequest("")
+	assert.NoError(t, Sign(r, priv, futureder, "sig1", components...))
+	_, err = v.Verify(r)
+	assert.Equal(t, ErrValidity, err)
+
+	oldca := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Old CA"},
+		NotBefore:             time.Now().Add(-2 * time.Hour),
+		NotAfter:              time.Now().Add(-time.Hour),
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	oldder, err := x509.CreateCertificate(rand.Reader, oldca, oldca, capriv.Public(), capriv)
+	assert.NoError(t, err)
+	old, _ := x509.ParseCertificate(oldder)
+	oldleaf, oldpriv := newLeaf(t, old, capriv, 11)
+
+	stale, err := NewVerifier(WithCA(old))
+	assert.NoError(t, err)
+	r = newRequest("")
+	assert.NoError(t, Sign(r, oldpriv, oldleaf, "sig1", components...))
+	_, err = stale.Verify(r)
+	assert.Equal(t, ErrValidity, err)
+
+	// the key of a trusted certificate must have made the signature
+	r = newRequest("")
+	assert.NoError(t, Sign(r, foreignpriv, der, "sig1", components...))
+	_, err = v.Verify(r)
+	assert.Equal(t, ErrSignature, err)
+
+	for _, header := range []string{"", "AAAA", ":AAAA:", ":AAAA: extra"} {
+		r = newRequest("")
+		assert.NoError(t, Sign(r, priv, der, "sig1", components...))
+		r.Header.Set(HeaderCertificate, header)
+		_, err = v.Verify(r)
+		assert.Equal(t, ErrCertificate, err)
+	}
+
+	r = newRequest("")
+	assert.Equal(t, http.StatusUnauthorized, serve(r))
+	_, err = v.Verify(r)
+	assert.Equal(t, ErrMissingSignature, err)
+
+	r = newRequest("")
+	assert.NoError(t, Sign(r, priv, der, "sig1", components...))
+	input := r.Header.Get(HeaderSignatureInput)
+
+	params := map[string]error{
+		strings.Replace(input, `alg="ed25519"`, `alg="rsa-pss-sha512"`, 1):                                ErrAlgorithm,
+		strings.Replace(input, ";created=", ";expires=1;created=", 1):                                     ErrExpired,
+		`sig1=("@method" "@authority" "@path")`:                                                           ErrMalformed,
+		`sig1=("@method" "@authority" "@path");created=1`:                                                 ErrExpired,
+		`sig1=("@method" "@authority" "@path");created=` + big.NewInt(time.Now().Unix()+3600).String():    ErrExpired,
+		`sig1=("@method" "@authority" "@path" "@path");created=` + big.NewInt(time.Now().Unix()).String(): ErrMalformed,
+		`sig1=("@method";x "@authority" "@path");created=` + big.NewInt(time.Now().Unix()).String():       ErrMalformed,
+		`sig1=("@method" "@authority" "@path" 1);created=` + big.NewInt(time.Now().Unix()).String():       ErrMalformed,
+		`sig2=("@method" "@authority" "@path");created=` + big.NewInt(time.Now().Unix()).String():         ErrMissingSignature,
+		`sig1="@method"`: ErrMissingSignature,
+		`sig1=(`:         ErrMalformed,
+		`sig1=("@method" "@authority" "@path" "x-missing");created=` + big.NewInt(time.Now().Unix()).String(): ErrComponent,
+	}
+
+	for value, expected := range params {
+		r.Header.Set(HeaderSignatureInput, value)
+		_, err = v.Verify(r)
+		assert.Equal(t, expected, err, value)
+	}
+
+	r.Header.Set(HeaderSignatureInput, input)
+	r.Header.Set(HeaderSignature, "sig1=1")
+	_, err = v.Verify(r)
+	assert.Equal(t, ErrMalformed, err)
+	r.Header.Set(HeaderSignature, "sig1=(")
+	_, err = v.Verify(r)
+	assert.Equal(t, ErrMalformed, err)
+
+	// a second signature is picked by label
+	r = newRequest("")
+	assert.NoError(t, Sign(r, priv, der, "verify", components...))
+	r.Header.Set(HeaderSignatureInput, `other=("@method");created=1, `+r.Header.Get(HeaderSignatureInput))
+	r.Header.Set(HeaderSignature, `other=:AAAA:, `+r.Header.Get(HeaderSignature))
+	_, err = v.Verify(r)
+	assert.Error(t, err)
+
+	labelled, err := NewVerifier(WithCA(ca), WithLabel("verify"), WithComponents("@method"))
+	assert.NoError(t, err)
+	id, err := labelled.Verify(r)
+	assert.NoError(t, err)
+	assert.Equal(t, "0xuser7", id.Address)
+	assert.Equal(t, der, id.Certificate.Raw)
+}
+
+func TestEchoMiddleware(t *testing.T) {
+
+	ca, capriv := newCA(t)
+	der, priv := newLeaf(t, ca, capriv, 7)
+
+	v, err := NewVerifier(WithCA(ca))
+	assert.NoError(t, err)
+
+	e := echo.New()
+	e.Use(v.Echo())
+	e.GET("/me", func(c echo.Context) error {
+		addr, ok := Address(c.Request().Context())
+		assert.True(t, ok)
+		return c.String(http.StatusOK, addr)
+	})
+
+	r := httptest.NewRequest(http.MethodGet, "/me", nil)
+	assert.NoError(t, Sign(r, priv, der, "sig1", "@method", "@authority", "@path"))
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, r)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "0xuser7", rec.Body.String())
+
+	r = httptest.NewRequest(http.MethodGet, "/me", nil)
+	rec = httptest.NewRecorder()
+	e.ServeHTTP(rec, r)
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+
+	_, ok := Address(context.Background())
+	assert.False(t, ok)
+}
+
+func TestSM2CA(t *testing.T) {
+
+	newSM2CA := func() (*x509.Certificate, *sm2.PrivateKey) {
+
+		priv, err := sm2.GenerateKey()
+		assert.NoError(t, err)
+
+		template := &x509.Certificate{
+			SerialNumber:          big.NewInt(1),
+			Subject:               pkix.Name{CommonName: "Verify SM2 CA"},
+			NotBefore:             time.Now().Add(-time.Hour),
+			NotAfter:              time.Now().Add(time.Hour),
+			BasicConstraintsValid: true,
+			IsCA:                  true,
+			KeyUsage:              x509.KeyUsageCertSign,
+		}
+
+		der, err := sm2.CreateCertificate(rand.Reader, template, template, priv.Public(), priv)
+		assert.NoError(t, err)
+
+		ca, err := sm2.ParseCertificate(der)
+		assert.NoError(t, err)
+
+		return ca, priv
+	}
+
+	newSM2Leaf := func(ca *x509.Certificate, capriv *sm2.PrivateKey) ([]byte, ed25519.PrivateKey) {
+
+		pub, priv, _ := ed25519.GenerateKey(nil)
+
+		template := &x509.Certificate{
+			SerialNumber: big.NewInt(7),
+			Subject:      pkix.Name{CommonName: "0xuser7"},
+			NotBefore:    time.Now(),
+		}
+
+		der, err := sm2.CreateCertificate(rand.Reader, template, ca, pub, capriv)
+		assert.NoError(t, err)
+
+		return der, priv
+	}
+
+	ca, capriv := newSM2CA()
+	der, priv := newSM2Leaf(ca, capriv)
+	other, otherpriv := newSM2CA()
+	foreign, foreignpriv := newSM2Leaf(other, otherpriv)
+
+	v, err := NewVerifier(WithCABundle(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ca.Raw})))
+	assert.NoError(t, err)
+
+	r := httptest.NewRequest(http.MethodGet, "http://service.example/me", nil)
+	assert.NoError(t, Sign(r, priv, der, "sig1", "@method", "@authority", "@path"))
+	id, err := v.Verify(r)
+	assert.NoError(t, err)
+	assert.Equal(t, "0xuser7", id.Address)
+
+	r = httptest.NewRequest(http.MethodGet, "http://service.example/me", nil)
+	assert.NoError(t, Sign(r, foreignpriv, foreign, "sig1", "@method", "@authority", "@path"))
+	_, err = v.Verify(r)
+	assert.Equal(t, ErrUntrusted, err)
+}
+
+func TestRevocation(t *testing.T) {
+
+	ca, capriv := newCA(t)
+	der, _ := newLeaf(t, ca, capriv, 7)
+	cert, _ := x509.ParseCertificate(der)
+
+	crlder, err := x509.CreateRevocationList(rand.Reader, &x509.RevocationList{
+		Number: big.NewInt(1),
+		RevokedCertificateEntries: []x509.RevocationListEntry{
+			{SerialNumber: big.NewInt(7), RevocationTime: time.Now()},
+		},
+		ThisUpdate: time.Now(),
+		NextUpdate: time.Now().Add(time.Hour),
+	}, ca, capriv)
+	assert.NoError(t, err)
+
+	crl, _ := x509.ParseRevocationList(crlder)
+
+	serials, err := FromCRL(crl, ca)
+	assert.NoError(t, err)
+	revoked, err := serials.Revoked(context.Background(), cert)
+	assert.NoError(t, err)
+	assert.True(t, revoked)
+
+	other, _ := newCA(t)
+	_, err = FromCRL(crl, other)
+	assert.Error(t, err)
+
+	calls := 0
+	status := http.StatusOK
+	code := "A0000"
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		var buf bytes.Buffer
+		_, _ = buf.ReadFrom(r.Body)
+		assert.Contains(t, buf.String(), "BEGIN CERTIFICATE")
+		w.WriteHeader(status)
+		_, _ = w.Write([]byte(`{"code":"` + code + `"}`))
+	}))
+	defer server.Close()
+
+	remote := NewRemote(server.URL+"/cert/verify", time.Minute)
+
+	revoked, err = remote.Revoked(context.Background(), cert)
+	assert.NoError(t, err)
+	assert.False(t, revoked)
+
+	// answers are remembered for the ttl
+	revoked, err = remote.Revoked(context.Background(), cert)
+	assert.NoError(t, err)
+	assert.False(t, revoked)
+	assert.Equal(t, 1, calls)
+
+	remote = NewRemote(server.URL+"/cert/verify", 0)
+	status, code = http.StatusUnauthorized, codeRevoked
+	revoked, err = remote.Revoked(context.Background(), cert)
+	assert.NoError(t, err)
+	assert.True(t, revoked)
+
+	status, code = http.StatusInternalServerError, "A9999"
+	_, err = remote.Revoked(context.Background(), cert)
+	assert.Error(t, err)
+
+	remote = NewRemote("http://127.0.0.1:0/cert/verify", 0)
+	_, err = remote.Revoked(context.Background(), cert)
+	assert.Error(t, err)
+
+	remote = NewRemote("://invalid", 0)
+	_, err = remote.Revoked(context.Background(), cert)
+	assert.Error(t, err)
+}
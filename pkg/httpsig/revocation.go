@@ -0,0 +1,136 @@
+package httpsig
+
+import (
+	"bytes"
+	"context"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Serials is a fixed set of revoked serial numbers.
+type Serials struct {
+	serials map[string]bool
+}
+
+func NewSerials(serials ...*big.Int) *Serials {
+	s := &Serials{serials: make(map[string]bool)}
+	for _, sn := range serials {
+		s.serials[sn.Text(16)] = true
+	}
+	return s
+}
+
+// FromCRL collects the revoked serials of a CRL signed by ca.
+func FromCRL(crl *x509.RevocationList, ca *x509.Certificate) (*Serials, error) {
+
+	if err := crl.CheckSignatureFrom(ca); err != nil {
+		return nil, err
+	}
+
+	s := NewSerials()
+
+	for _, entry := range crl.RevokedCertificateEntries {
+		s.serials[entry.SerialNumber.Text(16)] = true
+	}
+
+	return s, nil
+}
+
+func (s *Serials) Revoked(ctx context.Context, cert *x509.Certificate) (bool, error) {
+	return s.serials[cert.SerialNumber.Text(16)], nil
+}
+
+// codeRevoked is the response code Verify answers revoked certificates with.
+const codeRevoked = "A0241"
+
+type remoteResult struct {
+	revoked bool
+	expires time.Time
+}
+
+// Remote asks the /cert/verify endpoint of a Verify server about each
+// certificate and remembers the answers for ttl.
+type Remote struct {
+	endpoint string
+	client   *http.Client
+	ttl      time.Duration
+	results  map[string]remoteResult
+	mtx      sync.Mutex
+}
+
+func NewRemote(endpoint string, ttl time.Duration) *Remote {
+	return &Remote{
+		endpoint: endpoint,
+		client:   &http.Client{Timeout: 5 * time.Second},
+		ttl:      ttl,
+		results:  make(map[string]remoteResult),
+	}
+}
+
+func (r *Remote) Revoked(ctx context.Context, cert *x509.Certificate) (bool, error) {
+
+	serial := cert.SerialNumber.Text(16)
+	now := time.Now()
+
+	r.mtx.Lock()
+	res, ok := r.results[serial]
+	r.mtx.Unlock()
+
+	if ok && now.Before(res.expires) {
+		return res.revoked, nil
+	}
+
+	body, _ := json.Marshal(map[string]string{
+		"cert": string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw})),
+	})
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, r.endpoint, bytes.NewReader(body))
+
+	if err != nil {
+		return false, err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := r.client.Do(req)
+
+	if err != nil {
+		return false, err
+	}
+
+	defer resp.Body.Close()
+
+	var msg struct {
+		Code string `json:"code"`
+	}
+
+	_ = json.NewDecoder(resp.Body).Decode(&msg)
+
+	switch {
+	case resp.StatusCode == http.StatusOK:
+		res.revoked = false
+	case msg.Code == codeRevoked:
+		res.revoked = true
+	default:
+		return false, fmt.Errorf("httpsig: revocation check failed with status %d", resp.StatusCode)
+	}
+
+	res.expires = now.Add(r.ttl)
+
+	r.mtx.Lock()
+	for k, v := range r.results {
+		if now.After(v.expires) {
+			delete(r.results, k)
+		}
+	}
+	r.results[serial] = res
+	r.mtx.Unlock()
+
+	return res.revoked, nil
+}
@@ -0,0 +1,311 @@
+package httpsig
+
+import (
+	"encoding/base64"
+	"strconv"
+	"strings"
+)
+
+// This file parses the subset of RFC 8941 structured fields used by the
+// Signature-Input and Signature dictionaries.
+
+type item struct {
+	value  interface{}
+	params map[string]interface{}
+}
+
+type member struct {
+	item
+	list []item
+	// raw is the serialized member value, which RFC 9421 reuses verbatim
+	// as the value of the @signature-params component.
+	raw string
+}
+
+type parser struct {
+	s string
+	i int
+}
+
+func (p *parser) eof() bool {
+	return p.i >= len(p.s)
+}
+
+func (p *parser) peek() byte {
+	if p.eof() {
+		return 0
+	}
+	return p.s[p.i]
+}
+
+func (p *parser) skip(set string) {
+	for !p.eof() && strings.IndexByte(set, p.s[p.i]) >= 0 {
+		p.i++
+	}
+}
+
+func isLower(c byte) bool {
+	return c >= 'a' && c <= 'z'
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func isAlpha(c byte) bool {
+	return isLower(c) || c >= 'A' && c <= 'Z'
+}
+
+func (p *parser) key() (string, error) {
+
+	start := p.i
+
+	if c := p.peek(); !isLower(c) && c != '*' {
+		return "", ErrMalformed
+	}
+
+	for !p.eof() {
+		c := p.peek()
+		if !isLower(c) && !isDigit(c) && strings.IndexByte("_-.*", c) < 0 {
+			break
+		}
+		p.i++
+	}
+
+	return p.s[start:p.i], nil
+}
+
+func (p *parser) bareItem() (interface{}, error) {
+
+	c := p.peek()
+
+	switch {
+	case c == '"':
+
+		var b strings.Builder
+
+		for p.i++; !p.eof(); p.i++ {
+			switch c := p.s[p.i]; {
+			case c == '\\':
+				p.i++
+				if p.eof() || p.s[p.i] != '"' && p.s[p.i] != '\\' {
+					return nil, ErrMalformed
+				}
+				b.WriteByte(p.s[p.i])
+			case c == '"':
+				p.i++
+				return b.String(), nil
+			case c < 0x20 || c > 0x7e:
+				return nil, ErrMalformed
+			default:
+				b.WriteByte(c)
+			}
+		}
+
+		return nil, ErrMalformed
+
+	case c == ':':
+
+		end := strings.IndexByte(p.s[p.i+1:], ':')
+
+		if end < 0 {
+			return nil, ErrMalformed
+		}
+
+		b, err := base64.StdEncoding.DecodeString(p.s[p.i+1 : p.i+1+end])
+
+		if err != nil {
+			return nil, ErrMalformed
+		}
+
+		p.i += end + 2
+		return b, nil
+
+	case c == '?':
+
+		if p.i+1 >= len(p.s) || p.s[p.i+1] != '0' && p.s[p.i+1] != '1' {
+			return nil, ErrMalformed
+		}
+
+		p.i += 2
+		return p.s[p.i-1] == '1', nil
+
+	case c == '-' || isDigit(c):
+
+		start := p.i
+		p.i++
+
+		for !p.eof() && isDigit(p.peek()) {
+			p.i++
+		}
+
+		n, err := strconv.ParseInt(p.s[start:p.i], 10, 64)
+
+		if err != nil || p.i-start > 16 {
+			return nil, ErrMalformed
+		}
+
+		return n, nil
+
+	case isAlpha(c) || c == '*':
+
+		start := p.i
+
+		for !p.eof() {
+			c := p.peek()
+			if !isAlpha(c) && !isDigit(c) && strings.IndexByte("!#$%&'*+-.^_`|~:/", c) < 0 {
+				break
+			}
+			p.i++
+		}
+
+		return p.s[start:p.i], nil
+	}
+
+	return nil, ErrMalformed
+}
+
+func (p *parser) params() (map[string]interface{}, error) {
+
+	params := make(map[string]interface{})
+
+	for p.peek() == ';' {
+
+		p.i++
+		p.skip(" ")
+
+		key, err := p.key()
+
+		if err != nil {
+			return nil, err
+		}
+
+		var value interface{} = true
+
+		if p.peek() == '=' {
+			p.i++
+			if value, err = p.bareItem(); err != nil {
+				return nil, err
+			}
+		}
+
+		params[key] = value
+	}
+
+	return params, nil
+}
+
+func (p *parser) item() (item, error) {
+
+	value, err := p.bareItem()
+
+	if err != nil {
+		return item{}, err
+	}
+
+	params, err := p.params()
+
+	return item{value, params}, err
+}
+
+func (p *parser) member() (member, error) {
+
+	start := p.i
+
+	if p.peek() != '(' {
+		it, err := p.item()
+		return member{item: it, raw: p.s[start:p.i]}, err
+	}
+
+	var list []item
+
+	for p.i++; ; {
+
+		p.skip(" ")
+
+		if p.peek() == ')' {
+			p.i++
+			break
+		}
+
+		it, err := p.item()
+
+		if err != nil {
+			return member{}, err
+		}
+
+		list = append(list, it)
+
+		if c := p.peek(); c != ' ' && c != ')' {
+			return member{}, ErrMalformed
+		}
+	}
+
+	params, err := p.params()
+
+	if err != nil {
+		return member{}, err
+	}
+
+	return member{item: item{params: params}, list: list, raw: p.s[start:p.i]}, nil
+}
+
+// parseDictionary parses a structured field dictionary and returns its
+// members together with their keys in order.
+func parseDictionary(s string) (map[string]member, []string, error) {
+
+	p := &parser{s: s}
+	members := make(map[string]member)
+	var keys []string
+
+	p.skip(" \t")
+
+	for !p.eof() {
+
+		key, err := p.key()
+
+		if err != nil {
+			return nil, nil, err
+		}
+
+		var m member
+
+		if p.peek() == '=' {
+			p.i++
+			if m, err = p.member(); err != nil {
+				return nil, nil, err
+			}
+		} else {
+			params, err := p.params()
+			if err != nil {
+				return nil, nil, err
+			}
+			m = member{item: item{true, params}}
+		}
+
+		if _, ok := members[key]; !ok {
+			keys = append(keys, key)
+		}
+
+		members[key] = m
+
+		p.skip(" \t")
+
+		if p.eof() {
+			break
+		}
+
+		if p.peek() != ',' {
+			return nil, nil, ErrMalformed
+		}
+
+		p.i++
+		p.skip(" \t")
+
+		if p.eof() {
+			return nil, nil, ErrMalformed
+		}
+	}
+
+	return members, keys, nil
+}
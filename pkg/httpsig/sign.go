@@ -0,0 +1,53 @@
+package httpsig
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Sign signs r in place with the key of the Verify certificate in der. A
+// Content-Digest is added and covered when the request has a body.
+func Sign(r *http.Request, priv ed25519.PrivateKey, der []byte, label string, components ...string) error {
+
+	if r.Body != nil && r.Body != http.NoBody {
+
+		body, err := io.ReadAll(r.Body)
+
+		if err != nil {
+			return err
+		}
+
+		r.Body = io.NopCloser(bytes.NewReader(body))
+
+		if len(body) != 0 {
+			r.Header.Set(HeaderContentDigest, ContentDigest(body))
+			components = append(components, "content-digest")
+		}
+	}
+
+	quoted := make([]string, len(components))
+
+	for i, name := range components {
+		quoted[i] = "\"" + name + "\""
+	}
+
+	params := fmt.Sprintf("(%s);created=%d;alg=\"%s\"", strings.Join(quoted, " "), time.Now().Unix(), Algorithm)
+
+	base, err := signatureBase(r, components, params)
+
+	if err != nil {
+		return err
+	}
+
+	r.Header.Set(HeaderCertificate, ":"+base64.StdEncoding.EncodeToString(der)+":")
+	r.Header.Set(HeaderSignatureInput, label+"="+params)
+	r.Header.Set(HeaderSignature, label+"=:"+base64.StdEncoding.EncodeToString(ed25519.Sign(priv, base))+":")
+
+	return nil
+}
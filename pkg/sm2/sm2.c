@@ -0,0 +1,133 @@
+#include "sm2.h"
+
+#include <openssl/evp.h>
+#include <openssl/x509.h>
+
+/* default distinguishing identifier of GB/T 35276 */
+static const char sm2_id[] = "1234567812345678";
+
+static EVP_PKEY *sm2_load_private(const unsigned char *der, int len) {
+  const unsigned char *p = der;
+  PKCS8_PRIV_KEY_INFO *p8 = d2i_PKCS8_PRIV_KEY_INFO(NULL, &p, len);
+  EVP_PKEY *pkey = p8 != NULL ? EVP_PKCS82PKEY(p8) : NULL;
+  PKCS8_PRIV_KEY_INFO_free(p8);
+  if (pkey != NULL && (!EVP_PKEY_is_a(pkey, "SM2") || p != der + len)) {
+    EVP_PKEY_free(pkey);
+    return NULL;
+  }
+  return pkey;
+}
+
+static EVP_PKEY *sm2_load_public(const unsigned char *der, int len) {
+  const unsigned char *p = der;
+  EVP_PKEY *pkey = d2i_PUBKEY(NULL, &p, len);
+  if (pkey != NULL && (!EVP_PKEY_is_a(pkey, "SM2") || p != der + len)) {
+    EVP_PKEY_free(pkey);
+    return NULL;
+  }
+  return pkey;
+}
+
+static int sm2_encode_private(EVP_PKEY *pkey, unsigned char *der, int cap) {
+  PKCS8_PRIV_KEY_INFO *p8 = EVP_PKEY2PKCS8(pkey);
+  int len = -1;
+  if (p8 != NULL && i2d_PKCS8_PRIV_KEY_INFO(p8, NULL) <= cap) {
+    len = i2d_PKCS8_PRIV_KEY_INFO(p8, &der);
+  }
+  PKCS8_PRIV_KEY_INFO_free(p8);
+  return len;
+}
+
+int sm2_generate(unsigned char *der, int cap) {
+  EVP_PKEY *pkey = EVP_PKEY_Q_keygen(NULL, NULL, "SM2");
+  int len = -1;
+  if (pkey != NULL) {
+    len = sm2_encode_private(pkey, der, cap);
+  }
+  EVP_PKEY_free(pkey);
+  return len;
+}
+
+int sm2_check_private(const unsigned char *der, int len) {
+  EVP_PKEY *pkey = sm2_load_private(der, len);
+  EVP_PKEY_free(pkey);
+  return pkey != NULL;
+}
+
+int sm2_check_public(const unsigned char *der, int len) {
+  EVP_PKEY *pkey = sm2_load_public(der, len);
+  EVP_PKEY_free(pkey);
+  return pkey != NULL;
+}
+
+int sm2_public(const unsigned char *priv, int privlen, unsigned char *der,
+               int cap) {
+  EVP_PKEY *pkey = sm2_load_private(priv, privlen);
+  int len = -1;
+  if (pkey != NULL && i2d_PUBKEY(pkey, NULL) <= cap) {
+    len = i2d_PUBKEY(pkey, &der);
+  }
+  EVP_PKEY_free(pkey);
+  return len;
+}
+
+/* sm2_digest_init prepares mctx for SM2 with SM3 over Z || msg */
+static EVP_PKEY_CTX *sm2_digest_init(EVP_MD_CTX *mctx, EVP_PKEY *pkey,
+                                     int sign) {
+  EVP_PKEY_CTX *pctx = EVP_PKEY_CTX_new(pkey, NULL);
+  int ok;
+  if (pctx == NULL) {
+    return NULL;
+  }
+  EVP_PKEY_CTX_set1_id(pctx, sm2_id, sizeof(sm2_id) - 1);
+  EVP_MD_CTX_set_pkey_ctx(mctx, pctx);
+  if (sign) {
+    ok = EVP_DigestSignInit(mctx, NULL, EVP_sm3(), NULL, pkey);
+  } else {
+    ok = EVP_DigestVerifyInit(mctx, NULL, EVP_sm3(), NULL, pkey);
+  }
+  if (ok != 1) {
+    EVP_MD_CTX_set_pkey_ctx(mctx, NULL);
+    EVP_PKEY_CTX_free(pctx);
+    return NULL;
+  }
+  return pctx;
+}
+
+int sm2_sign(const unsigned char *priv, int privlen, const unsigned char *msg,
+             int msglen, unsigned char *sig, int cap) {
+  EVP_PKEY *pkey = sm2_load_private(priv, privlen);
+  EVP_MD_CTX *mctx = EVP_MD_CTX_new();
+  EVP_PKEY_CTX *pctx = NULL;
+  size_t siglen = cap;
+  int len = -1;
+
+  if (pkey != NULL && mctx != NULL &&
+      (pctx = sm2_digest_init(mctx, pkey, 1)) != NULL &&
+      EVP_DigestSign(mctx, sig, &siglen, msg, msglen) == 1) {
+    len = (int)siglen;
+  }
+
+  EVP_MD_CTX_free(mctx);
+  EVP_PKEY_CTX_free(pctx);
+  EVP_PKEY_free(pkey);
+  return len;
+}
+
+int sm2_verify(const unsigned char *pub, int publen, const unsigned char *msg,
+               int msglen, const unsigned char *sig, int siglen) {
+  EVP_PKEY *pkey = sm2_load_public(pub, publen);
+  EVP_MD_CTX *mctx = EVP_MD_CTX_new();
+  EVP_PKEY_CTX *pctx = NULL;
+  int ok = 0;
+
+  if (pkey != NULL && mctx != NULL &&
+      (pctx = sm2_digest_init(mctx, pkey, 0)) != NULL) {
+    ok = EVP_DigestVerify(mctx, sig, siglen, msg, msglen) == 1;
+  }
+
+  EVP_MD_CTX_free(mctx);
+  EVP_PKEY_CTX_free(pctx);
+  EVP_PKEY_free(pkey);
+  return ok;
+}
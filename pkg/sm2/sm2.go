@@ -0,0 +1,140 @@
+// Package sm2 signs with SM2 over SM3 (GB/T 32918, GB/T 32905) through the
+// OpenSSL libcrypto the ring signatures already link, and bridges the
+// certificates signed that way into crypto/x509, which knows neither the
+// curve nor the algorithm.
+package sm2
+
+// #cgo CFLAGS: -O2 -Wall
+// #cgo LDFLAGS: -lcrypto
+// #include "sm2.h"
+import "C"
+import (
+	"bytes"
+	"crypto"
+	"errors"
+	"io"
+	"unsafe"
+
+	"golang.org/x/crypto/cryptobyte"
+	cbasn1 "golang.org/x/crypto/cryptobyte/asn1"
+)
+
+const (
+	maxKeySize       = 256
+	maxSignatureSize = 80
+)
+
+var (
+	ErrKey       = errors.New("sm2: invalid key")
+	ErrSign      = errors.New("sm2: signing failed")
+	ErrHash      = errors.New("sm2: messages must not be hashed in advance")
+	ErrSignature = errors.New("sm2: invalid signature")
+)
+
+// PrivateKey holds the PKCS #8 encoding handed to OpenSSL on every use.
+type PrivateKey struct {
+	der []byte
+	pub *PublicKey
+}
+
+// PublicKey holds the PKIX SubjectPublicKeyInfo encoding.
+type PublicKey struct {
+	der []byte
+}
+
+func ptr(b []byte) *C.uchar {
+	if len(b) == 0 {
+		return nil
+	}
+	return (*C.uchar)(unsafe.Pointer(&b[0]))
+}
+
+func GenerateKey() (*PrivateKey, error) {
+
+	der := make([]byte, maxKeySize)
+	n := int(C.sm2_generate(ptr(der), C.int(len(der))))
+
+	if n <= 0 {
+		return nil, ErrKey
+	}
+
+	return ParsePKCS8PrivateKey(der[:n])
+}
+
+func ParsePKCS8PrivateKey(der []byte) (*PrivateKey, error) {
+
+	pub := make([]byte, maxKeySize)
+	n := int(C.sm2_public(ptr(der), C.int(len(der)), ptr(pub), C.int(len(pub))))
+
+	if n <= 0 {
+		return nil, ErrKey
+	}
+
+	return &PrivateKey{der: bytes.Clone(der), pub: &PublicKey{pub[:n]}}, nil
+}
+
+func MarshalPKCS8PrivateKey(k *PrivateKey) []byte {
+	return bytes.Clone(k.der)
+}
+
+func ParsePKIXPublicKey(der []byte) (*PublicKey, error) {
+
+	if C.sm2_check_public(ptr(der), C.int(len(der))) != 1 {
+		return nil, ErrKey
+	}
+
+	return &PublicKey{bytes.Clone(der)}, nil
+}
+
+func MarshalPKIXPublicKey(k *PublicKey) []byte {
+	return bytes.Clone(k.der)
+}
+
+func (k *PrivateKey) Public() crypto.PublicKey {
+	return k.pub
+}
+
+// Sign signs the message itself, hashed with SM3 after the Z value of the
+// default identifier, so opts must not name a hash. The randomness comes
+// from OpenSSL and rand is ignored.
+func (k *PrivateKey) Sign(rand io.Reader, msg []byte, opts crypto.SignerOpts) ([]byte, error) {
+
+	if opts != nil && opts.HashFunc() != 0 {
+		return nil, ErrHash
+	}
+
+	sig := make([]byte, maxSignatureSize)
+	n := int(C.sm2_sign(ptr(k.der), C.int(len(k.der)), ptr(msg), C.int(len(msg)), ptr(sig), C.int(len(sig))))
+
+	if n <= 0 {
+		return nil, ErrSign
+	}
+
+	return sig[:n], nil
+}
+
+func (k *PublicKey) Equal(x crypto.PublicKey) bool {
+	other, ok := x.(*PublicKey)
+	return ok && bytes.Equal(k.der, other.der)
+}
+
+// Point returns the affine coordinates of the key.
+func (k *PublicKey) Point() (x []byte, y []byte) {
+
+	spki := cryptobyte.String(k.der)
+	var body, point cryptobyte.String
+
+	spki.ReadASN1(&body, cbasn1.SEQUENCE)
+	body.SkipASN1(cbasn1.SEQUENCE)
+	body.ReadASN1(&point, cbasn1.BIT_STRING)
+
+	// unused bits and the uncompressed point prefix
+	point = point[2:]
+
+	return point[:len(point)/2], point[len(point)/2:]
+}
+
+// Verify reports whether sig is a valid signature of msg by pub.
+func Verify(pub *PublicKey, msg []byte, sig []byte) bool {
+	return C.sm2_verify(ptr(pub.der), C.int(len(pub.der)), ptr(msg), C.int(len(msg)), ptr(sig), C.int(len(sig))) == 1
+}
@@ -0,0 +1,22 @@
+#ifndef __SM2_H
+#define __SM2_H
+
+#ifdef __cplusplus
+extern "C" {
+#endif
+
+int sm2_generate(unsigned char *der, int cap);
+int sm2_check_private(const unsigned char *der, int len);
+int sm2_check_public(const unsigned char *der, int len);
+int sm2_public(const unsigned char *priv, int privlen, unsigned char *der,
+               int cap);
+int sm2_sign(const unsigned char *priv, int privlen, const unsigned char *msg,
+             int msglen, unsigned char *sig, int cap);
+int sm2_verify(const unsigned char *pub, int publen, const unsigned char *msg,
+               int msglen, const unsigned char *sig, int siglen);
+
+#ifdef __cplusplus
+}
+#endif
+
+#endif
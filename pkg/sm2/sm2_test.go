@@ -0,0 +1,143 @@
+package sm2
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newCA(t *testing.T) (*PrivateKey, *x509.Certificate) {
+
+	priv, err := GenerateKey()
+	assert.NoError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "SM2 CA", Organization: []string{"Cealgull"}},
+		NotBefore:             time.Now(),
+		NotAfter:              time.Now().AddDate(1, 0, 0),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+
+	der, err := CreateCertificate(rand.Reader, template, template, priv.Public(), priv)
+	assert.NoError(t, err)
+
+	ca, err := ParseCertificate(der)
+	assert.NoError(t, err)
+
+	return priv, ca
+}
+
+func TestSignVerify(t *testing.T) {
+
+	priv, err := GenerateKey()
+	assert.NoError(t, err)
+
+	pub := priv.Public().(*PublicKey)
+	msg := []byte("hello world")
+
+	sig, err := priv.Sign(rand.Reader, msg, crypto.Hash(0))
+	assert.NoError(t, err)
+	assert.True(t, Verify(pub, msg, sig))
+	assert.False(t, Verify(pub, []byte("hello"), sig))
+
+	sig, err = priv.Sign(rand.Reader, nil, nil)
+	assert.NoError(t, err)
+	assert.True(t, Verify(pub, nil, sig))
+
+	_, err = priv.Sign(rand.Reader, msg, crypto.SHA256)
+	assert.Equal(t, ErrHash, err)
+
+	decoded, err := ParsePKCS8PrivateKey(MarshalPKCS8PrivateKey(priv))
+	assert.NoError(t, err)
+	assert.True(t, pub.Equal(decoded.Public()))
+
+	other, _ := GenerateKey()
+	assert.False(t, pub.Equal(other.Public()))
+	assert.False(t, Verify(other.Public().(*PublicKey), msg, sig))
+
+	pubkey, err := ParsePKIXPublicKey(MarshalPKIXPublicKey(pub))
+	assert.NoError(t, err)
+	assert.True(t, pub.Equal(pubkey))
+
+	x, y := pub.Point()
+	assert.Len(t, x, 32)
+	assert.Len(t, y, 32)
+
+	_, err = ParsePKCS8PrivateKey([]byte("invalid"))
+	assert.Equal(t, ErrKey, err)
+
+	_, err = ParsePKIXPublicKey(MarshalPKCS8PrivateKey(priv))
+	assert.Equal(t, ErrKey, err)
+
+	// ed25519 keys are not SM2 keys
+	_, edpriv, _ := ed25519.GenerateKey(nil)
+	der, _ := x509.MarshalPKCS8PrivateKey(edpriv)
+	_, err = ParsePKCS8PrivateKey(der)
+	assert.Equal(t, ErrKey, err)
+}
+
+func TestCertificate(t *testing.T) {
+
+	priv, ca := newCA(t)
+
+	assert.True(t, IsSigned(ca))
+	assert.True(t, priv.Public().(*PublicKey).Equal(ca.PublicKey))
+	assert.Equal(t, "SM2 CA", ca.Subject.CommonName)
+	assert.Len(t, ca.SubjectKeyId, 20)
+	assert.NoError(t, CheckSignatureFrom(ca, ca))
+
+	pub, _, _ := ed25519.GenerateKey(nil)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: "leaf"},
+		NotBefore:    time.Now(),
+	}
+
+	der, err := CreateCertificate(rand.Reader, template, ca, pub, priv)
+	assert.NoError(t, err)
+
+	leaf, err := ParseCertificate(der)
+	assert.NoError(t, err)
+	assert.Equal(t, ca.Subject.String(), leaf.Issuer.String())
+	assert.Equal(t, ca.SubjectKeyId, leaf.AuthorityKeyId)
+	assert.Equal(t, pub, leaf.PublicKey)
+	assert.NoError(t, CheckSignatureFrom(leaf, ca))
+
+	certs, err := ParseCertificates(append(der, ca.Raw...))
+	assert.NoError(t, err)
+	assert.Len(t, certs, 2)
+
+	_, err = ParseCertificates(append(der, 0x30))
+	assert.Equal(t, ErrCertificate, err)
+
+	_, other := newCA(t)
+	assert.Equal(t, ErrSignature, CheckSignatureFrom(leaf, other))
+
+	// leaves cannot issue
+	assert.IsType(t, x509.ConstraintViolationError{}, CheckSignatureFrom(ca, leaf))
+
+	leaf.Signature[len(leaf.Signature)-1] ^= 1
+	assert.Equal(t, ErrSignature, CheckSignatureFrom(leaf, ca))
+
+	// ed25519 issuers fall back to crypto/x509
+	_, edpriv, _ := ed25519.GenerateKey(nil)
+	template.IsCA, template.BasicConstraintsValid = true, true
+	der, _ = x509.CreateCertificate(rand.Reader, template, template, edpriv.Public(), edpriv)
+	edca, err := ParseCertificate(der)
+	assert.NoError(t, err)
+	assert.False(t, IsSigned(edca))
+	assert.NoError(t, CheckSignatureFrom(edca, edca))
+
+	_, err = ParseCertificate([]byte("invalid"))
+	assert.Error(t, err)
+}
@@ -0,0 +1,272 @@
+package sm2
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/asn1"
+	"errors"
+	"io"
+
+	"golang.org/x/crypto/cryptobyte"
+	cbasn1 "golang.org/x/crypto/cryptobyte/asn1"
+)
+
+var (
+	oidPublicKeyEC = asn1.ObjectIdentifier{1, 2, 840, 10045, 2, 1}
+	oidCurveSM2    = asn1.ObjectIdentifier{1, 2, 156, 10197, 1, 301}
+	oidSM2WithSM3  = asn1.ObjectIdentifier{1, 2, 156, 10197, 1, 501}
+)
+
+var ErrCertificate = errors.New("sm2: malformed certificate")
+
+// certificate is a DER certificate split around the fields SM2 touches.
+type certificate struct {
+	tbs       []byte
+	serial    []byte // version and serialNumber
+	algorithm []byte
+	names     []byte // issuer, validity and subject
+	spki      []byte
+	rest      []byte // unique identifiers and extensions
+	signature []byte // signatureAlgorithm and signatureValue
+}
+
+func split(der []byte) (*certificate, bool) {
+
+	in := cryptobyte.String(der)
+	var body, tbs, rest cryptobyte.String
+	c := &certificate{}
+
+	if !in.ReadASN1(&body, cbasn1.SEQUENCE) || !in.Empty() ||
+		!body.ReadASN1Element(&tbs, cbasn1.SEQUENCE) {
+		return nil, false
+	}
+
+	c.tbs, c.signature = tbs, body
+	tbs.ReadASN1(&rest, cbasn1.SEQUENCE)
+	start := len(rest)
+
+	var elem cryptobyte.String
+
+	if rest.PeekASN1Tag(cbasn1.Tag(0).Constructed().ContextSpecific()) {
+		rest.SkipASN1(cbasn1.Tag(0).Constructed().ContextSpecific())
+	}
+
+	if !rest.SkipASN1(cbasn1.INTEGER) {
+		return nil, false
+	}
+
+	c.serial = c.tbs[len(c.tbs)-start : len(c.tbs)-len(rest)]
+
+	if !rest.ReadASN1Element(&elem, cbasn1.SEQUENCE) {
+		return nil, false
+	}
+
+	c.algorithm = elem
+	start = len(rest)
+
+	if !rest.SkipASN1(cbasn1.SEQUENCE) || !rest.SkipASN1(cbasn1.SEQUENCE) || !rest.SkipASN1(cbasn1.SEQUENCE) {
+		return nil, false
+	}
+
+	c.names = c.tbs[len(c.tbs)-start : len(c.tbs)-len(rest)]
+
+	if !rest.ReadASN1Element(&elem, cbasn1.SEQUENCE) {
+		return nil, false
+	}
+
+	c.spki = elem
+	c.rest = rest
+
+	return c, true
+}
+
+// build assembles a TBSCertificate from c with another signature
+// algorithm and public key.
+func (c *certificate) build(algorithm []byte, spki []byte) []byte {
+	return sequence(c.serial, algorithm, c.names, spki, c.rest)
+}
+
+func sequence(elems ...[]byte) []byte {
+	var b cryptobyte.Builder
+	b.AddASN1(cbasn1.SEQUENCE, func(b *cryptobyte.Builder) {
+		for _, elem := range elems {
+			b.AddBytes(elem)
+		}
+	})
+	return b.BytesOrPanic()
+}
+
+func algorithm(oid asn1.ObjectIdentifier) []byte {
+	var b cryptobyte.Builder
+	b.AddASN1ObjectIdentifier(oid)
+	return sequence(b.BytesOrPanic())
+}
+
+// isSM2Key reports whether spki holds an elliptic curve key on the SM2
+// curve.
+func isSM2Key(spki []byte) bool {
+
+	in := cryptobyte.String(spki)
+	var body, alg cryptobyte.String
+	var oid, curve asn1.ObjectIdentifier
+
+	return in.ReadASN1(&body, cbasn1.SEQUENCE) && body.ReadASN1(&alg, cbasn1.SEQUENCE) &&
+		alg.ReadASN1ObjectIdentifier(&oid) && oid.Equal(oidPublicKeyEC) &&
+		alg.ReadASN1ObjectIdentifier(&curve) && curve.Equal(oidCurveSM2)
+}
+
+// ParseCertificate parses a certificate which may hold an SM2 public key.
+// crypto/x509 rejects the curve, so the key is masked as an unknown
+// algorithm while the rest is parsed and put back afterwards, leaving a
+// *PublicKey in PublicKey.
+func ParseCertificate(der []byte) (*x509.Certificate, error) {
+
+	cert, err := x509.ParseCertificate(der)
+
+	if err == nil {
+		return cert, nil
+	}
+
+	c, ok := split(der)
+
+	if !ok || !isSM2Key(c.spki) {
+		return nil, err
+	}
+
+	pub, err := ParsePKIXPublicKey(c.spki)
+
+	if err != nil {
+		return nil, err
+	}
+
+	spki := cryptobyte.String(c.spki)
+	var body, key cryptobyte.String
+	spki.ReadASN1(&body, cbasn1.SEQUENCE)
+	body.SkipASN1(cbasn1.SEQUENCE)
+	body.ReadASN1Element(&key, cbasn1.BIT_STRING)
+
+	masked := sequence(c.build(c.algorithm, sequence(algorithm(oidCurveSM2), key)), c.signature)
+
+	if cert, err = x509.ParseCertificate(masked); err != nil {
+		return nil, err
+	}
+
+	cert.Raw = der
+	cert.RawTBSCertificate = c.tbs
+	cert.RawSubjectPublicKeyInfo = c.spki
+	cert.PublicKey = pub
+
+	return cert, nil
+}
+
+// ParseCertificates parses concatenated DER certificates.
+func ParseCertificates(der []byte) ([]*x509.Certificate, error) {
+
+	in := cryptobyte.String(der)
+	var certs []*x509.Certificate
+
+	for !in.Empty() {
+
+		var elem cryptobyte.String
+
+		if !in.ReadASN1Element(&elem, cbasn1.SEQUENCE) {
+			return nil, ErrCertificate
+		}
+
+		cert, err := ParseCertificate(elem)
+
+		if err != nil {
+			return nil, err
+		}
+
+		certs = append(certs, cert)
+	}
+
+	return certs, nil
+}
+
+// IsSigned reports whether cert is signed with SM2 over SM3.
+func IsSigned(cert *x509.Certificate) bool {
+	c, ok := split(cert.Raw)
+	return ok && string(c.algorithm) == string(algorithm(oidSM2WithSM3))
+}
+
+// CheckSignatureFrom is x509.Certificate.CheckSignatureFrom extended to
+// SM2 issuers.
+func CheckSignatureFrom(cert *x509.Certificate, parent *x509.Certificate) error {
+
+	pub, ok := parent.PublicKey.(*PublicKey)
+
+	if !ok {
+		return cert.CheckSignatureFrom(parent)
+	}
+
+	if (parent.Version == 3 && !parent.BasicConstraintsValid) ||
+		(parent.BasicConstraintsValid && !parent.IsCA) ||
+		(parent.KeyUsage != 0 && parent.KeyUsage&x509.KeyUsageCertSign == 0) {
+		return x509.ConstraintViolationError{}
+	}
+
+	if !IsSigned(cert) || !Verify(pub, cert.RawTBSCertificate, cert.Signature) {
+		return ErrSignature
+	}
+
+	return nil
+}
+
+// CreateCertificate is x509.CreateCertificate for SM2 issuers, with pub
+// either a key crypto/x509 supports or a *PublicKey. crypto/x509 lays the
+// certificate out around a throwaway ed25519 key, then the algorithm and
+// an SM2 subject key are swapped in and the TBSCertificate is signed
+// again.
+func CreateCertificate(rand io.Reader, template *x509.Certificate, parent *x509.Certificate, pub any, priv *PrivateKey) ([]byte, error) {
+
+	_, stub, err := ed25519.GenerateKey(rand)
+
+	if err != nil {
+		return nil, err
+	}
+
+	t, p := *template, *parent
+	p.PublicKey = nil
+
+	key, subjectSM2 := pub.(*PublicKey)
+
+	if subjectSM2 {
+		pub = stub.Public()
+		if t.IsCA && len(t.SubjectKeyId) == 0 {
+			x, y := key.Point()
+			h := sha256.Sum256(append(append([]byte{4}, x...), y...))
+			t.SubjectKeyId = h[:20]
+		}
+	}
+
+	der, err := x509.CreateCertificate(rand, &t, &p, pub, stub)
+
+	if err != nil {
+		return nil, err
+	}
+
+	c, _ := split(der)
+	spki := c.spki
+
+	if subjectSM2 {
+		spki = key.der
+	}
+
+	sigalg := algorithm(oidSM2WithSM3)
+	tbs := c.build(sigalg, spki)
+
+	sig, err := priv.Sign(rand, tbs, crypto.Hash(0))
+
+	if err != nil {
+		return nil, err
+	}
+
+	var b cryptobyte.Builder
+	b.AddASN1BitString(sig)
+
+	return sequence(tbs, sigalg, b.BytesOrPanic()), nil
+}